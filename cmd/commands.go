@@ -0,0 +1,206 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+)
+
+const (
+	// outputJSON indicates that commands print their results as JSON.
+	outputJSON = "json"
+	// outputTable indicates that commands print their results as a human-readable table.
+	outputTable = "table"
+)
+
+// command is a subcommand of the binary.
+type command struct {
+	// args describes the arguments accepted by the command, if any.
+	args string
+	// description is a short description of what the command does.
+	description string
+	// run runs the command with the provided arguments (i.e. the ones following the name of the command).
+	run func(args []string) error
+}
+
+// commands are the commands supported by the binary, indexed by name.
+var commands = map[string]command{
+	"config print": {
+		description: "print the effective configuration (with secrets redacted)",
+		run:         printConfig,
+	},
+	"export": {
+		args:        "[--file <path>] [--tenant <tenant>]",
+		description: "export payments as json, one per line",
+		run:         exportPayments,
+	},
+	"import": {
+		args:        "[--file <path>] [--tenant <tenant>]",
+		description: "import payments exported as json, one per line",
+		run:         importPayments,
+	},
+	"keys create": {
+		args:        "--name <name> --scopes <scope>[,<scope>...] [--tenant <tenant>] [--output table|json]",
+		description: "create an api key, printing its secret",
+		run:         createKey,
+	},
+	"migrate": {
+		args:        "[--to <version>]",
+		description: "apply pending migrations (or revert applied ones) so that the schema is at the specified version (the latest by default)",
+		run:         migrate,
+	},
+	"migrate status": {
+		args:        "[--output table|json]",
+		description: "list migrations, indicating which of them have been applied",
+		run:         migrationStatus,
+	},
+	"payments delete": {
+		args:        "<id> [--server-url <url>] [--tenant <tenant>]",
+		description: "delete a payment",
+		run:         deletePayment,
+	},
+	"payments get": {
+		args:        "<id> [--server-url <url>] [--tenant <tenant>] [--output table|json]",
+		description: "get a payment",
+		run:         getPayment,
+	},
+	"payments list": {
+		args:        "[--server-url <url>] [--tenant <tenant>] [--output table|json]",
+		description: "list payments",
+		run:         listPayments,
+	},
+	"payments restore": {
+		args:        "<id> [--tenant <tenant>]",
+		description: "restore a deleted payment",
+		run:         restorePayment,
+	},
+	"serve": {
+		description: "run the api server and the grpc server (the default)",
+		run:         serve,
+	},
+}
+
+// lookupCommand returns the command named by the provided arguments together with the arguments that follow its name.
+// The "serve" command is returned in case no arguments are provided.
+func lookupCommand(args []string) (command, []string, bool) {
+	if len(args) == 0 {
+		return commands["serve"], nil, true
+	}
+	if len(args) >= 2 {
+		if c, ok := commands[args[0]+" "+args[1]]; ok {
+			return c, args[2:], true
+		}
+	}
+	c, ok := commands[args[0]]
+	return c, args[1:], ok
+}
+
+// usage describes the global flags and the available commands.
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "usage: %s [flags] [command]\n\ncommands:\n", os.Args[0])
+	n := make([]string, 0, len(commands))
+	for k := range commands {
+		n = append(n, k)
+	}
+	sort.Strings(n)
+	for _, k := range n {
+		fmt.Fprintf(w, "  %s\n    \t%s\n", strings.TrimSpace(k+" "+commands[k].args), commands[k].description)
+	}
+	fmt.Fprintf(w, "\nflags:\n")
+	flag.PrintDefaults()
+}
+
+// newFlagSet returns a new flag set for the command with the specified name.
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ExitOnError)
+}
+
+// parseArgs parses the provided arguments using the provided flag set, allowing flags to follow positional arguments, and returns the positional arguments.
+// An error is returned in case the number of positional arguments differs from the expected one.
+func parseArgs(fs *flag.FlagSet, args []string, n int) ([]string, error) {
+	r := make([]string, 0, n)
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		r = append(r, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(r) != n {
+		return nil, fmt.Errorf("%q expects %d argument(s) (got %d)", fs.Name(), n, len(r))
+	}
+	return r, nil
+}
+
+// openDatabase connects to the configured database, returning a view scoped to the specified tenant (if any).
+// The returned function must be called to disconnect from the database once it is no longer needed.
+func openDatabase(tenant string) (db.Database, func(), error) {
+	d, err := db.NewMongoDDatabase(mongodbURL, mongodbDatabase, db.WithTenancyMode(db.TenancyMode(tenancyMode)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize the database: %v", err)
+	}
+	v, err := d.ForTenant(tenant)
+	if err != nil {
+		_ = d.Close()
+		return nil, nil, err
+	}
+	return v, func() {
+		_ = d.Close()
+	}, nil
+}
+
+// validateOutput returns an error in case the specified output format is not supported.
+func validateOutput(output string) error {
+	if output != outputJSON && output != outputTable {
+		return fmt.Errorf("unsupported output format %q (must be %q or %q)", output, outputTable, outputJSON)
+	}
+	return nil
+}
+
+// write writes the provided value to the provided writer in the specified output format.
+// When writing a table, the specified header is written first and rows is called so that it adds every row.
+func write(w io.Writer, output string, v interface{}, header []string, rows func(add func(...interface{}))) error {
+	switch output {
+	case outputJSON:
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(v)
+	case outputTable:
+		t := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(t, strings.Join(header, "\t"))
+		rows(func(cols ...interface{}) {
+			s := make([]string, len(cols))
+			for i, c := range cols {
+				s[i] = fmt.Sprint(c)
+			}
+			fmt.Fprintln(t, strings.Join(s, "\t"))
+		})
+		return t.Flush()
+	default:
+		return validateOutput(output)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/bmcstdio/dojo-payments/pkg/config"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/logging"
+	"github.com/bmcstdio/dojo-payments/pkg/tlsconfig"
+	"github.com/bmcstdio/dojo-payments/pkg/tracing"
+)
+
+// secretFlags are the names of the flags whose values are secret, and which must therefore be redacted when printing the configuration.
+var secretFlags = []string{
+	"cache-redis-url",
+	"mongodb-url",
+}
+
+// validateConfig validates the effective configuration, returning an error describing every problem found (if any).
+func validateConfig() error {
+	p := make([]string, 0)
+	// oneOf records a problem in case the value of the specified flag is not one of the allowed values.
+	oneOf := func(name, v string, allowed ...string) {
+		for _, a := range allowed {
+			if v == a {
+				return
+			}
+		}
+		p = append(p, fmt.Sprintf("--%s must be one of %q (got %q)", name, allowed, v))
+	}
+	// hostPort records a problem in case the value of the specified flag is not a "host:port" combination.
+	hostPort := func(name, v string) {
+		if _, _, err := net.SplitHostPort(v); err != nil {
+			p = append(p, fmt.Sprintf(`--%s must be a "host:port" combination (got %q)`, name, v))
+		}
+	}
+
+	hostPort("bind-addr", bindAddr)
+	if cacheMaxEntries <= 0 {
+		p = append(p, "--cache-max-entries must be positive")
+	}
+	if cacheNegativeTTL < 0 {
+		p = append(p, "--cache-negative-ttl must not be negative")
+	}
+	oneOf("cache-store", cacheStore, cacheStoreNone, cacheStoreMemory, cacheStoreRedis)
+	if cacheTTL <= 0 {
+		p = append(p, "--cache-ttl must be positive")
+	}
+	if databaseCircuitBreakerCooldown <= 0 {
+		p = append(p, "--database-circuit-breaker-cooldown must be positive")
+	}
+	if databaseCircuitBreakerThreshold < 0 {
+		p = append(p, "--database-circuit-breaker-threshold must not be negative")
+	}
+	if databaseMaxAttempts < 1 {
+		p = append(p, "--database-max-attempts must be at least one")
+	}
+	if databaseRetryBaseDelay < 0 || databaseRetryMaxDelay < databaseRetryBaseDelay {
+		p = append(p, "--database-retry-base-delay must not be negative nor greater than --database-retry-max-delay")
+	}
+	hostPort("grpc-bind-addr", grpcBindAddr)
+	if hmacMaxBodySize <= 0 {
+		p = append(p, "--hmac-max-body-size must be positive")
+	}
+	oneOf("log-format", logFormat, logging.FormatJSON, logging.FormatText)
+	if _, err := log.ParseLevel(logLevel); err != nil {
+		p = append(p, fmt.Sprintf("--log-level is invalid: %v", err))
+	}
+	if metricsEnabled {
+		hostPort("metrics-bind-addr", metricsBindAddr)
+	}
+	if mongodbDatabase == "" {
+		p = append(p, "--mongodb-database must not be empty")
+	}
+	if !strings.HasPrefix(mongodbURL, "mongodb://") && !strings.HasPrefix(mongodbURL, "mongodb+srv://") {
+		p = append(p, `--mongodb-url must start with "mongodb://" or "mongodb+srv://"`)
+	}
+	oneOf("rate-limit-store", rateLimitStore, "memory", "database")
+	if schedulerInterval <= 0 {
+		p = append(p, "--scheduler-interval must be positive")
+	}
+	if shutdownDelay < 0 {
+		p = append(p, "--shutdown-delay must not be negative")
+	}
+	if shutdownTimeout <= 0 {
+		p = append(p, "--shutdown-timeout must be positive")
+	}
+	oneOf("tenancy-mode", tenancyMode, string(db.TenancyModeShared), string(db.TenancyModeCollection), string(db.TenancyModeDatabase))
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		p = append(p, "--tls-cert-file and --tls-key-file must be set together")
+	}
+	if tlsClientCAFile != "" && tlsCertFile == "" {
+		p = append(p, "--tls-client-ca-file requires --tls-cert-file")
+	}
+	if tlsClientIdentitiesFile != "" && tlsClientCAFile == "" {
+		p = append(p, "--tls-client-identities-file requires --tls-client-ca-file")
+	}
+	oneOf("tls-cipher-policy", tlsCipherPolicy, tlsconfig.CipherPolicyModern, tlsconfig.CipherPolicyCompatible)
+	oneOf("tls-min-version", tlsMinVersion, "1.2", "1.3")
+	oneOf("tracing-exporter", tracingExporter, tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout)
+	if tracingSampleRatio < 0 || tracingSampleRatio > 1 {
+		p = append(p, fmt.Sprintf("--tracing-sample-ratio must be between 0 and 1 (got %v)", tracingSampleRatio))
+	}
+
+	if len(p) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(p, "; "))
+	}
+	return nil
+}
+
+// printConfig prints the effective configuration as YAML, with secrets redacted.
+func printConfig(args []string) error {
+	if _, err := parseArgs(newFlagSet("config print"), args, 0); err != nil {
+		return err
+	}
+	if err := config.Print(os.Stdout, flag.CommandLine, secretFlags...); err != nil {
+		return fmt.Errorf("failed to print the configuration: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	keys "github.com/bmcstdio/dojo-payments/pkg/apikeys"
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/pkg/server/apis/apikeys"
+)
+
+// createKey creates an API key directly on the database, printing it together with its secret.
+// This allows for bootstrapping the first API key allowed to manage API keys through the API keys admin API.
+func createKey(args []string) error {
+	var (
+		k      models.APIKey
+		output string
+		scopes string
+	)
+	fs := newFlagSet("keys create")
+	fs.StringVar(&k.Name, "name", "", "a human-readable name for the api key")
+	fs.StringVar(&output, "output", outputTable, `the format in which the api key is printed ("table" or "json")`)
+	fs.StringVar(&scopes, "scopes", "", "the comma-separated list of scopes granted to the api key")
+	fs.StringVar(&k.Tenant, "tenant", "", "the tenant on whose behalf the api key acts, if any")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	if err := validateOutput(output); err != nil {
+		return err
+	}
+	if scopes != "" {
+		k.Scopes = strings.Split(scopes, ",")
+	}
+	if err := k.Validate(); err != nil {
+		return err
+	}
+	for _, s := range k.Scopes {
+		if !auth.IsKnownScope(s) {
+			return fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	// Generate the API key's secret.
+	k.ID = primitive.NewObjectID()
+	v, salt, hash, err := keys.NewSecret(k.ID)
+	if err != nil {
+		return err
+	}
+	k.Salt, k.Hash = salt, hash
+	// Create the API key, which is not scoped to any tenant in the database.
+	d, fn, err := openDatabase("")
+	if err != nil {
+		return err
+	}
+	defer fn()
+	k, err = d.APIKeys().CreateAPIKey(k)
+	if err != nil {
+		return err
+	}
+	r := apikeys.IssuedAPIKey{
+		APIKey: k,
+		Key:    v,
+	}
+	return write(os.Stdout, output, r, []string{"ID", "NAME", "SCOPES", "TENANT", "KEY"}, func(add func(...interface{})) {
+		add(r.ID.Hex(), r.Name, strings.Join(r.Scopes, ","), r.Tenant, r.Key)
+	})
+}
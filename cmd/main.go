@@ -16,41 +16,182 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/bmcstdio/dojo-payments/pkg/config"
 	"github.com/bmcstdio/dojo-payments/pkg/db"
-	"github.com/bmcstdio/dojo-payments/pkg/server"
+	"github.com/bmcstdio/dojo-payments/pkg/logging"
+	"github.com/bmcstdio/dojo-payments/pkg/tlsconfig"
+	"github.com/bmcstdio/dojo-payments/pkg/tracing"
 )
 
 var (
+	// apiKeys indicates whether requests to the API server may be authenticated using API keys.
+	apiKeys bool
 	// bindAddr is the "host:port" combination at which to serve the API server.
 	bindAddr string
+	// cacheMaxEntries is the maximum number of lookups of payments cached in memory.
+	cacheMaxEntries int
+	// cacheNegativeTTL is the amount of time for which the absence of a payment is cached.
+	cacheNegativeTTL time.Duration
+	// cacheRedisURL is the URL at which the Redis server used to cache lookups of payments can be reached.
+	cacheRedisURL string
+	// cacheStore is the store in which lookups of payments are cached, if any.
+	cacheStore string
+	// cacheTTL is the amount of time for which payments are cached.
+	cacheTTL time.Duration
+	// configFile is the path to the YAML or TOML file from which configuration is read.
+	configFile string
+	// databaseCircuitBreakerCooldown is the amount of time for which the circuit breaker protecting the database stays open before probing whether it has recovered.
+	databaseCircuitBreakerCooldown time.Duration
+	// databaseCircuitBreakerThreshold is the number of consecutive failures after which the circuit breaker protecting the database opens.
+	databaseCircuitBreakerThreshold int
+	// databaseMaxAttempts is the maximum number of times reads are attempted while the database is unavailable.
+	databaseMaxAttempts int
+	// databaseRetryBaseDelay is the maximum amount of time to wait before retrying a read for the first time.
+	databaseRetryBaseDelay time.Duration
+	// databaseRetryMaxDelay is the maximum amount of time to wait before retrying a read.
+	databaseRetryMaxDelay time.Duration
+	// grpcBindAddr is the "host:port" combination at which to serve the gRPC server.
+	grpcBindAddr string
+	// hmacKeysFile is the path to the JSON file containing the keys used to validate signed requests.
+	hmacKeysFile string
+	// hmacMaxBodySize is the maximum size (in bytes) of the body of signed requests.
+	hmacMaxBodySize int64
+	// jwtJWKSFile is the path to the JWKS file containing the public keys used to validate RS256 and ES256 JWTs.
+	jwtJWKSFile string
+	// jwtSecretFile is the path to the file containing the secret used to validate HS256 JWTs.
+	jwtSecretFile string
+	// logFormat is the format in which log lines are emitted.
+	logFormat string
+	// logLevel is the minimum level of log lines that are emitted.
+	logLevel string
+	// metricsBindAddr is the "host:port" combination at which to serve the metrics server.
+	metricsBindAddr string
+	// metricsEnabled indicates whether metrics are recorded and exposed by the metrics server.
+	metricsEnabled bool
+	// migrateOnStart indicates whether pending migrations are applied before the servers start.
+	migrateOnStart bool
 	// mongodbDatabase is the name of the MongoDB database to use for storage.
 	mongodbDatabase string
 	// mongodbUrl is the URL at which MongoDB can be reached.
 	mongodbURL string
+	// rateLimitStore is the store in which the state of rate limits and quotas is kept.
+	rateLimitStore string
+	// rateLimitsFile is the path to the JSON file defining rate limits and quotas.
+	rateLimitsFile string
+	// rolesFile is the path to the JSON file defining the roles assigned to authenticated principals.
+	rolesFile string
+	// schedulerEnabled indicates whether to run the scheduler, which executes scheduled payments once their date arrives.
+	schedulerEnabled bool
+	// schedulerInterval is the interval at which the scheduler looks for due payments.
+	schedulerInterval time.Duration
+	// shutdownDelay is the amount of time to wait after reporting that the API server is not ready before no longer accepting connections.
+	shutdownDelay time.Duration
+	// shutdownTimeout is the maximum amount of time to wait for in-flight requests to complete when shutting down.
+	shutdownTimeout time.Duration
+	// tenancyMode is the mode in which payments belonging to different tenants are isolated.
+	tenancyMode string
+	// tlsCertFile is the path to the PEM-encoded certificate (chain) used to serve TLS connections.
+	tlsCertFile string
+	// tlsCipherPolicy is the policy that determines the cipher suites accepted when serving TLS connections.
+	tlsCipherPolicy string
+	// tlsClientCAFile is the path to the PEM-encoded bundle of CAs used to verify client certificates.
+	tlsClientCAFile string
+	// tlsClientIdentitiesFile is the path to the JSON file mapping names of client certificates to principals.
+	tlsClientIdentitiesFile string
+	// tlsKeyFile is the path to the PEM-encoded private key used to serve TLS connections.
+	tlsKeyFile string
+	// tlsMinVersion is the minimum TLS version accepted when serving TLS connections.
+	tlsMinVersion string
+	// tracingExporter is the exporter to which spans are sent.
+	tracingExporter string
+	// tracingFile is the path to the file to which spans are written when using the "stdout" exporter.
+	tracingFile string
+	// tracingOTLPEndpoint is the "host:port" combination at which the OTLP collector can be reached.
+	tracingOTLPEndpoint string
+	// tracingOTLPInsecure indicates whether to connect to the OTLP collector without TLS.
+	tracingOTLPInsecure bool
+	// tracingSampleRatio is the ratio of traces started by the API server that are sampled.
+	tracingSampleRatio float64
 )
 
 func init() {
+	flag.BoolVar(&apiKeys, "api-keys", false, "whether to require requests to the api server to be authenticated using api keys (or jwts, if configured)")
 	flag.StringVar(&bindAddr, "bind-addr", ":8080", `the "host:port" combination at which to serve the api server`)
+	flag.IntVar(&cacheMaxEntries, "cache-max-entries", 10000, `the maximum number of lookups of payments cached when using the "memory" cache store`)
+	flag.DurationVar(&cacheNegativeTTL, "cache-negative-ttl", 10*time.Second, "the amount of time for which the absence of a payment is cached (the absence of payments is not cached if zero)")
+	flag.StringVar(&cacheRedisURL, "cache-redis-url", "redis://localhost:6379/0", `the url at which the redis server can be reached when using the "redis" cache store`)
+	flag.StringVar(&cacheStore, "cache-store", cacheStoreNone, `the store in which lookups of payments by id are cached ("none", "memory" or "redis")`)
+	flag.DurationVar(&cacheTTL, "cache-ttl", time.Minute, "the amount of time for which payments are cached")
+	flag.StringVar(&configFile, config.FileFlagName, "", "the path to the yaml or toml file from which configuration is read (environment variables and flags take precedence)")
+	flag.DurationVar(&databaseCircuitBreakerCooldown, "database-circuit-breaker-cooldown", 10*time.Second, "the amount of time for which the circuit breaker protecting the database stays open before letting a request through to probe whether it has recovered")
+	flag.IntVar(&databaseCircuitBreakerThreshold, "database-circuit-breaker-threshold", 5, "the number of consecutive failures after which the circuit breaker protecting the database opens (the circuit breaker is disabled if zero)")
+	flag.IntVar(&databaseMaxAttempts, "database-max-attempts", 3, "the maximum number of times reads are attempted while the database is unavailable (reads are not retried if one)")
+	flag.DurationVar(&databaseRetryBaseDelay, "database-retry-base-delay", 50*time.Millisecond, "the maximum amount of time to wait before retrying a read for the first time, which doubles with every subsequent retry")
+	flag.DurationVar(&databaseRetryMaxDelay, "database-retry-max-delay", time.Second, "the maximum amount of time to wait before retrying a read")
+	flag.StringVar(&grpcBindAddr, "grpc-bind-addr", ":9090", `the "host:port" combination at which to serve the grpc server`)
+	flag.StringVar(&hmacKeysFile, "hmac-keys-file", "", "the path to the json file containing the keys used to validate signed requests")
+	flag.Int64Var(&hmacMaxBodySize, "hmac-max-body-size", 1<<20, "the maximum size (in bytes) of the body of signed requests, which is read before they are authenticated")
+	flag.StringVar(&jwtJWKSFile, "jwt-jwks-file", "", "the path to the jwks file containing the public keys used to validate rs256 and es256 jwts")
+	flag.StringVar(&jwtSecretFile, "jwt-secret-file", "", "the path to the file containing the secret used to validate hs256 jwts")
+	flag.StringVar(&logFormat, "log-format", logging.FormatJSON, `the format in which log lines are emitted ("json" or "text")`)
+	flag.StringVar(&logLevel, "log-level", "info", `the minimum level of log lines that are emitted ("debug", "info", "warn" or "error")`)
+	flag.BoolVar(&metricsEnabled, "metrics", false, "whether to record metrics and expose them at /metrics in the prometheus exposition format")
+	flag.StringVar(&metricsBindAddr, "metrics-bind-addr", "localhost:9100", `the "host:port" combination at which to serve the metrics server, which must only be reachable by monitoring systems`)
+	flag.BoolVar(&migrateOnStart, "migrate-on-start", false, "whether to apply pending migrations before starting the servers (waiting for other instances doing the same)")
 	flag.StringVar(&mongodbDatabase, "mongodb-database", "dojo-payments", "the name of the mongodb database to use for storage")
 	flag.StringVar(&mongodbURL, "mongodb-url", "mongodb://localhost:27017", "the url at which mongodb can be reached")
+	flag.StringVar(&rateLimitStore, "rate-limit-store", "memory", `the store in which the state of rate limits and quotas is kept ("memory" or "database")`)
+	flag.StringVar(&rateLimitsFile, "rate-limits-file", "", "the path to the json file defining rate limits and quotas (rate limiting is disabled if empty)")
+	flag.StringVar(&rolesFile, "roles-file", "", "the path to the json file defining the roles assigned to authenticated principals (uses the default roles if empty)")
+	flag.BoolVar(&schedulerEnabled, "scheduler", true, "whether to run the scheduler, which executes payments dated in the future once their date arrives and generates payments from standing orders (replicas coordinate so that each payment is executed or generated once)")
+	flag.DurationVar(&schedulerInterval, "scheduler-interval", 10*time.Second, "the interval at which the scheduler looks for due payments and standing orders")
+	flag.DurationVar(&shutdownDelay, "shutdown-delay", 0, "the amount of time to wait after reporting that the api server is not ready before no longer accepting connections when shutting down")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "the maximum amount of time to wait for in-flight requests to complete when shutting down")
+	flag.StringVar(&tenancyMode, "tenancy-mode", string(db.TenancyModeShared), `the mode in which payments belonging to different tenants are isolated ("shared", "collection" or "database")`)
+	flag.StringVar(&tlsCertFile, "tls-cert-file", "", "the path to the pem-encoded certificate (chain) used to serve tls connections (tls is disabled if empty)")
+	flag.StringVar(&tlsCipherPolicy, "tls-cipher-policy", tlsconfig.CipherPolicyModern, `the policy that determines the cipher suites accepted when serving tls connections ("modern" or "compatible")`)
+	flag.StringVar(&tlsClientCAFile, "tls-client-ca-file", "", "the path to the pem-encoded bundle of cas used to verify client certificates")
+	flag.StringVar(&tlsClientIdentitiesFile, "tls-client-identities-file", "", "the path to the json file mapping names of client certificates to principals (requires --tls-client-ca-file)")
+	flag.StringVar(&tlsKeyFile, "tls-key-file", "", "the path to the pem-encoded private key used to serve tls connections")
+	flag.StringVar(&tlsMinVersion, "tls-min-version", "1.2", `the minimum tls version accepted when serving tls connections ("1.2" or "1.3")`)
+	flag.StringVar(&tracingExporter, "tracing-exporter", tracing.ExporterNone, `the exporter to which spans are sent ("none", "otlp" or "stdout")`)
+	flag.StringVar(&tracingFile, "tracing-file", "", `the path to the file to which spans are written when using the "stdout" exporter (the standard output is used if empty)`)
+	flag.StringVar(&tracingOTLPEndpoint, "tracing-otlp-endpoint", "localhost:4317", `the "host:port" combination at which the otlp collector can be reached`)
+	flag.BoolVar(&tracingOTLPInsecure, "tracing-otlp-insecure", false, "whether to connect to the otlp collector without tls")
+	flag.Float64Var(&tracingSampleRatio, "tracing-sample-ratio", 1, "the ratio of traces started by the api server that are sampled")
 }
 
 func main() {
-	// Parse the provided command-line flags.
-	flag.Parse()
+	// Describe the available commands when asked for help.
+	flag.Usage = usage
+	// Load the configuration from the configuration file, the environment and the provided command-line flags, and validate it.
+	if err := config.Load(flag.CommandLine, os.Args[1:], os.Environ()); err != nil {
+		log.Fatalf("failed to load the configuration: %v", err)
+	}
+	if err := validateConfig(); err != nil {
+		log.Fatal(err)
+	}
 
-	// Initialize the the database.
-	database, err := db.NewMongoDDatabase(mongodbURL, mongodbDatabase)
-	if err != nil {
-		log.Fatalf("failed to initialize the database: %v", err)
+	// Initialize logging.
+	if err := logging.Setup(logLevel, logFormat); err != nil {
+		log.Fatalf("failed to initialize logging: %v", err)
 	}
 
-	// Initialize and run the API server using this database for storage.
-	srv := server.NewAPIServer(database)
-	if err := srv.Run(bindAddr); err != nil {
-		log.Fatalf("failed to run the api server: %v", err)
+	// Run the requested command, defaulting to running the servers.
+	c, args, ok := lookupCommand(flag.Args())
+	if !ok {
+		fmt.Fprintf(flag.CommandLine.Output(), "unknown command %q\n", strings.Join(flag.Args(), " "))
+		usage()
+		os.Exit(2)
+	}
+	if err := c.run(args); err != nil {
+		log.Fatal(err)
 	}
 }
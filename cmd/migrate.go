@@ -0,0 +1,75 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+)
+
+// migrate applies pending migrations (or reverts applied ones) so that the schema is at the requested version.
+func migrate(args []string) error {
+	var (
+		to int
+	)
+	fs := newFlagSet("migrate")
+	fs.IntVar(&to, "to", db.LatestMigrationVersion, "the version to migrate to (the latest version if negative)")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	if to < 0 {
+		to = db.LatestMigrationVersion
+	}
+	d, fn, err := openDatabase("")
+	if err != nil {
+		return err
+	}
+	defer fn()
+	return d.Migrations().Migrate(to)
+}
+
+// migrationStatus lists migrations, indicating which of them have been applied.
+func migrationStatus(args []string) error {
+	var (
+		output string
+	)
+	fs := newFlagSet("migrate status")
+	fs.StringVar(&output, "output", outputTable, `the format in which migrations are printed ("table" or "json")`)
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	if err := validateOutput(output); err != nil {
+		return err
+	}
+	d, fn, err := openDatabase("")
+	if err != nil {
+		return err
+	}
+	defer fn()
+	l, err := d.Migrations().ListMigrations()
+	if err != nil {
+		return err
+	}
+	return write(os.Stdout, output, l, []string{"VERSION", "DESCRIPTION", "APPLIED AT"}, func(add func(...interface{})) {
+		for _, m := range l {
+			a := "-"
+			if m.AppliedAt != nil {
+				a = m.AppliedAt.Format(time.RFC3339)
+			}
+			add(m.Version, m.Description, a)
+		}
+	})
+}
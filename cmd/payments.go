@@ -0,0 +1,445 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/bmcstdio/dojo-payments/pkg/client"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+const (
+	// dateFormat is the format in which the dates of payments are printed in tables.
+	dateFormat = "2006-01-02"
+)
+
+var (
+	// errRemoteAtomicImport is the error returned when attempting to import payments atomically over HTTP, which the Payments API does not support.
+	errRemoteAtomicImport = errors.New("importing payments atomically requires direct access to the database (i.e. --server-url must not be set)")
+	// errRemoteRestore is the error returned when attempting to restore a payment over HTTP, which the Payments API does not support.
+	errRemoteRestore = errors.New("restoring payments requires direct access to the database (i.e. --server-url must not be set)")
+)
+
+// paymentsBackend performs operations on payments, either directly on the database or over HTTP.
+type paymentsBackend interface {
+	// create creates the provided payment.
+	create(models.Payment) (models.Payment, error)
+	// delete deletes the payment with the specified ID, returning a value indicating whether it was found.
+	delete(string) (bool, error)
+	// get returns the payment with the specified ID, and a value indicating whether it was found.
+	get(string) (models.Payment, bool, error)
+	// list lists all existing payments.
+	list() ([]models.Payment, error)
+	// restore restores the deleted payment with the specified ID, returning a value indicating whether it was found.
+	restore(string) (bool, error)
+}
+
+// databaseBackend is an implementation of paymentsBackend that operates directly on the database.
+type databaseBackend struct {
+	// payments is the database on which to operate.
+	payments db.PaymentsDatabase
+}
+
+func (b *databaseBackend) create(p models.Payment) (models.Payment, error) {
+	return b.payments.CreatePayment(p)
+}
+
+func (b *databaseBackend) delete(id string) (bool, error) {
+	return b.payments.DeletePayment(id)
+}
+
+func (b *databaseBackend) get(id string) (models.Payment, bool, error) {
+	p, err := b.payments.GetPayment(id)
+	return p, !p.ID.IsZero(), err
+}
+
+func (b *databaseBackend) list() ([]models.Payment, error) {
+	return b.payments.ListPayments(0, -1)
+}
+
+func (b *databaseBackend) restore(id string) (bool, error) {
+	return b.payments.RestorePayment(id)
+}
+
+// httpBackend is an implementation of paymentsBackend that operates over HTTP using the Payments API.
+type httpBackend struct {
+	// client is the client used to make requests to the Payments API.
+	client *client.Client
+}
+
+func (b *httpBackend) create(p models.Payment) (models.Payment, error) {
+	// The ID of a payment is always assigned by the API server.
+	p.ID = primitive.NilObjectID
+	return b.client.CreatePayment(context.Background(), p)
+}
+
+func (b *httpBackend) delete(id string) (bool, error) {
+	if err := b.client.DeletePayment(context.Background(), id); err != nil {
+		if client.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *httpBackend) get(id string) (models.Payment, bool, error) {
+	p, err := b.client.GetPayment(context.Background(), id)
+	if err != nil {
+		if client.IsNotFound(err) {
+			return models.Payment{}, false, nil
+		}
+		return models.Payment{}, false, err
+	}
+	return p, true, nil
+}
+
+func (b *httpBackend) list() ([]models.Payment, error) {
+	return b.client.ListPayments(context.Background()).All()
+}
+
+func (b *httpBackend) restore(string) (bool, error) {
+	return false, errRemoteRestore
+}
+
+// paymentsOptions are the options accepted by commands operating on payments.
+type paymentsOptions struct {
+	// apiKey is the API key used to authenticate requests made over HTTP, if any.
+	apiKey string
+	// bearerToken is the bearer token (e.g. a JWT) used to authenticate requests made over HTTP, if any.
+	bearerToken string
+	// output is the format in which results are printed.
+	output string
+	// serverURL is the base URL of the API server, if payments are to be operated on over HTTP.
+	serverURL string
+	// tenant is the tenant to which the payments being operated on belong, if any.
+	tenant string
+}
+
+// register registers the flags corresponding to the options in the provided flag set.
+// Flags used to operate over HTTP and to choose the output format are only registered if requested.
+func (o *paymentsOptions) register(fs *flag.FlagSet, remote, output bool) {
+	if remote {
+		fs.StringVar(&o.apiKey, "api-key", "", "the api key used to authenticate requests made to the api server")
+		fs.StringVar(&o.bearerToken, "bearer-token", "", "the bearer token (e.g. a jwt) used to authenticate requests made to the api server")
+		fs.StringVar(&o.serverURL, "server-url", "", "the base url of the api server through which to operate (the database is accessed directly if empty)")
+	}
+	if output {
+		fs.StringVar(&o.output, "output", outputTable, `the format in which results are printed ("table" or "json")`)
+	}
+	fs.StringVar(&o.tenant, "tenant", "", "the tenant to which the payments belong, when accessing the database directly")
+}
+
+// backend returns the backend through which to operate on payments.
+// The returned function must be called once the backend is no longer needed.
+func (o *paymentsOptions) backend() (paymentsBackend, func(), error) {
+	if o.output != "" {
+		if err := validateOutput(o.output); err != nil {
+			return nil, nil, err
+		}
+	}
+	if o.serverURL != "" {
+		opts := make([]client.Option, 0)
+		if o.apiKey != "" {
+			opts = append(opts, client.WithAPIKey(o.apiKey))
+		}
+		if o.bearerToken != "" {
+			opts = append(opts, client.WithBearerToken(o.bearerToken))
+		}
+		return &httpBackend{client: client.New(o.serverURL, opts...)}, func() {}, nil
+	}
+	d, fn, err := openDatabase(o.tenant)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &databaseBackend{payments: d.Payments()}, fn, nil
+}
+
+// deletePayment deletes the payment with the ID provided as argument.
+func deletePayment(args []string) error {
+	var (
+		o paymentsOptions
+	)
+	fs := newFlagSet("payments delete")
+	o.register(fs, true, false)
+	a, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	b, fn, err := o.backend()
+	if err != nil {
+		return err
+	}
+	defer fn()
+	ok, err := b.delete(a[0])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("payment %q not found", a[0])
+	}
+	fmt.Printf("deleted payment %q\n", a[0])
+	return nil
+}
+
+// exportPayments writes every existing payment as JSON, one per line.
+func exportPayments(args []string) error {
+	var (
+		file string
+		o    paymentsOptions
+	)
+	fs := newFlagSet("export")
+	fs.StringVar(&file, "file", "", "the path to the file to which payments are written (the standard output is used if empty)")
+	o.register(fs, true, false)
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	b, fn, err := o.backend()
+	if err != nil {
+		return err
+	}
+	defer fn()
+	l, err := b.list()
+	if err != nil {
+		return err
+	}
+	var (
+		w io.Writer = os.Stdout
+	)
+	if file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", file, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	e := json.NewEncoder(w)
+	for _, p := range l {
+		if err := e.Encode(p); err != nil {
+			return fmt.Errorf("failed to export payment %q: %v", p.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// getPayment prints the payment with the ID provided as argument.
+func getPayment(args []string) error {
+	var (
+		o paymentsOptions
+	)
+	fs := newFlagSet("payments get")
+	o.register(fs, true, true)
+	a, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	b, fn, err := o.backend()
+	if err != nil {
+		return err
+	}
+	defer fn()
+	p, ok, err := b.get(a[0])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("payment %q not found", a[0])
+	}
+	return writePayments(o.output, p, p)
+}
+
+// importPayments creates the payments read as JSON, one per line.
+// When accessing the database directly the IDs of the payments are preserved, so that payments which have already been imported are rejected.
+func importPayments(args []string) error {
+	var (
+		atomic bool
+		file   string
+		o      paymentsOptions
+	)
+	fs := newFlagSet("import")
+	fs.BoolVar(&atomic, "atomic", false, "whether to import every payment in a single transaction, so that either all or none are imported (requires direct access to a replica set)")
+	fs.StringVar(&file, "file", "", "the path to the file from which payments are read (the standard input is used if empty)")
+	o.register(fs, true, false)
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	if atomic && o.serverURL != "" {
+		return errRemoteAtomicImport
+	}
+	var (
+		r io.Reader = os.Stdin
+	)
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", file, err)
+		}
+		defer f.Close()
+		r = f
+	}
+	if atomic {
+		return importPaymentsAtomically(r, o.tenant)
+	}
+	b, fn, err := o.backend()
+	if err != nil {
+		return err
+	}
+	defer fn()
+	n := 0
+	err = scanPayments(r, func(line int, p models.Payment) error {
+		if _, err := b.create(p); err != nil {
+			return fmt.Errorf("failed to import the payment at line %d (%d imported so far): %v", line, n, err)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "imported %d payment(s)\n", n)
+	return nil
+}
+
+// importPaymentsAtomically imports every payment read from the provided reader within a single transaction.
+// Payments are read and validated before the transaction is started, as it may need to be retried.
+func importPaymentsAtomically(r io.Reader, tenant string) error {
+	l := make([]models.Payment, 0)
+	lines := make([]int, 0)
+	err := scanPayments(r, func(line int, p models.Payment) error {
+		l = append(l, p)
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	d, fn, err := openDatabase(tenant)
+	if err != nil {
+		return err
+	}
+	defer fn()
+	err = d.WithTransaction(context.Background(), func(tx db.Database) error {
+		b := &databaseBackend{payments: tx.Payments()}
+		for i, p := range l {
+			if _, err := b.create(p); err != nil {
+				return fmt.Errorf("failed to import the payment at line %d: %v", lines[i], err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%v (no payments imported)", err)
+	}
+	fmt.Fprintf(os.Stderr, "imported %d payment(s)\n", len(l))
+	return nil
+}
+
+// scanPayments reads payments encoded as JSON, one per line, from the provided reader, validating each one before passing it to the provided function.
+func scanPayments(r io.Reader, fn func(line int, p models.Payment) error) error {
+	n := 0
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; s.Scan(); line++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var (
+			p models.Payment
+		)
+		if err := json.Unmarshal(s.Bytes(), &p); err != nil {
+			return fmt.Errorf("failed to parse the payment at line %d: %v", line, err)
+		}
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("invalid payment at line %d: %v", line, err)
+		}
+		if err := fn(line, p); err != nil {
+			return err
+		}
+		n++
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("failed to read payments (%d read so far): %v", n, err)
+	}
+	return nil
+}
+
+// listPayments prints every existing payment.
+func listPayments(args []string) error {
+	var (
+		o paymentsOptions
+	)
+	fs := newFlagSet("payments list")
+	o.register(fs, true, true)
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	b, fn, err := o.backend()
+	if err != nil {
+		return err
+	}
+	defer fn()
+	l, err := b.list()
+	if err != nil {
+		return err
+	}
+	return writePayments(o.output, l, l...)
+}
+
+// restorePayment restores the deleted payment with the ID provided as argument.
+func restorePayment(args []string) error {
+	var (
+		o paymentsOptions
+	)
+	fs := newFlagSet("payments restore")
+	o.register(fs, false, false)
+	a, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	b, fn, err := o.backend()
+	if err != nil {
+		return err
+	}
+	defer fn()
+	ok, err := b.restore(a[0])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("deleted payment %q not found", a[0])
+	}
+	fmt.Printf("restored payment %q\n", a[0])
+	return nil
+}
+
+// writePayments writes the provided value (a payment or a list of payments) to the standard output in the specified format, using the provided payments as the rows of the table.
+func writePayments(output string, v interface{}, l ...models.Payment) error {
+	return write(os.Stdout, output, v, []string{"ID", "DATE", "AMOUNT", "CURRENCY", "DEBTOR", "BENEFICIARY", "DESCRIPTION"}, func(add func(...interface{})) {
+		for _, p := range l {
+			add(p.ID.Hex(), p.Date.Format(dateFormat), fmt.Sprintf("%.2f", p.Amount), p.Currency, p.Debtor.Name, p.Beneficiary.Name, p.Description)
+		}
+	})
+}
@@ -0,0 +1,363 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/bmcstdio/dojo-payments/pkg/apikeys"
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/cache"
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/events"
+	"github.com/bmcstdio/dojo-payments/pkg/metrics"
+	"github.com/bmcstdio/dojo-payments/pkg/ratelimit"
+	"github.com/bmcstdio/dojo-payments/pkg/resilience"
+	"github.com/bmcstdio/dojo-payments/pkg/rpc"
+	"github.com/bmcstdio/dojo-payments/pkg/scheduler"
+	"github.com/bmcstdio/dojo-payments/pkg/server"
+	"github.com/bmcstdio/dojo-payments/pkg/signing"
+	"github.com/bmcstdio/dojo-payments/pkg/tlsconfig"
+	"github.com/bmcstdio/dojo-payments/pkg/tracing"
+)
+
+const (
+	// cacheStoreMemory is the cache store that keeps lookups of payments in memory, per instance of the API server.
+	cacheStoreMemory = "memory"
+	// cacheStoreNone disables caching lookups of payments.
+	cacheStoreNone = "none"
+	// cacheStoreRedis is the cache store that keeps lookups of payments in Redis, shared by all instances of the API server.
+	cacheStoreRedis = "redis"
+)
+
+// serve runs the API server and the gRPC server until a signal requesting termination is received, and then shuts them down gracefully.
+func serve(args []string) error {
+	if _, err := parseArgs(newFlagSet("serve"), args, 0); err != nil {
+		return err
+	}
+
+	// Initialize tracing.
+	shutdownTracing, err := tracing.Setup(tracing.Options{
+		Exporter:     tracingExporter,
+		File:         tracingFile,
+		OTLPEndpoint: tracingOTLPEndpoint,
+		OTLPInsecure: tracingOTLPInsecure,
+		SampleRatio:  tracingSampleRatio,
+	})
+	if err != nil {
+		log.Fatalf("failed to initialize tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// Initialize the context within which background workers run, which is canceled when shutting down.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Initialize the the database.
+	database, err := db.NewMongoDDatabase(mongodbURL, mongodbDatabase, db.WithTenancyMode(db.TenancyMode(tenancyMode)))
+	if err != nil {
+		log.Fatalf("failed to initialize the database: %v", err)
+	}
+	// Apply pending migrations, if requested.
+	if migrateOnStart {
+		if err := database.Migrations().Migrate(db.LatestMigrationVersion); err != nil {
+			log.Fatalf("failed to migrate the database: %v", err)
+		}
+	}
+
+	// Record metrics about storage operations, if requested.
+	var (
+		m *metrics.Metrics
+	)
+	if metricsEnabled {
+		m = metrics.New()
+		database = m.InstrumentDatabase(database)
+	}
+
+	// Retry reads while the database is unavailable, and fail fast once it has been unavailable for a while (unless disabled).
+	var (
+		breaker *resilience.Breaker
+	)
+	if databaseCircuitBreakerThreshold > 0 {
+		breaker = resilience.NewBreaker(resilience.BreakerOptions{
+			Cooldown:         databaseCircuitBreakerCooldown,
+			FailureThreshold: databaseCircuitBreakerThreshold,
+		})
+		if m != nil {
+			m.InstrumentBreaker(breaker)
+		}
+	}
+	ro := resilience.Options{
+		BaseDelay:   databaseRetryBaseDelay,
+		MaxAttempts: databaseMaxAttempts,
+		MaxDelay:    databaseRetryMaxDelay,
+	}
+	if m != nil {
+		ro.OnRetry = m.ObserveDatabaseRetry
+	}
+	database = resilience.NewDatabase(database, breaker, ro)
+
+	// Cache lookups of payments by ID, if requested.
+	// The cache wraps the instrumented database so that storage metrics only reflect lookups that miss the cache, and cached payments are served while the circuit breaker is open.
+	if cacheStore != cacheStoreNone {
+		var (
+			store cache.Store
+		)
+		switch cacheStore {
+		case cacheStoreMemory:
+			store = cache.NewMemoryStore(cacheMaxEntries)
+		case cacheStoreRedis:
+			store, err = cache.NewRedisStore(cacheRedisURL)
+			if err != nil {
+				log.Fatalf("failed to initialize the cache: %v", err)
+			}
+		}
+		o := cache.Options{
+			NegativeTTL: cacheNegativeTTL,
+			TTL:         cacheTTL,
+		}
+		if m != nil {
+			o.OnLookup = m.ObserveCacheLookup
+		}
+		database = cache.NewDatabase(database, store, o)
+	}
+
+	// Initialize the bus to which events describing changes to payments are published.
+	bus := events.NewBus()
+
+	// Initialize the limiter enforcing rate limits and quotas in case a file defining them has been provided.
+	var (
+		limiter *ratelimit.Limiter
+	)
+	if rateLimitsFile != "" {
+		c, err := ratelimit.LoadConfig(rateLimitsFile)
+		if err != nil {
+			log.Fatalf("failed to load rate limits: %v", err)
+		}
+		var (
+			store ratelimit.Store
+		)
+		switch rateLimitStore {
+		case "memory":
+			store = ratelimit.NewMemoryStore()
+		case "database":
+			store = ratelimit.NewDatabaseStore(database)
+		default:
+			log.Fatalf("unsupported rate limit store %q", rateLimitStore)
+		}
+		limiter = ratelimit.NewLimiter(c, store)
+	}
+
+	// Execute scheduled payments once their date arrives, if requested.
+	// The scheduler stops once the context within which background workers run is canceled.
+	schedulerDone := make(chan struct{})
+	if schedulerEnabled {
+		// Payments generated from standing orders consume the daily quota of the clients that created them.
+		o := scheduler.Options{
+			Interval:      schedulerInterval,
+			LeaseDuration: constants.SchedulerLeaseDuration,
+			Limiter:       limiter,
+		}
+		if m != nil {
+			o.OnExecute = m.ObservePaymentExecuted
+		}
+		s := scheduler.New(database, bus, o)
+		go func() {
+			defer close(schedulerDone)
+			s.Run(ctx)
+		}()
+	} else {
+		close(schedulerDone)
+	}
+
+	// Require requests to the API server and RPCs to the gRPC server to carry a valid API key, if requested.
+	opts := make([]server.APIServerOption, 0)
+	grpcOpts := make([]rpc.GRPCServerOption, 0)
+	authenticators := make([]auth.Authenticator, 0)
+	if apiKeys {
+		authenticators = append(authenticators, apikeys.NewAuthenticator(database))
+	}
+	// Require requests to carry a valid JWT in case a secret or a JWKS file has been provided.
+	if jwtSecretFile != "" || jwtJWKSFile != "" {
+		var (
+			secret []byte
+		)
+		if jwtSecretFile != "" {
+			b, err := ioutil.ReadFile(jwtSecretFile)
+			if err != nil {
+				log.Fatalf("failed to read the jwt secret: %v", err)
+			}
+			secret = []byte(strings.TrimSpace(string(b)))
+		}
+		a, err := auth.NewJWTAuthenticator(secret, jwtJWKSFile)
+		if err != nil {
+			log.Fatalf("failed to initialize jwt authentication: %v", err)
+		}
+		authenticators = append(authenticators, a)
+	}
+	// Require requests to be signed in case a file containing the keys used to sign them has been provided.
+	if hmacKeysFile != "" {
+		k, err := auth.LoadHMACKeys(hmacKeysFile)
+		if err != nil {
+			log.Fatalf("failed to initialize hmac authentication: %v", err)
+		}
+		// Nonces are remembered in memory, so replayed requests are only detected by the instance that received the original request.
+		authenticators = append(authenticators, auth.NewHMACAuthenticator(k, signing.NewMemoryNonceCache(), hmacMaxBodySize))
+	}
+	// Serve TLS connections in case a certificate has been provided, reloading it whenever it changes.
+	if tlsCertFile != "" {
+		r, err := tlsconfig.NewReloader(tlsconfig.Options{
+			CertFile:     tlsCertFile,
+			KeyFile:      tlsKeyFile,
+			ClientCAFile: tlsClientCAFile,
+			MinVersion:   tlsMinVersion,
+			CipherPolicy: tlsCipherPolicy,
+		})
+		if err != nil {
+			log.Fatalf("failed to initialize tls: %v", err)
+		}
+		go r.Watch(ctx, constants.TLSReloadInterval)
+		opts = append(opts, server.WithTLS(r.Config()))
+		grpcOpts = append(grpcOpts, rpc.WithTLS(r.Config()))
+	}
+	// Require requests to be made using a client certificate in case client certificates have been mapped to principals.
+	if tlsClientIdentitiesFile != "" {
+		i, err := auth.LoadClientCertIdentities(tlsClientIdentitiesFile)
+		if err != nil {
+			log.Fatalf("failed to initialize client certificate authentication: %v", err)
+		}
+		authenticators = append(authenticators, auth.NewClientCertAuthenticator(i))
+	}
+	opts = append(opts, server.WithAuthenticators(authenticators...))
+	grpcOpts = append(grpcOpts, rpc.WithAuthenticators(authenticators...))
+	// Respond with "503 SERVICE UNAVAILABLE" to requests failing because the circuit breaker is open, and report its state.
+	if breaker != nil {
+		opts = append(opts, server.WithCircuitBreaker(breaker))
+	}
+	// Trace requests, if requested.
+	if tracingExporter != tracing.ExporterNone {
+		opts = append(opts, server.WithTracing())
+	}
+	// Record metrics about HTTP requests, if requested.
+	if m != nil {
+		opts = append(opts, server.WithMetrics(m))
+	}
+	// Enforce rate limits and quotas in case a file defining them has been provided.
+	if limiter != nil {
+		opts = append(opts, server.WithRateLimiter(limiter))
+		grpcOpts = append(grpcOpts, rpc.WithRateLimiter(limiter))
+	}
+	// Replace the default roles in case a roles file has been provided.
+	if rolesFile != "" {
+		r, err := auth.LoadRoles(rolesFile)
+		if err != nil {
+			log.Fatalf("failed to load roles: %v", err)
+		}
+		opts = append(opts, server.WithRoles(r))
+		grpcOpts = append(grpcOpts, rpc.WithRoles(r))
+	}
+
+	// Initialize and run the gRPC server using the same database, bus, authenticators, limiter and tls configuration.
+	grpcSrv := rpc.NewGRPCServer(database, bus, grpcOpts...)
+	go func() {
+		if err := grpcSrv.Run(grpcBindAddr); err != nil {
+			log.Fatalf("failed to run the grpc server: %v", err)
+		}
+	}()
+
+	// Expose metrics on a dedicated listener, separate from the API server, as they reveal payment volumes and amounts across all tenants.
+	var (
+		metricsSrv *http.Server
+	)
+	if m != nil {
+		metricsSrv = m.NewServer(metricsBindAddr)
+		go func() {
+			log.Infof("starting the metrics server at %s", metricsBindAddr)
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("failed to run the metrics server: %v", err)
+			}
+		}()
+	}
+
+	// Initialize and run the API server using this database for storage.
+	srv := server.NewAPIServer(database, bus, opts...)
+	// Report whether the database is online based on the health checks made by the API server, so that scraping metrics does not reach the database.
+	if m != nil {
+		m.InstrumentDatabaseStatus(srv.IsDatabaseOnline)
+	}
+	go func() {
+		if err := srv.Run(bindAddr); err != nil {
+			log.Fatalf("failed to run the api server: %v", err)
+		}
+	}()
+
+	// Wait for a signal requesting termination.
+	// Signals are no longer caught once shutdown starts, so that a second signal terminates the process immediately.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	log.Infof("received %s, shutting down", <-sig)
+	signal.Stop(sig)
+
+	// Report that the API server is not ready, giving load balancers some time to notice before no longer accepting connections.
+	srv.Drain()
+	time.Sleep(shutdownDelay)
+	// End streams of events so that they do not prevent in-flight requests from being drained.
+	bus.Close()
+	// Stop accepting connections and drain in-flight requests and RPCs within the configured deadline.
+	sctx, fn := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer fn()
+	var (
+		wg sync.WaitGroup
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if err := srv.Shutdown(sctx); err != nil {
+			log.Errorf("failed to shut down the api server: %v", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := grpcSrv.Shutdown(sctx); err != nil {
+			log.Errorf("failed to shut down the grpc server: %v", err)
+		}
+	}()
+	wg.Wait()
+	// Stop exposing metrics only once in-flight requests have been drained, so that they are observed until the very end.
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(sctx); err != nil {
+			log.Errorf("failed to shut down the metrics server: %v", err)
+		}
+	}
+	// Stop background workers, waiting for the scheduler to finish executing the payment it is executing (if any).
+	cancel()
+	<-schedulerDone
+	// Close the database.
+	if err := database.Close(); err != nil {
+		log.Errorf("failed to close the database: %v", err)
+	}
+	log.Info("shut down")
+	return nil
+}
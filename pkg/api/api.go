@@ -0,0 +1,56 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"time"
+)
+
+// The types and constants in this package are shared by the API server and its clients.
+// They must not depend on anything but the standard library, so that clients do not pull in the API server's dependencies.
+
+const (
+	// APIKeyHeader is the name of the header in which clients send API keys.
+	APIKeyHeader = "X-API-Key"
+	// LimitQueryParam is the name of the query parameter used to limit the number of payments listed.
+	LimitQueryParam = "limit"
+	// OffsetQueryParam is the name of the query parameter used to skip payments when listing them.
+	OffsetQueryParam = "offset"
+	// PaymentsBasePath is the base path of the Payments API.
+	PaymentsBasePath = "/payments"
+	// TotalCountHeader is the name of the header containing the total number of payments when listing them.
+	TotalCountHeader = "X-Total-Count"
+)
+
+const (
+	// DatabaseStatusOffline indicates that the database cannot be reached.
+	DatabaseStatusOffline = "OFFLINE"
+	// DatabaseStatusOnline indicates that the database can be reached.
+	DatabaseStatusOnline = "ONLINE"
+)
+
+// APIServerRootResponse represents a response returned by the root handler.
+type APIServerRootResponse struct {
+	// DatabaseStatus is the current status of the database.
+	DatabaseStatus string `json:"database_status"`
+	// Timestamp is the current timestamp.
+	Timestamp time.Time `json:"time"`
+}
+
+// ErrorResponse represents the body of responses describing an error, as sent by Echo's error handler.
+type ErrorResponse struct {
+	// Message is the error message.
+	Message string `json:"message"`
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+const (
+	// keyPrefix is the prefix of every API key, which makes them easy to recognize (e.g. by secret scanners).
+	keyPrefix = "dp"
+	// keySeparator separates the prefix, the ID and the secret of an API key.
+	keySeparator = "_"
+	// saltLength is the length (in bytes) of the salt used to hash secrets.
+	saltLength = 16
+	// secretLength is the length (in bytes) of secrets.
+	secretLength = 32
+)
+
+var (
+	// errMalformedKey is the error returned when an API key is not well-formed.
+	errMalformedKey = errors.New("malformed api key")
+)
+
+// NewSecret generates a new secret for the API key with the provided ID.
+// It returns the full API key to hand out to the client (which must not be stored), and the salt and hash to store.
+func NewSecret(id primitive.ObjectID) (string, []byte, []byte, error) {
+	secret := make([]byte, secretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, nil, fmt.Errorf("failed to generate secret: %v", err)
+	}
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", nil, nil, fmt.Errorf("failed to generate salt: %v", err)
+	}
+	s := base64.RawURLEncoding.EncodeToString(secret)
+	return strings.Join([]string{keyPrefix, id.Hex(), s}, keySeparator), salt, hash(salt, s), nil
+}
+
+// Parse splits the provided API key into the ID of the corresponding record and its secret.
+func Parse(key string) (string, string, error) {
+	p := strings.SplitN(key, keySeparator, 3)
+	if len(p) != 3 || p[0] != keyPrefix || p[2] == "" {
+		return "", "", errMalformedKey
+	}
+	if _, err := primitive.ObjectIDFromHex(p[1]); err != nil {
+		return "", "", errMalformedKey
+	}
+	return p[1], p[2], nil
+}
+
+// Verify returns a value indicating whether the provided secret matches the hash stored for the specified API key.
+func Verify(k models.APIKey, secret string) bool {
+	return subtle.ConstantTimeCompare(hash(k.Salt, secret), k.Hash) == 1
+}
+
+// hash returns the salted hash of the provided secret.
+func hash(salt []byte, secret string) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(secret))
+	return h.Sum(nil)
+}
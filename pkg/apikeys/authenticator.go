@@ -0,0 +1,84 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apikeys
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bmcstdio/dojo-payments/pkg/api"
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/logging"
+)
+
+const (
+	// HeaderName is the name of the header in which clients send API keys.
+	HeaderName = api.APIKeyHeader
+	// SubjectPrefix is the prefix of the subject of principals authenticated using an API key.
+	SubjectPrefix = "apikey:"
+	// lastUsedResolution is the minimum amount of time between consecutive updates of the date at which an API key was last used.
+	lastUsedResolution = time.Minute
+)
+
+// authenticator is an implementation of auth.Authenticator that validates API keys.
+type authenticator struct {
+	// database is the database in which API keys are stored.
+	database db.Database
+}
+
+// NewAuthenticator returns an auth.Authenticator that validates API keys sent in the "X-API-Key" header against the ones stored in the provided database.
+func NewAuthenticator(database db.Database) auth.Authenticator {
+	return &authenticator{
+		database: database,
+	}
+}
+
+// Authenticate returns the principal identified by the API key sent in the provided request.
+func (a *authenticator) Authenticate(req *http.Request) (*auth.Principal, error) {
+	v := req.Header.Get(HeaderName)
+	if v == "" {
+		return nil, auth.ErrNoCredentials
+	}
+	id, secret, err := Parse(v)
+	if err != nil {
+		return nil, err
+	}
+	k, err := a.database.APIKeys().GetAPIKey(id)
+	if err != nil {
+		return nil, err
+	}
+	if k.ID.IsZero() || k.RevokedAt != nil || !Verify(k, secret) {
+		return nil, errors.New("invalid api key")
+	}
+	// Record that the API key has been used, but avoid writing to the database on every single request.
+	now := time.Now()
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= lastUsedResolution {
+		if err := a.database.APIKeys().TouchAPIKey(id, now); err != nil {
+			logging.FromContext(req.Context()).Warnf("failed to record usage of api key %q: %v", id, err)
+		}
+	}
+	return &auth.Principal{
+		Subject: SubjectPrefix + id,
+		Tenant:  k.Tenant,
+		Scopes:  k.Scopes,
+	}, nil
+}
+
+// Challenge returns the value of the "WWW-Authenticate" header to send to clients that failed to authenticate.
+func (a *authenticator) Challenge() string {
+	return "ApiKey"
+}
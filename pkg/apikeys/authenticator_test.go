@@ -0,0 +1,165 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apikeys
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+// fakeDatabase is an implementation of db.Database which only stores API keys.
+type fakeDatabase struct {
+	db.Database
+
+	// keys are the stored API keys, indexed by ID.
+	keys map[string]models.APIKey
+}
+
+// APIKeys allows for accessing methods used to manage API keys.
+func (f *fakeDatabase) APIKeys() db.APIKeysDatabase {
+	return &fakeAPIKeysDatabase{f}
+}
+
+// fakeAPIKeysDatabase is an implementation of db.APIKeysDatabase backed by a fakeDatabase.
+type fakeAPIKeysDatabase struct {
+	*fakeDatabase
+}
+
+func (f *fakeAPIKeysDatabase) CreateAPIKey(k models.APIKey) (models.APIKey, error) {
+	f.keys[k.ID.Hex()] = k
+	return k, nil
+}
+
+func (f *fakeAPIKeysDatabase) GetAPIKey(id string) (models.APIKey, error) {
+	return f.keys[id], nil
+}
+
+func (f *fakeAPIKeysDatabase) ListAPIKeys() ([]models.APIKey, error) {
+	panic("not implemented")
+}
+
+func (f *fakeAPIKeysDatabase) RevokeAPIKey(id string) (bool, error) {
+	k := f.keys[id]
+	now := time.Now()
+	k.RevokedAt = &now
+	f.keys[id] = k
+	return true, nil
+}
+
+func (f *fakeAPIKeysDatabase) RotateAPIKey(id string, salt, hash []byte) (models.APIKey, error) {
+	k := f.keys[id]
+	k.Salt, k.Hash = salt, hash
+	f.keys[id] = k
+	return k, nil
+}
+
+func (f *fakeAPIKeysDatabase) TouchAPIKey(id string, t time.Time) error {
+	k := f.keys[id]
+	k.LastUsedAt = &t
+	f.keys[id] = k
+	return nil
+}
+
+var _ = Describe("API key authentication", func() {
+	var (
+		database      *fakeDatabase
+		authenticator auth.Authenticator
+		id            primitive.ObjectID
+		key           string
+	)
+
+	// authenticate authenticates a request carrying the provided API key (if non-empty).
+	authenticate := func(key string) (*auth.Principal, error) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if key != "" {
+			req.Header.Set(HeaderName, key)
+		}
+		return authenticator.Authenticate(req)
+	}
+
+	BeforeEach(func() {
+		database = &fakeDatabase{
+			keys: make(map[string]models.APIKey),
+		}
+		authenticator = NewAuthenticator(database)
+		// Issue an API key.
+		id = primitive.NewObjectID()
+		v, salt, hash, err := NewSecret(id)
+		Expect(err).NotTo(HaveOccurred())
+		key = v
+		_, err = database.APIKeys().CreateAPIKey(models.APIKey{
+			ID:     id,
+			Hash:   hash,
+			Salt:   salt,
+			Name:   "reporting",
+			Scopes: []string{auth.ScopePaymentsRead},
+			Tenant: "acme",
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("ignores requests without an api key", func() {
+		_, err := authenticate("")
+		Expect(err).To(Equal(auth.ErrNoCredentials))
+	})
+
+	It("rejects malformed api keys", func() {
+		_, err := authenticate("foo")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects api keys with the wrong secret", func() {
+		_, err := authenticate("dp_" + id.Hex() + "_wrong")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("accepts valid api keys and records their usage", func() {
+		p, err := authenticate(key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*p).To(Equal(auth.Principal{
+			Subject: SubjectPrefix + id.Hex(),
+			Tenant:  "acme",
+			Scopes:  []string{auth.ScopePaymentsRead},
+		}))
+		Expect(database.keys[id.Hex()].LastUsedAt).NotTo(BeNil())
+	})
+
+	It("rejects revoked api keys", func() {
+		_, err := database.APIKeys().RevokeAPIKey(id.Hex())
+		Expect(err).NotTo(HaveOccurred())
+		_, err = authenticate(key)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects the previous secret of rotated api keys", func() {
+		v, salt, hash, err := NewSecret(id)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = database.APIKeys().RotateAPIKey(id.Hex(), salt, hash)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = authenticate(key)
+		Expect(err).To(HaveOccurred())
+		_, err = authenticate(v)
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,87 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo"
+
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+)
+
+var (
+	// ErrNoCredentials is the error returned by authenticators when a request does not carry the credentials they understand.
+	ErrNoCredentials = errors.New("no credentials")
+)
+
+// Authenticator authenticates HTTP requests.
+type Authenticator interface {
+	// Authenticate returns the principal on whose behalf the provided request is made.
+	// It must return ErrNoCredentials in case the request does not carry the credentials it understands, so that other authenticators may be tried.
+	Authenticate(*http.Request) (*Principal, error)
+	// Challenge returns the value of the "WWW-Authenticate" header to send to clients that failed to authenticate, or the empty string if there is none.
+	Challenge() string
+}
+
+// Middleware returns an Echo middleware that authenticates every request using the provided authenticators (in order), rejecting requests that fail to authenticate with "401 UNAUTHORIZED".
+// The authenticated principal is granted the scopes of its roles as defined by the provided roles, and is stored both in the Echo context and in the request's context.
+// Requests for which skipper returns true are not authenticated.
+func Middleware(skipper func(echo.Context) bool, roles Roles, authenticators ...Authenticator) echo.MiddlewareFunc {
+	return func(fn echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if skipper(ctx) {
+				return fn(ctx)
+			}
+			p, err := Authenticate(ctx.Request(), roles, authenticators...)
+			if err != nil {
+				for _, a := range authenticators {
+					if c := a.Challenge(); c != "" {
+						ctx.Response().Header().Add(echo.HeaderWWWAuthenticate, c)
+					}
+				}
+				return echo.NewHTTPError(http.StatusUnauthorized, err.Error()).SetInternal(err)
+			}
+			ctx.Set(constants.PrincipalContextKey, p)
+			ctx.SetRequest(ctx.Request().WithContext(WithPrincipal(ctx.Request().Context(), p)))
+			return fn(ctx)
+		}
+	}
+}
+
+// Authenticate returns the principal on whose behalf the provided request is made, as determined by the first authenticator (in order) that finds credentials in it.
+// The principal is granted the scopes of its roles as defined by the provided roles.
+func Authenticate(req *http.Request, roles Roles, authenticators ...Authenticator) (*Principal, error) {
+	p, err := authenticate(req, authenticators)
+	if err != nil {
+		return nil, err
+	}
+	// Copy the principal's scopes first, as they may be shared with the authenticator's configuration.
+	p.Scopes = append(append([]string{}, p.Scopes...), roles.Scopes(p.Roles)...)
+	return p, nil
+}
+
+// authenticate returns the principal on whose behalf the provided request is made, as determined by the first authenticator that finds credentials in it.
+func authenticate(req *http.Request, authenticators []Authenticator) (*Principal, error) {
+	for _, a := range authenticators {
+		p, err := a.Authenticate(req)
+		if err == ErrNoCredentials {
+			continue
+		}
+		return p, err
+	}
+	return nil, errors.New("missing credentials")
+}
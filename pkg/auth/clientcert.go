@@ -0,0 +1,105 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// ClientCertIdentity describes the principal identified by a client certificate.
+type ClientCertIdentity struct {
+	// Tenant is the tenant to which the principal belongs, if any.
+	Tenant string `json:"tenant"`
+	// Roles are the roles the principal has been assigned.
+	Roles []string `json:"roles"`
+	// Scopes are the scopes the principal has been granted.
+	Scopes []string `json:"scopes"`
+}
+
+// clientCertAuthenticator is an implementation of Authenticator that identifies principals using the certificates they present when establishing TLS connections.
+type clientCertAuthenticator struct {
+	// identities maps the names of client certificates to the principals they identify.
+	identities map[string]ClientCertIdentity
+}
+
+// LoadClientCertIdentities reads the identities defined in the specified JSON file, which must contain an object mapping names of client certificates to identities.
+// Names are either "URI:<uri>", "DNS:<name>" or "EMAIL:<address>" for subject alternative names, or "CN=<name>" for the subject's common name.
+func LoadClientCertIdentities(path string) (map[string]ClientCertIdentity, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the client certificate identities file: %v", err)
+	}
+	r := make(map[string]ClientCertIdentity)
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse the client certificate identities file: %v", err)
+	}
+	return r, nil
+}
+
+// NewClientCertAuthenticator returns an Authenticator that identifies principals using the provided mapping of names of client certificates to identities.
+// Client certificates must have been verified while establishing the TLS connection.
+func NewClientCertAuthenticator(identities map[string]ClientCertIdentity) Authenticator {
+	return &clientCertAuthenticator{
+		identities: identities,
+	}
+}
+
+// Authenticate returns the principal identified by the certificate presented by the client that made the provided request.
+// Subject alternative names take precedence over the subject's common name.
+func (a *clientCertAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 {
+		return nil, ErrNoCredentials
+	}
+	for _, n := range clientCertNames(req.TLS.VerifiedChains[0][0]) {
+		if i, ok := a.identities[n]; ok {
+			return &Principal{
+				Subject: n,
+				Tenant:  i.Tenant,
+				Roles:   i.Roles,
+				Scopes:  i.Scopes,
+			}, nil
+		}
+	}
+	return nil, errors.New("the client certificate does not identify any known principal")
+}
+
+// Challenge returns the value of the "WWW-Authenticate" header to send to clients that failed to authenticate.
+// Client certificates are requested during the TLS handshake rather than challenged for.
+func (a *clientCertAuthenticator) Challenge() string {
+	return ""
+}
+
+// clientCertNames returns the names of the provided certificate, in order of precedence.
+func clientCertNames(c *x509.Certificate) []string {
+	r := make([]string, 0)
+	for _, u := range c.URIs {
+		r = append(r, "URI:"+u.String())
+	}
+	for _, d := range c.DNSNames {
+		r = append(r, "DNS:"+d)
+	}
+	for _, e := range c.EmailAddresses {
+		r = append(r, "EMAIL:"+e)
+	}
+	if c.Subject.CommonName != "" {
+		r = append(r, "CN="+c.Subject.CommonName)
+	}
+	return r
+}
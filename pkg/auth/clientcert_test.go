@@ -0,0 +1,95 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client certificate authentication", func() {
+	var (
+		authenticator Authenticator
+	)
+
+	// newRequest returns a new request made using the provided (verified) client certificate, if any.
+	newRequest := func(c *x509.Certificate) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/payments", nil)
+		req.TLS = &tls.ConnectionState{}
+		if c != nil {
+			req.TLS.PeerCertificates = []*x509.Certificate{c}
+			req.TLS.VerifiedChains = [][]*x509.Certificate{{c}}
+		}
+		return req
+	}
+
+	BeforeEach(func() {
+		authenticator = NewClientCertAuthenticator(map[string]ClientCertIdentity{
+			"CN=billing": {
+				Tenant: "acme",
+				Roles:  []string{RoleViewer},
+			},
+			"URI:spiffe://acme/reporting": {
+				Tenant: "acme",
+				Scopes: []string{ScopePaymentsRead},
+			},
+		})
+	})
+
+	It("ignores requests made without a client certificate", func() {
+		_, err := authenticator.Authenticate(newRequest(nil))
+		Expect(err).To(Equal(ErrNoCredentials))
+		_, err = authenticator.Authenticate(httptest.NewRequest(http.MethodGet, "/payments", nil))
+		Expect(err).To(Equal(ErrNoCredentials))
+	})
+
+	It("identifies principals by the common name", func() {
+		p, err := authenticator.Authenticate(newRequest(&x509.Certificate{
+			Subject: pkix.Name{CommonName: "billing"},
+		}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*p).To(Equal(Principal{
+			Subject: "CN=billing",
+			Tenant:  "acme",
+			Roles:   []string{RoleViewer},
+		}))
+	})
+
+	It("gives precedence to subject alternative names", func() {
+		u, err := url.Parse("spiffe://acme/reporting")
+		Expect(err).NotTo(HaveOccurred())
+		p, err := authenticator.Authenticate(newRequest(&x509.Certificate{
+			Subject: pkix.Name{CommonName: "billing"},
+			URIs:    []*url.URL{u},
+		}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.Subject).To(Equal("URI:spiffe://acme/reporting"))
+	})
+
+	It("rejects unknown client certificates", func() {
+		_, err := authenticator.Authenticate(newRequest(&x509.Certificate{
+			Subject: pkix.Name{CommonName: "other"},
+		}))
+		Expect(err).To(HaveOccurred())
+		Expect(err).NotTo(Equal(ErrNoCredentials))
+	})
+})
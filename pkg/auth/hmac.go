@@ -0,0 +1,129 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+	"github.com/bmcstdio/dojo-payments/pkg/signing"
+)
+
+const (
+	// hmacSubjectPrefix is the prefix of the subject of principals authenticated using signed requests.
+	hmacSubjectPrefix = "hmac:"
+)
+
+// HMACKey is a secret shared with a client that signs its requests.
+type HMACKey struct {
+	// ID is the ID of the key, which clients send together with the signature.
+	ID string `json:"id"`
+	// Secret is the shared secret used to sign requests.
+	Secret string `json:"secret"`
+	// Tenant is the tenant to which the client belongs, if any.
+	Tenant string `json:"tenant"`
+	// Roles are the roles the client has been assigned.
+	Roles []string `json:"roles"`
+	// Scopes are the scopes the client has been granted.
+	Scopes []string `json:"scopes"`
+}
+
+// hmacAuthenticator is an implementation of Authenticator that validates signed requests.
+type hmacAuthenticator struct {
+	// keys are the keys shared with clients, indexed by ID.
+	keys map[string]HMACKey
+	// maxBodySize is the maximum size (in bytes) of the body of signed requests.
+	maxBodySize int64
+	// nonces is the cache used to detect replayed requests.
+	nonces signing.NonceCache
+	// now returns the current time.
+	now func() time.Time
+}
+
+// LoadHMACKeys reads the keys defined in the specified JSON file, which must contain a list of keys.
+func LoadHMACKeys(path string) ([]HMACKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the hmac keys file: %v", err)
+	}
+	r := make([]HMACKey, 0)
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse the hmac keys file: %v", err)
+	}
+	for _, k := range r {
+		if k.ID == "" || k.Secret == "" {
+			return nil, errors.New("the id and the secret of every hmac key must not be empty")
+		}
+	}
+	return r, nil
+}
+
+// NewHMACAuthenticator returns an Authenticator that validates requests signed using the provided keys, using the provided cache to detect replayed requests.
+// Signed requests whose body is larger than maxBodySize bytes are rejected, as the body must be read before the request is authenticated.
+// Replayed requests are only detected in case the cache is shared by every instance of the API server that may receive them.
+func NewHMACAuthenticator(keys []HMACKey, nonces signing.NonceCache, maxBodySize int64) Authenticator {
+	a := &hmacAuthenticator{
+		keys:        make(map[string]HMACKey, len(keys)),
+		maxBodySize: maxBodySize,
+		nonces:      nonces,
+		now:         time.Now,
+	}
+	for _, k := range keys {
+		a.keys[k.ID] = k
+	}
+	return a
+}
+
+// Authenticate returns the principal identified by the key used to sign the provided request.
+func (a *hmacAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	now := a.now()
+	id, nonce, err := signing.Verify(req, a.secret, now, constants.SignatureMaxClockSkew, a.maxBodySize)
+	if err == signing.ErrNotSigned {
+		return nil, ErrNoCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %v", err)
+	}
+	// Reject requests whose nonce has already been used, remembering it for as long as the request would otherwise be accepted.
+	if !a.nonces.Add(id+":"+nonce, now.Add(2*constants.SignatureMaxClockSkew)) {
+		return nil, errors.New("invalid signature: the request has already been received")
+	}
+	k := a.keys[id]
+	return &Principal{
+		Subject: hmacSubjectPrefix + k.ID,
+		Tenant:  k.Tenant,
+		Roles:   k.Roles,
+		Scopes:  k.Scopes,
+	}, nil
+}
+
+// Challenge returns the value of the "WWW-Authenticate" header to send to clients that failed to authenticate.
+func (a *hmacAuthenticator) Challenge() string {
+	return signing.Algorithm
+}
+
+// secret returns the secret of the key with the specified ID.
+func (a *hmacAuthenticator) secret(id string) ([]byte, error) {
+	k, ok := a.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	return []byte(k.Secret), nil
+}
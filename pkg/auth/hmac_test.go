@@ -0,0 +1,83 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/bmcstdio/dojo-payments/pkg/signing"
+)
+
+var _ = Describe("HMAC authentication", func() {
+	var (
+		authenticator Authenticator
+	)
+
+	// newRequest returns a new request signed using the specified key and secret.
+	newRequest := func(id, secret string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/payments", nil)
+		Expect(signing.Sign(req, id, []byte(secret), []string{"host"}, time.Now())).To(Succeed())
+		return req
+	}
+
+	BeforeEach(func() {
+		authenticator = NewHMACAuthenticator([]HMACKey{
+			{
+				ID:     "partner",
+				Secret: "secret",
+				Tenant: "acme",
+				Roles:  []string{RoleViewer},
+			},
+		}, signing.NewMemoryNonceCache(), 1<<20)
+	})
+
+	It("ignores requests which are not signed", func() {
+		_, err := authenticator.Authenticate(httptest.NewRequest(http.MethodGet, "/payments", nil))
+		Expect(err).To(Equal(ErrNoCredentials))
+	})
+
+	It("accepts correctly signed requests", func() {
+		p, err := authenticator.Authenticate(newRequest("partner", "secret"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*p).To(Equal(Principal{
+			Subject: "hmac:partner",
+			Tenant:  "acme",
+			Roles:   []string{RoleViewer},
+		}))
+	})
+
+	It("rejects requests signed with the wrong secret", func() {
+		_, err := authenticator.Authenticate(newRequest("partner", "wrong"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects requests signed with unknown keys", func() {
+		_, err := authenticator.Authenticate(newRequest("other", "secret"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects replayed requests", func() {
+		req := newRequest("partner", "secret")
+		_, err := authenticator.Authenticate(req)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = authenticator.Authenticate(req)
+		Expect(err).To(MatchError(ContainSubstring("already been received")))
+	})
+})
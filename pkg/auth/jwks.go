@@ -0,0 +1,121 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+)
+
+// jwk represents a JSON Web Key, as defined in RFC 7517.
+type jwk struct {
+	// Kty is the key type (either "RSA" or "EC").
+	Kty string `json:"kty"`
+	// Kid is the key ID.
+	Kid string `json:"kid"`
+	// N is the modulus of an RSA key.
+	N string `json:"n"`
+	// E is the exponent of an RSA key.
+	E string `json:"e"`
+	// Crv is the curve of an EC key.
+	Crv string `json:"crv"`
+	// X is the x coordinate of an EC key.
+	X string `json:"x"`
+	// Y is the y coordinate of an EC key.
+	Y string `json:"y"`
+}
+
+// jwks represents a JSON Web Key Set, as defined in RFC 7517.
+type jwks struct {
+	// Keys are the keys in the set.
+	Keys []jwk `json:"keys"`
+}
+
+// readJWKS reads the public keys in the provided JWKS file, indexing them by key ID.
+func readJWKS(path string) (map[string]interface{}, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jwks file: %v", err)
+	}
+	s := jwks{}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse jwks file: %v", err)
+	}
+	r := make(map[string]interface{}, len(s.Keys))
+	for i, k := range s.Keys {
+		v, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key #%d in jwks file: %v", i, err)
+		}
+		r[k.Kid] = v
+	}
+	return r, nil
+}
+
+// publicKey returns the public key represented by the current JWK.
+func (k *jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %v", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %v", err)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var (
+			c elliptic.Curve
+		)
+		switch k.Crv {
+		case "P-256":
+			c = elliptic.P256()
+		case "P-384":
+			c = elliptic.P384()
+		case "P-521":
+			c = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %v", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %v", err)
+		}
+		return &ecdsa.PublicKey{Curve: c, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// decodeBigInt decodes the provided base64url-encoded big-endian integer.
+func decodeBigInt(v string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo"
+)
+
+const (
+	// bearerScheme is the authentication scheme used to send JWTs.
+	bearerScheme = "Bearer"
+)
+
+// jwtClaims represents the claims carried by a JWT.
+type jwtClaims struct {
+	jwt.RegisteredClaims
+
+	// Tenant is the tenant to which the subject belongs.
+	Tenant string `json:"tenant,omitempty"`
+	// Roles is the list of roles the subject has been assigned.
+	Roles []string `json:"roles,omitempty"`
+	// Scope is the space-separated list of scopes the subject has been granted.
+	Scope string `json:"scope,omitempty"`
+	// Scp is the list of scopes the subject has been granted, as issued by some identity providers.
+	Scp []string `json:"scp,omitempty"`
+}
+
+// jwtAuthenticator is an implementation of Authenticator that validates JWTs sent as bearer tokens.
+type jwtAuthenticator struct {
+	// hmacSecret is the secret used to validate HS256 signatures, if any.
+	hmacSecret []byte
+	// keys are the public keys used to validate RS256 and ES256 signatures, indexed by key ID.
+	keys map[string]interface{}
+	// parser is the parser used to parse and validate JWTs.
+	parser *jwt.Parser
+}
+
+// NewJWTAuthenticator returns an Authenticator that validates JWTs sent as bearer tokens.
+// HS256 signatures are validated using the provided secret (if non-empty), and RS256 and ES256 signatures using the keys in the provided JWKS file (if non-empty).
+func NewJWTAuthenticator(hmacSecret []byte, jwksFile string) (Authenticator, error) {
+	if len(hmacSecret) == 0 && jwksFile == "" {
+		return nil, errors.New("either a secret or a jwks file must be provided")
+	}
+	a := &jwtAuthenticator{
+		hmacSecret: hmacSecret,
+		keys:       make(map[string]interface{}),
+	}
+	methods := make([]string, 0)
+	if len(hmacSecret) != 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if jwksFile != "" {
+		k, err := readJWKS(jwksFile)
+		if err != nil {
+			return nil, err
+		}
+		a.keys = k
+		methods = append(methods, jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg())
+	}
+	a.parser = jwt.NewParser(jwt.WithValidMethods(methods), jwt.WithExpirationRequired())
+	return a, nil
+}
+
+// Authenticate returns the principal identified by the JWT sent as a bearer token in the provided request.
+func (a *jwtAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	h := req.Header.Get(echo.HeaderAuthorization)
+	if !strings.HasPrefix(h, bearerScheme+" ") {
+		return nil, ErrNoCredentials
+	}
+	c := &jwtClaims{}
+	if _, err := a.parser.ParseWithClaims(strings.TrimPrefix(h, bearerScheme+" "), c, a.key); err != nil {
+		return nil, fmt.Errorf("invalid token: %v", err)
+	}
+	if c.Subject == "" {
+		return nil, errors.New("invalid token: the subject must not be empty")
+	}
+	return &Principal{
+		Subject: c.Subject,
+		Tenant:  c.Tenant,
+		Roles:   c.Roles,
+		Scopes:  append(strings.Fields(c.Scope), c.Scp...),
+	}, nil
+}
+
+// Challenge returns the value of the "WWW-Authenticate" header to send to clients that failed to authenticate.
+func (a *jwtAuthenticator) Challenge() string {
+	return bearerScheme
+}
+
+// key returns the key used to validate the signature of the provided token.
+func (a *jwtAuthenticator) key(t *jwt.Token) (interface{}, error) {
+	if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+		return a.hmacSecret, nil
+	}
+	// Use the key with the ID specified in the token's header, if any.
+	if kid, ok := t.Header["kid"].(string); ok {
+		k, ok := a.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		return k, nil
+	}
+	// Otherwise, use the only key of the appropriate type, if there is exactly one.
+	var (
+		r interface{}
+	)
+	for _, k := range a.keys {
+		switch k.(type) {
+		case *rsa.PublicKey:
+			if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+				continue
+			}
+		case *ecdsa.PublicKey:
+			if _, ok := t.Method.(*jwt.SigningMethodECDSA); !ok {
+				continue
+			}
+		}
+		if r != nil {
+			return nil, errors.New("the key id must be specified")
+		}
+		r = k
+	}
+	if r == nil {
+		return nil, fmt.Errorf("no key available for %s", t.Method.Alg())
+	}
+	return r, nil
+}
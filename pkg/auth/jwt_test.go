@@ -0,0 +1,170 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+)
+
+const (
+	// testSecret is the secret used to sign HS256 tokens.
+	testSecret = "s3cr3t"
+)
+
+// encodeBigInt encodes the provided integer as a base64url-encoded big-endian integer.
+func encodeBigInt(v *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(v.Bytes())
+}
+
+// sign returns a token with the provided claims signed using the specified method and key, and carrying the specified key ID (if non-empty).
+func sign(method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	t := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		t.Header["kid"] = kid
+	}
+	s, err := t.SignedString(key)
+	Expect(err).NotTo(HaveOccurred())
+	return s
+}
+
+var _ = Describe("JWT authentication", func() {
+	var (
+		authenticator Authenticator
+		dir           string
+		ecKey         *ecdsa.PrivateKey
+		rsaKey        *rsa.PrivateKey
+		srv           *echo.Echo
+	)
+
+	// do makes a request carrying the provided token (if non-empty) and returns the response.
+	do := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// validClaims returns a set of claims which are valid.
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":    "alice",
+			"tenant": "acme",
+			"scope":  "payments:read payments:write",
+			"exp":    time.Now().Add(time.Hour).Unix(),
+		}
+	}
+
+	BeforeEach(func() {
+		var (
+			err error
+		)
+		// Generate the keys used to sign RS256 and ES256 tokens, and write the corresponding JWKS file.
+		rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		b, err := json.Marshal(map[string]interface{}{
+			"keys": []map[string]string{
+				{"kty": "RSA", "kid": "rsa", "n": encodeBigInt(rsaKey.N), "e": encodeBigInt(big.NewInt(int64(rsaKey.E)))},
+				{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encodeBigInt(ecKey.X), "y": encodeBigInt(ecKey.Y)},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		dir, err = ioutil.TempDir("", "jwks")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "jwks.json"), b, 0600)).To(Succeed())
+		authenticator, err = NewJWTAuthenticator([]byte(testSecret), filepath.Join(dir, "jwks.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Create an Echo instance whose single route returns the authenticated principal.
+		srv = echo.New()
+		srv.Use(Middleware(func(echo.Context) bool { return false }, nil, authenticator))
+		srv.GET("/", func(ctx echo.Context) error {
+			Expect(PrincipalFromContext(ctx.Request().Context())).To(Equal(ctx.Get(constants.PrincipalContextKey)))
+			return ctx.JSON(http.StatusOK, ctx.Get(constants.PrincipalContextKey))
+		})
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It(`rejects requests without a token with "401 UNAUTHORIZED"`, func() {
+		rec := do("")
+		Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+		Expect(rec.Header().Get(echo.HeaderWWWAuthenticate)).To(Equal("Bearer"))
+	})
+
+	It(`rejects expired tokens with "401 UNAUTHORIZED"`, func() {
+		c := validClaims()
+		c["exp"] = time.Now().Add(-time.Minute).Unix()
+		Expect(do(sign(jwt.SigningMethodHS256, []byte(testSecret), "", c)).Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It(`rejects tokens without an expiration date with "401 UNAUTHORIZED"`, func() {
+		c := validClaims()
+		delete(c, "exp")
+		Expect(do(sign(jwt.SigningMethodHS256, []byte(testSecret), "", c)).Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It(`rejects tokens signed with the wrong key with "401 UNAUTHORIZED"`, func() {
+		Expect(do(sign(jwt.SigningMethodHS256, []byte("wrong"), "", validClaims())).Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It(`rejects tokens signed with an unsupported algorithm with "401 UNAUTHORIZED"`, func() {
+		Expect(do(sign(jwt.SigningMethodHS512, []byte(testSecret), "", validClaims())).Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	DescribeTable("accepts valid tokens and extracts the principal",
+		func(method jwt.SigningMethod, key func() interface{}, kid string) {
+			rec := do(sign(method, key(), kid, validClaims()))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			p := Principal{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &p)).To(Succeed())
+			Expect(p).To(Equal(Principal{
+				Subject: "alice",
+				Tenant:  "acme",
+				Scopes:  []string{"payments:read", "payments:write"},
+			}))
+		},
+		Entry("HS256", jwt.SigningMethodHS256, func() interface{} { return []byte(testSecret) }, ""),
+		Entry("RS256", jwt.SigningMethodRS256, func() interface{} { return rsaKey }, "rsa"),
+		Entry("RS256 without a key id", jwt.SigningMethodRS256, func() interface{} { return rsaKey }, ""),
+		Entry("ES256", jwt.SigningMethodES256, func() interface{} { return ecKey }, "ec"),
+	)
+})
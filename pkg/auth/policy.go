@@ -0,0 +1,38 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+// Route identifies a route of the API server.
+type Route struct {
+	// Method is the HTTP method of the route.
+	Method string
+	// Path is the path of the route, as registered with Echo.
+	Path string
+}
+
+// Policy maps routes to the scope required to access them.
+type Policy map[Route]string
+
+// Scope returns the scope required to access the specified route.
+// Routes not covered by the policy require a scope that cannot be granted, so that they are never accessible to authenticated principals by mistake.
+func (p Policy) Scope(r Route) string {
+	if s, ok := p[r]; ok {
+		return s
+	}
+	return unknownScope
+}
+
+// unknownScope is a scope which cannot be granted to principals.
+const unknownScope = "<unknown>"
@@ -0,0 +1,63 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+)
+
+// principalContextKey is the type of the key under which the principal is stored in a context.
+type principalContextKey struct{}
+
+// Principal represents the (authenticated) entity on whose behalf a request is made.
+type Principal struct {
+	// Subject is the unique identifier of the principal.
+	Subject string
+	// Tenant is the tenant to which the principal belongs, if any.
+	Tenant string
+	// Roles are the roles the principal has been assigned.
+	Roles []string
+	// Scopes are the scopes the principal has been granted, either directly or through its roles.
+	Scopes []string
+}
+
+// HasScope returns a value indicating whether the principal has been granted the specified scope.
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// WithPrincipal returns a copy of the provided context that carries the specified principal.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// PrincipalFromContext returns the principal carried by the provided context, or nil in case the request is not authenticated.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalContextKey{}).(*Principal)
+	return p
+}
+
+// TenantFromContext returns the tenant of the principal carried by the provided context, or the empty string if there is no such principal.
+func TenantFromContext(ctx context.Context) string {
+	if p := PrincipalFromContext(ctx); p != nil {
+		return p.Tenant
+	}
+	return ""
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+const (
+	// RoleAdmin is the role of principals allowed to perform any operation.
+	RoleAdmin = "admin"
+	// RoleOperator is the role of principals allowed to read, create and update payments.
+	RoleOperator = "operator"
+	// RoleViewer is the role of principals allowed to read payments.
+	RoleViewer = "viewer"
+)
+
+// Roles maps the name of each role to the scopes granted to principals assigned said role.
+type Roles map[string][]string
+
+// DefaultRoles are the roles used when no roles are explicitly configured.
+var DefaultRoles = Roles{
+	RoleAdmin: {
+		ScopeAPIKeysManage,
+		ScopePaymentsDelete,
+		ScopePaymentsRead,
+		ScopePaymentsWrite,
+	},
+	RoleOperator: {
+		ScopePaymentsRead,
+		ScopePaymentsWrite,
+	},
+	RoleViewer: {
+		ScopePaymentsRead,
+	},
+}
+
+// LoadRoles reads the roles defined in the specified JSON file, which must contain an object mapping the name of each role to the list of scopes it grants.
+func LoadRoles(path string) (Roles, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the roles file: %v", err)
+	}
+	r := make(Roles)
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse the roles file: %v", err)
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Scopes returns the scopes granted by the specified roles.
+// Unknown roles grant no scopes.
+func (r Roles) Scopes(names []string) []string {
+	s := make([]string, 0)
+	for _, n := range names {
+		s = append(s, r[n]...)
+	}
+	return s
+}
+
+// Validate validates the current set of roles.
+func (r Roles) Validate() error {
+	for n, scopes := range r {
+		if n == "" {
+			return errors.New("the name of a role must not be empty")
+		}
+		for _, s := range scopes {
+			if !IsKnownScope(s) {
+				return fmt.Errorf("role %q grants unknown scope %q", n, s)
+			}
+		}
+	}
+	return nil
+}
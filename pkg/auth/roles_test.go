@@ -0,0 +1,60 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Roles", func() {
+	// load writes the provided contents to a temporary file and loads the roles defined therein.
+	load := func(contents string) (Roles, error) {
+		f, err := ioutil.TempFile("", "roles")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.Remove(f.Name())
+		_, err = f.WriteString(contents)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+		return LoadRoles(f.Name())
+	}
+
+	It("loads roles from a file", func() {
+		r, err := load(`{"auditor": ["payments:read"]}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r).To(Equal(Roles{"auditor": {ScopePaymentsRead}}))
+	})
+
+	It("rejects roles granting unknown scopes", func() {
+		_, err := load(`{"auditor": ["payments:audit"]}`)
+		Expect(err).To(MatchError(ContainSubstring("payments:audit")))
+	})
+
+	It("rejects malformed files", func() {
+		_, err := load(`["payments:read"]`)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("returns the scopes granted by a set of roles", func() {
+		Expect(DefaultRoles.Scopes([]string{RoleViewer, "unknown"})).To(Equal([]string{ScopePaymentsRead}))
+	})
+
+	It("defines valid default roles", func() {
+		Expect(DefaultRoles.Validate()).To(Succeed())
+	})
+})
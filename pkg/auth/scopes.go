@@ -0,0 +1,89 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo"
+
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+)
+
+const (
+	// ScopeAPIKeysManage is the scope required to manage API keys.
+	ScopeAPIKeysManage = "apikeys:manage"
+	// ScopePaymentsDelete is the scope required to delete payments.
+	ScopePaymentsDelete = "payments:delete"
+	// ScopePaymentsRead is the scope required to read payments.
+	ScopePaymentsRead = "payments:read"
+	// ScopePaymentsWrite is the scope required to create and update payments.
+	ScopePaymentsWrite = "payments:write"
+)
+
+// Scopes are all the known scopes.
+var Scopes = []string{
+	ScopeAPIKeysManage,
+	ScopePaymentsDelete,
+	ScopePaymentsRead,
+	ScopePaymentsWrite,
+}
+
+// IsKnownScope returns a value indicating whether the provided scope is known.
+func IsKnownScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckScope returns an error in case the principal carried by the provided context has not been granted the specified scope.
+// Requests which are not authenticated (i.e. when authentication is disabled) are not checked.
+func CheckScope(ctx context.Context, scope string) error {
+	if p := PrincipalFromContext(ctx); p != nil && !p.HasScope(scope) {
+		return fmt.Errorf("missing permission %q", scope)
+	}
+	return nil
+}
+
+// RequirePrincipal returns an Echo middleware that rejects requests which are not authenticated with "401 UNAUTHORIZED", including when authentication is disabled.
+// It protects routes which must never be accessible anonymously.
+func RequirePrincipal() echo.MiddlewareFunc {
+	return func(fn echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if _, ok := ctx.Get(constants.PrincipalContextKey).(*Principal); !ok {
+				return echo.NewHTTPError(http.StatusUnauthorized, "authentication is required")
+			}
+			return fn(ctx)
+		}
+	}
+}
+
+// RequireScope returns an Echo middleware that rejects requests made by principals which have not been granted the specified scope with "403 FORBIDDEN".
+// Requests which are not authenticated (i.e. when authentication is disabled) are not checked.
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(fn echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if p, ok := ctx.Get(constants.PrincipalContextKey).(*Principal); ok && !p.HasScope(scope) {
+				return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("missing permission %q", scope))
+			}
+			return fn(ctx)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+)
+
+var _ = Describe("Scopes", func() {
+	// do makes a request to a route protected by the provided middleware on behalf of the provided principal (if any).
+	do := func(p *Principal, m echo.MiddlewareFunc) *httptest.ResponseRecorder {
+		srv := echo.New()
+		srv.Use(func(fn echo.HandlerFunc) echo.HandlerFunc {
+			return func(ctx echo.Context) error {
+				if p != nil {
+					ctx.Set(constants.PrincipalContextKey, p)
+				}
+				return fn(ctx)
+			}
+		})
+		srv.GET("/", func(ctx echo.Context) error {
+			return ctx.NoContent(http.StatusOK)
+		}, m)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec
+	}
+
+	It(`rejects principals without the required scope with "403 FORBIDDEN"`, func() {
+		rec := do(&Principal{Subject: "alice", Scopes: []string{ScopePaymentsRead}}, RequireScope(ScopePaymentsWrite))
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+		Expect(rec.Body.String()).To(ContainSubstring(ScopePaymentsWrite))
+	})
+
+	It("accepts principals with the required scope", func() {
+		Expect(do(&Principal{Subject: "alice", Scopes: []string{ScopePaymentsWrite}}, RequireScope(ScopePaymentsWrite)).Code).To(Equal(http.StatusOK))
+	})
+
+	It("does not check unauthenticated requests", func() {
+		Expect(do(nil, RequireScope(ScopePaymentsWrite)).Code).To(Equal(http.StatusOK))
+	})
+
+	It(`rejects unauthenticated requests to routes requiring a principal with "401 UNAUTHORIZED"`, func() {
+		Expect(do(nil, RequirePrincipal()).Code).To(Equal(http.StatusUnauthorized))
+		Expect(do(&Principal{Subject: "alice"}, RequirePrincipal()).Code).To(Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,340 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+// fakeDatabase is an implementation of db.Database which keeps payments in memory and counts how many times they are read.
+type fakeDatabase struct {
+	db.Database
+
+	// err is the error returned when reading payments, if any.
+	err error
+	// gate, if not nil, blocks reads until it is closed.
+	gate chan struct{}
+	// payments are the stored payments, indexed by tenant and ID.
+	payments map[string]models.Payment
+	// reads is the number of times a payment was read.
+	reads int32
+	// tenant is the tenant to which the payments being accessed belong, if any.
+	tenant string
+}
+
+// ForTenant returns a view of the database scoped to the specified tenant.
+func (f *fakeDatabase) ForTenant(tenant string) (db.Database, error) {
+	v := *f
+	v.tenant = tenant
+	return &v, nil
+}
+
+// Payments allows for accessing methods used to perform CRUD operations on payments.
+func (f *fakeDatabase) Payments() db.PaymentsDatabase {
+	return &fakePaymentsDatabase{fakeDatabase: f}
+}
+
+// ScheduledPayments allows for accessing methods used to execute scheduled payments.
+func (f *fakeDatabase) ScheduledPayments() db.ScheduledPaymentsDatabase {
+	return &fakeScheduledPaymentsDatabase{fakeDatabase: f}
+}
+
+// WithContext returns a view of the database whose reads fail once the provided context is done.
+func (f *fakeDatabase) WithContext(ctx context.Context) db.Database {
+	return &fakeContextDatabase{fakeDatabase: f, ctx: ctx}
+}
+
+// WithTransaction runs the provided function against the database itself.
+func (f *fakeDatabase) WithTransaction(_ context.Context, fn func(tx db.Database) error) error {
+	return fn(f)
+}
+
+// fakeContextDatabase is a view of a fakeDatabase whose reads fail once a given context is done.
+type fakeContextDatabase struct {
+	*fakeDatabase
+
+	// ctx is the context within which payments are read.
+	ctx context.Context
+}
+
+// Payments allows for accessing methods used to perform CRUD operations on payments within the context of the view.
+func (f *fakeContextDatabase) Payments() db.PaymentsDatabase {
+	return &fakePaymentsDatabase{ctx: f.ctx, fakeDatabase: f.fakeDatabase}
+}
+
+// fakePaymentsDatabase is an implementation of db.PaymentsDatabase backed by a fakeDatabase.
+type fakePaymentsDatabase struct {
+	db.PaymentsDatabase
+	*fakeDatabase
+
+	// ctx, if not nil, is the context within which payments are read, which fails reads once it is done.
+	ctx context.Context
+}
+
+func (f *fakePaymentsDatabase) CreatePayment(p models.Payment) (models.Payment, error) {
+	f.payments[f.tenant+p.ID.Hex()] = p
+	return p, nil
+}
+
+func (f *fakePaymentsDatabase) DeletePayment(id string) (bool, error) {
+	_, ok := f.payments[f.tenant+id]
+	delete(f.payments, f.tenant+id)
+	return ok, nil
+}
+
+func (f *fakePaymentsDatabase) GetPayment(id string) (models.Payment, error) {
+	atomic.AddInt32(&f.reads, 1)
+	if f.gate != nil {
+		<-f.gate
+	}
+	if f.err != nil {
+		return models.Payment{}, f.err
+	}
+	if f.ctx != nil && f.ctx.Err() != nil {
+		return models.Payment{}, f.ctx.Err()
+	}
+	return f.payments[f.tenant+id], nil
+}
+
+func (f *fakePaymentsDatabase) UpdatePayment(id string, p models.Payment) (models.Payment, error) {
+	f.payments[f.tenant+id] = p
+	return p, nil
+}
+
+// fakeScheduledPaymentsDatabase is an implementation of db.ScheduledPaymentsDatabase backed by a fakeDatabase.
+type fakeScheduledPaymentsDatabase struct {
+	db.ScheduledPaymentsDatabase
+	*fakeDatabase
+}
+
+func (f *fakeScheduledPaymentsDatabase) ExecutePayment(p models.Payment, _ string, now time.Time) (models.Payment, error) {
+	p.ExecutedAt, p.Status = &now, models.PaymentStatusExecuted
+	f.payments[p.Tenant+p.ID.Hex()] = p
+	return p, nil
+}
+
+var _ = Describe("Memory store", func() {
+	It("evicts the least recently used values", func() {
+		s := NewMemoryStore(2)
+		Expect(s.Set("a", []byte("1"), time.Minute)).To(Succeed())
+		Expect(s.Set("b", []byte("2"), time.Minute)).To(Succeed())
+		_, ok, _ := s.Get("a")
+		Expect(ok).To(BeTrue())
+		Expect(s.Set("c", []byte("3"), time.Minute)).To(Succeed())
+		_, ok, _ = s.Get("b")
+		Expect(ok).To(BeFalse())
+		v, ok, _ := s.Get("a")
+		Expect(ok).To(BeTrue())
+		Expect(v).To(Equal([]byte("1")))
+	})
+
+	It("does not return expired values", func() {
+		s := NewMemoryStore(2)
+		Expect(s.Set("a", []byte("1"), time.Millisecond)).To(Succeed())
+		time.Sleep(5 * time.Millisecond)
+		_, ok, _ := s.Get("a")
+		Expect(ok).To(BeFalse())
+	})
+})
+
+var _ = Describe("Cached database", func() {
+	var (
+		d        db.Database
+		database *fakeDatabase
+		lock     sync.Mutex
+		lookups  map[string]int
+		p        models.Payment
+	)
+
+	BeforeEach(func() {
+		p = models.Payment{ID: primitive.NewObjectID(), Amount: 12.5, Currency: "GBP", Date: time.Now().UTC().Truncate(time.Millisecond)}
+		database = &fakeDatabase{payments: map[string]models.Payment{p.ID.Hex(): p}}
+		lookups = make(map[string]int)
+		d = NewDatabase(database, NewMemoryStore(10), Options{
+			NegativeTTL: time.Minute,
+			OnLookup: func(result string) {
+				lock.Lock()
+				defer lock.Unlock()
+				lookups[result]++
+			},
+			TTL: time.Minute,
+		})
+	})
+
+	It("reads payments from the database only once", func() {
+		for i := 0; i < 3; i++ {
+			r, err := d.Payments().GetPayment(p.ID.Hex())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r).To(Equal(p))
+		}
+		Expect(database.reads).To(BeEquivalentTo(1))
+		Expect(lookups).To(Equal(map[string]int{ResultHit: 2, ResultMiss: 1}))
+	})
+
+	It("caches the absence of payments, unless disabled", func() {
+		id := primitive.NewObjectID().Hex()
+		for i := 0; i < 2; i++ {
+			r, err := d.Payments().GetPayment(id)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r).To(Equal(models.Payment{}))
+		}
+		Expect(database.reads).To(BeEquivalentTo(1))
+
+		d = NewDatabase(database, NewMemoryStore(10), Options{TTL: time.Minute})
+		for i := 0; i < 2; i++ {
+			_, err := d.Payments().GetPayment(id)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(database.reads).To(BeEquivalentTo(3))
+	})
+
+	It("does not cache errors", func() {
+		database.err = errors.New("boom")
+		_, err := d.Payments().GetPayment(p.ID.Hex())
+		Expect(err).To(MatchError("boom"))
+		database.err = nil
+		r, err := d.Payments().GetPayment(p.ID.Hex())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r).To(Equal(p))
+	})
+
+	It("invalidates payments when they are modified", func() {
+		_, err := d.Payments().GetPayment(p.ID.Hex())
+		Expect(err).NotTo(HaveOccurred())
+		u := p
+		u.Amount = 20
+		_, err = d.Payments().UpdatePayment(p.ID.Hex(), u)
+		Expect(err).NotTo(HaveOccurred())
+		r, err := d.Payments().GetPayment(p.ID.Hex())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Amount).To(Equal(20.0))
+
+		_, err = d.Payments().DeletePayment(p.ID.Hex())
+		Expect(err).NotTo(HaveOccurred())
+		r, err = d.Payments().GetPayment(p.ID.Hex())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r).To(Equal(models.Payment{}))
+
+		// Creating a payment with a given ID replaces its cached absence.
+		_, err = d.Payments().CreatePayment(p)
+		Expect(err).NotTo(HaveOccurred())
+		r, err = d.Payments().GetPayment(p.ID.Hex())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r).To(Equal(p))
+		Expect(database.reads).To(BeEquivalentTo(4))
+	})
+
+	It("invalidates payments when they are executed", func() {
+		_, err := d.Payments().GetPayment(p.ID.Hex())
+		Expect(err).NotTo(HaveOccurred())
+		_, err = d.ScheduledPayments().ExecutePayment(p, "foo", time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		r, err := d.Payments().GetPayment(p.ID.Hex())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Status).To(Equal(models.PaymentStatusExecuted))
+		Expect(database.reads).To(BeEquivalentTo(2))
+	})
+
+	It("caches payments separately per tenant", func() {
+		v, err := d.ForTenant("acme")
+		Expect(err).NotTo(HaveOccurred())
+		r, err := v.Payments().GetPayment(p.ID.Hex())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r).To(Equal(models.Payment{}))
+		r, err = d.Payments().GetPayment(p.ID.Hex())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r).To(Equal(p))
+	})
+
+	It("invalidates payments modified within a transaction once it completes", func() {
+		_, err := d.Payments().GetPayment(p.ID.Hex())
+		Expect(err).NotTo(HaveOccurred())
+		err = d.WithTransaction(context.Background(), func(tx db.Database) error {
+			_, err := tx.Payments().DeletePayment(p.ID.Hex())
+			Expect(err).NotTo(HaveOccurred())
+			// Reads within the transaction bypass the cache.
+			r, err := tx.Payments().GetPayment(p.ID.Hex())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r).To(Equal(models.Payment{}))
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		r, err := d.Payments().GetPayment(p.ID.Hex())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r).To(Equal(models.Payment{}))
+	})
+
+	It("coalesces concurrent lookups of the same payment", func() {
+		database.gate = make(chan struct{})
+		var (
+			wg sync.WaitGroup
+		)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				r, err := d.Payments().GetPayment(p.ID.Hex())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(r).To(Equal(p))
+			}()
+		}
+		Eventually(func() int32 { return atomic.LoadInt32(&database.reads) }).Should(BeEquivalentTo(1))
+		// Give the remaining lookups the chance to join the one in progress before letting it complete.
+		time.Sleep(50 * time.Millisecond)
+		close(database.gate)
+		wg.Wait()
+		Expect(database.reads).To(BeEquivalentTo(1))
+	})
+
+	It("keeps reading payments on behalf of concurrent lookups when the one that started reading them is canceled", func() {
+		database.gate = make(chan struct{})
+		ctx, cancel := context.WithCancel(context.Background())
+		errs := make(chan error, 1)
+		go func() {
+			_, err := d.WithContext(ctx).Payments().GetPayment(p.ID.Hex())
+			errs <- err
+		}()
+		Eventually(func() int32 { return atomic.LoadInt32(&database.reads) }).Should(BeEquivalentTo(1))
+		results := make(chan models.Payment, 1)
+		go func() {
+			defer GinkgoRecover()
+			r, err := d.Payments().GetPayment(p.ID.Hex())
+			Expect(err).NotTo(HaveOccurred())
+			results <- r
+		}()
+		// Give the other lookup the chance to join the one in progress before canceling the latter.
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+		var (
+			err error
+		)
+		Eventually(errs).Should(Receive(&err))
+		Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+		close(database.gate)
+		Eventually(results).Should(Receive(Equal(p)))
+		Expect(database.reads).To(BeEquivalentTo(1))
+	})
+})
@@ -0,0 +1,381 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+const (
+	// ResultHit is the outcome of a lookup for which the payment (or its absence) was found in the cache.
+	ResultHit = "hit"
+	// ResultMiss is the outcome of a lookup for which the payment had to be read from the database.
+	ResultMiss = "miss"
+)
+
+// Options configures how payments are cached.
+type Options struct {
+	// NegativeTTL is the amount of time for which the absence of a payment is cached (the absence of payments is not cached if zero).
+	NegativeTTL time.Duration
+	// OnLookup, if not nil, is called with the outcome of every lookup (i.e. ResultHit or ResultMiss).
+	OnLookup func(result string)
+	// TTL is the amount of time for which payments are cached.
+	TTL time.Duration
+}
+
+// entry is a cached lookup of a payment.
+type entry struct {
+	// Found indicates whether the payment was found.
+	Found bool `bson:"found"`
+	// Payment is the payment that was found, if any.
+	Payment models.Payment `bson:"payment"`
+}
+
+// cache holds the state shared by all views of a cached database.
+type cache struct {
+	// group coalesces concurrent lookups of the same payment.
+	group singleflight.Group
+	// invalidations counts the invalidations made so far, and allows for not caching payments which were read while being modified.
+	invalidations uint64
+	// opts are the options used to cache payments.
+	opts Options
+	// store is the store in which payments are cached.
+	store Store
+}
+
+// get returns the cached lookup with the specified key, and a value indicating whether it was found.
+// Failures to read from the store are logged and treated as misses, so that the database is used instead.
+func (c *cache) get(key string) (entry, bool) {
+	b, ok, err := c.store.Get(key)
+	if err != nil {
+		log.Warnf("failed to read %q from the cache: %v", key, err)
+		return entry{}, false
+	}
+	if !ok {
+		return entry{}, false
+	}
+	var (
+		e entry
+	)
+	if err := bson.Unmarshal(b, &e); err != nil {
+		log.Warnf("failed to decode %q from the cache: %v", key, err)
+		return entry{}, false
+	}
+	return e, true
+}
+
+// invalidate removes the cached lookup with the specified key, so that subsequent lookups read the payment from the database.
+// Failures to remove it from the store are logged, as the payment has already been modified.
+func (c *cache) invalidate(key string) {
+	atomic.AddUint64(&c.invalidations, 1)
+	c.group.Forget(key)
+	if err := c.store.Delete(key); err != nil {
+		log.Warnf("failed to invalidate %q in the cache: %v", key, err)
+	}
+}
+
+// observe reports the outcome of a lookup.
+func (c *cache) observe(result string) {
+	if c.opts.OnLookup != nil {
+		c.opts.OnLookup(result)
+	}
+}
+
+// set caches the provided lookup under the specified key.
+// Failures to write to the store are logged, as the payment can still be read from the database.
+func (c *cache) set(key string, e entry) {
+	ttl := c.opts.TTL
+	if !e.Found {
+		ttl = c.opts.NegativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	b, err := bson.Marshal(e)
+	if err != nil {
+		log.Warnf("failed to encode %q for the cache: %v", key, err)
+		return
+	}
+	if err := c.store.Set(key, b, ttl); err != nil {
+		log.Warnf("failed to write %q to the cache: %v", key, err)
+	}
+}
+
+// cachedDatabase is an implementation of db.Database that caches lookups of payments by ID made against the wrapped database.
+type cachedDatabase struct {
+	db.Database
+
+	// cache is the state shared by all views of the database.
+	cache *cache
+	// ctx is the context within which operations are performed.
+	ctx context.Context
+	// pending, if not nil, collects the keys of payments modified within a transaction, which are invalidated once it completes.
+	pending *[]string
+	// tenant is the tenant to which the payments being accessed belong, if any.
+	tenant string
+}
+
+// NewDatabase returns a view of the provided database that caches lookups of payments by ID in the provided store.
+// Cached payments are invalidated whenever they are modified through the returned view, and otherwise expire after the configured TTL.
+// Concurrent lookups of the same payment that miss the cache result in a single read from the database.
+func NewDatabase(database db.Database, store Store, opts Options) db.Database {
+	return &cachedDatabase{
+		Database: database,
+		cache: &cache{
+			opts:  opts,
+			store: store,
+		},
+		ctx: context.Background(),
+	}
+}
+
+// ForTenant returns a cached view of the database that only allows for accessing data belonging to the specified tenant.
+func (d *cachedDatabase) ForTenant(tenant string) (db.Database, error) {
+	v, err := d.Database.ForTenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+	return &cachedDatabase{
+		Database: v,
+		cache:    d.cache,
+		ctx:      d.ctx,
+		pending:  d.pending,
+		tenant:   tenant,
+	}, nil
+}
+
+// Payments allows for accessing methods used to perform CRUD operations on payments, whose lookups by ID are cached.
+func (d *cachedDatabase) Payments() db.PaymentsDatabase {
+	return &cachedPaymentsDatabase{
+		cache:    d.cache,
+		ctx:      d.ctx,
+		database: d.Database,
+		payments: d.Database.Payments(),
+		pending:  d.pending,
+		tenant:   d.tenant,
+	}
+}
+
+// ScheduledPayments allows for accessing methods used to execute scheduled payments, which invalidate the payments they execute.
+func (d *cachedDatabase) ScheduledPayments() db.ScheduledPaymentsDatabase {
+	return &cachedScheduledPaymentsDatabase{
+		cache:     d.cache,
+		pending:   d.pending,
+		scheduled: d.Database.ScheduledPayments(),
+	}
+}
+
+// WithContext returns a cached view of the database whose operations are performed within the provided context.
+func (d *cachedDatabase) WithContext(ctx context.Context) db.Database {
+	return &cachedDatabase{
+		Database: d.Database.WithContext(ctx),
+		cache:    d.cache,
+		ctx:      ctx,
+		pending:  d.pending,
+		tenant:   d.tenant,
+	}
+}
+
+// WithTransaction runs the provided function within a transaction, passing it a view of the database which bypasses the cache.
+// Payments modified within the transaction are invalidated once it completes, as they may have been modified regardless of its outcome.
+func (d *cachedDatabase) WithTransaction(ctx context.Context, fn func(tx db.Database) error) error {
+	if d.pending != nil {
+		return d.Database.WithTransaction(ctx, fn)
+	}
+	p := make([]string, 0)
+	defer func() {
+		for _, k := range p {
+			d.cache.invalidate(k)
+		}
+	}()
+	return d.Database.WithTransaction(ctx, func(tx db.Database) error {
+		return fn(&cachedDatabase{
+			Database: tx,
+			cache:    d.cache,
+			ctx:      d.ctx,
+			pending:  &p,
+			tenant:   d.tenant,
+		})
+	})
+}
+
+// cachedPaymentsDatabase is an implementation of db.PaymentsDatabase that caches lookups of payments by ID made against the wrapped one.
+type cachedPaymentsDatabase struct {
+	// cache is the state shared by all views of the database.
+	cache *cache
+	// ctx is the context within which operations are performed.
+	ctx context.Context
+	// database is the wrapped database, which is used to read payments on behalf of all concurrent lookups which missed the cache.
+	database db.Database
+	// payments is the wrapped database.
+	payments db.PaymentsDatabase
+	// pending, if not nil, collects the keys of payments modified within a transaction, which are invalidated once it completes.
+	pending *[]string
+	// tenant is the tenant to which the payments being accessed belong, if any.
+	tenant string
+}
+
+// CountPayments returns the number of registered payments, which is not cached.
+func (d *cachedPaymentsDatabase) CountPayments() (int64, error) {
+	return d.payments.CountPayments()
+}
+
+// CreatePayment creates the provided payment.
+func (d *cachedPaymentsDatabase) CreatePayment(p models.Payment) (models.Payment, error) {
+	r, err := d.payments.CreatePayment(p)
+	// Payments created with a given ID (e.g. when importing them) might have been cached as not found.
+	if err == nil {
+		d.invalidate(r.ID.Hex())
+	} else if !p.ID.IsZero() {
+		d.invalidate(p.ID.Hex())
+	}
+	return r, err
+}
+
+// DeletePayment deletes the payment with the specified ID.
+func (d *cachedPaymentsDatabase) DeletePayment(id string) (bool, error) {
+	r, err := d.payments.DeletePayment(id)
+	d.invalidate(id)
+	return r, err
+}
+
+// GetPayment returns the payment with the specified ID, reading it from the database only if it is not cached.
+func (d *cachedPaymentsDatabase) GetPayment(id string) (models.Payment, error) {
+	if d.pending != nil {
+		return d.payments.GetPayment(id)
+	}
+	k := key(d.tenant, id)
+	if e, ok := d.cache.get(k); ok {
+		d.cache.observe(ResultHit)
+		return e.Payment, nil
+	}
+	d.cache.observe(ResultMiss)
+	c := d.cache.group.DoChan(k, func() (interface{}, error) {
+		// The payment is read on behalf of all concurrent lookups, so it must not be canceled when the lookup that started reading it is.
+		ctx, fn := context.WithTimeout(context.WithoutCancel(d.ctx), constants.CacheLoadTimeout)
+		defer fn()
+		n := atomic.LoadUint64(&d.cache.invalidations)
+		p, err := d.database.WithContext(ctx).Payments().GetPayment(id)
+		if err != nil {
+			return nil, err
+		}
+		// Only cache the payment in case no payment was modified while it was being read, as it might be stale otherwise.
+		if atomic.LoadUint64(&d.cache.invalidations) == n {
+			d.cache.set(k, entry{Found: p != (models.Payment{}), Payment: p})
+		}
+		return p, nil
+	})
+	select {
+	case <-d.ctx.Done():
+		return models.Payment{}, fmt.Errorf("failed to get payment with id %q: %w", id, d.ctx.Err())
+	case r := <-c:
+		if r.Err != nil {
+			return models.Payment{}, r.Err
+		}
+		return r.Val.(models.Payment), nil
+	}
+}
+
+// ListPayments lists registered payments ordered by ID, skipping the specified number of payments and returning at most the specified number of them.
+// Listings are not cached.
+func (d *cachedPaymentsDatabase) ListPayments(offset, limit int) ([]models.Payment, error) {
+	return d.payments.ListPayments(offset, limit)
+}
+
+// RestorePayment restores the deleted payment with the specified ID.
+func (d *cachedPaymentsDatabase) RestorePayment(id string) (bool, error) {
+	r, err := d.payments.RestorePayment(id)
+	d.invalidate(id)
+	return r, err
+}
+
+// SearchPayments lists registered payments matching the provided filter ordered by ID, skipping the specified number of payments and returning at most the specified number of them, together with the total number of matching payments.
+// Searches are not cached.
+func (d *cachedPaymentsDatabase) SearchPayments(f db.PaymentsFilter, offset, limit int) ([]models.Payment, int64, error) {
+	return d.payments.SearchPayments(f, offset, limit)
+}
+
+// UpdatePayment updates the payment with the specified ID.
+func (d *cachedPaymentsDatabase) UpdatePayment(id string, p models.Payment) (models.Payment, error) {
+	r, err := d.payments.UpdatePayment(id, p)
+	d.invalidate(id)
+	return r, err
+}
+
+// invalidate invalidates the payment with the specified ID, or records it for invalidation once the current transaction completes.
+// Payments are invalidated even if modifying them fails, as the outcome of a failed operation is not always known.
+func (d *cachedPaymentsDatabase) invalidate(id string) {
+	k := key(d.tenant, id)
+	if d.pending != nil {
+		*d.pending = append(*d.pending, k)
+		return
+	}
+	d.cache.invalidate(k)
+}
+
+// cachedScheduledPaymentsDatabase is an implementation of db.ScheduledPaymentsDatabase that invalidates the payments executed through the wrapped one.
+type cachedScheduledPaymentsDatabase struct {
+	// cache is the state shared by all views of the database.
+	cache *cache
+	// pending, if not nil, collects the keys of payments modified within a transaction, which are invalidated once it completes.
+	pending *[]string
+	// scheduled is the wrapped database.
+	scheduled db.ScheduledPaymentsDatabase
+}
+
+// AdvanceStandingOrder saves the state of the provided (claimed) standing order after a payment has been generated from it, and releases the lease held on it by the specified owner.
+// Standing orders are not cached.
+func (d *cachedScheduledPaymentsDatabase) AdvanceStandingOrder(o models.StandingOrder, owner string) (models.StandingOrder, error) {
+	return d.scheduled.AdvanceStandingOrder(o, owner)
+}
+
+// ClaimDuePayment leases a scheduled payment whose date is not after the provided time on behalf of the specified owner, for the provided duration.
+// Leases are not visible to clients, so the claimed payment is not invalidated.
+func (d *cachedScheduledPaymentsDatabase) ClaimDuePayment(owner string, now time.Time, lease time.Duration) (models.Payment, error) {
+	return d.scheduled.ClaimDuePayment(owner, now, lease)
+}
+
+// ClaimDueStandingOrder leases an active standing order whose next occurrence is not after the provided time on behalf of the specified owner, for the provided duration.
+// Standing orders are not cached.
+func (d *cachedScheduledPaymentsDatabase) ClaimDueStandingOrder(owner string, now time.Time, lease time.Duration) (models.StandingOrder, error) {
+	return d.scheduled.ClaimDueStandingOrder(owner, now, lease)
+}
+
+// ExecutePayment marks the provided (claimed) payment as having been executed at the provided time, and releases the lease held on it by the specified owner.
+func (d *cachedScheduledPaymentsDatabase) ExecutePayment(p models.Payment, owner string, now time.Time) (models.Payment, error) {
+	r, err := d.scheduled.ExecutePayment(p, owner, now)
+	k := key(p.Tenant, p.ID.Hex())
+	if d.pending != nil {
+		*d.pending = append(*d.pending, k)
+	} else {
+		d.cache.invalidate(k)
+	}
+	return r, err
+}
+
+// key returns the key under which the payment with the specified ID, belonging to the specified tenant, is cached.
+func key(tenant, id string) string {
+	return fmt.Sprintf("payments/%s/%s", tenant, id)
+}
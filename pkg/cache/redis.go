@@ -0,0 +1,82 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+)
+
+const (
+	// redisKeyPrefix is the prefix of the keys under which values are stored in Redis.
+	redisKeyPrefix = "dojo-payments:"
+)
+
+// redisStore is an implementation of Store that keeps values in Redis (or any server compatible with it), so that they are shared between instances of the API server.
+type redisStore struct {
+	// client is the client used to access Redis.
+	client *redis.Client
+}
+
+// NewRedisStore returns a new Store that keeps values in the Redis server at the specified URL (e.g. "redis://localhost:6379/0").
+// Values are evicted according to the eviction policy configured in the server.
+func NewRedisStore(redisURL string) (Store, error) {
+	o, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the redis url: %v", err)
+	}
+	return &redisStore{
+		client: redis.NewClient(o),
+	}, nil
+}
+
+// Delete removes the value with the specified key, if any.
+func (s *redisStore) Delete(key string) error {
+	ctx, fn := context.WithTimeout(context.Background(), constants.CacheOperationTimeout)
+	defer fn()
+	if err := s.client.Del(ctx, redisKeyPrefix+key).Err(); err != nil {
+		return fmt.Errorf("failed to delete %q from redis: %v", key, err)
+	}
+	return nil
+}
+
+// Get returns the value with the specified key, and a value indicating whether it was found.
+func (s *redisStore) Get(key string) ([]byte, bool, error) {
+	ctx, fn := context.WithTimeout(context.Background(), constants.CacheOperationTimeout)
+	defer fn()
+	v, err := s.client.Get(ctx, redisKeyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get %q from redis: %v", key, err)
+	}
+	return v, true, nil
+}
+
+// Set stores the provided value under the specified key, for the specified amount of time.
+func (s *redisStore) Set(key string, value []byte, ttl time.Duration) error {
+	ctx, fn := context.WithTimeout(context.Background(), constants.CacheOperationTimeout)
+	defer fn()
+	if err := s.client.Set(ctx, redisKeyPrefix+key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set %q in redis: %v", key, err)
+	}
+	return nil
+}
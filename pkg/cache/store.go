@@ -0,0 +1,115 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Store stores cached values.
+type Store interface {
+	// Delete removes the value with the specified key, if any.
+	Delete(key string) error
+	// Get returns the value with the specified key, and a value indicating whether it was found (and has not expired).
+	Get(key string) ([]byte, bool, error)
+	// Set stores the provided value under the specified key, for the specified amount of time.
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// memoryEntry is a value stored in memory.
+type memoryEntry struct {
+	// expiresAt is the date at which the value expires.
+	expiresAt time.Time
+	// key is the key under which the value is stored.
+	key string
+	// value is the stored value.
+	value []byte
+}
+
+// memoryStore is an implementation of Store that keeps values in memory, evicting the least recently used ones when full.
+type memoryStore struct {
+	// entries are the elements of order, indexed by key.
+	entries map[string]*list.Element
+	// lock protects the fields of the store.
+	lock sync.Mutex
+	// maxEntries is the maximum number of values to keep.
+	maxEntries int
+	// order holds the stored values, from the most to the least recently used one.
+	order *list.List
+}
+
+// NewMemoryStore returns a new Store that keeps at most the specified number of values in memory.
+// Values are only cached per instance of the API server.
+func NewMemoryStore(maxEntries int) Store {
+	return &memoryStore{
+		entries:    make(map[string]*list.Element),
+		maxEntries: maxEntries,
+		order:      list.New(),
+	}
+}
+
+// Delete removes the value with the specified key, if any.
+func (s *memoryStore) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e, ok := s.entries[key]; ok {
+		s.remove(e)
+	}
+	return nil
+}
+
+// Get returns the value with the specified key, marking it as the most recently used one.
+func (s *memoryStore) Get(key string) ([]byte, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if time.Now().After(e.Value.(*memoryEntry).expiresAt) {
+		s.remove(e)
+		return nil, false, nil
+	}
+	s.order.MoveToFront(e)
+	return e.Value.(*memoryEntry).value, true, nil
+}
+
+// Set stores the provided value under the specified key, evicting the least recently used value if the store is full.
+func (s *memoryStore) Set(key string, value []byte, ttl time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	v := &memoryEntry{
+		expiresAt: time.Now().Add(ttl),
+		key:       key,
+		value:     value,
+	}
+	if e, ok := s.entries[key]; ok {
+		e.Value = v
+		s.order.MoveToFront(e)
+		return nil
+	}
+	s.entries[key] = s.order.PushFront(v)
+	for s.order.Len() > s.maxEntries {
+		s.remove(s.order.Back())
+	}
+	return nil
+}
+
+// remove removes the provided element from the store.
+func (s *memoryStore) remove(e *list.Element) {
+	s.order.Remove(e)
+	delete(s.entries, e.Value.(*memoryEntry).key)
+}
@@ -0,0 +1,274 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bmcstdio/dojo-payments/pkg/api"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/pkg/signing"
+)
+
+const (
+	// defaultMaxRetries is the default number of times a failed idempotent request is retried.
+	defaultMaxRetries = 3
+	// defaultPageSize is the default number of payments fetched per request when listing payments.
+	defaultPageSize = 100
+	// defaultRetryBackoff is the default amount of time to wait before retrying a failed request for the first time.
+	defaultRetryBackoff = 100 * time.Millisecond
+	// defaultTimeout is the default timeout for each request.
+	defaultTimeout = 10 * time.Second
+)
+
+// Client is a client for the Payments API.
+type Client struct {
+	// apiKey is the API key sent in the "X-API-Key" header of every request, if any.
+	apiKey string
+	// baseURL is the base URL at which the API server can be reached.
+	baseURL string
+	// bearerToken is the token sent in the "Authorization" header of every request, if any.
+	bearerToken string
+	// hmacHeaders are the headers signed in addition to the method, path, query and body of every request.
+	hmacHeaders []string
+	// hmacKeyID is the ID of the key used to sign every request, if any.
+	hmacKeyID string
+	// hmacSecret is the secret used to sign every request, if any.
+	hmacSecret []byte
+	// httpClient is the HTTP client used to make requests.
+	httpClient *http.Client
+	// maxRetries is the number of times a failed idempotent request is retried.
+	maxRetries int
+	// pageSize is the number of payments fetched per request when listing payments.
+	pageSize int
+	// retryBackoff is the amount of time to wait before retrying a failed request for the first time, doubling on every subsequent attempt.
+	retryBackoff time.Duration
+	// timeout is the timeout for each request.
+	timeout time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithAPIKey configures the client to authenticate every request using the provided API key.
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithBearerToken configures the client to authenticate every request using the provided bearer token (e.g. a JWT).
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.bearerToken = token
+	}
+}
+
+// WithHMACSigning configures the client to sign every request on behalf of the specified key using the provided secret.
+// The method, path, query and body of every request are signed, together with the specified headers (e.g. "host" and "content-type").
+func WithHMACSigning(keyID string, secret []byte, headers ...string) Option {
+	return func(c *Client) {
+		c.hmacHeaders = headers
+		c.hmacKeyID = keyID
+		c.hmacSecret = secret
+	}
+}
+
+// WithHTTPClient configures the client to make requests using the provided HTTP client.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithPageSize configures the number of payments fetched per request when listing payments.
+func WithPageSize(pageSize int) Option {
+	return func(c *Client) {
+		c.pageSize = pageSize
+	}
+}
+
+// WithRetries configures the number of times a failed idempotent request is retried, and the amount of time to wait before retrying it for the first time.
+// Requests are retried in case of network errors or of "5xx" responses, and the backoff doubles on every attempt.
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryBackoff = backoff
+	}
+}
+
+// WithTimeout configures the timeout for each request.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// New returns a new instance of Client for the API server reachable at the provided base URL.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		httpClient:   http.DefaultClient,
+		maxRetries:   defaultMaxRetries,
+		pageSize:     defaultPageSize,
+		retryBackoff: defaultRetryBackoff,
+		timeout:      defaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// CreatePayment creates the provided payment.
+func (c *Client) CreatePayment(ctx context.Context, p models.Payment) (models.Payment, error) {
+	r := models.Payment{}
+	if _, err := c.do(ctx, http.MethodPost, api.PaymentsBasePath, p, &r); err != nil {
+		return models.Payment{}, err
+	}
+	return r, nil
+}
+
+// DeletePayment deletes the payment with the specified ID.
+func (c *Client) DeletePayment(ctx context.Context, id string) error {
+	_, err := c.do(ctx, http.MethodDelete, api.PaymentsBasePath+"/"+url.PathEscape(id), nil, nil)
+	return err
+}
+
+// GetPayment returns the payment with the specified ID.
+func (c *Client) GetPayment(ctx context.Context, id string) (models.Payment, error) {
+	r := models.Payment{}
+	if _, err := c.do(ctx, http.MethodGet, api.PaymentsBasePath+"/"+url.PathEscape(id), nil, &r); err != nil {
+		return models.Payment{}, err
+	}
+	return r, nil
+}
+
+// Health returns the status of the API server.
+func (c *Client) Health(ctx context.Context) (api.APIServerRootResponse, error) {
+	r := api.APIServerRootResponse{}
+	if _, err := c.do(ctx, http.MethodGet, "/", nil, &r); err != nil {
+		return api.APIServerRootResponse{}, err
+	}
+	return r, nil
+}
+
+// ListPayments returns an iterator over all registered payments, which are fetched one page at a time as needed.
+func (c *Client) ListPayments(ctx context.Context) *PaymentIterator {
+	return &PaymentIterator{
+		client: c,
+		ctx:    ctx,
+	}
+}
+
+// UpdatePayment updates the payment with the specified ID.
+func (c *Client) UpdatePayment(ctx context.Context, id string, p models.Payment) (models.Payment, error) {
+	r := models.Payment{}
+	if _, err := c.do(ctx, http.MethodPut, api.PaymentsBasePath+"/"+url.PathEscape(id), p, &r); err != nil {
+		return models.Payment{}, err
+	}
+	return r, nil
+}
+
+// do makes a request with the specified method, path and (JSON) body, decoding the response's body into the provided value.
+// Idempotent requests are retried in case of network errors or of "5xx" responses.
+func (c *Client) do(ctx context.Context, method, path string, body, v interface{}) (http.Header, error) {
+	var (
+		b []byte
+	)
+	if body != nil {
+		r, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request body: %v", err)
+		}
+		b = r
+	}
+	attempts := 1
+	if method != http.MethodPost {
+		attempts += c.maxRetries
+	}
+	backoff := c.retryBackoff
+	for i := 1; ; i++ {
+		h, retryable, err := c.doOnce(ctx, method, path, b, v)
+		if err == nil || !retryable || i >= attempts {
+			return h, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+}
+
+// doOnce makes a single request, returning a value indicating whether it may be retried in case it fails.
+func (c *Client) doOnce(ctx context.Context, method, path string, body []byte, v interface{}) (http.Header, bool, error) {
+	ctx, fn := context.WithTimeout(ctx, c.timeout)
+	defer fn()
+	var (
+		r io.Reader
+	)
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, r)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create request: %v", err)
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set(api.APIKeyHeader, c.apiKey)
+	}
+	if c.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	}
+	// Sign every attempt separately, as each must carry a different nonce.
+	if c.hmacKeyID != "" {
+		if err := signing.Sign(req, c.hmacKeyID, c.hmacSecret, c.hmacHeaders, time.Now()); err != nil {
+			return nil, false, fmt.Errorf("failed to sign request: %v", err)
+		}
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to make request: %v", err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to read response body: %v", err)
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		return nil, res.StatusCode >= http.StatusInternalServerError, newError(res.StatusCode, b)
+	}
+	if v != nil {
+		if err := json.Unmarshal(b, v); err != nil {
+			return nil, false, fmt.Errorf("failed to decode response body: %v", err)
+		}
+	}
+	return res.Header, false, nil
+}
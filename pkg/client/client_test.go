@@ -0,0 +1,162 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/bmcstdio/dojo-payments/pkg/api"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/pkg/signing"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		handler  http.HandlerFunc
+		requests int32
+		srv      *httptest.Server
+	)
+
+	BeforeEach(func() {
+		atomic.StoreInt32(&requests, 0)
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			handler(w, r)
+		}))
+	})
+
+	AfterEach(func() {
+		srv.Close()
+	})
+
+	It("decodes errors returned by the api server", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"payment not found"}`))
+		}
+		_, err := New(srv.URL).GetPayment(context.Background(), primitive.NewObjectID().Hex())
+		Expect(IsNotFound(err)).To(BeTrue())
+		Expect(err.(*Error).Message).To(Equal("payment not found"))
+	})
+
+	It("escapes ids when building paths", func() {
+		var (
+			path string
+		)
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.EscapedPath()
+			w.WriteHeader(http.StatusNotFound)
+		}
+		_, err := New(srv.URL).GetPayment(context.Background(), "../admin/apikeys?x=1")
+		Expect(IsNotFound(err)).To(BeTrue())
+		Expect(path).To(Equal(api.PaymentsBasePath + "/..%2Fadmin%2Fapikeys%3Fx=1"))
+	})
+
+	It("retries idempotent requests which fail with a server error", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		_, err := New(srv.URL, WithRetries(2, time.Millisecond)).GetPayment(context.Background(), primitive.NewObjectID().Hex())
+		Expect(err).To(HaveOccurred())
+		Expect(atomic.LoadInt32(&requests)).To(BeEquivalentTo(3))
+	})
+
+	It("does not retry requests to create payments", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		_, err := New(srv.URL, WithRetries(2, time.Millisecond)).CreatePayment(context.Background(), models.Payment{})
+		Expect(err).To(HaveOccurred())
+		Expect(atomic.LoadInt32(&requests)).To(BeEquivalentTo(1))
+	})
+
+	It("does not retry requests which fail with a client error", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		_, err := New(srv.URL, WithRetries(2, time.Millisecond)).UpdatePayment(context.Background(), primitive.NewObjectID().Hex(), models.Payment{})
+		Expect(IsBadRequest(err)).To(BeTrue())
+		Expect(atomic.LoadInt32(&requests)).To(BeEquivalentTo(1))
+	})
+
+	It("fetches all pages when listing payments", func() {
+		all := make([]models.Payment, 5)
+		for i := range all {
+			all[i] = models.Payment{ID: primitive.NewObjectID()}
+		}
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			limit, _ := strconv.Atoi(r.URL.Query().Get(api.LimitQueryParam))
+			offset, _ := strconv.Atoi(r.URL.Query().Get(api.OffsetQueryParam))
+			end := offset + limit
+			if end > len(all) {
+				end = len(all)
+			}
+			w.Header().Set(api.TotalCountHeader, strconv.Itoa(len(all)))
+			_ = json.NewEncoder(w).Encode(all[offset:end])
+		}
+		r, err := New(srv.URL, WithPageSize(2)).ListPayments(context.Background()).All()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r).To(HaveLen(len(all)))
+		for i := range all {
+			Expect(r[i].ID).To(Equal(all[i].ID))
+		}
+		Expect(atomic.LoadInt32(&requests)).To(BeEquivalentTo(3))
+	})
+
+	It("signs every attempt of a request using a different nonce", func() {
+		nonces := make(map[string]bool)
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			id, nonce, err := signing.Verify(r, func(string) ([]byte, error) {
+				return []byte("secret"), nil
+			}, time.Now(), time.Minute, 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).To(Equal("partner"))
+			nonces[nonce] = true
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		_, err := New(srv.URL, WithRetries(1, time.Millisecond), WithHMACSigning("partner", []byte("secret"), "host")).UpdatePayment(context.Background(), primitive.NewObjectID().Hex(), models.Payment{})
+		Expect(err).To(HaveOccurred())
+		Expect(nonces).To(HaveLen(2))
+	})
+
+	It("authenticates requests using the provided api key", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Header.Get("X-API-Key")).To(Equal("dp_key"))
+			_, _ = w.Write([]byte(`{"database_status":"ONLINE"}`))
+		}
+		_, err := New(srv.URL, WithAPIKey("dp_key")).Health(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("uses the provided http client", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+		}
+		_, err := New(srv.URL, WithRetries(0, 0), WithHTTPClient(&http.Client{Timeout: 10 * time.Millisecond})).Health(context.Background())
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,66 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Error represents an error returned by the API server.
+type Error struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int `json:"-"`
+	// Message is the error message returned by the API server.
+	Message string `json:"message"`
+}
+
+// Error returns a string representation of the current error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// newError returns a new instance of Error given the status code and body of a response.
+func newError(statusCode int, body []byte) *Error {
+	e := &Error{}
+	if err := json.Unmarshal(body, e); err != nil || e.Message == "" {
+		// The response's body does not contain an error message, so we use its contents (if any) as is.
+		e.Message = string(body)
+	}
+	e.StatusCode = statusCode
+	return e
+}
+
+// IsBadRequest returns a value indicating whether the provided error was caused by the API server deeming the request invalid.
+func IsBadRequest(err error) bool {
+	return hasStatusCode(err, http.StatusBadRequest)
+}
+
+// IsConflict returns a value indicating whether the provided error was caused by the request conflicting with the current state of the requested resource.
+func IsConflict(err error) bool {
+	return hasStatusCode(err, http.StatusConflict)
+}
+
+// IsNotFound returns a value indicating whether the provided error was caused by the requested resource not existing.
+func IsNotFound(err error) bool {
+	return hasStatusCode(err, http.StatusNotFound)
+}
+
+// hasStatusCode returns a value indicating whether the provided error is an Error with the specified status code.
+func hasStatusCode(err error, statusCode int) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == statusCode
+}
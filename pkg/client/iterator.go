@@ -0,0 +1,101 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/bmcstdio/dojo-payments/pkg/api"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+// PaymentIterator iterates over registered payments, fetching them one page at a time as needed.
+type PaymentIterator struct {
+	// client is the client used to fetch pages.
+	client *Client
+	// ctx is the context used to fetch pages.
+	ctx context.Context
+	// current is the payment at which the iterator is positioned.
+	current models.Payment
+	// done indicates whether the last page has been fetched.
+	done bool
+	// err is the error that caused iteration to stop, if any.
+	err error
+	// offset is the offset of the next page to fetch.
+	offset int
+	// page contains the payments in the current page which have not been iterated over yet.
+	page []models.Payment
+}
+
+// Next advances the iterator to the next payment, returning false when there are no more payments or an error has occurred.
+func (it *PaymentIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if len(it.page) == 0 {
+		if it.done {
+			return false
+		}
+		if it.err = it.fetch(); it.err != nil || len(it.page) == 0 {
+			return false
+		}
+	}
+	it.current, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Payment returns the payment at which the iterator is positioned.
+func (it *PaymentIterator) Payment() models.Payment {
+	return it.current
+}
+
+// Err returns the error that caused iteration to stop, if any.
+func (it *PaymentIterator) Err() error {
+	return it.err
+}
+
+// All iterates over all remaining payments and returns them.
+func (it *PaymentIterator) All() ([]models.Payment, error) {
+	r := make([]models.Payment, 0)
+	for it.Next() {
+		r = append(r, it.Payment())
+	}
+	return r, it.Err()
+}
+
+// fetch fetches the next page of payments.
+func (it *PaymentIterator) fetch() error {
+	q := url.Values{}
+	q.Set(api.LimitQueryParam, strconv.Itoa(it.client.pageSize))
+	q.Set(api.OffsetQueryParam, strconv.Itoa(it.offset))
+	r := make([]models.Payment, 0)
+	h, err := it.client.do(it.ctx, http.MethodGet, api.PaymentsBasePath+"?"+q.Encode(), nil, &r)
+	if err != nil {
+		return err
+	}
+	it.offset += len(r)
+	it.page = r
+	// Stop fetching pages once the total number of payments has been reached, or in case a short page is returned.
+	total, err := strconv.Atoi(h.Get(api.TotalCountHeader))
+	if err != nil {
+		return fmt.Errorf("failed to parse the total number of payments: %v", err)
+	}
+	it.done = it.offset >= total || len(r) < it.client.pageSize
+	return nil
+}
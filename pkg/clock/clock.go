@@ -0,0 +1,119 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the current time and waits for time to pass.
+type Clock interface {
+	// After returns a channel on which the current time is sent once the provided duration has elapsed.
+	After(time.Duration) <-chan time.Time
+	// Now returns the current time.
+	Now() time.Time
+}
+
+// realClock is an implementation of Clock backed by the system clock.
+type realClock struct{}
+
+// Real returns a Clock backed by the system clock.
+func Real() Clock {
+	return realClock{}
+}
+
+// After returns a channel on which the current time is sent once the provided duration has elapsed.
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Now returns the current time.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Fake is an implementation of Clock whose time only passes when advanced explicitly, so that tests can control it deterministically.
+type Fake struct {
+	// mu guards access to the fields below.
+	mu sync.Mutex
+	// now is the current time.
+	now time.Time
+	// waiters are the channels waiting for time to pass, sorted by the time at which they fire.
+	waiters []waiter
+}
+
+// waiter is a channel waiting for the time of a fake clock to reach a given point.
+type waiter struct {
+	// at is the time at which the channel fires.
+	at time.Time
+	// c is the channel on which the time is sent.
+	c chan time.Time
+}
+
+// NewFake returns a fake clock whose current time is the provided one.
+func NewFake(now time.Time) *Fake {
+	return &Fake{
+		now: now,
+	}
+}
+
+// Advance moves the current time forward by the provided duration, firing the channels returned by After which are due.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	n := 0
+	for _, w := range f.waiters {
+		if w.at.After(f.now) {
+			break
+		}
+		w.c <- f.now
+		n++
+	}
+	f.waiters = f.waiters[n:]
+}
+
+// After returns a channel on which the current time is sent once the clock has been advanced by (at least) the provided duration.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// Buffer the channel so that advancing the clock never blocks.
+	c := make(chan time.Time, 1)
+	if d <= 0 {
+		c <- f.now
+		return c
+	}
+	f.waiters = append(f.waiters, waiter{at: f.now.Add(d), c: c})
+	sort.SliceStable(f.waiters, func(i, j int) bool {
+		return f.waiters[i].at.Before(f.waiters[j].at)
+	})
+	return c
+}
+
+// Now returns the current time.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Waiters returns the number of channels returned by After which have not fired yet.
+// It allows tests to wait until the code under test is waiting for time to pass before advancing the clock.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package clock
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fake clock", func() {
+	var (
+		f   *Fake
+		now time.Time
+	)
+
+	BeforeEach(func() {
+		now = time.Date(2019, 4, 30, 22, 30, 0, 0, time.UTC)
+		f = NewFake(now)
+	})
+
+	It("only moves forward when advanced", func() {
+		Expect(f.Now()).To(Equal(now))
+		f.Advance(time.Minute)
+		Expect(f.Now()).To(Equal(now.Add(time.Minute)))
+	})
+
+	It("fires channels once the clock has been advanced past them, in order", func() {
+		a := f.After(2 * time.Second)
+		b := f.After(time.Second)
+		Expect(f.Waiters()).To(Equal(2))
+
+		f.Advance(time.Second)
+		Expect(b).To(Receive(Equal(now.Add(time.Second))))
+		Expect(a).NotTo(Receive())
+		Expect(f.Waiters()).To(Equal(1))
+
+		f.Advance(5 * time.Second)
+		Expect(a).To(Receive(Equal(now.Add(6 * time.Second))))
+		Expect(f.Waiters()).To(BeZero())
+	})
+
+	It("fires channels right away for non-positive durations", func() {
+		Expect(f.After(0)).To(Receive(Equal(now)))
+		Expect(f.Waiters()).To(BeZero())
+	})
+})
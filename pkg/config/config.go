@@ -0,0 +1,183 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// EnvPrefix is the prefix of the names of the environment variables from which configuration is read.
+	EnvPrefix = "DOJO_PAYMENTS_"
+	// FileFlagName is the name of the flag holding the path to the configuration file, if any.
+	FileFlagName = "config"
+	// secretFileSuffix is the suffix of the keys whose values are read from the file at the path they hold.
+	secretFileSuffix = "-file"
+)
+
+// Load sets the flags in the provided flag set from a configuration file, from environment variables and from the provided command-line arguments, in increasing order of precedence.
+// The configuration file is the YAML (".yaml" or ".yml") or TOML (".toml") file at the path held by the flag named FileFlagName (if defined and set), whose keys are the names of the flags.
+// Environment variables are named after the flags, prefixed with EnvPrefix (e.g. "DOJO_PAYMENTS_MONGODB_URL" for "--mongodb-url").
+// The value of a flag "<name>" may also be read from the file at the path held by the key "<name>-file" (e.g. "DOJO_PAYMENTS_MONGODB_URL_FILE"), as long as no such flag exists, so that secrets need not be stored in the configuration file or in the environment.
+func Load(fs *flag.FlagSet, args []string, environ []string) error {
+	// Parse the command-line arguments first so that the flags they set can be left untouched.
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	// Collect the values of the environment variables that correspond to flags.
+	env, err := fromEnviron(fs, environ)
+	if err != nil {
+		return err
+	}
+	// Determine the path to the configuration file, giving precedence to the command-line arguments over the environment.
+	if v, ok := env[FileFlagName]; ok && !set[FileFlagName] {
+		if err := apply(fs, FileFlagName, v); err != nil {
+			return err
+		}
+	}
+	// Read the configuration file, if any, applying the values of the flags which are not set otherwise.
+	if f := fs.Lookup(FileFlagName); f != nil && f.Value.String() != "" {
+		file, err := fromFile(fs, f.Value.String())
+		if err != nil {
+			return err
+		}
+		for n, v := range file {
+			if _, ok := env[n]; ok || set[n] {
+				continue
+			}
+			if err := apply(fs, n, v); err != nil {
+				return err
+			}
+		}
+	}
+	// Overlay the environment variables.
+	for n, v := range env {
+		if set[n] {
+			continue
+		}
+		if err := apply(fs, n, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value is the value of a flag, together with a description of where it was read from.
+type value struct {
+	// source describes where the value was read from.
+	source string
+	// value is the actual value.
+	value string
+}
+
+// apply sets the specified flag to the provided value.
+func apply(fs *flag.FlagSet, name string, v value) error {
+	if err := fs.Set(name, v.value); err != nil {
+		return fmt.Errorf("invalid value %q for %q (from %s): %v", v.value, name, v.source, err)
+	}
+	return nil
+}
+
+// fromEnviron returns the values of the environment variables that correspond to flags in the provided flag set, indexed by the name of the flag.
+func fromEnviron(fs *flag.FlagSet, environ []string) (map[string]value, error) {
+	r := make(map[string]value)
+	for _, kv := range environ {
+		p := strings.SplitN(kv, "=", 2)
+		if len(p) != 2 || !strings.HasPrefix(p[0], EnvPrefix) {
+			continue
+		}
+		k := strings.ToLower(strings.Replace(strings.TrimPrefix(p[0], EnvPrefix), "_", "-", -1))
+		n, v, err := resolve(fs, k, p[1], fmt.Sprintf("environment variable %s", p[0]))
+		if err != nil {
+			return nil, err
+		}
+		if n == "" {
+			// Ignore environment variables which do not correspond to any flag, as they may be meant for other purposes.
+			continue
+		}
+		r[n] = v
+	}
+	return r, nil
+}
+
+// fromFile returns the values held in the configuration file at the specified path, indexed by the name of the flag.
+func fromFile(fs *flag.FlagSet, path string) (map[string]value, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the configuration file: %v", err)
+	}
+	m := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &m)
+	case ".toml":
+		_, err = toml.Decode(string(b), &m)
+	default:
+		return nil, fmt.Errorf("unsupported format of configuration file %q (must be yaml or toml)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the configuration file %q: %v", path, err)
+	}
+	r := make(map[string]value, len(m))
+	for k, raw := range m {
+		var (
+			s string
+		)
+		switch raw.(type) {
+		case map[interface{}]interface{}, map[string]interface{}, []interface{}, []map[string]interface{}:
+			return nil, fmt.Errorf("invalid value for %q in %s (must be a scalar)", k, path)
+		case nil:
+			continue
+		default:
+			s = fmt.Sprint(raw)
+		}
+		n, v, err := resolve(fs, k, s, path)
+		if err != nil {
+			return nil, err
+		}
+		if n == "" {
+			return nil, fmt.Errorf("unknown key %q in %s", k, path)
+		}
+		r[n] = v
+	}
+	return r, nil
+}
+
+// resolve returns the name of the flag corresponding to the provided key and its value, reading the value from a file in case the key refers to one.
+// The empty name is returned in case the key does not correspond to any flag.
+func resolve(fs *flag.FlagSet, key, v, source string) (string, value, error) {
+	if fs.Lookup(key) != nil {
+		return key, value{source: source, value: v}, nil
+	}
+	n := strings.TrimSuffix(key, secretFileSuffix)
+	if n == key || fs.Lookup(n) == nil {
+		return "", value{}, nil
+	}
+	b, err := ioutil.ReadFile(v)
+	if err != nil {
+		return "", value{}, fmt.Errorf("failed to read the value of %q (from %s): %v", n, source, err)
+	}
+	return n, value{source: fmt.Sprintf("%s (via %s)", v, source), value: strings.TrimSpace(string(b))}, nil
+}
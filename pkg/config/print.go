@@ -0,0 +1,122 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// redacted is the value printed in place of secrets.
+	redacted = "REDACTED"
+)
+
+var (
+	// sensitiveQueryParameters holds fragments of the (lowercase) names of URL query parameters whose values are considered secret (e.g. "password", "authMechanismProperties" or "tlsCertificateKeyFilePassword").
+	sensitiveQueryParameters = []string{"auth", "credential", "key", "pass", "secret", "token"}
+)
+
+// Print writes the effective configuration held in the provided flag set to the provided writer, as a YAML document which can be used as a configuration file.
+// The values of the specified flags are considered secret, and are redacted.
+func Print(w io.Writer, fs *flag.FlagSet, secrets ...string) error {
+	s := make(map[string]bool, len(secrets))
+	for _, n := range secrets {
+		s[n] = true
+	}
+	// Flags are visited in lexicographical order, so keys are printed in that order too.
+	m := make(yaml.MapSlice, 0)
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == FileFlagName {
+			return
+		}
+		var (
+			v interface{}
+		)
+		if s[f.Name] {
+			v = redact(f.Value.String())
+		} else {
+			v = typed(f)
+		}
+		m = append(m, yaml.MapItem{Key: f.Name, Value: v})
+	})
+	b, err := yaml.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the configuration: %v", err)
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// redact returns the provided secret in a form which is safe to print.
+// Only the password and the values of sensitive query parameters are redacted from URLs so that it remains possible to tell which server is being used.
+func redact(v string) string {
+	if v == "" {
+		return v
+	}
+	if u, err := url.Parse(v); err == nil && u.Scheme != "" && u.Host != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		if u.RawQuery != "" {
+			q, err := url.ParseQuery(u.RawQuery)
+			if err != nil {
+				// The query cannot be parsed, so there is no telling which parts of it are secret.
+				u.RawQuery = redacted
+				return u.String()
+			}
+			for k := range q {
+				if isSensitiveQueryParameter(k) {
+					q[k] = []string{redacted}
+				}
+			}
+			u.RawQuery = q.Encode()
+		}
+		return u.String()
+	}
+	return redacted
+}
+
+// isSensitiveQueryParameter returns a value indicating whether the value of the URL query parameter with the provided name is considered secret.
+func isSensitiveQueryParameter(name string) bool {
+	n := strings.ToLower(name)
+	for _, f := range sensitiveQueryParameters {
+		if strings.Contains(n, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// typed returns the value of the provided flag as a boolean or a number whenever it is one, so that it is printed as such.
+func typed(f *flag.Flag) interface{} {
+	g, ok := f.Value.(flag.Getter)
+	if !ok {
+		return f.Value.String()
+	}
+	switch v := g.Get().(type) {
+	case bool, float64, int, int64, uint, uint64:
+		return v
+	case time.Duration:
+		return v.String()
+	default:
+		return f.Value.String()
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package constants
+
+import (
+	"time"
+)
+
+const (
+	// CacheLoadTimeout is the timeout to use when reading a payment from the database on behalf of all concurrent lookups which missed the cache.
+	CacheLoadTimeout = 10 * time.Second
+	// CacheOperationTimeout is the timeout to use when performing operations against a remote cache.
+	CacheOperationTimeout = 100 * time.Millisecond
+)
@@ -17,4 +17,10 @@ package constants
 const (
 	// DatabaseContextKey is the name of the Echo context key that contains the database to use for storing data.
 	DatabaseContextKey = "db"
+	// EventBusContextKey is the name of the Echo context key that contains the bus to which events are published.
+	EventBusContextKey = "events"
+	// PrincipalContextKey is the name of the Echo context key that contains the principal on whose behalf a request is made.
+	PrincipalContextKey = "principal"
+	// RateLimiterContextKey is the name of the Echo context key that contains the limiter used to enforce quotas.
+	RateLimiterContextKey = "ratelimiter"
 )
@@ -19,6 +19,20 @@ import (
 )
 
 const (
+	// MongoDBMigrationLockRenewInterval is the interval at which the lock that prevents migrations from being run concurrently is renewed while migrations run.
+	MongoDBMigrationLockRenewInterval = time.Minute
+	// MongoDBMigrationLockRetryInterval is the interval at which acquiring the lock that prevents migrations from being run concurrently is retried.
+	MongoDBMigrationLockRetryInterval = time.Second
+	// MongoDBMigrationLockTTL is the amount of time after which the lock that prevents migrations from being run concurrently is considered to have been abandoned unless renewed.
+	MongoDBMigrationLockTTL = 10 * time.Minute
+	// MongoDBMigrationTimeout is the timeout to use when applying or reverting a single migration.
+	MongoDBMigrationTimeout = 5 * time.Minute
 	// MongoDBOperationTimeout is the timeout to use when performing operations against MongoDB.
 	MongoDBOperationTimeout = 5 * time.Second
+	// MongoDBTransactionRetryBaseDelay is the maximum amount of time to wait before retrying a transaction (or committing it) for the first time, which doubles with every retry.
+	MongoDBTransactionRetryBaseDelay = 10 * time.Millisecond
+	// MongoDBTransactionRetryMaxDelay is the maximum amount of time to wait before retrying a transaction (or committing it).
+	MongoDBTransactionRetryMaxDelay = time.Second
+	// MongoDBTransactionTimeout is the timeout to use when running a transaction against MongoDB, including any retries.
+	MongoDBTransactionTimeout = 30 * time.Second
 )
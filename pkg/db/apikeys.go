@@ -0,0 +1,186 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+// APIKeysDatabase contains methods used to manage API keys.
+type APIKeysDatabase interface {
+	// CreateAPIKey creates the provided API key.
+	CreateAPIKey(models.APIKey) (models.APIKey, error)
+	// GetAPIKey returns the API key with the specified ID, including revoked ones.
+	GetAPIKey(string) (models.APIKey, error)
+	// ListAPIKeys lists all API keys, including revoked ones.
+	ListAPIKeys() ([]models.APIKey, error)
+	// RevokeAPIKey revokes the API key with the specified ID.
+	RevokeAPIKey(string) (bool, error)
+	// RotateAPIKey replaces the salt and hash of the (non-revoked) API key with the specified ID.
+	RotateAPIKey(string, []byte, []byte) (models.APIKey, error)
+	// TouchAPIKey records that the API key with the specified ID was used at the provided date.
+	TouchAPIKey(string, time.Time) error
+}
+
+// mongodbAPIKeysDatabase is an implementation of APIKeysDatabase powered by MongoDB.
+type mongodbAPIKeysDatabase struct {
+	// c is the MongoDB collection to use for storing API keys.
+	c *mongo.Collection
+	// ctx is the context within which operations are performed.
+	ctx context.Context
+}
+
+// CreateAPIKey creates the provided API key.
+func (db *mongodbAPIKeysDatabase) CreateAPIKey(k models.APIKey) (models.APIKey, error) {
+	// Grab the current timestamp and set the creation date.
+	k.CreatedAt = time.Now()
+	// Create the API key.
+	ctx, fn := startOperation(db.ctx, "APIKeysDatabase.CreateAPIKey")
+	defer fn()
+	r, err := db.c.InsertOne(ctx, k)
+	if err != nil {
+		return models.APIKey{}, failed(ctx, fmt.Errorf("failed to create api key: %w", err))
+	}
+	// Return the full API key back to the caller.
+	k.ID = r.InsertedID.(primitive.ObjectID)
+	return k, nil
+}
+
+// GetAPIKey returns the API key with the specified ID, including revoked ones.
+func (db *mongodbAPIKeysDatabase) GetAPIKey(id string) (models.APIKey, error) {
+	// Grab the ObjectID that corresponds to the provided ID.
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("%q is not a valid api key ID", id)
+	}
+	// Try to retrieve the API key with the provided ID.
+	ctx, fn := startOperation(db.ctx, "APIKeysDatabase.GetAPIKey")
+	defer fn()
+	r := db.c.FindOne(ctx, byID(objectID))
+	if r.Err() != nil {
+		return models.APIKey{}, failed(ctx, fmt.Errorf("failed to get api key with id %q: %w", id, r.Err()))
+	}
+	// Check whether an API key with the provided ID was found, and return it if it does.
+	k := models.APIKey{}
+	if err := r.Decode(&k); err != nil {
+		if err != mongo.ErrNoDocuments {
+			// The API key might exist or not, but we've got an unexpected error which we must propagate.
+			return models.APIKey{}, failed(ctx, fmt.Errorf("failed to get api key with id %q: %w", id, err))
+		}
+		// The API key was not found, so we just return an empty API key (and error).
+		return models.APIKey{}, nil
+	}
+	return k, nil
+}
+
+// ListAPIKeys lists all API keys, including revoked ones.
+func (db *mongodbAPIKeysDatabase) ListAPIKeys() ([]models.APIKey, error) {
+	ctx, fn := startOperation(db.ctx, "APIKeysDatabase.ListAPIKeys")
+	defer fn()
+	c, err := db.c.Find(ctx, primitive.M{})
+	if err != nil {
+		return nil, failed(ctx, fmt.Errorf("failed to list api keys: %w", err))
+	}
+	defer c.Close(ctx)
+	// Build the list of API keys and return it back to the caller.
+	r := make([]models.APIKey, 0)
+	for c.Next(ctx) {
+		k := models.APIKey{}
+		if err := c.Decode(&k); err != nil {
+			return nil, failed(ctx, fmt.Errorf("failed to list api keys: %w", err))
+		}
+		r = append(r, k)
+	}
+	if c.Err() != nil {
+		return nil, failed(ctx, fmt.Errorf("failed to list api keys: %w", c.Err()))
+	}
+	return r, nil
+}
+
+// RevokeAPIKey revokes the API key with the specified ID.
+func (db *mongodbAPIKeysDatabase) RevokeAPIKey(id string) (bool, error) {
+	// Grab the current timestamp so we can set the revocation date.
+	now := time.Now()
+	// Grab the ObjectID that corresponds to the provided ID.
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, fmt.Errorf("%q is not a valid api key ID", id)
+	}
+	// Try to mark the API key as having been revoked.
+	ctx, fn := startOperation(db.ctx, "APIKeysDatabase.RevokeAPIKey")
+	defer fn()
+	r, err := db.c.UpdateOne(ctx, notRevokedByID(objectID), set(revokedAtFieldName, now))
+	if err != nil {
+		return false, failed(ctx, fmt.Errorf("failed to revoke api key with id %q: %w", id, err))
+	}
+	return r.ModifiedCount != 0, nil
+}
+
+// RotateAPIKey replaces the salt and hash of the (non-revoked) API key with the specified ID.
+func (db *mongodbAPIKeysDatabase) RotateAPIKey(id string, salt, hash []byte) (models.APIKey, error) {
+	// Grab the ObjectID that corresponds to the provided ID.
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("%q is not a valid api key ID", id)
+	}
+	// Try to replace the salt and hash, requesting for the new (updated) document to be returned.
+	opts := &options.FindOneAndUpdateOptions{}
+	opts.SetReturnDocument(options.After)
+	ctx, fn := startOperation(db.ctx, "APIKeysDatabase.RotateAPIKey")
+	defer fn()
+	r := db.c.FindOneAndUpdate(ctx, notRevokedByID(objectID), primitive.M{
+		setOp: primitive.M{
+			hashFieldName: hash,
+			saltFieldName: salt,
+		},
+	}, opts)
+	if r.Err() != nil {
+		return models.APIKey{}, failed(ctx, fmt.Errorf("failed to rotate api key: %w", r.Err()))
+	}
+	// Check whether an API key with the provided ID was found, and return it if it does.
+	k := models.APIKey{}
+	if err := r.Decode(&k); err != nil {
+		if err != mongo.ErrNoDocuments {
+			// The API key might exist or not, but we've got an unexpected error which we must propagate.
+			return models.APIKey{}, failed(ctx, fmt.Errorf("failed to rotate api key: %w", err))
+		}
+		// The API key was not found, so we just return an empty API key (and error).
+		return models.APIKey{}, nil
+	}
+	return k, nil
+}
+
+// TouchAPIKey records that the API key with the specified ID was used at the provided date.
+func (db *mongodbAPIKeysDatabase) TouchAPIKey(id string, t time.Time) error {
+	// Grab the ObjectID that corresponds to the provided ID.
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid api key ID", id)
+	}
+	ctx, fn := startOperation(db.ctx, "APIKeysDatabase.TouchAPIKey")
+	defer fn()
+	if _, err := db.c.UpdateOne(ctx, byID(objectID), set(lastUsedAtFieldName, t)); err != nil {
+		return failed(ctx, fmt.Errorf("failed to record usage of api key with id %q: %w", id, err))
+	}
+	return nil
+}
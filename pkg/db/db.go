@@ -17,6 +17,8 @@ package db
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"sync"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -27,42 +29,235 @@ import (
 
 // Database represents the database where data will be stored.
 type Database interface {
+	// APIKeys allows for accessing methods used to manage API keys.
+	APIKeys() APIKeysDatabase
+	// Close disconnects from the database, after which no further operations may be performed.
+	// Views of the database share the underlying connection, so closing any of them closes all of them.
+	Close() error
+	// Events allows for accessing methods used to persist and replay events.
+	Events() EventsDatabase
+	// ForTenant returns a view of the database that only allows for accessing payments, events and standing orders belonging to the specified tenant.
+	// The empty tenant stands for data not belonging to any tenant.
+	// API keys are not scoped to any tenant.
+	ForTenant(string) (Database, error)
 	// IsOnline returns a value indicating whether the database is online.
 	IsOnline() bool
+	// Migrations allows for accessing methods used to manage the schema of the database.
+	// Migrations apply to data belonging to all tenants.
+	Migrations() MigrationsDatabase
 	// Payments allows for accessing methods used to perform CRUD operations on payments.
 	Payments() PaymentsDatabase
+	// RateLimits allows for accessing methods used to share the state of rate limits and quotas.
+	RateLimits() RateLimitsDatabase
+	// ScheduledPayments allows for accessing methods used to execute scheduled payments once their date arrives.
+	// Scheduled payments belonging to all tenants are accessed.
+	ScheduledPayments() ScheduledPaymentsDatabase
+	// StandingOrders allows for accessing methods used to manage standing orders.
+	StandingOrders() StandingOrdersDatabase
+	// WithContext returns a view of the database whose operations are performed within the provided context.
+	// Operations are traced as children of the span active in the context (if any), and are canceled when the context is.
+	WithContext(context.Context) Database
+	// WithTransaction runs the provided function within a transaction, passing it a view of the database whose operations are performed as part of the transaction.
+	// The transaction is committed in case the function returns nil, and aborted otherwise.
+	// In case the transaction fails with a transient error (e.g. a write conflict) it is retried as a whole, so the function must be safe to call multiple times.
+	WithTransaction(context.Context, func(tx Database) error) error
+}
+
+// TenancyMode is the mode in which data belonging to different tenants is isolated.
+type TenancyMode string
+
+const (
+	// TenancyModeShared is the mode in which data belonging to all tenants is stored in the same collections, and isolated by filtering on the tenant.
+	TenancyModeShared TenancyMode = "shared"
+	// TenancyModeCollection is the mode in which data belonging to each tenant is stored in a dedicated set of collections.
+	TenancyModeCollection TenancyMode = "collection"
+	// TenancyModeDatabase is the mode in which data belonging to each tenant is stored in a dedicated database.
+	TenancyModeDatabase TenancyMode = "database"
+)
+
+var (
+	// tenantRegexp is the regular expression that tenants must match so that they can safely be used in the names of collections and databases.
+	tenantRegexp = regexp.MustCompile(`^` + tenantPattern + `$`)
+)
+
+const (
+	// tenantPattern is the pattern that tenants must match so that they can safely be used in the names of collections and databases.
+	tenantPattern = `[A-Za-z0-9_-]{1,32}`
+)
+
+// MongoDBOption is an option used to configure an instance of Database powered by MongoDB.
+type MongoDBOption func(*mongodbDatabase)
+
+// WithTenancyMode configures the mode in which data belonging to different tenants is isolated.
+func WithTenancyMode(mode TenancyMode) MongoDBOption {
+	return func(m *mongodbDatabase) {
+		m.mode = mode
+	}
 }
 
 // mongodbDatabase is an implementation of Database powered by MongoDB.
 type mongodbDatabase struct {
+	// ctx is the context within which operations are performed.
+	ctx context.Context
 	// db is the actual MongoDB database in which to store data.
 	db *mongo.Database
+	// mode is the mode in which data belonging to different tenants is isolated.
+	mode TenancyMode
+	// root is the MongoDB database in which to store data not belonging to any particular tenant.
+	root *mongo.Database
+	// tenant is the tenant to which the data being accessed belongs, if any.
+	tenant string
+	// tenants holds the tenants which have been registered (and whose collections have been indexed) by this instance, and is shared by all views.
+	tenants *sync.Map
 }
 
 // NewMongoDDatabase returns a new instance of Database powered by MongoDB.
-func NewMongoDDatabase(mongodbURL, databaseName string) (Database, error) {
+func NewMongoDDatabase(mongodbURL, databaseName string, opts ...MongoDBOption) (Database, error) {
 	ctx, fn := context.WithTimeout(context.Background(), constants.MongoDBOperationTimeout)
 	defer fn()
 	c, err := mongo.Connect(ctx, options.Client().ApplyURI(mongodbURL))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to mongodb: %v", err)
 	}
-	return &mongodbDatabase{
-		db: c.Database(databaseName),
-	}, nil
+	return newMongoDBDatabase(c.Database(databaseName), opts...)
+}
+
+// newMongoDBDatabase returns a new instance of Database powered by the provided MongoDB database.
+func newMongoDBDatabase(db *mongo.Database, opts ...MongoDBOption) (*mongodbDatabase, error) {
+	m := &mongodbDatabase{
+		ctx:     context.Background(),
+		db:      db,
+		mode:    TenancyModeShared,
+		root:    db,
+		tenants: &sync.Map{},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	switch m.mode {
+	case TenancyModeShared, TenancyModeCollection, TenancyModeDatabase:
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unsupported tenancy mode %q", m.mode)
+	}
+}
+
+// APIKeys allows for accessing methods used to manage API keys.
+func (m *mongodbDatabase) APIKeys() APIKeysDatabase {
+	return &mongodbAPIKeysDatabase{
+		c:   m.root.Collection("api_keys"),
+		ctx: m.ctx,
+	}
+}
+
+// Close disconnects from the database, after which no further operations may be performed.
+func (m *mongodbDatabase) Close() error {
+	ctx, fn := startOperation(m.ctx, "Database.Close")
+	defer fn()
+	if err := m.root.Client().Disconnect(ctx); err != nil {
+		return failed(ctx, fmt.Errorf("failed to disconnect from mongodb: %w", err))
+	}
+	return nil
+}
+
+// Events allows for accessing methods used to persist and replay events.
+func (m *mongodbDatabase) Events() EventsDatabase {
+	return &mongodbEventsDatabase{
+		c:      m.collection("events"),
+		ctx:    m.ctx,
+		tenant: m.tenant,
+	}
+}
+
+// ForTenant returns a view of the database that only allows for accessing payments and events belonging to the specified tenant.
+// The first time a tenant is accessed in the "collection" and "database" tenancy modes, its collections are indexed and it is registered so that its payments and standing orders can be found by the scheduler.
+func (m *mongodbDatabase) ForTenant(tenant string) (Database, error) {
+	if tenant != "" && !tenantRegexp.MatchString(tenant) {
+		return nil, fmt.Errorf("%q is not a valid tenant", tenant)
+	}
+	r := &mongodbDatabase{
+		ctx:     m.ctx,
+		db:      m.root,
+		mode:    m.mode,
+		root:    m.root,
+		tenant:  tenant,
+		tenants: m.tenants,
+	}
+	// Use a dedicated database for the tenant, if required.
+	if m.mode == TenancyModeDatabase && tenant != "" {
+		r.db = m.root.Client().Database(m.root.Name() + "_" + tenant)
+	}
+	r.ensureTenant()
+	return r, nil
 }
 
 // IsOnline returns a value indicating whether the database is online.
 func (m *mongodbDatabase) IsOnline() bool {
-	ctx, fn := context.WithTimeout(context.Background(), constants.MongoDBOperationTimeout)
+	ctx, fn := startOperation(m.ctx, "Database.IsOnline")
 	defer fn()
 	err := m.db.Client().Ping(ctx, readpref.Primary())
 	return err == nil
 }
 
+// Migrations allows for accessing methods used to manage the schema of the database.
+func (m *mongodbDatabase) Migrations() MigrationsDatabase {
+	return &mongodbMigrationsDatabase{
+		ctx:     m.ctx,
+		lock:    m.root.Collection("schema_migrations_lock"),
+		mode:    m.mode,
+		records: m.root.Collection("schema_migrations"),
+		root:    m.root,
+	}
+}
+
 // Payments allows for accessing methods used to perform CRUD operations on payments.
 func (m *mongodbDatabase) Payments() PaymentsDatabase {
 	return &mongodbPaymentsDatabase{
-		c: m.db.Collection("payments"),
+		c:      m.collection("payments"),
+		ctx:    m.ctx,
+		tenant: m.tenant,
+	}
+}
+
+// RateLimits allows for accessing methods used to share the state of rate limits and quotas.
+func (m *mongodbDatabase) RateLimits() RateLimitsDatabase {
+	return &mongodbRateLimitsDatabase{
+		buckets: m.root.Collection("rate_limit_buckets"),
+		ctx:     m.ctx,
+		quotas:  m.root.Collection("quota_usages"),
+	}
+}
+
+// ScheduledPayments allows for accessing methods used to execute scheduled payments once their date arrives.
+func (m *mongodbDatabase) ScheduledPayments() ScheduledPaymentsDatabase {
+	r := *m
+	r.db, r.tenant = m.root, ""
+	return &mongodbScheduledPaymentsDatabase{
+		ctx:      m.ctx,
+		database: &r,
+	}
+}
+
+// StandingOrders allows for accessing methods used to manage standing orders.
+func (m *mongodbDatabase) StandingOrders() StandingOrdersDatabase {
+	return &mongodbStandingOrdersDatabase{
+		c:      m.collection("standing_orders"),
+		ctx:    m.ctx,
+		tenant: m.tenant,
+	}
+}
+
+// WithContext returns a view of the database whose operations are performed within the provided context.
+func (m *mongodbDatabase) WithContext(ctx context.Context) Database {
+	r := *m
+	r.ctx = ctx
+	return &r
+}
+
+// collection returns the MongoDB collection with the specified name, using a dedicated collection for the current tenant if required.
+func (m *mongodbDatabase) collection(name string) *mongo.Collection {
+	if m.mode == TenancyModeCollection && m.tenant != "" {
+		return m.db.Collection(name + "_" + m.tenant)
 	}
+	return m.db.Collection(name)
 }
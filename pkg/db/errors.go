@@ -0,0 +1,115 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package db
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+	"go.mongodb.org/mongo-driver/x/network/connection"
+)
+
+const (
+	// serverSelectionErrorPrefix is the prefix of the messages of the errors returned by MongoDB when failing to select a server to perform an operation on.
+	serverSelectionErrorPrefix = "server selection error"
+)
+
+var (
+	// ErrPaymentExecuted is the error returned when attempting to change the date of a payment which has already been executed.
+	ErrPaymentExecuted = errors.New("the date of a payment cannot be changed once it has been executed")
+)
+
+// unavailableErrorCodes are the codes of MongoDB errors indicating that the database is (temporarily) unable to perform operations, rather than that an operation is invalid.
+var unavailableErrorCodes = map[int32]bool{
+	6:     true, // HostUnreachable
+	7:     true, // HostNotFound
+	89:    true, // NetworkTimeout
+	91:    true, // ShutdownInProgress
+	189:   true, // PrimarySteppedDown
+	262:   true, // ExceededTimeLimit
+	9001:  true, // SocketException
+	10107: true, // NotMaster
+	11600: true, // InterruptedAtShutdown
+	11602: true, // InterruptedDueToReplStateChange
+	13435: true, // NotMasterNoSlaveOk
+	13436: true, // NotMasterOrSecondary
+}
+
+// storageError is an error returned by MongoDB while performing a storage operation.
+type storageError struct {
+	// err is the actual error.
+	err error
+}
+
+// Error returns the message of the actual error.
+func (e *storageError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the actual error.
+func (e *storageError) Unwrap() error {
+	return e.err
+}
+
+// IsDuplicate returns a value indicating whether the provided error was returned because a record with the same ID (or unique key) already exists.
+func IsDuplicate(err error) bool {
+	var (
+		c mongo.CommandError
+		w mongo.WriteException
+	)
+	if errors.As(err, &w) {
+		return isDuplicateKeyError(w)
+	}
+	if errors.As(err, &c) {
+		return isDuplicateKeyError(c)
+	}
+	return false
+}
+
+// IsUnavailable returns a value indicating whether the provided error was returned because the database is unavailable (e.g. unreachable, too slow or electing a new primary), in which case the operation may succeed if retried later.
+// Only network errors, timeouts, failures to select a server and command errors known to be transient are considered as such.
+// Any other error (e.g. caused by invalid input, by a document which cannot be decoded or by the cancellation of the operation by the caller) is not.
+func IsUnavailable(err error) bool {
+	var (
+		s *storageError
+	)
+	if !errors.As(err, &s) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, topology.ErrServerSelectionTimeout) {
+		return true
+	}
+	var (
+		c  mongo.CommandError
+		ce connection.Error
+		ne net.Error
+	)
+	if errors.As(err, &c) {
+		return unavailableErrorCodes[c.Code] || c.HasErrorLabel("NetworkError")
+	}
+	if errors.As(err, &ce) || errors.As(err, &ne) {
+		return true
+	}
+	// Failures to select a server are only reported by the driver as plain errors.
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if strings.HasPrefix(e.Error(), serverSelectionErrorPrefix) {
+			return true
+		}
+	}
+	return false
+}
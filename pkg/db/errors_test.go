@@ -0,0 +1,63 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+	"go.mongodb.org/mongo-driver/x/network/connection"
+)
+
+var _ = Describe("Errors", func() {
+	It("are considered to be caused by the database being unavailable only if returned by MongoDB", func() {
+		ctx := context.Background()
+		Expect(IsUnavailable(nil)).To(BeFalse())
+		Expect(IsUnavailable(errors.New(`"foo" is not a valid payment ID`))).To(BeFalse())
+		Expect(IsUnavailable(failed(ctx, errors.New("server selection error: server selection timeout")))).To(BeTrue())
+		Expect(IsUnavailable(failed(ctx, fmt.Errorf("failed to get payment: %w", context.DeadlineExceeded)))).To(BeTrue())
+		Expect(IsUnavailable(failed(ctx, fmt.Errorf("failed to get payment: %w", context.Canceled)))).To(BeFalse())
+	})
+
+	It("are considered to be caused by the database being unavailable only if known to be transient", func() {
+		ctx := context.Background()
+		Expect(IsUnavailable(failed(ctx, fmt.Errorf("failed to get payment: %w", connection.Error{ConnectionID: "localhost:27017[-1]"})))).To(BeTrue())
+		Expect(IsUnavailable(failed(ctx, fmt.Errorf("failed to get payment: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")})))).To(BeTrue())
+		Expect(IsUnavailable(failed(ctx, fmt.Errorf("failed to get payment: %w", topology.ErrServerSelectionTimeout)))).To(BeTrue())
+		Expect(IsUnavailable(failed(ctx, fmt.Errorf("failed to get payment: %w", errors.New("error decoding key amount: cannot decode string into a float64"))))).To(BeFalse())
+		Expect(IsUnavailable(failed(ctx, fmt.Errorf("failed to get payment: %w", mongo.ErrClientDisconnected)))).To(BeFalse())
+	})
+
+	It("tell apart command errors indicating that the database is unavailable", func() {
+		ctx := context.Background()
+		Expect(IsUnavailable(failed(ctx, fmt.Errorf("failed to get payment: %w", mongo.CommandError{Code: 10107, Name: "NotMaster"})))).To(BeTrue())
+		Expect(IsUnavailable(failed(ctx, fmt.Errorf("failed to get payment: %w", mongo.CommandError{Labels: []string{"NetworkError"}})))).To(BeTrue())
+		Expect(IsUnavailable(failed(ctx, fmt.Errorf("failed to get payment: %w", mongo.CommandError{Code: 2, Name: "BadValue"})))).To(BeFalse())
+		Expect(IsUnavailable(failed(ctx, fmt.Errorf("failed to create payment: %w", mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}})))).To(BeFalse())
+	})
+
+	It("tell apart duplicate key errors", func() {
+		ctx := context.Background()
+		Expect(IsDuplicate(nil)).To(BeFalse())
+		Expect(IsDuplicate(failed(ctx, fmt.Errorf("failed to create payment: %w", mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}})))).To(BeTrue())
+		Expect(IsDuplicate(failed(ctx, fmt.Errorf("failed to create payment: %w", mongo.CommandError{Code: 11000})))).To(BeTrue())
+		Expect(IsDuplicate(failed(ctx, fmt.Errorf("failed to create payment: %w", mongo.CommandError{Code: 10107, Name: "NotMaster"})))).To(BeFalse())
+	})
+})
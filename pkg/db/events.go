@@ -0,0 +1,122 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+// EventsDatabase contains methods used to persist and replay events.
+type EventsDatabase interface {
+	// AppendEvent persists the provided event, assigning it the next sequence number.
+	AppendEvent(models.Event) (models.Event, error)
+	// ListEvents lists all events whose sequence number is greater than the specified one, in order.
+	// Only events describing payments belonging to the current tenant are listed.
+	ListEvents(int64) ([]models.Event, error)
+}
+
+// mongodbEventsDatabase is an implementation of EventsDatabase powered by MongoDB.
+type mongodbEventsDatabase struct {
+	// c is the MongoDB collection to use for storing events.
+	c *mongo.Collection
+	// ctx is the context within which operations are performed.
+	ctx context.Context
+	// tenant is the tenant to which the events being accessed belong, if any.
+	tenant string
+}
+
+// AppendEvent persists the provided event, assigning it the next sequence number.
+// The sequence number is assigned as part of inserting the event, which is only possible once the event that precedes it has been persisted, so events are persisted in the order of their sequence numbers and no sequence number is skipped.
+func (db *mongodbEventsDatabase) AppendEvent(e models.Event) (models.Event, error) {
+	// Grab the current timestamp and set the event's timestamp.
+	e.Timestamp = time.Now()
+	// Make the event belong to the current tenant.
+	e.Payment.Tenant = db.tenant
+	ctx, fn := startOperation(db.ctx, "EventsDatabase.AppendEvent")
+	defer fn()
+	for {
+		// Use the sequence number that follows the one of the last persisted event.
+		s, err := db.lastSequence(ctx)
+		if err != nil {
+			return models.Event{}, failed(ctx, fmt.Errorf("failed to assign sequence number to event: %w", err))
+		}
+		e.Sequence = s + 1
+		// Persist the event, relying on the unique index on the sequence number to detect events persisted with the same sequence number in the meantime.
+		res, err := db.c.InsertOne(ctx, e)
+		if err != nil {
+			if isDuplicateKeyError(err) {
+				// Another event was persisted with the same sequence number, so try again with the next one.
+				continue
+			}
+			return models.Event{}, failed(ctx, fmt.Errorf("failed to create event: %w", err))
+		}
+		// Return the full event back to the caller.
+		e.ID = res.InsertedID.(primitive.ObjectID)
+		return e, nil
+	}
+}
+
+// ListEvents lists all events whose sequence number is greater than the specified one, in order.
+// Only events describing payments belonging to the current tenant are listed.
+func (db *mongodbEventsDatabase) ListEvents(sequence int64) ([]models.Event, error) {
+	// Try to retrieve all events recorded after the specified one, sorted by their sequence number.
+	opts := &options.FindOptions{}
+	opts.SetSort(primitive.M{sequenceFieldName: 1})
+	ctx, fn := startOperation(db.ctx, "EventsDatabase.ListEvents")
+	defer fn()
+	f := greaterThan(sequenceFieldName, sequence)
+	f[paymentTenantFieldName] = ofTenant(db.tenant)
+	c, err := db.c.Find(ctx, f, opts)
+	if err != nil {
+		return nil, failed(ctx, fmt.Errorf("failed to list events: %w", err))
+	}
+	defer c.Close(ctx)
+	// Build the list of events and return it back to the caller.
+	r := make([]models.Event, 0)
+	for c.Next(ctx) {
+		e := models.Event{}
+		if err := c.Decode(&e); err != nil {
+			return nil, failed(ctx, fmt.Errorf("failed to list events: %w", err))
+		}
+		r = append(r, e)
+	}
+	if c.Err() != nil {
+		return nil, failed(ctx, fmt.Errorf("failed to list events: %w", c.Err()))
+	}
+	return r, nil
+}
+
+// lastSequence returns the sequence number of the last persisted event, or zero in case no events have been persisted.
+func (db *mongodbEventsDatabase) lastSequence(ctx context.Context) (int64, error) {
+	opts := &options.FindOneOptions{}
+	opts.SetProjection(primitive.M{sequenceFieldName: 1})
+	opts.SetSort(primitive.M{sequenceFieldName: -1})
+	e := models.Event{}
+	if err := db.c.FindOne(ctx, primitive.M{}, opts).Decode(&e); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return e.Sequence, nil
+}
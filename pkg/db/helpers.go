@@ -21,35 +21,203 @@ import (
 )
 
 const (
+	// amountFieldName is the name of the field that holds the amount of a given payment.
+	amountFieldName = "amount"
+	// beneficiaryAccountNumberFieldName is the name of the field that holds the account number of the beneficiary of a given payment.
+	beneficiaryAccountNumberFieldName = "beneficiary.account_number"
+	// beneficiaryFieldName is the name of the field that holds the beneficiary of a given payment.
+	beneficiaryFieldName = "beneficiary"
+	// currencyFieldName is the name of the field that holds the currency of a given payment.
+	currencyFieldName = "currency"
+	// dateFieldName is the name of the field that holds the date of a given payment.
+	dateFieldName = "date"
+	// debtorAccountNumberFieldName is the name of the field that holds the account number of the debtor of a given payment.
+	debtorAccountNumberFieldName = "debtor.account_number"
+	// debtorFieldName is the name of the field that holds the debtor of a given payment.
+	debtorFieldName = "debtor"
 	// deletedAtFieldName is the name of the field that holds the deletion date of a given record.
 	deletedAtFieldName = "deleted_at"
+	// descriptionFieldName is the name of the field that holds the description of a given payment.
+	descriptionFieldName = "description"
+	// executedAtFieldName is the name of the field that holds the execution date of a given payment.
+	executedAtFieldName = "executed_at"
+	// expiresAtFieldName is the name of the field that holds the expiration date of a given record.
+	expiresAtFieldName = "expires_at"
+	// generatedFieldName is the name of the field that holds the number of payments generated by a given standing order.
+	generatedFieldName = "generated"
+	// hashFieldName is the name of the field that holds the hash of the secret of a given api key.
+	hashFieldName = "hash"
 	// idFieldName is the name of the field that holds the ID of a given record.
 	idFieldName = "_id"
+	// lastUsedAtFieldName is the name of the field that holds the date at which a given api key was last used.
+	lastUsedAtFieldName = "last_used_at"
+	// leaseExpiresAtFieldName is the name of the field that holds the expiration date of the lease held on a given payment.
+	leaseExpiresAtFieldName = "lease_expires_at"
+	// leaseOwnerFieldName is the name of the field that holds the owner of the lease held on a given payment.
+	leaseOwnerFieldName = "lease_owner"
+	// nextAtFieldName is the name of the field that holds the date of the next occurrence of the schedule of a given standing order.
+	nextAtFieldName = "next_at"
+	// nextOccurrenceFieldName is the name of the field that holds the number of the next occurrence of the schedule of a given standing order.
+	nextOccurrenceFieldName = "next_occurrence"
+	// ownerFieldName is the name of the field that holds the owner of a given lock.
+	ownerFieldName = "owner"
+	// paymentTenantFieldName is the name of the field that holds the tenant of the payment described by a given event.
+	paymentTenantFieldName = "payment.tenant"
+	// quotaAmountsFieldName is the name of the field that holds the amounts used from a given quota, indexed by currency.
+	quotaAmountsFieldName = "amounts"
+	// quotaCountFieldName is the name of the field that holds the count used from a given quota.
+	quotaCountFieldName = "count"
+	// registeredAtFieldName is the name of the field that holds the registration date of a given tenant.
+	registeredAtFieldName = "registered_at"
+	// revokedAtFieldName is the name of the field that holds the revocation date of a given api key.
+	revokedAtFieldName = "revoked_at"
+	// saltFieldName is the name of the field that holds the salt used to hash the secret of a given api key.
+	saltFieldName = "salt"
+	// sequenceFieldName is the name of the field that holds the sequence number of a given event.
+	sequenceFieldName = "sequence"
+	// statusFieldName is the name of the field that holds the status of a given payment.
+	statusFieldName = "status"
+	// tenantFieldName is the name of the field that holds the tenant to which a given record belongs.
+	tenantFieldName = "tenant"
+	// updatedAtFieldName is the name of the field that holds the modification date of a given record.
+	updatedAtFieldName = "updated_at"
+	// versionFieldName is the name of the field that holds the version of a given record.
+	versionFieldName = "version"
 )
 
 const (
+	// andOp represents the "$and" operator.
+	andOp = "$and"
 	// eqOp represents the "$eq" operator.
 	eqOp = "$eq"
+	// existsOp represents the "$exists" operator.
+	existsOp = "$exists"
+	// gtOp represents the "$gt" operator.
+	gtOp = "$gt"
+	// incOp represents the "$inc" operator.
+	incOp = "$inc"
+	// inOp represents the "$in" operator.
+	inOp = "$in"
+	// lteOp represents the "$lte" operator.
+	lteOp = "$lte"
+	// neOp represents the "$ne" operator.
+	neOp = "$ne"
+	// orOp represents the "$or" operator.
+	orOp = "$or"
+	// regexOp represents the "$regex" operator.
+	regexOp = "$regex"
+	// setOnInsertOp represents the "$setOnInsert" operator.
+	setOnInsertOp = "$setOnInsert"
 	// setOp represents the "$set" operator.
 	setOp = "$set"
+	// unsetOp represents the "$unset" operator.
+	unsetOp = "$unset"
 )
 
-// existing is a helper method that allows for selecting existing (i.e. not deleted) objects.
-func existing() primitive.M {
+// atMostOrMissing is a helper method that allows for selecting objects whose value for the specified field is at most the provided one, or which do not have the field set.
+func atMostOrMissing(field string, value interface{}) primitive.M {
+	return primitive.M{
+		orOp: []primitive.M{
+			{
+				field: primitive.M{
+					existsOp: false,
+				},
+			},
+			{
+				field: primitive.M{
+					lteOp: value,
+				},
+			},
+		},
+	}
+}
+
+// byID is a helper method that allows for selecting an object by its ID, regardless of whether it has been deleted.
+func byID(id interface{}) primitive.M {
+	return primitive.M{
+		idFieldName: id,
+	}
+}
+
+// deletedByID is a helper method that allows for selecting a deleted object belonging to the specified tenant by its ID.
+func deletedByID(tenant string, id primitive.ObjectID) primitive.M {
+	return primitive.M{
+		idFieldName: id,
+		deletedAtFieldName: primitive.M{
+			neOp: nil,
+		},
+		tenantFieldName: ofTenant(tenant),
+	}
+}
+
+// existing is a helper method that allows for selecting existing (i.e. not deleted) objects belonging to the specified tenant.
+func existing(tenant string) primitive.M {
 	return primitive.M{
 		deletedAtFieldName: primitive.M{
 			eqOp: nil,
 		},
+		tenantFieldName: ofTenant(tenant),
 	}
 }
 
-// existingByID is a helper method that allows for selecting an existing (i.e. not deleted) object by its ID.
-func existingByID(id primitive.ObjectID) primitive.M {
+// existingByID is a helper method that allows for selecting an existing (i.e. not deleted) object belonging to the specified tenant by its ID.
+func existingByID(tenant string, id primitive.ObjectID) primitive.M {
 	return primitive.M{
 		idFieldName: id,
 		deletedAtFieldName: primitive.M{
 			eqOp: nil,
 		},
+		tenantFieldName: ofTenant(tenant),
+	}
+}
+
+// greaterThan is a helper method that allows for selecting objects whose value for the specified field is greater than the provided one.
+func greaterThan(field string, value interface{}) primitive.M {
+	return primitive.M{
+		field: primitive.M{
+			gtOp: value,
+		},
+	}
+}
+
+// notRevokedByID is a helper method that allows for selecting a non-revoked api key by its ID.
+func notRevokedByID(id primitive.ObjectID) primitive.M {
+	return primitive.M{
+		idFieldName: id,
+		revokedAtFieldName: primitive.M{
+			eqOp: nil,
+		},
+	}
+}
+
+// ofTenant is a helper method that allows for matching the specified tenant.
+// Objects not belonging to any tenant do not have the tenant field set, and hence are matched by the empty tenant.
+func ofTenant(tenant string) primitive.M {
+	if tenant == "" {
+		return primitive.M{
+			eqOp: nil,
+		}
+	}
+	return primitive.M{
+		eqOp: tenant,
+	}
+}
+
+// set is a helper method that allows for setting the specified field to the provided value.
+func set(field string, value interface{}) primitive.M {
+	return primitive.M{
+		setOp: primitive.M{
+			field: value,
+		},
+	}
+}
+
+// markRestored is a helper method that allows for marking a deleted object as not deleted.
+func markRestored() primitive.M {
+	return primitive.M{
+		setOp: primitive.M{
+			deletedAtFieldName: nil,
+		},
 	}
 }
 
@@ -0,0 +1,528 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/pkg/logging"
+)
+
+const (
+	// LatestMigrationVersion stands for the version of the latest known migration when migrating.
+	LatestMigrationVersion = -1
+)
+
+const (
+	// indexNotFoundErrorCode is the code of the error returned by MongoDB when dropping an index which does not exist.
+	indexNotFoundErrorCode = 27
+	// migrationLockID is the ID of the document used as the lock that prevents migrations from being run concurrently.
+	migrationLockID = "migrations"
+	// namespaceNotFoundErrorCode is the code of the error returned by MongoDB when operating on a collection which does not exist.
+	namespaceNotFoundErrorCode = 26
+	// ttlIndexName is the name of the indexes used to expire records.
+	ttlIndexName = "expires_at_ttl"
+)
+
+// MigrationsDatabase contains methods used to manage the schema of the database.
+type MigrationsDatabase interface {
+	// ListMigrations lists all known migrations, indicating which of them have been applied.
+	ListMigrations() ([]models.Migration, error)
+	// Migrate applies pending migrations up to the specified version and reverts applied migrations above it, in order.
+	// It waits for (and holds) a lock that prevents migrations from being run concurrently by other instances.
+	// LatestMigrationVersion stands for the version of the latest known migration.
+	Migrate(int) error
+}
+
+// migration is a numbered, reversible change to the schema of the database.
+type migration struct {
+	// description is a human-readable description of the migration.
+	description string
+	// down reverts the migration.
+	down func(context.Context, *mongodbMigrationsDatabase) error
+	// up applies the migration.
+	up func(context.Context, *mongodbMigrationsDatabase) error
+	// version is the number of the migration, which determines the order in which migrations are applied.
+	version int
+}
+
+// migrations are all known migrations, in order.
+// Migrations must never be changed or removed once released, as they may have been applied already.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create indexes on payments",
+		up: func(ctx context.Context, db *mongodbMigrationsDatabase) error {
+			c, err := tenantCollections(ctx, db.root, db.mode, "payments")
+			if err != nil {
+				return err
+			}
+			return createIndexes(ctx, c, paymentsIndexes)
+		},
+		down: func(ctx context.Context, db *mongodbMigrationsDatabase) error {
+			c, err := tenantCollections(ctx, db.root, db.mode, "payments")
+			if err != nil {
+				return err
+			}
+			return dropIndexes(ctx, c, paymentsIndexes)
+		},
+	},
+	{
+		version:     2,
+		description: "expire rate limit buckets and quota usages",
+		up: func(ctx context.Context, db *mongodbMigrationsDatabase) error {
+			return createIndexes(ctx, db.rateLimitsCollections(), ttlIndexes)
+		},
+		down: func(ctx context.Context, db *mongodbMigrationsDatabase) error {
+			return dropIndexes(ctx, db.rateLimitsCollections(), ttlIndexes)
+		},
+	},
+	{
+		version:     3,
+		description: "set the status of payments and index scheduled payments",
+		up: func(ctx context.Context, db *mongodbMigrationsDatabase) error {
+			c, err := tenantCollections(ctx, db.root, db.mode, "payments")
+			if err != nil {
+				return err
+			}
+			if err := backfillPaymentsStatus(ctx, c, time.Now()); err != nil {
+				return err
+			}
+			return createIndexes(ctx, c, scheduledPaymentsIndexes)
+		},
+		down: func(ctx context.Context, db *mongodbMigrationsDatabase) error {
+			c, err := tenantCollections(ctx, db.root, db.mode, "payments")
+			if err != nil {
+				return err
+			}
+			// The status of payments is left in place, as it is ignored by previous versions.
+			return dropIndexes(ctx, c, scheduledPaymentsIndexes)
+		},
+	},
+	{
+		version:     4,
+		description: "index standing orders",
+		up: func(ctx context.Context, db *mongodbMigrationsDatabase) error {
+			c, err := tenantCollections(ctx, db.root, db.mode, "standing_orders")
+			if err != nil {
+				return err
+			}
+			return createIndexes(ctx, c, standingOrdersIndexes)
+		},
+		down: func(ctx context.Context, db *mongodbMigrationsDatabase) error {
+			c, err := tenantCollections(ctx, db.root, db.mode, "standing_orders")
+			if err != nil {
+				return err
+			}
+			return dropIndexes(ctx, c, standingOrdersIndexes)
+		},
+	},
+	{
+		version:     5,
+		description: "register and index existing tenants",
+		up: func(ctx context.Context, db *mongodbMigrationsDatabase) error {
+			t, err := discoverTenants(ctx, db.root, db.mode)
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			for _, v := range t {
+				if err := registerTenant(ctx, db.root, db.mode, v, now); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		down: func(ctx context.Context, db *mongodbMigrationsDatabase) error {
+			// Registered tenants are left in place, as they are ignored by previous versions.
+			return nil
+		},
+	},
+	{
+		version:     6,
+		description: "index events by sequence number",
+		up: func(ctx context.Context, db *mongodbMigrationsDatabase) error {
+			c, err := tenantCollections(ctx, db.root, db.mode, "events")
+			if err != nil {
+				return err
+			}
+			return createIndexes(ctx, c, eventsIndexes)
+		},
+		down: func(ctx context.Context, db *mongodbMigrationsDatabase) error {
+			c, err := tenantCollections(ctx, db.root, db.mode, "events")
+			if err != nil {
+				return err
+			}
+			return dropIndexes(ctx, c, eventsIndexes)
+		},
+	},
+}
+
+var (
+	// eventsIndexes are the indexes created on collections storing events, which prevent two events from being assigned the same sequence number.
+	eventsIndexes = []mongo.IndexModel{
+		{
+			Keys:    primitive.D{{Key: sequenceFieldName, Value: 1}},
+			Options: options.Index().SetName(sequenceFieldName).SetUnique(true),
+		},
+	}
+	// paymentsIndexes are the indexes created on collections storing payments.
+	paymentsIndexes = []mongo.IndexModel{
+		ascendingIndex(beneficiaryAccountNumberFieldName),
+		ascendingIndex(currencyFieldName),
+		ascendingIndex(dateFieldName),
+		ascendingIndex(debtorAccountNumberFieldName),
+		ascendingIndex(deletedAtFieldName),
+	}
+	// scheduledPaymentsIndexes are the indexes created on collections storing payments in order for due payments to be found efficiently.
+	scheduledPaymentsIndexes = []mongo.IndexModel{
+		{
+			Keys:    primitive.D{{Key: statusFieldName, Value: 1}, {Key: dateFieldName, Value: 1}},
+			Options: options.Index().SetName(statusFieldName + "_" + dateFieldName),
+		},
+	}
+	// standingOrdersIndexes are the indexes created on collections storing standing orders in order for due standing orders to be found efficiently.
+	standingOrdersIndexes = []mongo.IndexModel{
+		{
+			Keys:    primitive.D{{Key: statusFieldName, Value: 1}, {Key: nextAtFieldName, Value: 1}},
+			Options: options.Index().SetName(statusFieldName + "_" + nextAtFieldName),
+		},
+	}
+	// ttlIndexes are the indexes created on collections storing records which expire.
+	ttlIndexes = []mongo.IndexModel{
+		{
+			Keys:    primitive.D{{Key: expiresAtFieldName, Value: 1}},
+			Options: options.Index().SetName(ttlIndexName).SetExpireAfterSeconds(0),
+		},
+	}
+)
+
+// mongodbMigrationsDatabase is an implementation of MigrationsDatabase powered by MongoDB.
+type mongodbMigrationsDatabase struct {
+	// ctx is the context within which operations are performed.
+	ctx context.Context
+	// lock is the MongoDB collection to use for storing the lock that prevents migrations from being run concurrently.
+	lock *mongo.Collection
+	// mode is the mode in which data belonging to different tenants is isolated.
+	mode TenancyMode
+	// records is the MongoDB collection to use for recording applied migrations.
+	records *mongo.Collection
+	// root is the MongoDB database in which to store data not belonging to any particular tenant.
+	root *mongo.Database
+}
+
+// ListMigrations lists all known migrations, indicating which of them have been applied.
+func (db *mongodbMigrationsDatabase) ListMigrations() ([]models.Migration, error) {
+	a, err := db.applied()
+	if err != nil {
+		return nil, err
+	}
+	r := make([]models.Migration, 0, len(migrations))
+	for _, m := range migrations {
+		v := models.Migration{
+			Version:     m.version,
+			Description: m.description,
+		}
+		if t, ok := a[m.version]; ok {
+			v.AppliedAt = &t
+		}
+		r = append(r, v)
+	}
+	return r, nil
+}
+
+// Migrate applies pending migrations up to the specified version and reverts applied migrations above it, in order.
+func (db *mongodbMigrationsDatabase) Migrate(version int) error {
+	if version == LatestMigrationVersion {
+		version = migrations[len(migrations)-1].version
+	}
+	if version < 0 || version > migrations[len(migrations)-1].version {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+	// Wait for the lock, making sure that it is released when done.
+	owner := primitive.NewObjectID().Hex()
+	if err := db.acquireLock(owner); err != nil {
+		return err
+	}
+	defer db.releaseLock(owner)
+	// Keep renewing the lock while migrations run, as they may take longer than its TTL.
+	// Migrations are canceled in case the lock is lost, as another instance may then take it over.
+	ctx, fn := context.WithCancel(db.ctx)
+	defer fn()
+	v := *db
+	v.ctx = ctx
+	done := make(chan struct{})
+	defer close(done)
+	go db.renewLock(owner, fn, done)
+	// Check which migrations have been applied only after acquiring the lock, as they may have been applied while waiting for it.
+	a, err := v.applied()
+	if err != nil {
+		return err
+	}
+	// Apply pending migrations up to the specified version.
+	for _, m := range migrations {
+		if _, ok := a[m.version]; ok || m.version > version {
+			continue
+		}
+		if err := v.run(m, true); err != nil {
+			return err
+		}
+	}
+	// Revert applied migrations above the specified version, latest first.
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if _, ok := a[m.version]; !ok || m.version <= version {
+			continue
+		}
+		if err := v.run(m, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acquireLock waits until the lock that prevents migrations from being run concurrently can be acquired on behalf of the specified owner.
+// Locks which have not been released after constants.MongoDBMigrationLockTTL are considered to have been abandoned, and are taken over.
+func (db *mongodbMigrationsDatabase) acquireLock(owner string) error {
+	for {
+		ok, err := db.tryLock(owner)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		logging.FromContext(db.ctx).Info("waiting for another instance to finish running migrations")
+		select {
+		case <-db.ctx.Done():
+			return fmt.Errorf("failed to acquire the migrations lock: %v", db.ctx.Err())
+		case <-time.After(constants.MongoDBMigrationLockRetryInterval):
+		}
+	}
+}
+
+// applied returns the dates at which migrations have been applied, indexed by version.
+func (db *mongodbMigrationsDatabase) applied() (map[int]time.Time, error) {
+	ctx, fn := startOperation(db.ctx, "MigrationsDatabase.ListMigrations")
+	defer fn()
+	c, err := db.records.Find(ctx, primitive.M{})
+	if err != nil {
+		return nil, failed(ctx, fmt.Errorf("failed to list applied migrations: %w", err))
+	}
+	defer c.Close(ctx)
+	r := make(map[int]time.Time)
+	for c.Next(ctx) {
+		m := models.Migration{}
+		if err := c.Decode(&m); err != nil {
+			return nil, failed(ctx, fmt.Errorf("failed to list applied migrations: %w", err))
+		}
+		if m.AppliedAt != nil {
+			r[m.Version] = *m.AppliedAt
+		}
+	}
+	if c.Err() != nil {
+		return nil, failed(ctx, fmt.Errorf("failed to list applied migrations: %w", c.Err()))
+	}
+	return r, nil
+}
+
+// extendLock extends the lock that prevents migrations from being run concurrently on behalf of the specified owner, returning a value indicating whether it is still held by them.
+func (db *mongodbMigrationsDatabase) extendLock(owner string, now time.Time) (bool, error) {
+	ctx, fn := startOperation(db.ctx, "MigrationsDatabase.RenewLock")
+	defer fn()
+	f := byID(migrationLockID)
+	f[ownerFieldName] = owner
+	r, err := db.lock.UpdateOne(ctx, f, set(expiresAtFieldName, now.Add(constants.MongoDBMigrationLockTTL)))
+	if err != nil {
+		return false, failed(ctx, fmt.Errorf("failed to renew the migrations lock: %w", err))
+	}
+	return r.MatchedCount > 0, nil
+}
+
+// rateLimitsCollections returns the MongoDB collections storing the state of rate limits and quotas.
+func (db *mongodbMigrationsDatabase) rateLimitsCollections() []*mongo.Collection {
+	return []*mongo.Collection{
+		db.root.Collection("quota_usages"),
+		db.root.Collection("rate_limit_buckets"),
+	}
+}
+
+// releaseLock releases the lock that prevents migrations from being run concurrently, provided that it is still held by the specified owner.
+func (db *mongodbMigrationsDatabase) releaseLock(owner string) {
+	ctx, fn := startOperation(db.ctx, "MigrationsDatabase.ReleaseLock")
+	defer fn()
+	f := byID(migrationLockID)
+	f[ownerFieldName] = owner
+	if _, err := db.lock.DeleteOne(ctx, f); err != nil {
+		// The lock will eventually be taken over by another instance.
+		logging.FromContext(ctx).Warnf("failed to release the migrations lock: %v", failed(ctx, err))
+	}
+}
+
+// renewLock renews the lock that prevents migrations from being run concurrently on behalf of the specified owner every constants.MongoDBMigrationLockRenewInterval, until done is closed.
+// The provided function is called in case the lock is lost, either because it has been taken over or because it could not be renewed before expiring.
+func (db *mongodbMigrationsDatabase) renewLock(owner string, lost func(), done <-chan struct{}) {
+	t := time.NewTicker(constants.MongoDBMigrationLockRenewInterval)
+	defer t.Stop()
+	expiresAt := time.Now().Add(constants.MongoDBMigrationLockTTL)
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+		now := time.Now()
+		ok, err := db.extendLock(owner, now)
+		switch {
+		case err == nil && ok:
+			expiresAt = now.Add(constants.MongoDBMigrationLockTTL)
+			continue
+		case err == nil:
+			logging.FromContext(db.ctx).Error("the migrations lock has been taken over by another instance")
+		case now.Before(expiresAt):
+			// Renewing the lock is attempted again, as it has not yet expired.
+			logging.FromContext(db.ctx).Warnf("failed to renew the migrations lock: %v", err)
+			continue
+		default:
+			logging.FromContext(db.ctx).Errorf("failed to renew the migrations lock before it expired: %v", err)
+		}
+		lost()
+		return
+	}
+}
+
+// run applies (or reverts) the provided migration, recording the outcome.
+func (db *mongodbMigrationsDatabase) run(m migration, up bool) error {
+	var (
+		err error
+	)
+	name, verb, past := "MigrationsDatabase.ApplyMigration", "apply", "applied"
+	if !up {
+		name, verb, past = "MigrationsDatabase.RevertMigration", "revert", "reverted"
+	}
+	ctx, fn := startOperationWithTimeout(db.ctx, name, constants.MongoDBMigrationTimeout)
+	defer fn()
+	if up {
+		if err = m.up(ctx, db); err == nil {
+			now := time.Now()
+			_, err = db.records.InsertOne(ctx, models.Migration{
+				Version:     m.version,
+				Description: m.description,
+				AppliedAt:   &now,
+			})
+		}
+	} else {
+		if err = m.down(ctx, db); err == nil {
+			_, err = db.records.DeleteOne(ctx, byID(m.version))
+		}
+	}
+	if err != nil {
+		return failed(ctx, fmt.Errorf("failed to %s migration %d (%s): %w", verb, m.version, m.description, err))
+	}
+	logging.FromContext(ctx).Infof("%s migration %d (%s)", past, m.version, m.description)
+	return nil
+}
+
+// tryLock attempts to acquire the lock that prevents migrations from being run concurrently on behalf of the specified owner, returning a value indicating whether it succeeded.
+func (db *mongodbMigrationsDatabase) tryLock(owner string) (bool, error) {
+	now := time.Now()
+	// Only select the lock in case it has expired (or was never acquired).
+	// In case it is not selected, an upsert is attempted which fails if the lock is held.
+	f := atMostOrMissing(expiresAtFieldName, now)
+	f[idFieldName] = migrationLockID
+	opts := &options.ReplaceOptions{}
+	opts.SetUpsert(true)
+	ctx, fn := startOperation(db.ctx, "MigrationsDatabase.AcquireLock")
+	defer fn()
+	_, err := db.lock.ReplaceOne(ctx, f, models.MigrationLock{
+		ID:        migrationLockID,
+		Owner:     owner,
+		ExpiresAt: now.Add(constants.MongoDBMigrationLockTTL),
+	}, opts)
+	if isDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, failed(ctx, fmt.Errorf("failed to acquire the migrations lock: %w", err))
+	}
+	return true, nil
+}
+
+// ascendingIndex returns the model of an ascending index on the specified field, named after the field.
+func ascendingIndex(field string) mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys:    primitive.D{{Key: field, Value: 1}},
+		Options: options.Index().SetName(field),
+	}
+}
+
+// backfillPaymentsStatus sets the status of the payments stored in each of the provided collections which do not have one, based on their date relative to the specified time.
+func backfillPaymentsStatus(ctx context.Context, collections []*mongo.Collection, now time.Time) error {
+	for _, c := range collections {
+		for status, f := range map[string]primitive.M{
+			models.PaymentStatusExecuted:  primitive.M{dateFieldName: primitive.M{lteOp: now}},
+			models.PaymentStatusScheduled: greaterThan(dateFieldName, now),
+		} {
+			f[statusFieldName] = primitive.M{existsOp: false}
+			if _, err := c.UpdateMany(ctx, f, set(statusFieldName, status)); err != nil {
+				return fmt.Errorf("failed to set the status of payments on %s: %v", c.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// createIndexes creates the provided indexes on each of the provided collections.
+func createIndexes(ctx context.Context, collections []*mongo.Collection, indexes []mongo.IndexModel) error {
+	for _, c := range collections {
+		if _, err := c.Indexes().CreateMany(ctx, indexes); err != nil {
+			return fmt.Errorf("failed to create indexes on %s: %v", c.Name(), err)
+		}
+	}
+	return nil
+}
+
+// dropIndexes drops the provided indexes from each of the provided collections, ignoring the ones which do not exist.
+func dropIndexes(ctx context.Context, collections []*mongo.Collection, indexes []mongo.IndexModel) error {
+	for _, c := range collections {
+		for _, i := range indexes {
+			if _, err := c.Indexes().DropOne(ctx, *i.Options.Name); err != nil && !isCommandError(err, indexNotFoundErrorCode, namespaceNotFoundErrorCode) {
+				return fmt.Errorf("failed to drop index %s on %s: %v", *i.Options.Name, c.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// isCommandError returns a value indicating whether the provided error is a command error with any of the specified codes.
+func isCommandError(err error, codes ...int32) bool {
+	e, ok := err.(mongo.CommandError)
+	if !ok {
+		return false
+	}
+	for _, c := range codes {
+		if e.Code == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package db
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+)
+
+var _ = Describe("Migrations", func() {
+	It("are numbered consecutively and reversible", func() {
+		for i, m := range migrations {
+			Expect(m.version).To(Equal(i + 1))
+			Expect(m.description).NotTo(BeEmpty())
+			Expect(m.up).NotTo(BeNil())
+			Expect(m.down).NotTo(BeNil())
+		}
+	})
+
+	It("index payments by deletion date, date, currency and account numbers", func() {
+		n := make([]string, 0, len(paymentsIndexes))
+		for _, i := range paymentsIndexes {
+			Expect(i.Keys).To(Equal(primitive.D{{Key: *i.Options.Name, Value: 1}}))
+			n = append(n, *i.Options.Name)
+		}
+		Expect(n).To(ConsistOf("deleted_at", "date", "currency", "debtor.account_number", "beneficiary.account_number"))
+		Expect(*ttlIndexes[0].Options.ExpireAfterSeconds).To(BeZero())
+	})
+
+	It("rejects unknown versions without acquiring the lock", func() {
+		c, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+		Expect(err).NotTo(HaveOccurred())
+		m, err := newMongoDBDatabase(c.Database("dojo-payments"))
+		Expect(err).NotTo(HaveOccurred())
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		Expect(m.WithContext(ctx).Migrations().Migrate(len(migrations) + 1)).To(MatchError(ContainSubstring("unknown migration version")))
+		Expect(m.WithContext(ctx).Migrations().Migrate(-2)).To(MatchError(ContainSubstring("unknown migration version")))
+	})
+
+	It("renew the lock well before it expires, and stop doing so once done", func() {
+		Expect(3 * constants.MongoDBMigrationLockRenewInterval).To(BeNumerically("<=", constants.MongoDBMigrationLockTTL))
+		c, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+		Expect(err).NotTo(HaveOccurred())
+		m, err := newMongoDBDatabase(c.Database("dojo-payments"))
+		Expect(err).NotTo(HaveOccurred())
+		done := make(chan struct{})
+		close(done)
+		lost := false
+		m.Migrations().(*mongodbMigrationsDatabase).renewLock("foo", func() { lost = true }, done)
+		Expect(lost).To(BeFalse())
+	})
+
+	It("recognizes command errors by code", func() {
+		Expect(isCommandError(mongo.CommandError{Code: indexNotFoundErrorCode}, indexNotFoundErrorCode, namespaceNotFoundErrorCode)).To(BeTrue())
+		Expect(isCommandError(mongo.CommandError{Code: duplicateKeyErrorCode}, indexNotFoundErrorCode)).To(BeFalse())
+		Expect(isCommandError(nil, indexNotFoundErrorCode)).To(BeFalse())
+	})
+})
@@ -0,0 +1,61 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKey represents a long-lived credential used by machine clients to authenticate.
+// Only a salted hash of the key's secret is stored.
+type APIKey struct {
+	// ID is the ID of the API key.
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	// CreatedAt is the record's creation date.
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	// LastUsedAt is the date at which the API key was last used to authenticate, if ever.
+	LastUsedAt *time.Time `bson:"last_used_at" json:"last_used_at"`
+	// RevokedAt is the date at which the API key was revoked, if ever.
+	RevokedAt *time.Time `bson:"revoked_at" json:"revoked_at"`
+
+	// Hash is the salted hash of the API key's secret.
+	Hash []byte `bson:"hash" json:"-"`
+	// Salt is the salt used to hash the API key's secret.
+	Salt []byte `bson:"salt" json:"-"`
+
+	// Name is a human-readable name for the API key.
+	// It is a required field.
+	Name string `bson:"name" json:"name"`
+	// Scopes are the scopes granted to the API key.
+	// It is a required field.
+	Scopes []string `bson:"scopes" json:"scopes"`
+	// Tenant is the tenant on whose behalf the API key acts.
+	// It is an optional field.
+	Tenant string `bson:"tenant" json:"tenant"`
+}
+
+// Validate validates the current APIKey object.
+func (k *APIKey) Validate() error {
+	if k.Name == "" {
+		return errors.New("the name must not be empty")
+	}
+	if len(k.Scopes) == 0 {
+		return errors.New("the scopes must not be empty")
+	}
+	return nil
+}
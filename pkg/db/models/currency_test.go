@@ -0,0 +1,29 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package models
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Currencies", func() {
+	It("only knows uppercase iso 4217 codes", func() {
+		Expect(IsKnownCurrency("EUR")).To(BeTrue())
+		Expect(IsKnownCurrency("GBP")).To(BeTrue())
+		Expect(IsKnownCurrency("eur")).To(BeFalse())
+		Expect(IsKnownCurrency("FOO")).To(BeFalse())
+		Expect(IsKnownCurrency("")).To(BeFalse())
+	})
+})
@@ -0,0 +1,57 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EventType represents the kind of change made to a payment.
+type EventType string
+
+const (
+	// EventTypePaymentCreated indicates that a payment has been created.
+	EventTypePaymentCreated EventType = "payment.created"
+	// EventTypePaymentDeleted indicates that a payment has been deleted.
+	EventTypePaymentDeleted EventType = "payment.deleted"
+	// EventTypePaymentExecuted indicates that a scheduled payment has been executed.
+	EventTypePaymentExecuted EventType = "payment.executed"
+	// EventTypePaymentUpdated indicates that a payment has been updated.
+	EventTypePaymentUpdated EventType = "payment.updated"
+)
+
+// Event represents a change made to a payment.
+type Event struct {
+	// ID is the ID of the event.
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	// Sequence is the position of the event in the (totally-ordered) sequence of events.
+	Sequence int64 `bson:"sequence" json:"sequence"`
+	// Timestamp is the date at which the event was recorded.
+	Timestamp time.Time `bson:"timestamp" json:"timestamp"`
+
+	// Actor is the subject of the principal that made the change, if the request was authenticated.
+	Actor string `bson:"actor,omitempty" json:"actor,omitempty"`
+	// Type is the kind of change made to the payment.
+	Type EventType `bson:"type" json:"type"`
+	// Payment is the payment that was changed, as it was after the change.
+	Payment Payment `bson:"payment" json:"payment"`
+}
+
+// Involves returns a value indicating whether the entity with the provided account number is a party to the payment.
+func (e *Event) Involves(accountNumber string) bool {
+	return e.Payment.Beneficiary.AccountNumber == accountNumber || e.Payment.Debtor.AccountNumber == accountNumber
+}
@@ -0,0 +1,38 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package models
+
+import (
+	"time"
+)
+
+// Migration represents a numbered, reversible change to the schema of the database, and whether it has been applied.
+type Migration struct {
+	// Version is the number of the migration, which determines the order in which migrations are applied.
+	Version int `bson:"_id" json:"version"`
+	// Description is a human-readable description of the migration.
+	Description string `bson:"description" json:"description"`
+	// AppliedAt is the date at which the migration was applied, if it has been.
+	AppliedAt *time.Time `bson:"applied_at" json:"applied_at"`
+}
+
+// MigrationLock represents the lock that prevents migrations from being run concurrently.
+type MigrationLock struct {
+	// ID is the ID of the lock.
+	ID string `bson:"_id"`
+	// Owner identifies the process holding the lock.
+	Owner string `bson:"owner"`
+	// ExpiresAt is the date after which the lock is considered to have been abandoned, and hence can be taken over.
+	ExpiresAt time.Time `bson:"expires_at"`
+}
@@ -46,6 +46,13 @@ func (e *Entity) Validate() error {
 	return nil
 }
 
+const (
+	// PaymentStatusExecuted is the status of a payment which has been executed.
+	PaymentStatusExecuted = "executed"
+	// PaymentStatusScheduled is the status of a payment whose date has not arrived yet, and which is held until it does.
+	PaymentStatusScheduled = "scheduled"
+)
+
 // Payment represents a payment to an entity (the beneficiary) made by another entity (the debtor).
 type Payment struct {
 	// ID is the ID of the payments.
@@ -54,6 +61,23 @@ type Payment struct {
 	UpdatedAt time.Time `bson:"updated_at" json:"-"`
 	// DeletedAt is the record's deletion date.
 	DeletedAt *time.Time `bson:"deleted_at" json:"-"`
+	// Tenant is the tenant to which the payment belongs, if any.
+	// It is derived from the principal that created the payment.
+	Tenant string `bson:"tenant,omitempty" json:"-"`
+	// LeaseExpiresAt is the date at which the lease held on a scheduled payment by the scheduler executing it expires, if any.
+	LeaseExpiresAt *time.Time `bson:"lease_expires_at,omitempty" json:"-"`
+	// LeaseOwner is the scheduler holding a lease on a scheduled payment in order to execute it, if any.
+	LeaseOwner string `bson:"lease_owner,omitempty" json:"-"`
+
+	// ExecutedAt is the date at which the payment was executed, if it has been executed.
+	// It is set by the server.
+	ExecutedAt *time.Time `bson:"executed_at,omitempty" json:"executed_at,omitempty"`
+	// Status is the status of the payment (i.e. "scheduled" or "executed").
+	// It is set by the server based on the payment's date, and ignored when provided.
+	Status string `bson:"status" json:"status"`
+	// StandingOrderID is the ID of the standing order that generated the payment, if any.
+	// It is set by the server.
+	StandingOrderID *primitive.ObjectID `bson:"standing_order_id,omitempty" json:"standing_order_id,omitempty"`
 
 	// Beneficiary is the entity that received the payment.
 	Beneficiary Entity `bson:"beneficiary" json:"beneficiary"`
@@ -0,0 +1,45 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"time"
+)
+
+// RateLimitBucket represents the state of a token bucket used to rate-limit requests.
+type RateLimitBucket struct {
+	// Key is the key that identifies the bucket.
+	Key string `bson:"_id"`
+	// Tokens is the number of tokens available in the bucket as of UpdatedAt.
+	Tokens float64 `bson:"tokens"`
+	// UpdatedAt is the date at which the bucket was last updated.
+	UpdatedAt time.Time `bson:"updated_at"`
+	// ExpiresAt is the date after which the bucket is full again, and hence can be discarded.
+	ExpiresAt time.Time `bson:"expires_at"`
+	// Version is incremented every time the bucket is updated, and is used to detect concurrent updates.
+	Version int64 `bson:"version"`
+}
+
+// QuotaUsage represents the usage of a quota during a given period.
+type QuotaUsage struct {
+	// Key is the key that identifies the quota and the period.
+	Key string `bson:"_id"`
+	// Count is the number of payments created during the period.
+	Count int64 `bson:"count"`
+	// Amounts are the total amounts involved in payments created during the period, indexed by currency.
+	Amounts map[string]float64 `bson:"amounts"`
+	// ExpiresAt is the date after which the period is over, and hence the usage can be discarded.
+	ExpiresAt time.Time `bson:"expires_at"`
+}
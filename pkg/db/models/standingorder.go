@@ -0,0 +1,271 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// FrequencyDaily is the frequency of schedules with an occurrence every day.
+	FrequencyDaily = "daily"
+	// FrequencyLastBusinessDay is the frequency of schedules with an occurrence on the last business day (i.e. Monday to Friday) of every month.
+	FrequencyLastBusinessDay = "last_business_day"
+	// FrequencyMonthly is the frequency of schedules with an occurrence every month, on the day of the month of the schedule's start (or on the last day of shorter months).
+	FrequencyMonthly = "monthly"
+	// FrequencyWeekly is the frequency of schedules with an occurrence every week, on the day of the week of the schedule's start.
+	FrequencyWeekly = "weekly"
+)
+
+const (
+	// StandingOrderStatusActive is the status of a standing order which generates payments.
+	StandingOrderStatusActive = "active"
+	// StandingOrderStatusCancelled is the status of a standing order which has been cancelled, and hence no longer generates payments.
+	StandingOrderStatusCancelled = "cancelled"
+	// StandingOrderStatusCompleted is the status of a standing order whose schedule has no occurrences left.
+	StandingOrderStatusCompleted = "completed"
+	// StandingOrderStatusPaused is the status of a standing order which has been paused, and hence does not generate payments until it is resumed.
+	StandingOrderStatusPaused = "paused"
+)
+
+// PaymentTemplate represents the payment generated by a standing order on each occurrence of its schedule.
+type PaymentTemplate struct {
+	// Beneficiary is the entity that receives the payments.
+	Beneficiary Entity `bson:"beneficiary" json:"beneficiary"`
+	// Debtor is the entity that sends the payments.
+	Debtor Entity `bson:"debtor" json:"debtor"`
+
+	// Amount is the amount involved in each payment.
+	// It is a required field.
+	Amount float64 `bson:"amount" json:"amount"`
+	// Currency is the currency in which the payments are made.
+	// It is a required field.
+	Currency string `bson:"currency" json:"currency"`
+	// Description is the description associated with each payment.
+	// It is a required field.
+	Description string `bson:"description" json:"description"`
+}
+
+// Payment returns the payment generated from the template for the specified date.
+func (t *PaymentTemplate) Payment(date time.Time) Payment {
+	return Payment{
+		Beneficiary: t.Beneficiary,
+		Debtor:      t.Debtor,
+		Amount:      t.Amount,
+		Currency:    t.Currency,
+		Date:        date,
+		Description: t.Description,
+	}
+}
+
+// Validate validates the current PaymentTemplate object.
+func (t *PaymentTemplate) Validate() error {
+	// The payments' date is determined by the schedule, so any non-empty date will do.
+	p := t.Payment(time.Unix(0, 0))
+	return p.Validate()
+}
+
+// Schedule represents the recurring dates at which a standing order generates payments, in a way similar to iCalendar's recurrence rules.
+type Schedule struct {
+	// Frequency is the frequency of the occurrences (i.e. "daily", "weekly", "monthly" or "last_business_day").
+	// It is a required field.
+	Frequency string `bson:"frequency" json:"frequency"`
+	// Interval is the number of days, weeks or months between occurrences (e.g. 2 for every other week).
+	// It is an optional field, and defaults to 1.
+	Interval int `bson:"interval,omitempty" json:"interval,omitempty"`
+	// Start is the date of the first occurrence, which also determines the time of day (and the day of the week or month) of subsequent occurrences.
+	// When the frequency is "last_business_day", the first occurrence is the first last business day of a month not before this date.
+	// It is a required field.
+	Start time.Time `bson:"start" json:"start"`
+	// End is the date after which there are no occurrences.
+	// It is an optional field.
+	End *time.Time `bson:"end,omitempty" json:"end,omitempty"`
+	// MaxOccurrences is the maximum number of occurrences, including the ones skipped while the standing order was paused.
+	// It is an optional field.
+	MaxOccurrences int `bson:"max_occurrences,omitempty" json:"max_occurrences,omitempty"`
+}
+
+// Occurrence returns the date of the n-th (zero-based) occurrence of the schedule, and a value indicating whether it exists.
+func (s *Schedule) Occurrence(n int) (time.Time, bool) {
+	if n < 0 || (s.MaxOccurrences > 0 && n >= s.MaxOccurrences) {
+		return time.Time{}, false
+	}
+	i := s.Interval
+	if i == 0 {
+		i = 1
+	}
+	var (
+		r time.Time
+	)
+	switch s.Frequency {
+	case FrequencyDaily:
+		r = s.Start.AddDate(0, 0, n*i)
+	case FrequencyWeekly:
+		r = s.Start.AddDate(0, 0, 7*n*i)
+	case FrequencyMonthly:
+		r = inMonth(s.Start, n*i, s.Start.Day())
+	case FrequencyLastBusinessDay:
+		// Skip the month of the start in case its last business day is before the start.
+		o := 0
+		if lastBusinessDay(s.Start, 0).Before(s.Start) {
+			o = 1
+		}
+		r = lastBusinessDay(s.Start, o+n*i)
+	default:
+		return time.Time{}, false
+	}
+	if s.End != nil && r.After(*s.End) {
+		return time.Time{}, false
+	}
+	return r, true
+}
+
+// Validate validates the current Schedule object.
+func (s *Schedule) Validate() error {
+	switch s.Frequency {
+	case FrequencyDaily, FrequencyWeekly, FrequencyMonthly, FrequencyLastBusinessDay:
+	default:
+		return fmt.Errorf("the frequency must be one of %q, %q, %q or %q", FrequencyDaily, FrequencyWeekly, FrequencyMonthly, FrequencyLastBusinessDay)
+	}
+	if s.Interval < 0 {
+		return errors.New("the interval must not be negative")
+	}
+	if s.Start.IsZero() {
+		return errors.New("the start must not be empty")
+	}
+	if s.End != nil && s.End.Before(s.Start) {
+		return errors.New("the end must not be before the start")
+	}
+	if s.MaxOccurrences < 0 {
+		return errors.New("the maximum number of occurrences must not be negative")
+	}
+	return nil
+}
+
+// StandingOrder represents an instruction to make the same payment repeatedly, according to a schedule.
+type StandingOrder struct {
+	// ID is the ID of the standing order.
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	// UpdatedAt is the record's modification date.
+	UpdatedAt time.Time `bson:"updated_at" json:"-"`
+	// Client is the key identifying the client that created the standing order, whose daily quota is consumed by the payments the standing order generates.
+	// It is derived from the principal that created the standing order.
+	Client string `bson:"client,omitempty" json:"-"`
+	// Tenant is the tenant to which the standing order (and the payments it generates) belongs, if any.
+	// It is derived from the principal that created the standing order.
+	Tenant string `bson:"tenant,omitempty" json:"-"`
+	// LeaseExpiresAt is the date at which the lease held on the standing order by the scheduler generating a payment from it expires, if any.
+	LeaseExpiresAt *time.Time `bson:"lease_expires_at,omitempty" json:"-"`
+	// LeaseOwner is the scheduler holding a lease on the standing order in order to generate a payment from it, if any.
+	LeaseOwner string `bson:"lease_owner,omitempty" json:"-"`
+	// Version is incremented every time the state of the standing order changes, and is used to detect concurrent updates.
+	Version int64 `bson:"version" json:"-"`
+
+	// Payment is the payment generated on each occurrence of the schedule.
+	Payment PaymentTemplate `bson:"payment" json:"payment"`
+	// Schedule is the schedule according to which payments are generated.
+	Schedule Schedule `bson:"schedule" json:"schedule"`
+
+	// Generated is the number of payments generated by the standing order.
+	// It is set by the server.
+	Generated int `bson:"generated" json:"generated"`
+	// NextAt is the date of the next occurrence of the schedule, if any.
+	// It is set by the server.
+	NextAt *time.Time `bson:"next_at,omitempty" json:"next_at,omitempty"`
+	// NextOccurrence is the (zero-based) number of the next occurrence of the schedule.
+	NextOccurrence int `bson:"next_occurrence" json:"-"`
+	// Status is the status of the standing order (i.e. "active", "paused", "cancelled" or "completed").
+	// It is set by the server.
+	Status string `bson:"status" json:"status"`
+}
+
+// Advance moves the standing order to the next occurrence of its schedule, completing it in case there are none left.
+func (o *StandingOrder) Advance() {
+	o.NextOccurrence++
+	o.next()
+}
+
+// SkipUntil moves the standing order to the first occurrence of its schedule which is not before the specified date, completing it in case there are none left.
+func (o *StandingOrder) SkipUntil(t time.Time) {
+	for {
+		d, ok := o.Schedule.Occurrence(o.NextOccurrence)
+		if !ok || !d.Before(t) {
+			break
+		}
+		o.NextOccurrence++
+	}
+	o.next()
+}
+
+// Upcoming returns the dates of at most the specified number of upcoming occurrences of the schedule.
+// Standing orders which have been cancelled or completed have no upcoming occurrences.
+func (o *StandingOrder) Upcoming(n int) []time.Time {
+	r := make([]time.Time, 0)
+	if o.Status == StandingOrderStatusCancelled || o.Status == StandingOrderStatusCompleted {
+		return r
+	}
+	for i := o.NextOccurrence; len(r) < n; i++ {
+		d, ok := o.Schedule.Occurrence(i)
+		if !ok {
+			break
+		}
+		r = append(r, d)
+	}
+	return r
+}
+
+// Validate validates the current StandingOrder object.
+func (o *StandingOrder) Validate() error {
+	if err := o.Payment.Validate(); err != nil {
+		return fmt.Errorf("payment: %v", err)
+	}
+	if err := o.Schedule.Validate(); err != nil {
+		return fmt.Errorf("schedule: %v", err)
+	}
+	return nil
+}
+
+// next sets the date of the next occurrence of the schedule, completing the standing order in case there is none.
+func (o *StandingOrder) next() {
+	d, ok := o.Schedule.Occurrence(o.NextOccurrence)
+	if !ok {
+		o.NextAt, o.Status = nil, StandingOrderStatusCompleted
+		return
+	}
+	o.NextAt = &d
+}
+
+// inMonth returns the date on the specified day of the month which is the specified number of months after the provided date's, at the same time of day.
+// The day is clamped to the last day of shorter months.
+func inMonth(t time.Time, months, day int) time.Time {
+	// Start from the first day of the month so that adding months never overflows into the following one.
+	f := time.Date(t.Year(), t.Month(), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location()).AddDate(0, months, 0)
+	if n := f.AddDate(0, 1, -1).Day(); day > n {
+		day = n
+	}
+	return f.AddDate(0, 0, day-1)
+}
+
+// lastBusinessDay returns the last business day (i.e. Monday to Friday) of the month which is the specified number of months after the provided date's, at the same time of day.
+func lastBusinessDay(t time.Time, months int) time.Time {
+	r := inMonth(t, months, 31)
+	for r.Weekday() == time.Saturday || r.Weekday() == time.Sunday {
+		r = r.AddDate(0, 0, -1)
+	}
+	return r
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package models
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// date returns the specified date at 09:00 UTC.
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 9, 0, 0, 0, time.UTC)
+}
+
+var _ = Describe("Schedule", func() {
+	// occurrences returns the dates of the first n occurrences of the provided schedule.
+	occurrences := func(s Schedule, n int) []time.Time {
+		o := StandingOrder{Schedule: s}
+		return o.Upcoming(n)
+	}
+
+	It("repeats daily and weekly schedules at the configured interval", func() {
+		Expect(occurrences(Schedule{Frequency: FrequencyDaily, Interval: 2, Start: date(2019, 2, 27)}, 3)).To(Equal([]time.Time{
+			date(2019, 2, 27),
+			date(2019, 3, 1),
+			date(2019, 3, 3),
+		}))
+		Expect(occurrences(Schedule{Frequency: FrequencyWeekly, Start: date(2019, 12, 24)}, 3)).To(Equal([]time.Time{
+			date(2019, 12, 24),
+			date(2019, 12, 31),
+			date(2020, 1, 7),
+		}))
+	})
+
+	It("clamps monthly schedules to the last day of shorter months without drifting", func() {
+		Expect(occurrences(Schedule{Frequency: FrequencyMonthly, Start: date(2020, 1, 31)}, 4)).To(Equal([]time.Time{
+			date(2020, 1, 31),
+			date(2020, 2, 29),
+			date(2020, 3, 31),
+			date(2020, 4, 30),
+		}))
+	})
+
+	It("moves last business day schedules back from weekends and skips the start's month if it has already passed", func() {
+		Expect(occurrences(Schedule{Frequency: FrequencyLastBusinessDay, Start: date(2019, 8, 1)}, 3)).To(Equal([]time.Time{
+			date(2019, 8, 30),
+			date(2019, 9, 30),
+			date(2019, 10, 31),
+		}))
+		Expect(occurrences(Schedule{Frequency: FrequencyLastBusinessDay, Start: date(2019, 11, 30)}, 2)).To(Equal([]time.Time{
+			date(2019, 12, 31),
+			date(2020, 1, 31),
+		}))
+	})
+
+	It("stops at the end date or after the maximum number of occurrences", func() {
+		end := date(2019, 1, 3)
+		Expect(occurrences(Schedule{Frequency: FrequencyDaily, Start: date(2019, 1, 1), End: &end}, 10)).To(HaveLen(3))
+		Expect(occurrences(Schedule{Frequency: FrequencyDaily, Start: date(2019, 1, 1), MaxOccurrences: 2}, 10)).To(HaveLen(2))
+	})
+
+	It("rejects invalid schedules", func() {
+		end := date(2018, 12, 31)
+		Expect((&Schedule{Frequency: "yearly", Start: date(2019, 1, 1)}).Validate()).To(HaveOccurred())
+		Expect((&Schedule{Frequency: FrequencyDaily}).Validate()).To(HaveOccurred())
+		Expect((&Schedule{Frequency: FrequencyDaily, Start: date(2019, 1, 1), End: &end}).Validate()).To(HaveOccurred())
+		Expect((&Schedule{Frequency: FrequencyDaily, Start: date(2019, 1, 1), Interval: -1}).Validate()).To(HaveOccurred())
+		Expect((&Schedule{Frequency: FrequencyDaily, Start: date(2019, 1, 1)}).Validate()).NotTo(HaveOccurred())
+	})
+})
+
+var _ = Describe("StandingOrder", func() {
+	It("skips occurrences before the specified date, counting them towards the maximum", func() {
+		o := StandingOrder{Schedule: Schedule{Frequency: FrequencyDaily, Start: date(2019, 1, 1), MaxOccurrences: 5}, Status: StandingOrderStatusActive}
+		o.SkipUntil(date(2019, 1, 3))
+		Expect(o.NextOccurrence).To(Equal(2))
+		Expect(*o.NextAt).To(Equal(date(2019, 1, 3)))
+		Expect(o.Upcoming(10)).To(HaveLen(3))
+
+		o.SkipUntil(date(2019, 2, 1))
+		Expect(o.NextAt).To(BeNil())
+		Expect(o.Status).To(Equal(StandingOrderStatusCompleted))
+		Expect(o.Upcoming(10)).To(BeEmpty())
+	})
+
+	It("completes once the last occurrence has been advanced past", func() {
+		o := StandingOrder{Schedule: Schedule{Frequency: FrequencyWeekly, Start: date(2019, 1, 1), MaxOccurrences: 2}, Status: StandingOrderStatusActive}
+		o.SkipUntil(date(2019, 1, 1))
+		o.Advance()
+		Expect(*o.NextAt).To(Equal(date(2019, 1, 8)))
+		Expect(o.Status).To(Equal(StandingOrderStatusActive))
+		o.Advance()
+		Expect(o.NextAt).To(BeNil())
+		Expect(o.Status).To(Equal(StandingOrderStatusCompleted))
+	})
+
+	It("has no upcoming occurrences once cancelled", func() {
+		o := StandingOrder{Schedule: Schedule{Frequency: FrequencyDaily, Start: date(2019, 1, 1)}, Status: StandingOrderStatusCancelled}
+		Expect(o.Upcoming(10)).To(BeEmpty())
+	})
+})
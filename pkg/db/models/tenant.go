@@ -0,0 +1,27 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"time"
+)
+
+// Tenant represents a tenant whose data is stored in dedicated collections or in a dedicated database.
+type Tenant struct {
+	// ID is the name of the tenant.
+	ID string `bson:"_id"`
+	// RegisteredAt is the date at which the tenant was first accessed.
+	RegisteredAt time.Time `bson:"registered_at"`
+}
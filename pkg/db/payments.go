@@ -23,28 +23,58 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
-	"github.com/bmcstdio/dojo-payments/pkg/constants"
 	"github.com/bmcstdio/dojo-payments/pkg/db/models"
 )
 
 // PaymentsDatabase contains methods used to perform CRUD operations on payments.
 type PaymentsDatabase interface {
+	// CountPayments returns the number of registered payments.
+	CountPayments() (int64, error)
 	// CreatePayment creates the provided payment.
 	CreatePayment(models.Payment) (models.Payment, error)
 	// DeletePayment deletes the payment with the specified ID.
 	DeletePayment(string) (bool, error)
 	// GetPayment returns the payment with the specified ID.
 	GetPayment(string) (models.Payment, error)
-	// ListPayments lists all registered payments.
-	ListPayments() ([]models.Payment, error)
+	// ListPayments lists registered payments ordered by ID, skipping the specified number of payments and returning at most the specified number of them.
+	// All remaining payments are returned in case the limit is negative.
+	ListPayments(int, int) ([]models.Payment, error)
+	// RestorePayment restores the deleted payment with the specified ID.
+	RestorePayment(string) (bool, error)
+	// SearchPayments lists registered payments matching the provided filter ordered by ID, skipping the specified number of payments and returning at most the specified number of them, together with the total number of matching payments.
+	// All remaining payments are returned in case the limit is negative.
+	SearchPayments(PaymentsFilter, int, int) ([]models.Payment, int64, error)
 	// UpdatePayment updates the payment with the specified ID.
 	UpdatePayment(string, models.Payment) (models.Payment, error)
 }
 
+// PaymentsFilter selects the payments returned by SearchPayments.
+type PaymentsFilter struct {
+	// Account is the account number of either the beneficiary or the debtor of the payments to select, if any.
+	Account string
+	// Currency is the currency of the payments to select, if any.
+	Currency string
+}
+
 // mongodbPaymentsDatabase is an implementation of PaymentsDatabase powered by MongoDB.
 type mongodbPaymentsDatabase struct {
 	// c is the MongoDB collection to use for storing payments.
 	c *mongo.Collection
+	// ctx is the context within which operations are performed.
+	ctx context.Context
+	// tenant is the tenant to which the payments being accessed belong, if any.
+	tenant string
+}
+
+// CountPayments returns the number of registered payments.
+func (db *mongodbPaymentsDatabase) CountPayments() (int64, error) {
+	ctx, fn := startOperation(db.ctx, "PaymentsDatabase.CountPayments")
+	defer fn()
+	n, err := db.c.CountDocuments(ctx, existing(db.tenant))
+	if err != nil {
+		return 0, failed(ctx, fmt.Errorf("failed to count payments: %w", err))
+	}
+	return n, nil
 }
 
 // CreatePayment creates the provided payment.
@@ -52,12 +82,16 @@ func (db *mongodbPaymentsDatabase) CreatePayment(p models.Payment) (models.Payme
 	// Grab the current timestamp and set the modification date.
 	now := time.Now()
 	p.UpdatedAt = now
+	// Make the payment belong to the current tenant.
+	p.Tenant = db.tenant
+	// Hold the payment until its date arrives, or execute it right away if it already has.
+	scheduleOrExecute(&p, now)
 	// Create the payment.
-	ctx, fn := context.WithTimeout(context.Background(), constants.MongoDBOperationTimeout)
+	ctx, fn := startOperation(db.ctx, "PaymentsDatabase.CreatePayment")
 	defer fn()
 	r, err := db.c.InsertOne(ctx, p)
 	if err != nil {
-		return models.Payment{}, fmt.Errorf("failed to create payment: %v", err)
+		return models.Payment{}, failed(ctx, fmt.Errorf("failed to create payment: %w", err))
 	}
 	// Return the full payment back to the caller.
 	p.ID = r.InsertedID.(primitive.ObjectID)
@@ -74,11 +108,11 @@ func (db *mongodbPaymentsDatabase) DeletePayment(id string) (bool, error) {
 		return false, fmt.Errorf("%q is not a valid payment ID", id)
 	}
 	// Try to mark the payment as having been deleted.
-	ctx, fn := context.WithTimeout(context.Background(), constants.MongoDBOperationTimeout)
+	ctx, fn := startOperation(db.ctx, "PaymentsDatabase.DeletePayment")
 	defer fn()
-	r, err := db.c.UpdateOne(ctx, existingByID(objectID), markDeleted(now))
+	r, err := db.c.UpdateOne(ctx, existingByID(db.tenant, objectID), markDeleted(now))
 	if err != nil {
-		return false, fmt.Errorf("failed to delete payment with id %q: %v", id, err)
+		return false, failed(ctx, fmt.Errorf("failed to delete payment with id %q: %w", id, err))
 	}
 	return r.ModifiedCount != 0, nil
 }
@@ -91,18 +125,18 @@ func (db *mongodbPaymentsDatabase) GetPayment(id string) (models.Payment, error)
 		return models.Payment{}, fmt.Errorf("%q is not a valid payment ID", id)
 	}
 	// Try to retrieve the payment with the provided ID, excluding deleted payments.
-	ctx, fn := context.WithTimeout(context.Background(), constants.MongoDBOperationTimeout)
+	ctx, fn := startOperation(db.ctx, "PaymentsDatabase.GetPayment")
 	defer fn()
-	r := db.c.FindOne(ctx, existingByID(objectID))
+	r := db.c.FindOne(ctx, existingByID(db.tenant, objectID))
 	if r.Err() != nil {
-		return models.Payment{}, fmt.Errorf("failed to get payment with id %q: %v", id, r.Err())
+		return models.Payment{}, failed(ctx, fmt.Errorf("failed to get payment with id %q: %w", id, r.Err()))
 	}
 	// Check whether a payment with the provided ID was found, and return it if it does.
 	p := models.Payment{}
 	if err := r.Decode(&p); err != nil {
 		if err != mongo.ErrNoDocuments {
 			// The payment might exist or not, but we've got an unexpected error which we must propagate.
-			return models.Payment{}, fmt.Errorf("failed to get payment with id %q: %v", id, err)
+			return models.Payment{}, failed(ctx, fmt.Errorf("failed to get payment with id %q: %w", id, err))
 		}
 		// The payment was not found, so we just return an empty payment (and error).
 		return models.Payment{}, nil
@@ -110,32 +144,62 @@ func (db *mongodbPaymentsDatabase) GetPayment(id string) (models.Payment, error)
 	return p, nil
 }
 
-// ListPayments lists all registered payments.
-func (db *mongodbPaymentsDatabase) ListPayments() ([]models.Payment, error) {
-	// Try to retrieve all registered payments, excluding deleted ones.
-	ctx, fn := context.WithTimeout(context.Background(), constants.MongoDBOperationTimeout)
+// ListPayments lists registered payments ordered by ID, skipping the specified number of payments and returning at most the specified number of them.
+func (db *mongodbPaymentsDatabase) ListPayments(offset, limit int) ([]models.Payment, error) {
+	ctx, fn := startOperation(db.ctx, "PaymentsDatabase.ListPayments")
 	defer fn()
-	c, err := db.c.Find(ctx, existing())
+	r, err := db.find(ctx, existing(db.tenant), offset, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list payments: %v", err)
+		return nil, failed(ctx, fmt.Errorf("failed to list payments: %w", err))
 	}
-	defer c.Close(ctx)
-	// Build the list of payments and return it back to the caller.
-	r := make([]models.Payment, 0)
-	for c.Next(ctx) {
-		p := models.Payment{}
-		if err := c.Decode(&p); err != nil {
-			return nil, fmt.Errorf("failed to list payments: %v", err)
+	return r, nil
+}
+
+// RestorePayment restores the deleted payment with the specified ID.
+func (db *mongodbPaymentsDatabase) RestorePayment(id string) (bool, error) {
+	// Grab the ObjectID that corresponds to the provided ID.
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, fmt.Errorf("%q is not a valid payment ID", id)
+	}
+	// Try to mark the payment as not having been deleted.
+	ctx, fn := startOperation(db.ctx, "PaymentsDatabase.RestorePayment")
+	defer fn()
+	r, err := db.c.UpdateOne(ctx, deletedByID(db.tenant, objectID), markRestored())
+	if err != nil {
+		return false, failed(ctx, fmt.Errorf("failed to restore payment with id %q: %w", id, err))
+	}
+	return r.ModifiedCount != 0, nil
+}
+
+// SearchPayments lists registered payments matching the provided filter ordered by ID, skipping the specified number of payments and returning at most the specified number of them, together with the total number of matching payments.
+func (db *mongodbPaymentsDatabase) SearchPayments(filter PaymentsFilter, offset, limit int) ([]models.Payment, int64, error) {
+	// Push the filter down to the database, excluding deleted payments.
+	f := existing(db.tenant)
+	if filter.Account != "" {
+		f[orOp] = []primitive.M{
+			{beneficiaryAccountNumberFieldName: filter.Account},
+			{debtorAccountNumberFieldName: filter.Account},
 		}
-		r = append(r, p)
 	}
-	if c.Err() != nil {
-		return nil, fmt.Errorf("failed to list payments: %v", err)
+	if filter.Currency != "" {
+		f[currencyFieldName] = filter.Currency
 	}
-	return r, nil
+	ctx, fn := startOperation(db.ctx, "PaymentsDatabase.SearchPayments")
+	defer fn()
+	n, err := db.c.CountDocuments(ctx, f)
+	if err != nil {
+		return nil, 0, failed(ctx, fmt.Errorf("failed to search payments: %w", err))
+	}
+	r, err := db.find(ctx, f, offset, limit)
+	if err != nil {
+		return nil, 0, failed(ctx, fmt.Errorf("failed to search payments: %w", err))
+	}
+	return r, n, nil
 }
 
 // UpdatePayment updates the payment with the specified ID.
+// Payments which have not been executed yet are scheduled (or executed right away) based on their new date, while the date of executed payments cannot be changed.
 func (db *mongodbPaymentsDatabase) UpdatePayment(id string, p models.Payment) (models.Payment, error) {
 	// Grab the current timestamp so we can set the modification date.
 	now := time.Now()
@@ -144,28 +208,125 @@ func (db *mongodbPaymentsDatabase) UpdatePayment(id string, p models.Payment) (m
 	if err != nil {
 		return models.Payment{}, fmt.Errorf("%q is not a valid payment ID", id)
 	}
-	// Force-overwrite the payment's ID so that it is not possibly changed during the update.
-	p.ID = objectID
-	// Set the payment's modification date.
-	p.UpdatedAt = now
-	// Try to update the payment with the specified ID, requesting for the new (updated) document to be returned.
-	opts := &options.FindOneAndReplaceOptions{}
-	opts.SetReturnDocument(options.After)
-	ctx, fn := context.WithTimeout(context.Background(), constants.MongoDBOperationTimeout)
+	ctx, fn := startOperation(db.ctx, "PaymentsDatabase.UpdatePayment")
 	defer fn()
-	r := db.c.FindOneAndReplace(ctx, existingByID(objectID), p, opts)
-	if r.Err() != nil {
-		return models.Payment{}, fmt.Errorf("failed to update payment: %v", r.Err())
+	// Try to update the payment in case it has not been executed yet, releasing the lease held on it (if any) so that it is not executed ahead of its new date.
+	f := existingByID(db.tenant, objectID)
+	f[statusFieldName] = primitive.M{neOp: models.PaymentStatusExecuted}
+	res, err := db.findOneAndUpdate(ctx, f, reschedule(p, now))
+	if err != nil || res != (models.Payment{}) {
+		return res, err
 	}
-	// Check whether a payment with the provided ID was found, and return it if it does.
+	// Otherwise, try to update the (executed) payment in case its date is left unchanged.
+	f = existingByID(db.tenant, objectID)
+	f[dateFieldName] = p.Date
+	f[statusFieldName] = models.PaymentStatusExecuted
+	res, err = db.findOneAndUpdate(ctx, f, primitive.M{setOp: updatableFields(p, now)})
+	if err != nil || res != (models.Payment{}) {
+		return res, err
+	}
+	// Tell apart payments which do not exist from executed payments whose date was being changed.
+	n, err := db.c.CountDocuments(ctx, existingByID(db.tenant, objectID))
+	if err != nil {
+		return models.Payment{}, failed(ctx, fmt.Errorf("failed to update payment: %w", err))
+	}
+	if n > 0 {
+		return models.Payment{}, ErrPaymentExecuted
+	}
+	// The payment was not found, so we just return an empty payment (and error).
+	return models.Payment{}, nil
+}
+
+// find returns the payments matching the provided filter ordered by ID, skipping the specified number of payments and returning at most the specified number of them (or all remaining payments in case the limit is negative).
+func (db *mongodbPaymentsDatabase) find(ctx context.Context, f primitive.M, offset, limit int) ([]models.Payment, error) {
+	// Order payments by ID so that pages are stable, and push the selection of the requested page to the database.
+	opts := &options.FindOptions{}
+	opts.SetSort(primitive.D{{Key: idFieldName, Value: 1}})
+	opts.SetSkip(int64(offset))
+	if limit >= 0 {
+		if limit == 0 {
+			// A limit of zero means no limit to MongoDB.
+			return make([]models.Payment, 0), nil
+		}
+		opts.SetLimit(int64(limit))
+	}
+	c, err := db.c.Find(ctx, f, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close(ctx)
+	// Build the list of payments and return it back to the caller.
+	r := make([]models.Payment, 0)
+	for c.Next(ctx) {
+		p := models.Payment{}
+		if err := c.Decode(&p); err != nil {
+			return nil, err
+		}
+		r = append(r, p)
+	}
+	if c.Err() != nil {
+		return nil, c.Err()
+	}
+	return r, nil
+}
+
+// findOneAndUpdate applies the provided update to the payment matching the provided filter, returning the updated payment or an empty payment in case none matches.
+func (db *mongodbPaymentsDatabase) findOneAndUpdate(ctx context.Context, f, u primitive.M) (models.Payment, error) {
+	opts := &options.FindOneAndUpdateOptions{}
+	opts.SetReturnDocument(options.After)
+	r := db.c.FindOneAndUpdate(ctx, f, u, opts)
 	res := models.Payment{}
 	if err := r.Decode(&res); err != nil {
 		if err != mongo.ErrNoDocuments {
 			// The payment might exist or not, but we've got an unexpected error which we must propagate.
-			return models.Payment{}, fmt.Errorf("failed to update payment: %v", r.Err())
+			return models.Payment{}, failed(ctx, fmt.Errorf("failed to update payment: %w", err))
 		}
-		// The payment was not found, so we just return an empty payment (and error).
 		return models.Payment{}, nil
 	}
 	return res, nil
 }
+
+// reschedule returns the update that replaces the fields of a payment which has not been executed yet with the ones of the provided payment, which is being updated at the specified time, scheduling (or executing) it based on its new date.
+// The lease held on the payment (if any) is released, so that it is not executed by the scheduler based on its previous date.
+func reschedule(p models.Payment, now time.Time) primitive.M {
+	scheduleOrExecute(&p, now)
+	s := updatableFields(p, now)
+	s[statusFieldName] = p.Status
+	u := primitive.M{
+		unsetOp: primitive.M{
+			leaseExpiresAtFieldName: "",
+			leaseOwnerFieldName:     "",
+		},
+	}
+	if p.ExecutedAt != nil {
+		s[executedAtFieldName] = *p.ExecutedAt
+	} else {
+		u[unsetOp].(primitive.M)[executedAtFieldName] = ""
+	}
+	u[setOp] = s
+	return u
+}
+
+// scheduleOrExecute sets the status of the provided payment, which is being created (or rescheduled) at the specified time, based on its date.
+// Payments dated in the future are scheduled, and are executed by the scheduler once their date arrives.
+func scheduleOrExecute(p *models.Payment, now time.Time) {
+	p.LeaseExpiresAt, p.LeaseOwner = nil, ""
+	if p.Date.After(now) {
+		p.ExecutedAt, p.Status = nil, models.PaymentStatusScheduled
+		return
+	}
+	p.ExecutedAt, p.Status = &now, models.PaymentStatusExecuted
+}
+
+// updatableFields returns the values of the fields of the provided payment which may be changed by the caller, together with the modification date, preserving the payment's tenant, status and lease (if any).
+func updatableFields(p models.Payment, now time.Time) primitive.M {
+	return primitive.M{
+		amountFieldName:      p.Amount,
+		beneficiaryFieldName: p.Beneficiary,
+		currencyFieldName:    p.Currency,
+		dateFieldName:        p.Date,
+		debtorFieldName:      p.Debtor,
+		descriptionFieldName: p.Description,
+		updatedAtFieldName:   now,
+	}
+}
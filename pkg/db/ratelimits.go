@@ -0,0 +1,154 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+const (
+	// duplicateKeyErrorCode is the code of the error returned by MongoDB when a unique index is violated.
+	duplicateKeyErrorCode = 11000
+)
+
+// RateLimitsDatabase contains methods used to share the state of rate limits and quotas between instances of the API server.
+type RateLimitsDatabase interface {
+	// GetRateLimitBucket returns the token bucket with the specified key.
+	GetRateLimitBucket(string) (models.RateLimitBucket, error)
+	// IncrementQuotaUsage atomically adds the specified count and amount (in the specified currency) to the usage of the quota with the specified key, which expires at the provided date.
+	// The usage is left untouched and false is returned in case the resulting count or amount would exceed the specified maximums (if positive).
+	IncrementQuotaUsage(key string, count int64, currency string, amount float64, maxCount int64, maxAmount float64, expiresAt time.Time) (bool, error)
+	// SaveRateLimitBucket saves the provided token bucket, provided that it has not been updated since it was read.
+	// It returns false in case the bucket has been concurrently updated.
+	SaveRateLimitBucket(models.RateLimitBucket) (bool, error)
+}
+
+// mongodbRateLimitsDatabase is an implementation of RateLimitsDatabase powered by MongoDB.
+type mongodbRateLimitsDatabase struct {
+	// buckets is the MongoDB collection to use for storing token buckets.
+	buckets *mongo.Collection
+	// ctx is the context within which operations are performed.
+	ctx context.Context
+	// quotas is the MongoDB collection to use for storing the usage of quotas.
+	quotas *mongo.Collection
+}
+
+// GetRateLimitBucket returns the token bucket with the specified key.
+func (db *mongodbRateLimitsDatabase) GetRateLimitBucket(key string) (models.RateLimitBucket, error) {
+	ctx, fn := startOperation(db.ctx, "RateLimitsDatabase.GetRateLimitBucket")
+	defer fn()
+	r := db.buckets.FindOne(ctx, byID(key))
+	if r.Err() != nil {
+		return models.RateLimitBucket{}, failed(ctx, fmt.Errorf("failed to get rate limit bucket %q: %w", key, r.Err()))
+	}
+	// Check whether the bucket was found, and return it if it does.
+	b := models.RateLimitBucket{}
+	if err := r.Decode(&b); err != nil {
+		if err != mongo.ErrNoDocuments {
+			return models.RateLimitBucket{}, failed(ctx, fmt.Errorf("failed to get rate limit bucket %q: %w", key, err))
+		}
+		// The bucket was not found, so we just return an empty bucket (and error).
+		return models.RateLimitBucket{}, nil
+	}
+	return b, nil
+}
+
+// IncrementQuotaUsage atomically adds the specified count and amount (in the specified currency) to the usage of the quota with the specified key.
+func (db *mongodbRateLimitsDatabase) IncrementQuotaUsage(key string, count int64, currency string, amount float64, maxCount int64, maxAmount float64, expiresAt time.Time) (bool, error) {
+	amountFieldName := quotaAmountsFieldName + "." + currency
+	// Only select the usage in case incrementing it would not exceed the maximums.
+	// In case it is not selected, an upsert is attempted which fails if the usage already exists.
+	f := byID(key)
+	c := make([]primitive.M, 0)
+	if maxCount > 0 {
+		c = append(c, atMostOrMissing(quotaCountFieldName, float64(maxCount-count)))
+	}
+	if maxAmount > 0 {
+		c = append(c, atMostOrMissing(amountFieldName, maxAmount-amount))
+	}
+	if len(c) > 0 {
+		f[andOp] = c
+	}
+	opts := &options.UpdateOptions{}
+	opts.SetUpsert(true)
+	ctx, fn := startOperation(db.ctx, "RateLimitsDatabase.IncrementQuotaUsage")
+	defer fn()
+	_, err := db.quotas.UpdateOne(ctx, f, primitive.M{
+		incOp: primitive.M{
+			quotaCountFieldName: count,
+			amountFieldName:     amount,
+		},
+		setOp: primitive.M{
+			expiresAtFieldName: expiresAt,
+		},
+	}, opts)
+	if isDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, failed(ctx, fmt.Errorf("failed to increment usage of quota %q: %w", key, err))
+	}
+	return true, nil
+}
+
+// SaveRateLimitBucket saves the provided token bucket, provided that it has not been updated since it was read.
+func (db *mongodbRateLimitsDatabase) SaveRateLimitBucket(b models.RateLimitBucket) (bool, error) {
+	ctx, fn := startOperation(db.ctx, "RateLimitsDatabase.SaveRateLimitBucket")
+	defer fn()
+	// Create the bucket in case it has never been saved, failing if it has been concurrently created.
+	if b.Version == 0 {
+		b.Version = 1
+		_, err := db.buckets.InsertOne(ctx, b)
+		if isDuplicateKeyError(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, failed(ctx, fmt.Errorf("failed to save rate limit bucket %q: %w", b.Key, err))
+		}
+		return true, nil
+	}
+	// Replace the bucket in case it has not been concurrently updated.
+	f := byID(b.Key)
+	f[versionFieldName] = b.Version
+	b.Version++
+	r, err := db.buckets.ReplaceOne(ctx, f, b)
+	if err != nil {
+		return false, failed(ctx, fmt.Errorf("failed to save rate limit bucket %q: %w", b.Key, err))
+	}
+	return r.ModifiedCount != 0, nil
+}
+
+// isDuplicateKeyError returns a value indicating whether the provided error was caused by a unique index being violated.
+func isDuplicateKeyError(err error) bool {
+	switch e := err.(type) {
+	case mongo.WriteException:
+		for _, we := range e.WriteErrors {
+			if we.Code == duplicateKeyErrorCode {
+				return true
+			}
+		}
+	case mongo.CommandError:
+		return e.Code == duplicateKeyErrorCode
+	}
+	return false
+}
@@ -0,0 +1,257 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+// ScheduledPaymentsDatabase contains methods used to execute scheduled payments once their date arrives, and to generate payments from standing orders.
+// Scheduled payments and standing orders belonging to all tenants are accessed.
+// The tenants are listed once per view, so a view should be obtained for every pass over due records (tenants registered in the meantime being picked up by the next pass).
+type ScheduledPaymentsDatabase interface {
+	// AdvanceStandingOrder saves the state of the provided (claimed) standing order after a payment has been generated from it, and releases the lease held on it by the specified owner.
+	// It returns an empty standing order in case the lease is no longer held by the owner, or in case the standing order has been modified (e.g. paused) since it was claimed.
+	AdvanceStandingOrder(models.StandingOrder, string) (models.StandingOrder, error)
+	// ClaimDuePayment leases a scheduled payment whose date is not after the provided time on behalf of the specified owner, for the provided duration.
+	// Payments whose lease has expired (e.g. because their owner crashed) may be claimed again.
+	// It returns an empty payment in case there are no due payments left to claim.
+	ClaimDuePayment(string, time.Time, time.Duration) (models.Payment, error)
+	// ClaimDueStandingOrder leases an active standing order whose next occurrence is not after the provided time on behalf of the specified owner, for the provided duration.
+	// Standing orders whose lease has expired may be claimed again.
+	// It returns an empty standing order in case there are no due standing orders left to claim.
+	ClaimDueStandingOrder(string, time.Time, time.Duration) (models.StandingOrder, error)
+	// ExecutePayment marks the provided (claimed) payment as having been executed at the provided time, and releases the lease held on it by the specified owner.
+	// It returns an empty payment in case the lease is no longer held by the owner (e.g. because it expired and the payment was claimed by someone else).
+	ExecutePayment(models.Payment, string, time.Time) (models.Payment, error)
+}
+
+// mongodbScheduledPaymentsDatabase is an implementation of ScheduledPaymentsDatabase powered by MongoDB.
+type mongodbScheduledPaymentsDatabase struct {
+	// collections holds the collections belonging to every tenant, by name, as listed the first time they were needed.
+	collections map[string][]*mongo.Collection
+	// ctx is the context within which operations are performed.
+	ctx context.Context
+	// database is the database from which views of the collections storing payments belonging to each tenant are obtained.
+	database *mongodbDatabase
+	// mu synchronizes access to collections.
+	mu sync.Mutex
+}
+
+// AdvanceStandingOrder saves the state of the provided (claimed) standing order after a payment has been generated from it, and releases the lease held on it by the specified owner.
+func (db *mongodbScheduledPaymentsDatabase) AdvanceStandingOrder(o models.StandingOrder, owner string) (models.StandingOrder, error) {
+	// Grab a view of the collection storing standing orders belonging to the standing order's tenant.
+	v, err := db.database.ForTenant(o.Tenant)
+	if err != nil {
+		return models.StandingOrder{}, err
+	}
+	c := v.(*mongodbDatabase).collection("standing_orders")
+	// Only select the standing order in case it is still leased by the specified owner and has not been modified since it was claimed.
+	f := byID(o.ID)
+	f[leaseOwnerFieldName] = owner
+	f[versionFieldName] = o.Version
+	ctx, fn := startOperation(db.ctx, "ScheduledPaymentsDatabase.AdvanceStandingOrder")
+	defer fn()
+	r, err := updateStandingOrder(ctx, c, f, o, time.Now(), true)
+	if err != nil {
+		return models.StandingOrder{}, failed(ctx, fmt.Errorf("failed to advance standing order with id %q: %w", o.ID.Hex(), err))
+	}
+	return r, nil
+}
+
+// ClaimDuePayment leases a scheduled payment whose date is not after the provided time on behalf of the specified owner, for the provided duration.
+func (db *mongodbScheduledPaymentsDatabase) ClaimDuePayment(owner string, now time.Time, lease time.Duration) (models.Payment, error) {
+	ctx, fn := startOperation(db.ctx, "ScheduledPaymentsDatabase.ClaimDuePayment")
+	defer fn()
+	// Only select scheduled payments which have not been deleted.
+	f := primitive.M{
+		deletedAtFieldName: primitive.M{eqOp: nil},
+		statusFieldName:    models.PaymentStatusScheduled,
+	}
+	p := models.Payment{}
+	if err := db.claimDue(ctx, "payments", dateFieldName, f, owner, now, lease, &p); err != nil {
+		return models.Payment{}, failed(ctx, fmt.Errorf("failed to claim due payment: %w", err))
+	}
+	return p, nil
+}
+
+// ClaimDueStandingOrder leases an active standing order whose next occurrence is not after the provided time on behalf of the specified owner, for the provided duration.
+func (db *mongodbScheduledPaymentsDatabase) ClaimDueStandingOrder(owner string, now time.Time, lease time.Duration) (models.StandingOrder, error) {
+	ctx, fn := startOperation(db.ctx, "ScheduledPaymentsDatabase.ClaimDueStandingOrder")
+	defer fn()
+	f := primitive.M{
+		statusFieldName: models.StandingOrderStatusActive,
+	}
+	o := models.StandingOrder{}
+	if err := db.claimDue(ctx, "standing_orders", nextAtFieldName, f, owner, now, lease, &o); err != nil {
+		return models.StandingOrder{}, failed(ctx, fmt.Errorf("failed to claim due standing order: %w", err))
+	}
+	return o, nil
+}
+
+// ExecutePayment marks the provided (claimed) payment as having been executed at the provided time, and releases the lease held on it by the specified owner.
+func (db *mongodbScheduledPaymentsDatabase) ExecutePayment(p models.Payment, owner string, now time.Time) (models.Payment, error) {
+	// Grab a view of the collection storing payments belonging to the payment's tenant.
+	v, err := db.database.ForTenant(p.Tenant)
+	if err != nil {
+		return models.Payment{}, err
+	}
+	c := v.(*mongodbDatabase).collection("payments")
+	// Only select the payment in case it is still scheduled, due and leased by the specified owner.
+	f := executable(p.ID, owner, now)
+	u := primitive.M{
+		setOp: primitive.M{
+			executedAtFieldName: now,
+			statusFieldName:     models.PaymentStatusExecuted,
+			updatedAtFieldName:  now,
+		},
+		unsetOp: primitive.M{
+			leaseExpiresAtFieldName: "",
+			leaseOwnerFieldName:     "",
+		},
+	}
+	opts := &options.FindOneAndUpdateOptions{}
+	opts.SetReturnDocument(options.After)
+	ctx, fn := startOperation(db.ctx, "ScheduledPaymentsDatabase.ExecutePayment")
+	defer fn()
+	r := c.FindOneAndUpdate(ctx, f, u, opts)
+	res := models.Payment{}
+	if err := r.Decode(&res); err != nil {
+		if err != mongo.ErrNoDocuments {
+			return models.Payment{}, failed(ctx, fmt.Errorf("failed to execute payment with id %q: %w", p.ID.Hex(), err))
+		}
+		// The lease is no longer held by the owner.
+		return models.Payment{}, nil
+	}
+	return res, nil
+}
+
+// claimDue leases the record matching the provided filter whose value for the specified date field is the oldest one not after the provided time, across the collections with the specified name belonging to every tenant.
+// Records which are leased are only selected in case their lease has expired.
+// The claimed record (if any) is decoded into v, which is left untouched otherwise.
+func (db *mongodbScheduledPaymentsDatabase) claimDue(ctx context.Context, name, field string, f primitive.M, owner string, now time.Time, lease time.Duration, v interface{}) error {
+	collections, err := db.tenantCollections(ctx, name)
+	if err != nil {
+		return err
+	}
+	for k, e := range atMostOrMissing(leaseExpiresAtFieldName, now) {
+		f[k] = e
+	}
+	f[field] = primitive.M{lteOp: now}
+	u := primitive.M{
+		setOp: primitive.M{
+			leaseExpiresAtFieldName: now.Add(lease),
+			leaseOwnerFieldName:     owner,
+		},
+	}
+	opts := &options.FindOneAndUpdateOptions{}
+	opts.SetReturnDocument(options.After)
+	opts.SetSort(primitive.D{{Key: field, Value: 1}})
+	for {
+		c, err := oldestDue(ctx, collections, field, f)
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			return nil
+		}
+		if err := c.FindOneAndUpdate(ctx, f, u, opts).Decode(v); err != nil {
+			if err == mongo.ErrNoDocuments && len(collections) > 1 {
+				// The record was claimed by someone else in the meantime, so look for the next oldest one.
+				continue
+			}
+			if err == mongo.ErrNoDocuments {
+				return nil
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// tenantCollections returns the collections with the specified name belonging to every tenant, listing them only the first time they are needed.
+func (db *mongodbScheduledPaymentsDatabase) tenantCollections(ctx context.Context, name string) ([]*mongo.Collection, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if c, ok := db.collections[name]; ok {
+		return c, nil
+	}
+	c, err := tenantCollections(ctx, db.database.root, db.database.mode, name)
+	if err != nil {
+		return nil, err
+	}
+	if db.collections == nil {
+		db.collections = make(map[string][]*mongo.Collection)
+	}
+	db.collections[name] = c
+	return c, nil
+}
+
+// oldestDue returns the collection among the provided ones holding the record matching the provided filter whose value for the specified date field is the oldest one, or nil in case none of them holds a matching record.
+func oldestDue(ctx context.Context, collections []*mongo.Collection, field string, f primitive.M) (*mongo.Collection, error) {
+	if len(collections) == 1 {
+		// There is nothing to compare, so let the caller find out whether there is a matching record.
+		return collections[0], nil
+	}
+	opts := &options.FindOneOptions{}
+	opts.SetProjection(primitive.M{field: 1})
+	opts.SetSort(primitive.D{{Key: field, Value: 1}})
+	dates := make([]*time.Time, len(collections))
+	for i, c := range collections {
+		r, err := c.FindOne(ctx, f, opts).DecodeBytes()
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				continue
+			}
+			return nil, err
+		}
+		if t, ok := r.Lookup(field).TimeOK(); ok {
+			dates[i] = &t
+		}
+	}
+	if i := oldest(dates); i >= 0 {
+		return collections[i], nil
+	}
+	return nil, nil
+}
+
+// oldest returns the index of the oldest of the provided times (the first one in case of a tie), ignoring missing ones, or -1 in case all of them are missing.
+func oldest(v []*time.Time) int {
+	r := -1
+	for i, t := range v {
+		if t != nil && (r < 0 || t.Before(*v[r])) {
+			r = i
+		}
+	}
+	return r
+}
+
+// executable returns a filter that selects the payment with the specified ID in case it is still scheduled, its date is not after the provided time and it is leased by the specified owner.
+// Payments whose date has been changed since they were claimed (which releases their lease) are hence not executed.
+func executable(id primitive.ObjectID, owner string, now time.Time) primitive.M {
+	f := byID(id)
+	f[dateFieldName] = primitive.M{lteOp: now}
+	f[leaseOwnerFieldName] = owner
+	f[statusFieldName] = models.PaymentStatusScheduled
+	return f
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package db
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+var _ = Describe("Scheduled payments", func() {
+	now := time.Date(2019, 4, 30, 22, 30, 0, 0, time.UTC)
+
+	It("are held until their date arrives", func() {
+		p := models.Payment{Date: now.Add(time.Second), LeaseOwner: "foo", Status: models.PaymentStatusExecuted}
+		scheduleOrExecute(&p, now)
+		Expect(p.Status).To(Equal(models.PaymentStatusScheduled))
+		Expect(p.ExecutedAt).To(BeNil())
+		Expect(p.LeaseOwner).To(BeEmpty())
+	})
+
+	It("are executed right away in case their date has arrived", func() {
+		for _, d := range []time.Time{now, now.Add(-time.Hour)} {
+			p := models.Payment{Date: d, Status: models.PaymentStatusScheduled}
+			scheduleOrExecute(&p, now)
+			Expect(p.Status).To(Equal(models.PaymentStatusExecuted))
+			Expect(*p.ExecutedAt).To(Equal(now))
+		}
+	})
+
+	It("are accessed across tenants", func() {
+		c, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+		Expect(err).NotTo(HaveOccurred())
+		m, err := newMongoDBDatabase(c.Database("dojo-payments"), WithTenancyMode(TenancyModeDatabase))
+		Expect(err).NotTo(HaveOccurred())
+		v, err := m.ForTenant("acme")
+		Expect(err).NotTo(HaveOccurred())
+		d := v.ScheduledPayments().(*mongodbScheduledPaymentsDatabase).database
+		Expect(d.db.Name()).To(Equal("dojo-payments"))
+		Expect(d.tenant).To(BeEmpty())
+	})
+
+	It("are claimed from the collection holding the oldest due one", func() {
+		a, b := now.Add(-time.Hour), now.Add(-2*time.Hour)
+		Expect(oldest([]*time.Time{nil, &a, &b, &b})).To(Equal(2))
+		Expect(oldest([]*time.Time{nil, nil})).To(Equal(-1))
+		Expect(oldest(nil)).To(Equal(-1))
+	})
+
+	It("are rescheduled when their date is pushed into the future, releasing their lease", func() {
+		u := reschedule(models.Payment{Date: now.Add(time.Hour), Status: models.PaymentStatusExecuted}, now)
+		Expect(u[setOp]).To(HaveKeyWithValue(statusFieldName, models.PaymentStatusScheduled))
+		Expect(u[setOp]).To(HaveKeyWithValue(dateFieldName, now.Add(time.Hour)))
+		Expect(u[setOp]).NotTo(HaveKey(executedAtFieldName))
+		Expect(u[unsetOp]).To(Equal(primitive.M{executedAtFieldName: "", leaseExpiresAtFieldName: "", leaseOwnerFieldName: ""}))
+	})
+
+	It("are executed right away when their date is moved to the past", func() {
+		u := reschedule(models.Payment{Date: now.Add(-time.Hour), Status: models.PaymentStatusScheduled}, now)
+		Expect(u[setOp]).To(HaveKeyWithValue(statusFieldName, models.PaymentStatusExecuted))
+		Expect(u[setOp]).To(HaveKeyWithValue(executedAtFieldName, now))
+		Expect(u[unsetOp]).To(Equal(primitive.M{leaseExpiresAtFieldName: "", leaseOwnerFieldName: ""}))
+	})
+
+	It("are only executed in case they are still due and leased by the owner", func() {
+		id := primitive.NewObjectID()
+		Expect(executable(id, "foo", now)).To(Equal(primitive.M{
+			idFieldName:         id,
+			dateFieldName:       primitive.M{lteOp: now},
+			leaseOwnerFieldName: "foo",
+			statusFieldName:     models.PaymentStatusScheduled,
+		}))
+	})
+
+	It("are indexed by status and date", func() {
+		Expect(scheduledPaymentsIndexes).To(HaveLen(1))
+		Expect(scheduledPaymentsIndexes[0].Keys).To(Equal(primitive.D{{Key: "status", Value: 1}, {Key: "date", Value: 1}}))
+	})
+})
@@ -0,0 +1,164 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+// StandingOrdersDatabase contains methods used to manage standing orders.
+type StandingOrdersDatabase interface {
+	// CreateStandingOrder creates the provided standing order, which starts at the first occurrence of its schedule which is not in the past.
+	CreateStandingOrder(models.StandingOrder) (models.StandingOrder, error)
+	// GetStandingOrder returns the standing order with the specified ID.
+	GetStandingOrder(string) (models.StandingOrder, error)
+	// ListStandingOrders lists all registered standing orders.
+	ListStandingOrders() ([]models.StandingOrder, error)
+	// UpdateStandingOrder updates the status and the next occurrence of the provided standing order, provided that it has not been modified since it was read.
+	// It returns an empty standing order in case it does not exist or has been modified since it was read.
+	UpdateStandingOrder(models.StandingOrder) (models.StandingOrder, error)
+}
+
+// mongodbStandingOrdersDatabase is an implementation of StandingOrdersDatabase powered by MongoDB.
+type mongodbStandingOrdersDatabase struct {
+	// c is the MongoDB collection to use for storing standing orders.
+	c *mongo.Collection
+	// ctx is the context within which operations are performed.
+	ctx context.Context
+	// tenant is the tenant to which the standing orders being accessed belong, if any.
+	tenant string
+}
+
+// CreateStandingOrder creates the provided standing order.
+func (db *mongodbStandingOrdersDatabase) CreateStandingOrder(o models.StandingOrder) (models.StandingOrder, error) {
+	// Grab the current timestamp and set the modification date.
+	now := time.Now()
+	o.UpdatedAt = now
+	// Make the standing order belong to the current tenant.
+	o.Tenant = db.tenant
+	// Start the standing order from scratch, skipping occurrences which are already in the past.
+	o.ID, o.LeaseExpiresAt, o.LeaseOwner, o.Version = primitive.NilObjectID, nil, "", 0
+	o.Generated, o.NextOccurrence, o.Status = 0, 0, models.StandingOrderStatusActive
+	o.SkipUntil(now)
+	// Create the standing order.
+	ctx, fn := startOperation(db.ctx, "StandingOrdersDatabase.CreateStandingOrder")
+	defer fn()
+	r, err := db.c.InsertOne(ctx, o)
+	if err != nil {
+		return models.StandingOrder{}, failed(ctx, fmt.Errorf("failed to create standing order: %w", err))
+	}
+	// Return the full standing order back to the caller.
+	o.ID = r.InsertedID.(primitive.ObjectID)
+	return o, nil
+}
+
+// GetStandingOrder returns the standing order with the specified ID.
+func (db *mongodbStandingOrdersDatabase) GetStandingOrder(id string) (models.StandingOrder, error) {
+	// Grab the ObjectID that corresponds to the provided ID.
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.StandingOrder{}, fmt.Errorf("%q is not a valid standing order ID", id)
+	}
+	// Try to retrieve the standing order with the provided ID.
+	ctx, fn := startOperation(db.ctx, "StandingOrdersDatabase.GetStandingOrder")
+	defer fn()
+	r := db.c.FindOne(ctx, existingByID(db.tenant, objectID))
+	o := models.StandingOrder{}
+	if err := r.Decode(&o); err != nil {
+		if err != mongo.ErrNoDocuments {
+			return models.StandingOrder{}, failed(ctx, fmt.Errorf("failed to get standing order with id %q: %w", id, err))
+		}
+		// The standing order was not found, so we just return an empty standing order (and error).
+		return models.StandingOrder{}, nil
+	}
+	return o, nil
+}
+
+// ListStandingOrders lists all registered standing orders.
+func (db *mongodbStandingOrdersDatabase) ListStandingOrders() ([]models.StandingOrder, error) {
+	ctx, fn := startOperation(db.ctx, "StandingOrdersDatabase.ListStandingOrders")
+	defer fn()
+	c, err := db.c.Find(ctx, existing(db.tenant))
+	if err != nil {
+		return nil, failed(ctx, fmt.Errorf("failed to list standing orders: %w", err))
+	}
+	defer c.Close(ctx)
+	r := make([]models.StandingOrder, 0)
+	for c.Next(ctx) {
+		o := models.StandingOrder{}
+		if err := c.Decode(&o); err != nil {
+			return nil, failed(ctx, fmt.Errorf("failed to list standing orders: %w", err))
+		}
+		r = append(r, o)
+	}
+	if c.Err() != nil {
+		return nil, failed(ctx, fmt.Errorf("failed to list standing orders: %w", c.Err()))
+	}
+	return r, nil
+}
+
+// UpdateStandingOrder updates the status and the next occurrence of the provided standing order, provided that it has not been modified since it was read.
+func (db *mongodbStandingOrdersDatabase) UpdateStandingOrder(o models.StandingOrder) (models.StandingOrder, error) {
+	f := existingByID(db.tenant, o.ID)
+	f[versionFieldName] = o.Version
+	ctx, fn := startOperation(db.ctx, "StandingOrdersDatabase.UpdateStandingOrder")
+	defer fn()
+	r, err := updateStandingOrder(ctx, db.c, f, o, time.Now(), false)
+	if err != nil {
+		return models.StandingOrder{}, failed(ctx, fmt.Errorf("failed to update standing order with id %q: %w", o.ID.Hex(), err))
+	}
+	return r, nil
+}
+
+// updateStandingOrder saves the state of the provided standing order to the document matching the provided filter (if any), incrementing its version.
+// The lease held on the standing order (if any) is released if requested.
+// It returns an empty standing order in case no document matches the filter.
+func updateStandingOrder(ctx context.Context, c *mongo.Collection, f primitive.M, o models.StandingOrder, now time.Time, release bool) (models.StandingOrder, error) {
+	u := primitive.M{
+		incOp: primitive.M{
+			versionFieldName: 1,
+		},
+		setOp: primitive.M{
+			generatedFieldName:      o.Generated,
+			nextAtFieldName:         o.NextAt,
+			nextOccurrenceFieldName: o.NextOccurrence,
+			statusFieldName:         o.Status,
+			updatedAtFieldName:      now,
+		},
+	}
+	if release {
+		u[unsetOp] = primitive.M{
+			leaseExpiresAtFieldName: "",
+			leaseOwnerFieldName:     "",
+		}
+	}
+	opts := &options.FindOneAndUpdateOptions{}
+	opts.SetReturnDocument(options.After)
+	r := models.StandingOrder{}
+	if err := c.FindOneAndUpdate(ctx, f, u, opts).Decode(&r); err != nil {
+		if err != mongo.ErrNoDocuments {
+			return models.StandingOrder{}, err
+		}
+		return models.StandingOrder{}, nil
+	}
+	return r, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ = Describe("Tenancy", func() {
+	// newDatabase returns a new instance of Database using the specified tenancy mode, without connecting to MongoDB.
+	newDatabase := func(mode TenancyMode) *mongodbDatabase {
+		c, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+		Expect(err).NotTo(HaveOccurred())
+		m, err := newMongoDBDatabase(c.Database("dojo-payments"), WithTenancyMode(mode))
+		Expect(err).NotTo(HaveOccurred())
+		return m
+	}
+
+	// forTenant returns a view of the provided database scoped to the specified tenant.
+	forTenant := func(m *mongodbDatabase, tenant string) *mongodbDatabase {
+		r, err := m.ForTenant(tenant)
+		Expect(err).NotTo(HaveOccurred())
+		return r.(*mongodbDatabase)
+	}
+
+	Describe("filters", func() {
+		It("select existing payments belonging to the specified tenant", func() {
+			id := primitive.NewObjectID()
+			Expect(existingByID("acme", id)).To(Equal(primitive.M{
+				idFieldName:        id,
+				deletedAtFieldName: primitive.M{eqOp: nil},
+				tenantFieldName:    primitive.M{eqOp: "acme"},
+			}))
+			Expect(existing("acme")).To(Equal(primitive.M{
+				deletedAtFieldName: primitive.M{eqOp: nil},
+				tenantFieldName:    primitive.M{eqOp: "acme"},
+			}))
+		})
+
+		It("select deleted payments belonging to the specified tenant", func() {
+			id := primitive.NewObjectID()
+			Expect(deletedByID("acme", id)).To(Equal(primitive.M{
+				idFieldName:        id,
+				deletedAtFieldName: primitive.M{neOp: nil},
+				tenantFieldName:    primitive.M{eqOp: "acme"},
+			}))
+		})
+
+		It("select payments not belonging to any tenant for the empty tenant", func() {
+			Expect(existing("")).To(HaveKeyWithValue(tenantFieldName, primitive.M{eqOp: nil}))
+		})
+	})
+
+	Describe("views", func() {
+		It("are scoped to the specified tenant", func() {
+			m := forTenant(newDatabase(TenancyModeShared), "acme")
+			Expect(m.Payments().(*mongodbPaymentsDatabase).tenant).To(Equal("acme"))
+			Expect(m.Events().(*mongodbEventsDatabase).tenant).To(Equal("acme"))
+		})
+
+		It("reject invalid tenants", func() {
+			_, err := newDatabase(TenancyModeShared).ForTenant("acme/../other")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("do not scope api keys", func() {
+			m := forTenant(newDatabase(TenancyModeDatabase), "acme")
+			c := m.APIKeys().(*mongodbAPIKeysDatabase).c
+			Expect(c.Database().Name()).To(Equal("dojo-payments"))
+			Expect(c.Name()).To(Equal("api_keys"))
+		})
+	})
+
+	DescribeTable("storing payments",
+		func(mode TenancyMode, database, collection string) {
+			c := forTenant(newDatabase(mode), "acme").Payments().(*mongodbPaymentsDatabase).c
+			Expect(c.Database().Name()).To(Equal(database))
+			Expect(c.Name()).To(Equal(collection))
+		},
+		Entry("in shared mode", TenancyModeShared, "dojo-payments", "payments"),
+		Entry("in collection mode", TenancyModeCollection, "dojo-payments", "payments_acme"),
+		Entry("in database mode", TenancyModeDatabase, "dojo-payments_acme", "payments"),
+	)
+
+	DescribeTable("finding the collections dedicated to a tenant",
+		func(name, tenant string) {
+			m := tenantCollectionRegexp.FindStringSubmatch(name)
+			if tenant == "" {
+				Expect(m).To(BeNil())
+			} else {
+				Expect(m).To(Equal([]string{name, tenant}))
+			}
+		},
+		Entry("for payments", "payments_acme", "acme"),
+		Entry("for standing orders", "standing_orders_acme", "acme"),
+		Entry("for tenants including underscores", "payments_acme_eu", "acme_eu"),
+		Entry("ignoring shared collections", "payments", ""),
+		Entry("ignoring unrelated collections", "payments-archive_acme", ""),
+		Entry("ignoring invalid tenants", "payments_acme.eu", ""),
+	)
+
+	DescribeTable("registering tenants",
+		func(mode TenancyMode, tenant string, database, collection string) {
+			c := tenantCollection(newDatabase(mode).root, mode, tenant, "payments")
+			Expect(c.Database().Name()).To(Equal(database))
+			Expect(c.Name()).To(Equal(collection))
+		},
+		Entry("in collection mode", TenancyModeCollection, "acme", "dojo-payments", "payments_acme"),
+		Entry("in database mode", TenancyModeDatabase, "acme", "dojo-payments_acme", "payments"),
+	)
+
+	It("registers tenants once per instance", func() {
+		m := newDatabase(TenancyModeCollection)
+		m.tenants.Store("acme", struct{}{})
+		v := forTenant(m, "acme")
+		Expect(v.tenants).To(BeIdenticalTo(m.tenants))
+		// Tenants which failed to be registered (as there is no connection to MongoDB) are attempted again later.
+		forTenant(m, "other")
+		_, ok := m.tenants.Load("other")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("does not register tenants in shared mode", func() {
+		m := newDatabase(TenancyModeShared)
+		forTenant(m, "acme")
+		_, ok := m.tenants.Load("acme")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("rejects unsupported tenancy modes", func() {
+		_, err := newMongoDBDatabase(nil, WithTenancyMode("foo"))
+		Expect(err).To(HaveOccurred())
+	})
+})
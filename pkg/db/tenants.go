@@ -0,0 +1,211 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/pkg/logging"
+)
+
+const (
+	// tenantsCollectionName is the name of the MongoDB collection used to register the tenants whose data is stored in dedicated collections or databases.
+	tenantsCollectionName = "tenants"
+)
+
+var (
+	// tenantCollectionRegexp is the regular expression matched by the names of the collections dedicated to a tenant in the "collection" tenancy mode, capturing the tenant.
+	tenantCollectionRegexp = regexp.MustCompile(`^(?:payments|standing_orders)_(` + tenantPattern + `)$`)
+	// tenantIndexes are the indexes created on the collections dedicated to each tenant, indexed by the name of the collection.
+	tenantIndexes = map[string][]mongo.IndexModel{
+		"events":          eventsIndexes,
+		"payments":        append(append([]mongo.IndexModel{}, paymentsIndexes...), scheduledPaymentsIndexes...),
+		"standing_orders": standingOrdersIndexes,
+	}
+)
+
+// ensureTenant registers the tenant to which the data being accessed belongs and indexes its collections, unless this has already been done by this instance.
+// Failing to do so is not fatal, as it is attempted again the next time the tenant is accessed.
+func (m *mongodbDatabase) ensureTenant() {
+	if m.mode == TenancyModeShared || m.tenant == "" {
+		return
+	}
+	if _, ok := m.tenants.Load(m.tenant); ok {
+		return
+	}
+	ctx, fn := startOperation(m.ctx, "Database.RegisterTenant")
+	defer fn()
+	if err := registerTenant(ctx, m.root, m.mode, m.tenant, time.Now()); err != nil {
+		logging.FromContext(ctx).Warnf("failed to register tenant %q: %v", m.tenant, failed(ctx, err))
+		return
+	}
+	m.tenants.Store(m.tenant, struct{}{})
+}
+
+// discoverTenants returns the tenants whose data is stored in dedicated collections or databases in the specified tenancy mode, based on the names of existing collections and databases.
+// It is used to register the tenants created before tenants started being registered.
+func discoverTenants(ctx context.Context, root *mongo.Database, mode TenancyMode) ([]string, error) {
+	r := make([]string, 0)
+	switch mode {
+	case TenancyModeCollection:
+		n, err := listCollectionNames(ctx, root, primitive.M{
+			"name": primitive.M{regexOp: tenantCollectionRegexp.String()},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range n {
+			if m := tenantCollectionRegexp.FindStringSubmatch(v); m != nil {
+				r = append(r, m[1])
+			}
+		}
+	case TenancyModeDatabase:
+		n, err := root.Client().ListDatabaseNames(ctx, primitive.M{
+			"name": primitive.M{regexOp: "^" + regexp.QuoteMeta(root.Name()+"_") + tenantPattern + "$"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list databases: %v", err)
+		}
+		for _, v := range n {
+			// Only consider databases holding payments or standing orders, as other databases may share the prefix.
+			c, err := listCollectionNames(ctx, root.Client().Database(v), primitive.M{
+				"name": primitive.M{inOp: primitive.A{"payments", "standing_orders"}},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if len(c) > 0 {
+				r = append(r, v[len(root.Name())+1:])
+			}
+		}
+	}
+	return uniqueSorted(r), nil
+}
+
+// listCollectionNames returns the names of the collections in the provided MongoDB database which match the provided filter, in order.
+func listCollectionNames(ctx context.Context, db *mongo.Database, f primitive.M) ([]string, error) {
+	c, err := db.ListCollections(ctx, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections on %s: %v", db.Name(), err)
+	}
+	defer c.Close(ctx)
+	r := make([]string, 0)
+	for c.Next(ctx) {
+		v := struct {
+			Name string `bson:"name"`
+		}{}
+		if err := c.Decode(&v); err != nil {
+			return nil, fmt.Errorf("failed to list collections on %s: %v", db.Name(), err)
+		}
+		r = append(r, v.Name)
+	}
+	if c.Err() != nil {
+		return nil, fmt.Errorf("failed to list collections on %s: %v", db.Name(), c.Err())
+	}
+	sort.Strings(r)
+	return r, nil
+}
+
+// registerTenant indexes the collections dedicated to the specified tenant in the specified tenancy mode and registers the tenant, unless it has already been registered.
+// The tenant is only registered after its collections have been indexed, so that registered tenants can be assumed to have been indexed.
+func registerTenant(ctx context.Context, root *mongo.Database, mode TenancyMode, tenant string, now time.Time) error {
+	for name, indexes := range tenantIndexes {
+		if err := createIndexes(ctx, []*mongo.Collection{tenantCollection(root, mode, tenant, name)}, indexes); err != nil {
+			return err
+		}
+	}
+	opts := &options.UpdateOptions{}
+	opts.SetUpsert(true)
+	_, err := root.Collection(tenantsCollectionName).UpdateOne(ctx, byID(tenant), primitive.M{
+		setOnInsertOp: primitive.M{registeredAtFieldName: now},
+	}, opts)
+	// A duplicate key error means that the tenant has been concurrently registered by another instance.
+	if err != nil && !isDuplicateKeyError(err) {
+		return fmt.Errorf("failed to register tenant %q: %v", tenant, err)
+	}
+	return nil
+}
+
+// registeredTenants returns the tenants which have been registered, in order.
+func registeredTenants(ctx context.Context, root *mongo.Database) ([]string, error) {
+	opts := &options.FindOptions{}
+	opts.SetSort(primitive.D{{Key: idFieldName, Value: 1}})
+	c, err := root.Collection(tenantsCollectionName).Find(ctx, primitive.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %v", err)
+	}
+	defer c.Close(ctx)
+	r := make([]string, 0)
+	for c.Next(ctx) {
+		t := models.Tenant{}
+		if err := c.Decode(&t); err != nil {
+			return nil, fmt.Errorf("failed to list tenants: %v", err)
+		}
+		r = append(r, t.ID)
+	}
+	if c.Err() != nil {
+		return nil, fmt.Errorf("failed to list tenants: %v", c.Err())
+	}
+	return r, nil
+}
+
+// tenantCollection returns the MongoDB collection with the specified name dedicated to the specified tenant in the specified tenancy mode.
+func tenantCollection(root *mongo.Database, mode TenancyMode, tenant, name string) *mongo.Collection {
+	switch mode {
+	case TenancyModeCollection:
+		return root.Collection(name + "_" + tenant)
+	case TenancyModeDatabase:
+		return root.Client().Database(root.Name() + "_" + tenant).Collection(name)
+	default:
+		return root.Collection(name)
+	}
+}
+
+// tenantCollections returns the MongoDB collections with the specified name, including the ones dedicated to registered tenants in the specified tenancy mode.
+func tenantCollections(ctx context.Context, root *mongo.Database, mode TenancyMode, name string) ([]*mongo.Collection, error) {
+	r := []*mongo.Collection{root.Collection(name)}
+	if mode == TenancyModeShared {
+		return r, nil
+	}
+	t, err := registeredTenants(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range t {
+		r = append(r, tenantCollection(root, mode, v, name))
+	}
+	return r, nil
+}
+
+// uniqueSorted returns the provided strings without duplicates, in order.
+func uniqueSorted(v []string) []string {
+	sort.Strings(v)
+	r := make([]string, 0, len(v))
+	for i, s := range v {
+		if i == 0 || s != v[i-1] {
+			r = append(r, s)
+		}
+	}
+	return r
+}
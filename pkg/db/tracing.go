@@ -0,0 +1,66 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+	"github.com/bmcstdio/dojo-payments/pkg/logging"
+)
+
+const (
+	// instrumentationName is the name of the instrumentation library reported in spans describing storage operations.
+	instrumentationName = "github.com/bmcstdio/dojo-payments/pkg/db"
+)
+
+// startOperation starts the storage operation with the specified name as a child of the span active in the provided context (if any).
+// It returns the context in which the operation must be performed, which is subject to constants.MongoDBOperationTimeout, and a function that must be called when the operation completes.
+func startOperation(parent context.Context, name string) (context.Context, context.CancelFunc) {
+	return startOperationWithTimeout(parent, name, constants.MongoDBOperationTimeout)
+}
+
+// startOperationWithTimeout is like startOperation, but makes the operation subject to the specified timeout.
+// It is used for operations which are expected to take long (e.g. migrations).
+func startOperationWithTimeout(parent context.Context, name string, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, span := otel.Tracer(instrumentationName).Start(parent, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system", "mongodb"),
+		attribute.String("db.operation", name),
+	))
+	ctx, fn := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		fn()
+		span.End()
+	}
+}
+
+// failed records the provided error in the span of the storage operation performed in the provided context, logs it using the logger of the request being handled (if any), and returns it.
+// The returned error is marked as having been returned by MongoDB, so that IsUnavailable can tell it apart from errors caused by invalid input.
+func failed(ctx context.Context, err error) error {
+	logging.FromContext(ctx).WithError(err).Debug("storage operation failed")
+	s := trace.SpanFromContext(ctx)
+	s.RecordError(err)
+	s.SetStatus(codes.Error, err.Error())
+	return &storageError{err: err}
+}
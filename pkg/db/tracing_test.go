@@ -0,0 +1,71 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("Tracing", func() {
+	var (
+		provider *sdktrace.TracerProvider
+		recorder *tracetest.SpanRecorder
+	)
+
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		provider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		otel.SetTracerProvider(provider)
+	})
+
+	It("traces storage operations as children of the span active in the context", func() {
+		parent, span := provider.Tracer("test").Start(context.Background(), "PUT /payments/:id")
+		ctx, fn := startOperation(parent, "PaymentsDatabase.UpdatePayment")
+		Expect(failed(ctx, errors.New("boom"))).To(MatchError("boom"))
+		fn()
+		span.End()
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(2))
+		Expect(spans[0].Name()).To(Equal("PaymentsDatabase.UpdatePayment"))
+		Expect(spans[0].Parent().SpanID()).To(Equal(span.SpanContext().SpanID()))
+		Expect(spans[0].Status().Code).To(Equal(codes.Error))
+		// Make sure that the operation's context is canceled once the operation completes.
+		Expect(ctx.Err()).To(Equal(context.Canceled))
+	})
+
+	It("performs operations within the context provided to WithContext", func() {
+		c, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+		Expect(err).NotTo(HaveOccurred())
+		m, err := newMongoDBDatabase(c.Database("dojo-payments"))
+		Expect(err).NotTo(HaveOccurred())
+		ctx := context.WithValue(context.Background(), struct{}{}, "request")
+		v, err := m.WithContext(ctx).ForTenant("acme")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(v.Payments().(*mongodbPaymentsDatabase).ctx).To(Equal(ctx))
+		Expect(v.Events().(*mongodbEventsDatabase).ctx).To(Equal(ctx))
+		// Make sure that the original database is left untouched.
+		Expect(m.Payments().(*mongodbPaymentsDatabase).ctx).To(Equal(context.Background()))
+	})
+})
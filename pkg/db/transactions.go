@@ -0,0 +1,136 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+)
+
+const (
+	// transientTransactionErrorLabel is the label MongoDB attaches to errors after which a transaction may be retried as a whole.
+	transientTransactionErrorLabel = "TransientTransactionError"
+	// unknownTransactionCommitResultLabel is the label MongoDB attaches to errors after which committing a transaction may be retried.
+	unknownTransactionCommitResultLabel = "UnknownTransactionCommitResult"
+)
+
+// transactionSession is the subset of mongo.Session used to run transactions.
+// It allows for testing how transactions are retried without a replica set.
+type transactionSession interface {
+	// AbortTransaction aborts the current transaction.
+	AbortTransaction(context.Context) error
+	// CommitTransaction commits the current transaction.
+	CommitTransaction(context.Context) error
+	// StartTransaction starts a new transaction.
+	StartTransaction(...*options.TransactionOptions) error
+}
+
+// WithTransaction runs the provided function within a transaction, passing it a view of the database whose operations are performed as part of the transaction.
+// Transactions require MongoDB to be deployed as a replica set.
+func (m *mongodbDatabase) WithTransaction(ctx context.Context, fn func(tx Database) error) error {
+	ctx, done := startOperationWithTimeout(ctx, "Database.WithTransaction", constants.MongoDBTransactionTimeout)
+	defer done()
+	s, err := m.root.Client().StartSession()
+	if err != nil {
+		return failed(ctx, fmt.Errorf("failed to start session: %w", err))
+	}
+	defer s.EndSession(ctx)
+	err = mongo.WithSession(ctx, s, func(sc mongo.SessionContext) error {
+		return runTransaction(sc, s, func(ctx context.Context) error {
+			return fn(m.WithContext(ctx))
+		})
+	})
+	if err != nil {
+		// Errors returned by the provided function are returned as they are, so that they are not mistaken for errors returned by MongoDB.
+		_ = failed(ctx, err)
+		return err
+	}
+	return nil
+}
+
+// runTransaction runs the provided function within a transaction started on the provided session, committing the transaction in case it returns nil and aborting it otherwise.
+// The transaction is retried as a whole in case it fails with a transient error, and committing it is retried in case its outcome is unknown, with jittered exponential backoff and until the provided context is done.
+func runTransaction(ctx context.Context, s transactionSession, fn func(context.Context) error) error {
+	for retry := 1; ; retry++ {
+		if err := s.StartTransaction(); err != nil {
+			return &storageError{err: fmt.Errorf("failed to start transaction: %w", err)}
+		}
+		if err := fn(ctx); err != nil {
+			// Errors returned when aborting are ignored, as the transaction may have already been aborted by MongoDB.
+			_ = s.AbortTransaction(ctx)
+			if hasErrorLabel(err, transientTransactionErrorLabel) && sleep(ctx, transactionBackoff(retry)) {
+				continue
+			}
+			return err
+		}
+		err := commitTransaction(ctx, s)
+		if err == nil {
+			return nil
+		}
+		if hasErrorLabel(err, transientTransactionErrorLabel) && sleep(ctx, transactionBackoff(retry)) {
+			continue
+		}
+		return &storageError{err: fmt.Errorf("failed to commit transaction: %w", err)}
+	}
+}
+
+// commitTransaction commits the current transaction on the provided session, retrying with jittered exponential backoff in case its outcome is unknown until the provided context is done.
+func commitTransaction(ctx context.Context, s transactionSession) error {
+	for retry := 1; ; retry++ {
+		err := s.CommitTransaction(ctx)
+		if err == nil || !hasErrorLabel(err, unknownTransactionCommitResultLabel) || !sleep(ctx, transactionBackoff(retry)) {
+			return err
+		}
+	}
+}
+
+// hasErrorLabel returns a value indicating whether the provided error was caused by a MongoDB error carrying the specified label.
+func hasErrorLabel(err error, label string) bool {
+	var (
+		e mongo.CommandError
+	)
+	return errors.As(err, &e) && e.HasErrorLabel(label)
+}
+
+// sleep waits for the specified amount of time, returning a value indicating whether it did so before the provided context was done.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// transactionBackoff returns the amount of time to wait before making the specified retry (starting at one), chosen at random up to an exponentially increasing maximum.
+func transactionBackoff(retry int) time.Duration {
+	d := constants.MongoDBTransactionRetryBaseDelay << uint(retry-1)
+	if d > constants.MongoDBTransactionRetryMaxDelay || d <= 0 {
+		d = constants.MongoDBTransactionRetryMaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
@@ -0,0 +1,156 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+)
+
+// fakeSession is an implementation of transactionSession which stands in for a session against a replica set.
+type fakeSession struct {
+	// aborts is the number of times a transaction was aborted.
+	aborts int
+	// commitErrors are the errors to return from successive commits.
+	commitErrors []error
+	// commits is the number of times committing a transaction was attempted.
+	commits int
+	// starts is the number of times a transaction was started.
+	starts int
+}
+
+// AbortTransaction records that the current transaction was aborted.
+func (f *fakeSession) AbortTransaction(context.Context) error {
+	f.aborts++
+	return nil
+}
+
+// CommitTransaction records that committing the current transaction was attempted and returns the next configured error, if any.
+func (f *fakeSession) CommitTransaction(context.Context) error {
+	f.commits++
+	if len(f.commitErrors) == 0 {
+		return nil
+	}
+	err := f.commitErrors[0]
+	f.commitErrors = f.commitErrors[1:]
+	return err
+}
+
+// StartTransaction records that a transaction was started.
+func (f *fakeSession) StartTransaction(...*options.TransactionOptions) error {
+	f.starts++
+	return nil
+}
+
+// labelled returns an error carrying the specified label, wrapped as pkg/db does.
+func labelled(label string) error {
+	return fmt.Errorf("failed to create payment: %w", mongo.CommandError{Labels: []string{label}, Message: "write conflict"})
+}
+
+var _ = Describe("Transactions", func() {
+	It("are committed when the function succeeds", func() {
+		s := &fakeSession{}
+		Expect(runTransaction(context.Background(), s, func(context.Context) error { return nil })).To(Succeed())
+		Expect(s.starts).To(Equal(1))
+		Expect(s.commits).To(Equal(1))
+		Expect(s.aborts).To(BeZero())
+	})
+
+	It("are aborted and not retried when the function fails", func() {
+		s := &fakeSession{}
+		e := errors.New("invalid payment")
+		Expect(runTransaction(context.Background(), s, func(context.Context) error { return e })).To(MatchError(e))
+		Expect(s.starts).To(Equal(1))
+		Expect(s.commits).To(BeZero())
+		Expect(s.aborts).To(Equal(1))
+	})
+
+	It("are retried as a whole on transient errors", func() {
+		s := &fakeSession{
+			commitErrors: []error{labelled(transientTransactionErrorLabel)},
+		}
+		n := 0
+		err := runTransaction(context.Background(), s, func(context.Context) error {
+			n++
+			if n == 1 {
+				return labelled(transientTransactionErrorLabel)
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(3))
+		Expect(s.starts).To(Equal(3))
+		Expect(s.commits).To(Equal(2))
+		Expect(s.aborts).To(Equal(1))
+	})
+
+	It("retry committing when its outcome is unknown", func() {
+		s := &fakeSession{
+			commitErrors: []error{labelled(unknownTransactionCommitResultLabel), labelled(unknownTransactionCommitResultLabel)},
+		}
+		n := 0
+		Expect(runTransaction(context.Background(), s, func(context.Context) error { n++; return nil })).To(Succeed())
+		Expect(n).To(Equal(1))
+		Expect(s.commits).To(Equal(3))
+	})
+
+	It("give up retrying once the context is done", func() {
+		ctx, fn := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer fn()
+		s := &fakeSession{}
+		err := runTransaction(ctx, s, func(context.Context) error {
+			time.Sleep(time.Millisecond)
+			return labelled(transientTransactionErrorLabel)
+		})
+		Expect(hasErrorLabel(err, transientTransactionErrorLabel)).To(BeTrue())
+		Expect(s.starts).To(Equal(s.aborts))
+	})
+
+	It("back off exponentially before being retried", func() {
+		for retry := 1; retry <= 100; retry++ {
+			d := transactionBackoff(retry)
+			Expect(d).To(BeNumerically(">", 0))
+			Expect(d).To(BeNumerically("<=", constants.MongoDBTransactionRetryMaxDelay))
+			if retry == 1 {
+				Expect(d).To(BeNumerically("<=", constants.MongoDBTransactionRetryBaseDelay))
+			}
+		}
+	})
+
+	It("do not back off once the context is done", func() {
+		ctx, fn := context.WithCancel(context.Background())
+		fn()
+		start := time.Now()
+		Expect(sleep(ctx, time.Hour)).To(BeFalse())
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+
+	It("do not retry committing after errors without labels", func() {
+		s := &fakeSession{
+			commitErrors: []error{errors.New("connection reset")},
+		}
+		Expect(runTransaction(context.Background(), s, func(context.Context) error { return nil })).To(MatchError("failed to commit transaction: connection reset"))
+		Expect(s.starts).To(Equal(1))
+		Expect(s.commits).To(Equal(1))
+	})
+})
@@ -0,0 +1,90 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"sync"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+const (
+	// subscriptionBufferSize is the number of events that may be pending delivery to a subscriber before it is dropped.
+	subscriptionBufferSize = 64
+)
+
+// Bus delivers events published by the Payments API to every interested subscriber in the current process.
+type Bus struct {
+	// closed indicates whether the bus has been closed.
+	closed bool
+	// lock serializes access to closed and subscribers.
+	lock sync.Mutex
+	// subscribers is the set of channels to which events are delivered.
+	subscribers map[chan models.Event]struct{}
+}
+
+// NewBus returns a new instance of Bus with no subscribers.
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[chan models.Event]struct{}),
+	}
+}
+
+// Close ends every subscription (i.e. closes their channels) so that subscribers stop waiting for events, and causes further subscriptions to end immediately.
+// It is used when shutting down so that long-lived streams of events do not prevent in-flight requests from being drained.
+func (b *Bus) Close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Publish delivers the provided event to every subscriber.
+// Subscribers that are not keeping up with the rate of events are dropped (i.e. their channel is closed) so that they may resume from the database.
+func (b *Bus) Publish(e models.Event) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns a channel on which published events are delivered, and a function that must be called to cancel the subscription.
+func (b *Bus) Subscribe() (<-chan models.Event, func()) {
+	ch := make(chan models.Event, subscriptionBufferSize)
+	b.lock.Lock()
+	if b.closed {
+		close(ch)
+	} else {
+		b.subscribers[ch] = struct{}{}
+	}
+	b.lock.Unlock()
+	return ch, func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
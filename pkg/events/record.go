@@ -0,0 +1,46 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/pkg/logging"
+)
+
+// Record persists an event describing the specified change to the provided payment and publishes it to the bus.
+// The principal carried by the provided context, if any, is recorded as the actor that made the change.
+// Failing to record an event is logged but not reported to the caller, as the change to the payment itself has already been made.
+func Record(ctx context.Context, database db.Database, bus *Bus, t models.EventType, p models.Payment) {
+	var (
+		actor string
+	)
+	if principal := auth.PrincipalFromContext(ctx); principal != nil {
+		actor = principal.Subject
+	}
+	e, err := database.Events().AppendEvent(models.Event{
+		Actor:   actor,
+		Type:    t,
+		Payment: p,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Warnf("failed to record %q event for payment %q: %v", t, p.ID.Hex(), err)
+		return
+	}
+	bus.Publish(e)
+}
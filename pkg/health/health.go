@@ -0,0 +1,189 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// StatusDown indicates that a dependency (or the application) is not healthy.
+	StatusDown = "DOWN"
+	// StatusUnknown indicates that the health of a dependency has not been checked yet.
+	StatusUnknown = "UNKNOWN"
+	// StatusUp indicates that a dependency (or the application) is healthy.
+	StatusUp = "UP"
+)
+
+// Check checks the health of a dependency, returning an error in case it is not healthy.
+// Checks must honor the deadline of the provided context.
+type Check func(ctx context.Context) error
+
+// CheckResult is the result of the last check of the health of a dependency.
+type CheckResult struct {
+	// Status is the status of the dependency.
+	Status string `json:"status"`
+	// Error is the error returned by the check, if any.
+	Error string `json:"error,omitempty"`
+	// LatencyMillis is the amount of time the check took, in milliseconds.
+	LatencyMillis float64 `json:"latency_ms"`
+	// CheckedAt is the date at which the check was made.
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report describes the health of the application.
+type Report struct {
+	// Status is the status of the application, which is only up in case all dependencies are.
+	Status string `json:"status"`
+	// Checks are the results of the last checks of the health of each dependency, indexed by name.
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+	// Info is additional information about the application which does not affect its status (e.g. the state of circuit breakers), indexed by name.
+	Info map[string]string `json:"info,omitempty"`
+}
+
+// Checker checks the health of dependencies in the background, caching the results so that reporting health does not put load on dependencies.
+type Checker struct {
+	// checks are the checks to run, indexed by the name of the dependency.
+	checks map[string]Check
+	// timeout is the maximum amount of time a single check may take.
+	timeout time.Duration
+
+	// draining indicates whether the application is shutting down, in which case it is reported as being down.
+	draining bool
+	// info are the functions returning additional information about the application, indexed by name.
+	info map[string]func() string
+	// lock protects draining, info and results.
+	lock sync.RWMutex
+	// results are the results of the last checks, indexed by the name of the dependency.
+	results map[string]CheckResult
+}
+
+// NewChecker returns a new checker that runs the provided checks, each of which may take at most the specified amount of time.
+func NewChecker(checks map[string]Check, timeout time.Duration) *Checker {
+	r := make(map[string]CheckResult, len(checks))
+	for n := range checks {
+		r[n] = CheckResult{
+			Status: StatusUnknown,
+		}
+	}
+	return &Checker{
+		checks:  checks,
+		info:    make(map[string]func() string),
+		results: r,
+		timeout: timeout,
+	}
+}
+
+// AddInfo causes the value returned by the provided function to be included in reports under the specified name.
+// The function is called whenever a report is requested, and must therefore be cheap.
+func (c *Checker) AddInfo(name string, fn func() string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.info[name] = fn
+}
+
+// Run checks the health of dependencies immediately and then at the specified interval, until the provided context is canceled.
+func (c *Checker) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		c.CheckNow(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// CheckNow checks the health of all dependencies concurrently, waiting for all checks to complete.
+func (c *Checker) CheckNow(ctx context.Context) {
+	var (
+		wg sync.WaitGroup
+	)
+	for n, fn := range c.checks {
+		wg.Add(1)
+		go func(n string, fn Check) {
+			defer wg.Done()
+			r := c.check(ctx, fn)
+			c.lock.Lock()
+			c.results[n] = r
+			c.lock.Unlock()
+		}(n, fn)
+	}
+	wg.Wait()
+}
+
+// check runs the provided check, bounding the amount of time it may take.
+func (c *Checker) check(ctx context.Context, fn Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	start := time.Now()
+	err := fn(ctx)
+	r := CheckResult{
+		Status:        StatusUp,
+		LatencyMillis: float64(time.Since(start)) / float64(time.Millisecond),
+		CheckedAt:     start,
+	}
+	if err != nil {
+		r.Status = StatusDown
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// Drain causes the application to be reported as being down from now on regardless of the health of its dependencies.
+// It is used when shutting down so that load balancers stop routing new requests to the application while in-flight ones are drained.
+func (c *Checker) Drain() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.draining = true
+}
+
+// Report returns the cached results of the last checks.
+// The application is reported as being down in case any dependency is down or has not been checked yet, or in case it is draining.
+func (c *Checker) Report() Report {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	r := Report{
+		Status: StatusUp,
+		Checks: make(map[string]CheckResult, len(c.results)),
+	}
+	for n, v := range c.results {
+		r.Checks[n] = v
+		if v.Status != StatusUp {
+			r.Status = StatusDown
+		}
+	}
+	if c.draining {
+		r.Status = StatusDown
+	}
+	if len(c.info) > 0 {
+		r.Info = make(map[string]string, len(c.info))
+		for n, fn := range c.info {
+			r.Info[n] = fn()
+		}
+	}
+	return r
+}
+
+// Result returns the cached result of the last check of the health of the specified dependency.
+func (c *Checker) Result(name string) CheckResult {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.results[name]
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Checker", func() {
+	It("reports dependencies which have not been checked yet as unknown", func() {
+		c := NewChecker(map[string]Check{
+			"database": func(context.Context) error { return nil },
+		}, time.Second)
+		r := c.Report()
+		Expect(r.Status).To(Equal(StatusDown))
+		Expect(r.Checks["database"].Status).To(Equal(StatusUnknown))
+	})
+
+	It("reports dependencies whose checks time out as down", func() {
+		c := NewChecker(map[string]Check{
+			"database": func(context.Context) error { return nil },
+			"slow": func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		}, 10*time.Millisecond)
+		c.CheckNow(context.Background())
+		r := c.Report()
+		Expect(r.Status).To(Equal(StatusDown))
+		Expect(r.Checks["database"].Status).To(Equal(StatusUp))
+		Expect(r.Checks["slow"].Status).To(Equal(StatusDown))
+		Expect(r.Checks["slow"].Error).To(Equal(context.DeadlineExceeded.Error()))
+	})
+
+	It("checks dependencies in the background until stopped", func() {
+		var (
+			n int32
+		)
+		c := NewChecker(map[string]Check{
+			"database": func(context.Context) error {
+				atomic.AddInt32(&n, 1)
+				return nil
+			},
+		}, time.Second)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			c.Run(ctx, 5*time.Millisecond)
+			close(done)
+		}()
+		Eventually(func() int32 { return atomic.LoadInt32(&n) }).Should(BeNumerically(">=", 2))
+		cancel()
+		Eventually(done).Should(BeClosed())
+		Expect(c.Report().Status).To(Equal(StatusUp))
+	})
+	It("reports the application as down once it is draining", func() {
+		c := NewChecker(map[string]Check{
+			"database": func(context.Context) error { return nil },
+		}, time.Second)
+		c.CheckNow(context.Background())
+		Expect(c.Report().Status).To(Equal(StatusUp))
+		c.Drain()
+		r := c.Report()
+		Expect(r.Status).To(Equal(StatusDown))
+		Expect(r.Checks["database"].Status).To(Equal(StatusUp))
+	})
+
+	It("includes additional information which does not affect the status of the application", func() {
+		c := NewChecker(map[string]Check{
+			"database": func(context.Context) error { return nil },
+		}, time.Second)
+		c.AddInfo("database_circuit_breaker", func() string { return "open" })
+		c.CheckNow(context.Background())
+		r := c.Report()
+		Expect(r.Status).To(Equal(StatusUp))
+		Expect(r.Info).To(Equal(map[string]string{"database_circuit_breaker": "open"}))
+	})
+})
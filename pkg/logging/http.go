@@ -0,0 +1,65 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	log "github.com/sirupsen/logrus"
+)
+
+// Middleware returns an Echo middleware that stores a request-scoped logger in the request's context and logs a line describing each request once it has been handled.
+// It must be installed after the middleware that assigns IDs to requests.
+func Middleware() echo.MiddlewareFunc {
+	return func(fn echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			start := time.Now()
+			// Store the fields describing the request in its context.
+			f := log.Fields{
+				RequestIDField: ctx.Response().Header().Get(echo.HeaderXRequestID),
+				RouteField:     ctx.Request().Method + " " + ctx.Path(),
+			}
+			ctx.SetRequest(ctx.Request().WithContext(WithFields(ctx.Request().Context(), f)))
+			// Handle the request and log its outcome.
+			err := fn(ctx)
+			if err != nil {
+				// Let Echo write the response so that its actual status is logged.
+				ctx.Error(err)
+			}
+			s := ctx.Response().Status
+			e := FromContext(ctx.Request().Context()).WithFields(log.Fields{
+				"latency_ms": float64(time.Since(start)) / float64(time.Millisecond),
+				"remote_ip":  ctx.RealIP(),
+				"status":     s,
+			})
+			if err != nil {
+				e = e.WithError(err)
+			}
+			if s >= http.StatusInternalServerError {
+				e.Error("handled request")
+			} else {
+				e.Info("handled request")
+			}
+			return nil
+		}
+	}
+}
+
+// AddFields includes the specified fields in every line logged while handling the current request, including the line logged by Middleware.
+func AddFields(ctx echo.Context, data log.Fields) {
+	ctx.SetRequest(ctx.Request().WithContext(WithFields(ctx.Request().Context(), data)))
+}
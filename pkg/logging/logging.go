@@ -0,0 +1,117 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+)
+
+const (
+	// FormatJSON indicates that log lines are emitted as JSON objects.
+	FormatJSON = "json"
+	// FormatText indicates that log lines are emitted as human-readable text.
+	FormatText = "text"
+)
+
+const (
+	// PaymentIDField is the name of the field containing the ID of the payment being handled.
+	PaymentIDField = "payment_id"
+	// PrincipalField is the name of the field containing the subject of the principal on whose behalf a request is made.
+	PrincipalField = "principal"
+	// RequestIDField is the name of the field containing the ID of the request being handled.
+	RequestIDField = "request_id"
+	// RouteField is the name of the field containing the route of the request being handled.
+	RouteField = "route"
+	// StandingOrderIDField is the name of the field containing the ID of the standing order being handled.
+	StandingOrderIDField = "standing_order_id"
+	// TenantField is the name of the field containing the tenant of the principal on whose behalf a request is made.
+	TenantField = "tenant"
+)
+
+// fieldsContextKey is the type of the key under which the fields of the request being handled are stored in a context.
+type fieldsContextKey struct{}
+
+// fields holds the fields included in every line logged while handling a request.
+type fields struct {
+	// lock protects data.
+	lock sync.Mutex
+	// data are the fields.
+	data log.Fields
+}
+
+// Setup configures the standard logger to log at the specified level using the specified format, redacting account numbers.
+func Setup(level, format string) error {
+	l, err := log.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("failed to parse log level: %v", err)
+	}
+	var (
+		f log.Formatter
+	)
+	switch format {
+	case FormatJSON:
+		f = &log.JSONFormatter{}
+	case FormatText:
+		f = &log.TextFormatter{}
+	default:
+		return fmt.Errorf("unsupported log format %q", format)
+	}
+	log.SetLevel(l)
+	log.SetFormatter(&redactingFormatter{formatter: f})
+	return nil
+}
+
+// WithFields returns a copy of the provided context in which the specified fields are included in every line logged using FromContext.
+// Fields are shared with the returned context's parent, if any, so that fields added while handling a request are also included in lines logged by middleware.
+func WithFields(ctx context.Context, data log.Fields) context.Context {
+	if f, ok := ctx.Value(fieldsContextKey{}).(*fields); ok {
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		for k, v := range data {
+			f.data[k] = v
+		}
+		return ctx
+	}
+	f := &fields{
+		data: make(log.Fields, len(data)),
+	}
+	for k, v := range data {
+		f.data[k] = v
+	}
+	return context.WithValue(ctx, fieldsContextKey{}, f)
+}
+
+// FromContext returns a logger that includes the fields stored in the provided context, as well as the principal on whose behalf the current request is made (if any).
+func FromContext(ctx context.Context) *log.Entry {
+	e := log.NewEntry(log.StandardLogger())
+	if f, ok := ctx.Value(fieldsContextKey{}).(*fields); ok {
+		f.lock.Lock()
+		e = e.WithFields(f.data)
+		f.lock.Unlock()
+	}
+	if p := auth.PrincipalFromContext(ctx); p != nil {
+		e = e.WithField(PrincipalField, p.Subject)
+		if p.Tenant != "" {
+			e = e.WithField(TenantField, p.Tenant)
+		}
+	}
+	return e
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+var _ = Describe("Logging", func() {
+	var (
+		out *bytes.Buffer
+	)
+
+	// lines returns the lines logged so far, decoded from JSON.
+	lines := func() []map[string]interface{} {
+		r := make([]map[string]interface{}, 0)
+		d := json.NewDecoder(bytes.NewReader(out.Bytes()))
+		for d.More() {
+			l := make(map[string]interface{})
+			Expect(d.Decode(&l)).To(Succeed())
+			r = append(r, l)
+		}
+		return r
+	}
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+		Expect(Setup("debug", FormatJSON)).To(Succeed())
+		log.SetOutput(out)
+	})
+
+	AfterEach(func() {
+		log.SetOutput(os.Stderr)
+	})
+
+	It("rejects unsupported levels and formats", func() {
+		Expect(Setup("loud", FormatJSON)).NotTo(Succeed())
+		Expect(Setup("info", "xml")).NotTo(Succeed())
+	})
+
+	Describe("middleware", func() {
+		var (
+			e *echo.Echo
+		)
+
+		BeforeEach(func() {
+			e = echo.New()
+			e.Use(middleware.RequestID())
+			e.Use(Middleware())
+			// Simulate an authenticated request.
+			e.Use(func(fn echo.HandlerFunc) echo.HandlerFunc {
+				return func(ctx echo.Context) error {
+					ctx.SetRequest(ctx.Request().WithContext(auth.WithPrincipal(ctx.Request().Context(), &auth.Principal{Subject: "alice", Tenant: "acme"})))
+					return fn(ctx)
+				}
+			})
+			e.POST("/payments", func(ctx echo.Context) error {
+				FromContext(ctx.Request().Context()).Info("creating payment")
+				AddFields(ctx, log.Fields{PaymentIDField: "1234"})
+				return ctx.NoContent(http.StatusCreated)
+			})
+			e.GET("/payments/:id", func(ctx echo.Context) error {
+				return echo.NewHTTPError(http.StatusNotFound, "payment not found")
+			})
+		})
+
+		It("includes request-scoped fields in every line", func() {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/payments", nil))
+			l := lines()
+			Expect(l).To(HaveLen(2))
+			for _, v := range l {
+				Expect(v).To(HaveKeyWithValue(RequestIDField, rec.Header().Get(echo.HeaderXRequestID)))
+				Expect(v).To(HaveKeyWithValue(RouteField, "POST /payments"))
+				Expect(v).To(HaveKeyWithValue(PrincipalField, "alice"))
+				Expect(v).To(HaveKeyWithValue(TenantField, "acme"))
+			}
+			Expect(l[0]).To(HaveKeyWithValue("msg", "creating payment"))
+			// Fields added while handling the request are included in the line describing the request.
+			Expect(l[1]).To(HaveKeyWithValue(PaymentIDField, "1234"))
+			Expect(l[1]).To(HaveKeyWithValue("status", float64(http.StatusCreated)))
+			Expect(l[1]).To(HaveKey("latency_ms"))
+		})
+
+		It("logs the status of failed requests", func() {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/payments/1234", nil))
+			Expect(rec.Code).To(Equal(http.StatusNotFound))
+			l := lines()
+			Expect(l).To(HaveLen(1))
+			Expect(l[0]).To(HaveKeyWithValue("status", float64(http.StatusNotFound)))
+			Expect(l[0]).To(HaveKeyWithValue("level", "info"))
+		})
+	})
+
+	Describe("redaction", func() {
+		DescribeTable("masks all but the last characters of account numbers",
+			func(n, expected string) {
+				Expect(RedactAccountNumber(n)).To(Equal(expected))
+			},
+			Entry("long", "12345678", "****5678"),
+			Entry("short", "123", "***"),
+			Entry("empty", "", ""),
+		)
+
+		It("redacts account numbers from messages and fields", func() {
+			p := models.Payment{
+				Beneficiary: models.Entity{AccountNumber: "11112222", Name: "Alice"},
+				Debtor:      models.Entity{AccountNumber: "33334444", Name: "Bob"},
+			}
+			log.WithFields(log.Fields{
+				"account_number": "55556666",
+				"body":           `{"account_number":"77778888","bank_id":"403000"}`,
+				"error":          errors.New("invalid AccountNumber: 99990000"),
+				"payment":        p,
+			}).Info(`received {"account_number": "12345678"}`)
+			s := out.String()
+			for _, n := range []string{"11112222", "33334444", "55556666", "77778888", "99990000", "12345678"} {
+				Expect(s).NotTo(ContainSubstring(n))
+			}
+			l := lines()
+			Expect(l[0]).To(HaveKeyWithValue("account_number", "****6666"))
+			Expect(l[0]).To(HaveKeyWithValue("msg", `received {"account_number": "****5678"}`))
+			Expect(l[0]["payment"].(map[string]interface{})["beneficiary"]).To(HaveKeyWithValue("account_number", "****2222"))
+			Expect(l[0]["payment"].(map[string]interface{})["beneficiary"]).To(HaveKeyWithValue("name", "Alice"))
+			// Make sure that the original payment is left untouched.
+			Expect(p.Beneficiary.AccountNumber).To(Equal("11112222"))
+		})
+	})
+})
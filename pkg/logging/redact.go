@@ -0,0 +1,112 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+const (
+	// accountNumberField is the name of fields containing account numbers.
+	accountNumberField = "account_number"
+	// visibleAccountNumberSuffixLength is the number of trailing characters of account numbers left visible when redacting them.
+	visibleAccountNumberSuffixLength = 4
+)
+
+var (
+	// accountNumberRegexp matches account numbers in free-form text (e.g. `"account_number":"12345678"` or `AccountNumber:12345678`).
+	accountNumberRegexp = regexp.MustCompile(`(?i)("?account_?number"?\s*[:=]\s*"?)([^",}\s]+)`)
+)
+
+// redactingFormatter is a log.Formatter that redacts account numbers before delegating to another formatter.
+type redactingFormatter struct {
+	// formatter is the formatter to which redacted entries are passed.
+	formatter log.Formatter
+}
+
+// Format redacts account numbers from the provided entry and formats it.
+func (f *redactingFormatter) Format(entry *log.Entry) ([]byte, error) {
+	// Work on a copy of the entry so that its fields are not modified for other hooks and formatters.
+	e := *entry
+	e.Message = redactText(entry.Message)
+	e.Data = make(log.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		e.Data[k] = redactField(k, v)
+	}
+	return f.formatter.Format(&e)
+}
+
+// redactField redacts account numbers from the value of the field with the specified key.
+func redactField(k string, v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		if strings.EqualFold(k, accountNumberField) {
+			return RedactAccountNumber(t)
+		}
+		return redactText(t)
+	case error:
+		return redactText(t.Error())
+	case models.Entity:
+		return redactEntity(t)
+	case *models.Entity:
+		if t == nil {
+			return t
+		}
+		return redactEntity(*t)
+	case models.Payment:
+		return redactPayment(t)
+	case *models.Payment:
+		if t == nil {
+			return t
+		}
+		return redactPayment(*t)
+	default:
+		return v
+	}
+}
+
+// redactText redacts account numbers from the provided free-form text.
+func redactText(s string) string {
+	return accountNumberRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		p := accountNumberRegexp.FindStringSubmatch(m)
+		return p[1] + RedactAccountNumber(p[2])
+	})
+}
+
+// redactEntity returns a copy of the provided entity with its account number redacted.
+func redactEntity(e models.Entity) models.Entity {
+	e.AccountNumber = RedactAccountNumber(e.AccountNumber)
+	return e
+}
+
+// redactPayment returns a copy of the provided payment with the account numbers of the entities involved redacted.
+func redactPayment(p models.Payment) models.Payment {
+	p.Beneficiary = redactEntity(p.Beneficiary)
+	p.Debtor = redactEntity(p.Debtor)
+	return p
+}
+
+// RedactAccountNumber masks all but the last few characters of the provided account number.
+func RedactAccountNumber(n string) string {
+	if len(n) <= visibleAccountNumberSuffixLength {
+		return strings.Repeat("*", len(n))
+	}
+	return strings.Repeat("*", len(n)-visibleAccountNumberSuffixLength) + n[len(n)-visibleAccountNumberSuffixLength:]
+}
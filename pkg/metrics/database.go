@@ -0,0 +1,203 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/pkg/resilience"
+)
+
+// instrumentedDatabase is an implementation of db.Database that records metrics about the payments stored in the wrapped database.
+type instrumentedDatabase struct {
+	db.Database
+
+	// metrics is the set of metrics in which to record observations.
+	metrics *Metrics
+}
+
+// InstrumentDatabase returns a view of the provided database that records the latency and errors of storage operations on payments, as well as business metrics about created payments.
+func (m *Metrics) InstrumentDatabase(database db.Database) db.Database {
+	return &instrumentedDatabase{
+		Database: database,
+		metrics:  m,
+	}
+}
+
+// InstrumentDatabaseStatus registers a gauge reporting whether the database is online as reported by the provided function, which is called on every scrape and must therefore not block (e.g. by returning the result of the last health check).
+// It must be called at most once per set of metrics.
+func (m *Metrics) InstrumentDatabaseStatus(online func() bool) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "database",
+		Name:      "online",
+		Help:      "Whether the database was online (1) or not (0) as of the last health check.",
+	}, func() float64 {
+		if online() {
+			return 1
+		}
+		return 0
+	}))
+}
+
+// InstrumentBreaker registers a gauge reporting the state of the provided circuit breaker, which is one for the current state and zero for the others.
+// It must be called at most once per set of metrics.
+func (m *Metrics) InstrumentBreaker(b *resilience.Breaker) {
+	for _, s := range []resilience.State{resilience.StateClosed, resilience.StateHalfOpen, resilience.StateOpen} {
+		s := s
+		m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "database",
+			Name:        "circuit_breaker_state",
+			Help:        "The state of the circuit breaker protecting the database (1 for the current state).",
+			ConstLabels: prometheus.Labels{"state": string(s)},
+		}, func() float64 {
+			if b.State() == s {
+				return 1
+			}
+			return 0
+		}))
+	}
+}
+
+// ForTenant returns an instrumented view of the database that only allows for accessing data belonging to the specified tenant.
+func (d *instrumentedDatabase) ForTenant(tenant string) (db.Database, error) {
+	v, err := d.Database.ForTenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedDatabase{
+		Database: v,
+		metrics:  d.metrics,
+	}, nil
+}
+
+// Payments allows for accessing instrumented methods used to perform CRUD operations on payments.
+func (d *instrumentedDatabase) Payments() db.PaymentsDatabase {
+	return &instrumentedPaymentsDatabase{
+		payments: d.Database.Payments(),
+		metrics:  d.metrics,
+	}
+}
+
+// WithContext returns an instrumented view of the database whose operations are performed within the provided context.
+func (d *instrumentedDatabase) WithContext(ctx context.Context) db.Database {
+	return &instrumentedDatabase{
+		Database: d.Database.WithContext(ctx),
+		metrics:  d.metrics,
+	}
+}
+
+// WithTransaction runs the provided function within a transaction, passing it an instrumented view of the database whose operations are performed as part of the transaction.
+func (d *instrumentedDatabase) WithTransaction(ctx context.Context, fn func(tx db.Database) error) error {
+	return d.Database.WithTransaction(ctx, func(tx db.Database) error {
+		return fn(&instrumentedDatabase{
+			Database: tx,
+			metrics:  d.metrics,
+		})
+	})
+}
+
+// instrumentedPaymentsDatabase is an implementation of db.PaymentsDatabase that records metrics about the operations performed on the wrapped one.
+type instrumentedPaymentsDatabase struct {
+	// payments is the wrapped database.
+	payments db.PaymentsDatabase
+	// metrics is the set of metrics in which to record observations.
+	metrics *Metrics
+}
+
+// CountPayments returns the number of registered payments.
+func (d *instrumentedPaymentsDatabase) CountPayments() (int64, error) {
+	done := d.observe("CountPayments")
+	r, err := d.payments.CountPayments()
+	done(err)
+	return r, err
+}
+
+// CreatePayment creates the provided payment.
+func (d *instrumentedPaymentsDatabase) CreatePayment(p models.Payment) (models.Payment, error) {
+	done := d.observe("CreatePayment")
+	r, err := d.payments.CreatePayment(p)
+	done(err)
+	if err == nil {
+		d.metrics.paymentsCreated.WithLabelValues(currencyLabel(r.Currency)).Inc()
+		d.metrics.paymentsCreatedAmount.WithLabelValues(currencyLabel(r.Currency)).Add(r.Amount)
+	}
+	return r, err
+}
+
+// DeletePayment deletes the payment with the specified ID.
+func (d *instrumentedPaymentsDatabase) DeletePayment(id string) (bool, error) {
+	done := d.observe("DeletePayment")
+	r, err := d.payments.DeletePayment(id)
+	done(err)
+	return r, err
+}
+
+// GetPayment returns the payment with the specified ID.
+func (d *instrumentedPaymentsDatabase) GetPayment(id string) (models.Payment, error) {
+	done := d.observe("GetPayment")
+	r, err := d.payments.GetPayment(id)
+	done(err)
+	return r, err
+}
+
+// ListPayments lists registered payments ordered by ID, skipping the specified number of payments and returning at most the specified number of them.
+func (d *instrumentedPaymentsDatabase) ListPayments(offset, limit int) ([]models.Payment, error) {
+	done := d.observe("ListPayments")
+	r, err := d.payments.ListPayments(offset, limit)
+	done(err)
+	return r, err
+}
+
+// RestorePayment restores the deleted payment with the specified ID.
+func (d *instrumentedPaymentsDatabase) RestorePayment(id string) (bool, error) {
+	done := d.observe("RestorePayment")
+	r, err := d.payments.RestorePayment(id)
+	done(err)
+	return r, err
+}
+
+// SearchPayments lists registered payments matching the provided filter ordered by ID, skipping the specified number of payments and returning at most the specified number of them, together with the total number of matching payments.
+func (d *instrumentedPaymentsDatabase) SearchPayments(f db.PaymentsFilter, offset, limit int) ([]models.Payment, int64, error) {
+	done := d.observe("SearchPayments")
+	r, n, err := d.payments.SearchPayments(f, offset, limit)
+	done(err)
+	return r, n, err
+}
+
+// UpdatePayment updates the payment with the specified ID.
+func (d *instrumentedPaymentsDatabase) UpdatePayment(id string, p models.Payment) (models.Payment, error) {
+	done := d.observe("UpdatePayment")
+	r, err := d.payments.UpdatePayment(id, p)
+	done(err)
+	return r, err
+}
+
+// observe starts observing the specified operation, returning a function that must be called with its outcome when it completes.
+func (d *instrumentedPaymentsDatabase) observe(operation string) func(error) {
+	start := time.Now()
+	return func(err error) {
+		d.metrics.databaseOperationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+		if err != nil {
+			d.metrics.databaseOperationErrors.WithLabelValues(operation).Inc()
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	// unmatchedRoute is the route reported for requests that do not match any route.
+	unmatchedRoute = "<unmatched>"
+)
+
+// methods are the HTTP methods reported as such, other methods being reported as "other".
+var methods = map[string]bool{
+	http.MethodConnect: true,
+	http.MethodDelete:  true,
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPatch:   true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodTrace:   true,
+}
+
+// Middleware returns an Echo middleware that counts HTTP requests and observes their latency.
+// Requests are labelled with the template of the matched route (e.g. "/payments/:id") rather than with their path so that the number of series remains bounded.
+func (m *Metrics) Middleware() echo.MiddlewareFunc {
+	var (
+		once   sync.Once
+		routes map[string]bool
+	)
+	return func(fn echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			start := time.Now()
+			err := fn(ctx)
+			// Echo reports the requested path as the path of requests that do not match any route, so only registered routes are used as labels.
+			// Routes are only collected once the first request is served, as they are registered after middleware is installed.
+			once.Do(func() {
+				routes = make(map[string]bool)
+				for _, r := range ctx.Echo().Routes() {
+					routes[r.Path] = true
+				}
+			})
+			r := ctx.Path()
+			if !routes[r] {
+				r = unmatchedRoute
+			}
+			// Clients may use arbitrary methods, so only standard ones are used as labels.
+			method := ctx.Request().Method
+			if !methods[method] {
+				method = otherLabelValue
+			}
+			m.httpRequests.WithLabelValues(method, r, strconv.Itoa(status(ctx, err))).Inc()
+			m.httpRequestDuration.WithLabelValues(method, r).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// status returns the status of the response to the current request.
+// Errors are only turned into responses by Echo's error handler after middleware returns, so the status is derived from them when present.
+func status(ctx echo.Context, err error) int {
+	if err == nil {
+		return ctx.Response().Status
+	}
+	if he, ok := err.(*echo.HTTPError); ok {
+		return he.Code
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,176 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+const (
+	// namespace is the prefix of the names of all metrics.
+	namespace = "dojo_payments"
+	// otherLabelValue is the value reported in place of label values which are not known in advance, so that the number of series remains bounded.
+	otherLabelValue = "other"
+)
+
+const (
+	// Path is the path at which metrics are exposed by the metrics server.
+	Path = "/metrics"
+)
+
+// Metrics holds the metrics exposed by the application.
+type Metrics struct {
+	// registry is the registry in which metrics are registered.
+	registry *prometheus.Registry
+
+	// httpRequests counts HTTP requests by method, route and status.
+	httpRequests *prometheus.CounterVec
+	// httpRequestDuration observes the latency of HTTP requests by method and route.
+	httpRequestDuration *prometheus.HistogramVec
+	// cacheLookups counts lookups of payments in the cache by result.
+	cacheLookups *prometheus.CounterVec
+	// databaseOperationDuration observes the latency of storage operations by operation.
+	databaseOperationDuration *prometheus.HistogramVec
+	// databaseOperationErrors counts failed storage operations by operation.
+	databaseOperationErrors *prometheus.CounterVec
+	// databaseOperationRetries counts retried storage operations by operation.
+	databaseOperationRetries *prometheus.CounterVec
+	// paymentsCreated counts created payments by currency.
+	paymentsCreated *prometheus.CounterVec
+	// paymentsCreatedAmount sums the amount involved in created payments by currency.
+	paymentsCreatedAmount *prometheus.CounterVec
+	// paymentsExecuted counts scheduled payments executed by the scheduler by currency.
+	paymentsExecuted *prometheus.CounterVec
+}
+
+// New returns a new set of metrics, registered in a dedicated registry together with the standard Go and process metrics.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of HTTP requests by method and route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "lookups_total",
+			Help:      "Number of lookups of payments in the cache by result (hit or miss).",
+		}, []string{"result"}),
+		databaseOperationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "database",
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of storage operations by operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		databaseOperationErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "database",
+			Name:      "operation_errors_total",
+			Help:      "Number of failed storage operations by operation.",
+		}, []string{"operation"}),
+		databaseOperationRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "database",
+			Name:      "operation_retries_total",
+			Help:      "Number of retried storage operations by operation.",
+		}, []string{"operation"}),
+		paymentsCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "payments_created_total",
+			Help:      "Number of payments created by currency.",
+		}, []string{"currency"}),
+		paymentsCreatedAmount: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "payments_created_amount_total",
+			Help:      "Total amount involved in payments created by currency.",
+		}, []string{"currency"}),
+		paymentsExecuted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "payments_executed_total",
+			Help:      "Number of scheduled payments executed by currency.",
+		}, []string{"currency"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpRequestDuration,
+		m.cacheLookups,
+		m.databaseOperationDuration,
+		m.databaseOperationErrors,
+		m.databaseOperationRetries,
+		m.paymentsCreated,
+		m.paymentsCreatedAmount,
+		m.paymentsExecuted,
+	)
+	return m
+}
+
+// ObserveCacheLookup records a lookup of a payment in the cache with the specified result.
+func (m *Metrics) ObserveCacheLookup(result string) {
+	m.cacheLookups.WithLabelValues(result).Inc()
+}
+
+// ObserveDatabaseRetry records that the specified storage operation was retried.
+func (m *Metrics) ObserveDatabaseRetry(operation string) {
+	m.databaseOperationRetries.WithLabelValues(operation).Inc()
+}
+
+// ObservePaymentExecuted records that the provided scheduled payment was executed.
+func (m *Metrics) ObservePaymentExecuted(p models.Payment) {
+	m.paymentsExecuted.WithLabelValues(currencyLabel(p.Currency)).Inc()
+}
+
+// currencyLabel returns the value of the "currency" label for the specified currency.
+// Currencies not defined by ISO 4217 (e.g. of payments created before currencies were validated) are reported as "other".
+func currencyLabel(currency string) string {
+	if models.IsKnownCurrency(currency) {
+		return currency
+	}
+	return otherLabelValue
+}
+
+// Handler returns an HTTP handler that exposes the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// NewServer returns an HTTP server that exposes the metrics at Path when listening at the specified address.
+// Metrics reveal payment volumes and amounts across all tenants, so the server is meant to listen on an internal address which only monitoring systems can reach.
+func (m *Metrics) NewServer(bindAddress string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(Path, m.Handler())
+	return &http.Server{
+		Addr:    bindAddress,
+		Handler: mux,
+	}
+}
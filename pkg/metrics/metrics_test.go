@@ -0,0 +1,176 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+// fakeDatabase is an implementation of db.Database which only creates and gets payments.
+type fakeDatabase struct {
+	db.Database
+
+	// err is the error returned by every operation, if any.
+	err error
+}
+
+// Payments allows for accessing methods used to perform CRUD operations on payments.
+func (f *fakeDatabase) Payments() db.PaymentsDatabase {
+	return &fakePaymentsDatabase{fakeDatabase: f}
+}
+
+// fakePaymentsDatabase is an implementation of db.PaymentsDatabase backed by a fakeDatabase.
+type fakePaymentsDatabase struct {
+	db.PaymentsDatabase
+	*fakeDatabase
+}
+
+func (f *fakePaymentsDatabase) CreatePayment(p models.Payment) (models.Payment, error) {
+	if f.err != nil {
+		return models.Payment{}, f.err
+	}
+	return p, nil
+}
+
+func (f *fakePaymentsDatabase) GetPayment(id string) (models.Payment, error) {
+	return models.Payment{}, f.err
+}
+
+var _ = Describe("Metrics", func() {
+	var (
+		m *Metrics
+	)
+
+	BeforeEach(func() {
+		m = New()
+	})
+
+	Describe("HTTP middleware", func() {
+		var (
+			e *echo.Echo
+		)
+
+		BeforeEach(func() {
+			e = echo.New()
+			e.Use(m.Middleware())
+			e.GET("/payments/:id", func(ctx echo.Context) error {
+				if ctx.Param("id") == "missing" {
+					return echo.NewHTTPError(http.StatusNotFound, "payment not found")
+				}
+				return ctx.NoContent(http.StatusOK)
+			})
+		})
+
+		It("labels requests with the route template and the status", func() {
+			for _, id := range []string{"1", "2", "missing"} {
+				e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/payments/"+id, nil))
+			}
+			Expect(testutil.ToFloat64(m.httpRequests.WithLabelValues(http.MethodGet, "/payments/:id", "200"))).To(Equal(2.0))
+			Expect(testutil.ToFloat64(m.httpRequests.WithLabelValues(http.MethodGet, "/payments/:id", "404"))).To(Equal(1.0))
+			Expect(testutil.CollectAndCount(m.httpRequestDuration)).To(Equal(1))
+		})
+
+		It("labels requests not matching any route with a placeholder", func() {
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/foo/bar", nil))
+			Expect(testutil.ToFloat64(m.httpRequests.WithLabelValues(http.MethodGet, unmatchedRoute, "404"))).To(Equal(1.0))
+		})
+
+		It("labels requests made using non-standard methods as other", func() {
+			for _, method := range []string{"FOO", "BAR"} {
+				e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/payments/1", nil))
+			}
+			Expect(testutil.ToFloat64(m.httpRequests.WithLabelValues(otherLabelValue, "/payments/:id", "405"))).To(Equal(2.0))
+		})
+	})
+
+	Describe("instrumented database", func() {
+		var (
+			database *fakeDatabase
+			d        db.Database
+		)
+
+		BeforeEach(func() {
+			database = &fakeDatabase{}
+			d = m.InstrumentDatabase(database)
+		})
+
+		It("records storage operations and created payments", func() {
+			_, err := d.Payments().CreatePayment(models.Payment{Amount: 12.5, Currency: "GBP"})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = d.Payments().CreatePayment(models.Payment{Amount: 7.5, Currency: "GBP"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testutil.ToFloat64(m.paymentsCreated.WithLabelValues("GBP"))).To(Equal(2.0))
+			Expect(testutil.ToFloat64(m.paymentsCreatedAmount.WithLabelValues("GBP"))).To(Equal(20.0))
+			Expect(testutil.ToFloat64(m.databaseOperationErrors.WithLabelValues("CreatePayment"))).To(Equal(0.0))
+		})
+
+		It("labels payments made in unknown currencies as other", func() {
+			for _, c := range []string{"FOO", "BAR"} {
+				_, err := d.Payments().CreatePayment(models.Payment{Amount: 1, Currency: c})
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(testutil.ToFloat64(m.paymentsCreated.WithLabelValues(otherLabelValue))).To(Equal(2.0))
+			Expect(testutil.CollectAndCount(m.paymentsCreated)).To(Equal(1))
+		})
+
+		It("records failed storage operations", func() {
+			database.err = errors.New("boom")
+			_, err := d.Payments().GetPayment("1")
+			Expect(err).To(HaveOccurred())
+			_, err = d.Payments().CreatePayment(models.Payment{Amount: 1, Currency: "GBP"})
+			Expect(err).To(HaveOccurred())
+			Expect(testutil.ToFloat64(m.databaseOperationErrors.WithLabelValues("GetPayment"))).To(Equal(1.0))
+			Expect(testutil.ToFloat64(m.databaseOperationErrors.WithLabelValues("CreatePayment"))).To(Equal(1.0))
+			Expect(testutil.ToFloat64(m.paymentsCreated.WithLabelValues("GBP"))).To(Equal(0.0))
+		})
+
+	})
+
+	It("exposes whether the database is online as reported by the provided function", func() {
+		online := true
+		m.InstrumentDatabaseStatus(func() bool {
+			return online
+		})
+		rec := httptest.NewRecorder()
+		m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path, nil))
+		Expect(rec.Body.String()).To(ContainSubstring("dojo_payments_database_online 1"))
+		online = false
+		rec = httptest.NewRecorder()
+		m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path, nil))
+		Expect(rec.Body.String()).To(ContainSubstring("dojo_payments_database_online 0"))
+	})
+
+	It("exposes metrics at the metrics path of the metrics server only", func() {
+		srv := m.NewServer("localhost:9100")
+		Expect(srv.Addr).To(Equal("localhost:9100"))
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path, nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(ContainSubstring("go_goroutines"))
+		rec = httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/payments", nil))
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,161 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi
+
+import (
+	"strings"
+)
+
+const (
+	// Version is the version of the OpenAPI specification implemented by this package.
+	Version = "3.0.3"
+)
+
+const (
+	// MediaTypeJSON is the media type used for JSON request and response bodies.
+	MediaTypeJSON = "application/json"
+)
+
+// Document represents an OpenAPI document.
+type Document struct {
+	// OpenAPI is the version of the OpenAPI specification the document implements.
+	OpenAPI string `json:"openapi"`
+	// Info contains metadata about the API.
+	Info Info `json:"info"`
+	// Paths are the paths available in the API, indexed by their template.
+	Paths map[string]PathItem `json:"paths"`
+	// Components contains the reusable objects referenced from elsewhere in the document.
+	Components Components `json:"components"`
+}
+
+// Info contains metadata about an API.
+type Info struct {
+	// Title is the title of the API.
+	Title string `json:"title"`
+	// Description is a short description of the API.
+	Description string `json:"description,omitempty"`
+	// Version is the version of the API.
+	Version string `json:"version"`
+}
+
+// PathItem describes the operations available on a single path, indexed by their (lowercase) HTTP method.
+type PathItem map[string]*Operation
+
+// Operation describes a single API operation on a path.
+type Operation struct {
+	// OperationID is the unique identifier of the operation.
+	OperationID string `json:"operationId"`
+	// Summary is a short summary of what the operation does.
+	Summary string `json:"summary"`
+	// Description is a longer description of the operation's behavior, if any.
+	Description string `json:"description,omitempty"`
+	// Parameters are the parameters accepted by the operation.
+	Parameters []Parameter `json:"parameters,omitempty"`
+	// RequestBody is the request body accepted by the operation.
+	RequestBody *RequestBody `json:"requestBody,omitempty"`
+	// Responses are the responses returned by the operation, indexed by status code.
+	Responses map[string]Response `json:"responses"`
+}
+
+// Parameter describes a single operation parameter.
+type Parameter struct {
+	// Name is the name of the parameter.
+	Name string `json:"name"`
+	// In is the location of the parameter (e.g. "path", "query" or "header").
+	In string `json:"in"`
+	// Description is a brief description of the parameter.
+	Description string `json:"description,omitempty"`
+	// Required indicates whether the parameter is mandatory.
+	Required bool `json:"required,omitempty"`
+	// Schema is the schema of the parameter's value.
+	Schema *Schema `json:"schema"`
+}
+
+// RequestBody describes a request body.
+type RequestBody struct {
+	// Required indicates whether the request body is mandatory.
+	Required bool `json:"required,omitempty"`
+	// Content contains the supported representations of the request body, indexed by media type.
+	Content map[string]MediaType `json:"content"`
+}
+
+// Response describes a single response from an operation.
+type Response struct {
+	// Description is a short description of the response.
+	Description string `json:"description"`
+	// Content contains the supported representations of the response, indexed by media type.
+	Content map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType describes a representation of a request or response body.
+type MediaType struct {
+	// Schema is the schema of the body.
+	Schema *Schema `json:"schema"`
+}
+
+// Components contains the reusable objects referenced from elsewhere in a document.
+type Components struct {
+	// Schemas are the reusable schemas, indexed by name.
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// Schema describes a data type.
+type Schema struct {
+	// Ref is a reference to a schema defined in the document's components.
+	Ref string `json:"$ref,omitempty"`
+	// Type is the type of the data.
+	Type string `json:"type,omitempty"`
+	// Format refines the type of the data.
+	Format string `json:"format,omitempty"`
+	// Pattern is a regular expression the data must match.
+	Pattern string `json:"pattern,omitempty"`
+	// Nullable indicates whether the data may be null.
+	Nullable bool `json:"nullable,omitempty"`
+	// Items is the schema of the elements of an array.
+	Items *Schema `json:"items,omitempty"`
+	// Properties are the schemas of the properties of an object, indexed by name.
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	// AdditionalProperties is the schema of the values of an object with arbitrary keys.
+	AdditionalProperties *Schema `json:"additionalProperties,omitempty"`
+}
+
+// NewDocument returns a new, empty, instance of Document with the provided metadata.
+func NewDocument(info Info) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   make(map[string]PathItem),
+		Components: Components{
+			Schemas: make(map[string]*Schema),
+		},
+	}
+}
+
+// AddOperation adds the provided operation to the document under the specified method and path template.
+func (d *Document) AddOperation(method, path string, op *Operation) {
+	if _, ok := d.Paths[path]; !ok {
+		d.Paths[path] = make(PathItem)
+	}
+	d.Paths[path][strings.ToLower(method)] = op
+}
+
+// JSON returns a request or response body containing JSON data conforming to the provided schema.
+func JSON(s *Schema) map[string]MediaType {
+	return map[string]MediaType{
+		MediaTypeJSON: {
+			Schema: s,
+		},
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// componentsSchemasRefPrefix is the prefix of references to schemas defined in a document's components.
+	componentsSchemasRefPrefix = "#/components/schemas/"
+	// objectIDPattern is the pattern which MongoDB ObjectIDs (in their hexadecimal representation) match.
+	objectIDPattern = "^[0-9a-f]{24}$"
+)
+
+var (
+	// objectIDType is the type of MongoDB ObjectIDs.
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+	// timeType is the type of timestamps.
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+// SchemaOf returns the schema of the JSON representation of the provided value.
+// Named struct types are added to the document's components and referenced from the returned schema.
+func (d *Document) SchemaOf(v interface{}) *Schema {
+	return d.schemaOf(reflect.TypeOf(v))
+}
+
+// schemaOf returns the schema of the JSON representation of values of the provided type.
+func (d *Document) schemaOf(t reflect.Type) *Schema {
+	switch t {
+	case objectIDType:
+		return &Schema{Type: "string", Pattern: objectIDPattern}
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := d.schemaOf(t.Elem())
+		if s.Ref != "" {
+			return s
+		}
+		s.Nullable = true
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Array, reflect.Slice:
+		return &Schema{Type: "array", Items: d.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchemaOf(t)
+		}
+		if _, ok := d.Components.Schemas[t.Name()]; !ok {
+			// Register a placeholder first so that recursive types do not cause infinite recursion.
+			d.Components.Schemas[t.Name()] = &Schema{}
+			*d.Components.Schemas[t.Name()] = *d.structSchemaOf(t)
+		}
+		return &Schema{Ref: componentsSchemasRefPrefix + t.Name()}
+	default:
+		return &Schema{}
+	}
+}
+
+// structSchemaOf returns the schema of the JSON representation of values of the provided struct type.
+func (d *Document) structSchemaOf(t reflect.Type) *Schema {
+	s := &Schema{
+		Type:       "object",
+		Properties: make(map[string]*Schema),
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			// Unexported fields are never serialized.
+			continue
+		}
+		n := strings.Split(f.Tag.Get("json"), ",")[0]
+		if n == "-" {
+			continue
+		}
+		if f.Anonymous && n == "" && f.Type.Kind() == reflect.Struct {
+			// The fields of embedded structs are promoted to the embedding struct.
+			for k, v := range d.structSchemaOf(f.Type).Properties {
+				s.Properties[k] = v
+			}
+			continue
+		}
+		if n == "" {
+			n = f.Name
+		}
+		s.Properties[n] = d.schemaOf(f.Type)
+	}
+	return s
+}
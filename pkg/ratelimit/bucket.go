@@ -0,0 +1,66 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"math"
+	"time"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+// Result is the result of trying to take a token from a bucket.
+type Result struct {
+	// Allowed indicates whether a token was taken, and hence whether the request is allowed.
+	Allowed bool
+	// Limit is the maximum number of tokens in the bucket.
+	Limit int
+	// Remaining is the number of (whole) tokens left in the bucket.
+	Remaining int
+	// Reset is the amount of time after which the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the amount of time after which a token is available, in case none was taken.
+	RetryAfter time.Duration
+}
+
+// take tries to take a token from the provided bucket as of the specified time, returning the updated bucket.
+func take(b models.RateLimitBucket, l Limit, now time.Time) (models.RateLimitBucket, Result) {
+	burst := float64(l.Burst)
+	// Refill the bucket according to the time elapsed since it was last updated, starting with a full bucket.
+	tokens := burst
+	if !b.UpdatedAt.IsZero() {
+		tokens = math.Min(burst, b.Tokens+now.Sub(b.UpdatedAt).Seconds()*l.Rate)
+	}
+	r := Result{
+		Limit: l.Burst,
+	}
+	if tokens >= 1 {
+		tokens--
+		r.Allowed = true
+	} else {
+		r.RetryAfter = seconds((1 - tokens) / l.Rate)
+	}
+	r.Remaining = int(math.Floor(tokens))
+	r.Reset = seconds((burst - tokens) / l.Rate)
+	b.Tokens = tokens
+	b.UpdatedAt = now
+	b.ExpiresAt = now.Add(r.Reset)
+	return b, r
+}
+
+// seconds returns the duration corresponding to the specified number of seconds.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Limit configures a token bucket.
+type Limit struct {
+	// Rate is the number of tokens added to the bucket per second.
+	Rate float64 `json:"rate"`
+	// Burst is the maximum number of tokens in the bucket, which is the maximum number of requests that can be made at once.
+	Burst int `json:"burst"`
+}
+
+// Quota configures the maximum usage allowed per client and per (UTC) day.
+type Quota struct {
+	// DailyCount is the maximum number of payments created per day, if positive.
+	DailyCount int64 `json:"daily_count"`
+	// DailyAmount is the maximum total amount involved in payments created per day, indexed by currency.
+	// Payments made in currencies not listed are not limited.
+	DailyAmount map[string]float64 `json:"daily_amount"`
+}
+
+// Config configures rate limits and quotas.
+type Config struct {
+	// Default is the limit applied to routes without a specific limit.
+	// Routes without a specific limit are not rate-limited in case its rate is not positive.
+	Default Limit `json:"default"`
+	// IP is the limit applied to all requests made from each IP address, before they are authenticated, so that credentials cannot be guessed at an unlimited rate.
+	// Requests are not rate-limited per IP address in case its rate is not positive.
+	IP Limit `json:"ip"`
+	// Routes are the limits applied to specific routes, indexed by route (e.g. "POST /payments").
+	// Routes whose rate is not positive are not rate-limited.
+	Routes map[string]Limit `json:"routes"`
+	// Quota is the quota applied to the creation of payments.
+	Quota Quota `json:"quota"`
+}
+
+// LoadConfig reads the configuration defined in the specified JSON file.
+func LoadConfig(path string) (Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read the rate limits file: %v", err)
+	}
+	c := Config{}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return Config{}, fmt.Errorf("failed to parse the rate limits file: %v", err)
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// Validate validates the current Config object.
+func (c *Config) Validate() error {
+	if err := c.Default.validate(); err != nil {
+		return fmt.Errorf("default: %v", err)
+	}
+	if err := c.IP.validate(); err != nil {
+		return fmt.Errorf("ip: %v", err)
+	}
+	for r, l := range c.Routes {
+		if len(strings.Fields(r)) != 2 {
+			return fmt.Errorf(`route %q must be of the form "<method> <path>"`, r)
+		}
+		if err := l.validate(); err != nil {
+			return fmt.Errorf("route %q: %v", r, err)
+		}
+	}
+	return nil
+}
+
+// validate validates the current Limit object.
+func (l *Limit) validate() error {
+	if l.Rate > 0 && l.Burst < 1 {
+		return errors.New("the burst must be positive")
+	}
+	return nil
+}
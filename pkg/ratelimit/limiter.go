@@ -0,0 +1,229 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/pkg/logging"
+)
+
+const (
+	// LimitHeader is the name of the header that contains the maximum number of requests that can be made at once.
+	LimitHeader = "RateLimit-Limit"
+	// RemainingHeader is the name of the header that contains the number of requests that can still be made at once.
+	RemainingHeader = "RateLimit-Remaining"
+	// ResetHeader is the name of the header that contains the number of seconds after which the limit is fully reset.
+	ResetHeader = "RateLimit-Reset"
+	// RetryAfterHeader is the name of the header that contains the number of seconds after which a request may be retried.
+	RetryAfterHeader = "Retry-After"
+)
+
+var (
+	// ErrQuotaExceeded is the error returned when a payment would exceed the daily quota of a client.
+	ErrQuotaExceeded = errors.New("daily quota exceeded")
+)
+
+// limiterContextKey is the type of the key under which the limiter and the key of the client are stored in a context.
+type limiterContextKey struct{}
+
+// limiterContextValue is the value stored in a context under limiterContextKey.
+type limiterContextValue struct {
+	// client is the key identifying the client.
+	client string
+	// limiter is the limiter.
+	limiter *Limiter
+}
+
+// Limiter enforces rate limits and quotas.
+type Limiter struct {
+	// config is the configuration of rate limits and quotas.
+	config Config
+	// store is the store in which the state of rate limits and quotas is kept.
+	store Store
+	// now returns the current time.
+	now func() time.Time
+}
+
+// NewLimiter returns a new limiter that enforces the provided configuration, keeping state in the specified store.
+func NewLimiter(config Config, store Store) *Limiter {
+	return &Limiter{
+		config: config,
+		store:  store,
+		now:    time.Now,
+	}
+}
+
+// IPMiddleware returns an Echo middleware that rate-limits all requests per IP address, regardless of the route and of the principal making them.
+// It must be installed before the authentication middleware so that requests failing to authenticate are rate-limited as well.
+// Requests for which skipper returns true are not rate-limited.
+func (l *Limiter) IPMiddleware(skipper func(echo.Context) bool) echo.MiddlewareFunc {
+	return func(fn echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if skipper(ctx) {
+				return fn(ctx)
+			}
+			res, err := l.TakeIP(ctx.RealIP())
+			return respond(ctx, res, err, fn)
+		}
+	}
+}
+
+// Middleware returns an Echo middleware that rate-limits requests per client and per route, and that makes the limiter available to HTTP handlers.
+// It must be installed after the authentication middleware so that requests can be attributed to principals.
+func (l *Limiter) Middleware() echo.MiddlewareFunc {
+	return func(fn echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			ctx.Set(constants.RateLimiterContextKey, l)
+			// Try to take a token from the bucket corresponding to the current client and route.
+			res, err := l.Take(ClientKey(ctx.Request().Context(), ctx.RealIP()), ctx.Request().Method+" "+ctx.Path())
+			return respond(ctx, res, err, fn)
+		}
+	}
+}
+
+// respond rejects the current request with "429 TOO MANY REQUESTS" in case the provided result of taking a token indicates it is not allowed, and calls the provided handler otherwise.
+// Rate limit headers are set according to said result (if any).
+func respond(ctx echo.Context, res *Result, err error, fn echo.HandlerFunc) error {
+	if err != nil {
+		// Fail open rather than rejecting every request because the store is unavailable.
+		logging.FromContext(ctx.Request().Context()).Errorf("failed to enforce rate limit: %v", err)
+		return fn(ctx)
+	}
+	if res == nil {
+		return fn(ctx)
+	}
+	h := ctx.Response().Header()
+	h.Set(LimitHeader, strconv.Itoa(res.Limit))
+	h.Set(RemainingHeader, strconv.Itoa(res.Remaining))
+	h.Set(ResetHeader, strconv.Itoa(ceilSeconds(res.Reset)))
+	if !res.Allowed {
+		h.Set(RetryAfterHeader, strconv.Itoa(ceilSeconds(res.RetryAfter)))
+		return echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded")
+	}
+	return fn(ctx)
+}
+
+// Take tries to take a token from the bucket corresponding to the specified client and route (in the "<METHOD> <PATH>" form).
+// A nil result is returned in case no rate limit applies to the route.
+func (l *Limiter) Take(client, route string) (*Result, error) {
+	v, ok := l.config.Routes[route]
+	if !ok {
+		v = l.config.Default
+	}
+	if v.Rate <= 0 {
+		return nil, nil
+	}
+	res, err := l.store.Take(client+"|"+route, v, l.now())
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// TakeIP tries to take a token from the bucket corresponding to the specified IP address.
+// A nil result is returned in case requests are not rate-limited per IP address.
+func (l *Limiter) TakeIP(ip string) (*Result, error) {
+	if l.config.IP.Rate <= 0 {
+		return nil, nil
+	}
+	res, err := l.store.Take("ip:"+ip, l.config.IP, l.now())
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ConsumeQuota adds the provided payment to the daily quota of the client making the current request, using the limiter present in the context (if any).
+// An HTTP error with status 429 is returned in case the quota would be exceeded.
+// Callers must call the returned function in case the payment ends up not being created.
+func ConsumeQuota(ctx echo.Context, p models.Payment) (func(), error) {
+	l, ok := ctx.Get(constants.RateLimiterContextKey).(*Limiter)
+	if !ok || l == nil {
+		return func() {}, nil
+	}
+	release, retryAfter, err := l.Consume(ctx.Request().Context(), ClientKey(ctx.Request().Context(), ctx.RealIP()), p)
+	switch {
+	case err == ErrQuotaExceeded:
+		ctx.Response().Header().Set(RetryAfterHeader, strconv.Itoa(ceilSeconds(retryAfter)))
+		return nil, echo.NewHTTPError(http.StatusTooManyRequests, err.Error())
+	case err != nil:
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
+	}
+	return release, nil
+}
+
+// Consume adds the provided payment to the daily quota of the specified client.
+// ErrQuotaExceeded is returned, together with the time after which the quota is reset, in case the quota would be exceeded.
+// Callers must call the returned function in case the payment ends up not being created.
+func (l *Limiter) Consume(ctx context.Context, client string, p models.Payment) (func(), time.Duration, error) {
+	q := l.config.Quota
+	if q.DailyCount <= 0 && len(q.DailyAmount) == 0 {
+		return func() {}, 0, nil
+	}
+	// Quotas are reset every day at midnight (UTC).
+	now := l.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	reset := day.AddDate(0, 0, 1)
+	k := fmt.Sprintf("%s|%s", client, day.Format("2006-01-02"))
+	ok, err := l.store.AddUsage(k, 1, p.Currency, p.Amount, q.DailyCount, q.DailyAmount[p.Currency], reset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to check quota: %v", err)
+	}
+	if !ok {
+		return nil, reset.Sub(now), ErrQuotaExceeded
+	}
+	return func() {
+		if _, err := l.store.AddUsage(k, -1, p.Currency, -p.Amount, 0, 0, reset); err != nil {
+			logging.FromContext(ctx).Errorf("failed to release quota: %v", err)
+		}
+	}, 0, nil
+}
+
+// NewContext returns a copy of the provided context that carries the specified limiter and the key identifying the client on whose behalf operations are performed.
+func NewContext(ctx context.Context, l *Limiter, client string) context.Context {
+	return context.WithValue(ctx, limiterContextKey{}, limiterContextValue{client: client, limiter: l})
+}
+
+// FromContext returns the limiter and the key of the client carried by the provided context, or nil and the empty string if there are none.
+func FromContext(ctx context.Context) (*Limiter, string) {
+	v, _ := ctx.Value(limiterContextKey{}).(limiterContextValue)
+	return v.limiter, v.client
+}
+
+// ClientKey returns the key identifying the client making a request with the provided context from the specified IP address.
+// Authenticated requests are attributed to the principal on whose behalf they are made, and the remaining ones to the client's IP address.
+func ClientKey(ctx context.Context, ip string) string {
+	if p := auth.PrincipalFromContext(ctx); p != nil {
+		return fmt.Sprintf("principal:%s/%s", p.Tenant, p.Subject)
+	}
+	return "ip:" + ip
+}
+
+// ceilSeconds returns the specified duration as a whole number of seconds, rounded up.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+var _ = Describe("Limiter", func() {
+	var (
+		e   *echo.Echo
+		l   *Limiter
+		now time.Time
+	)
+
+	// request makes a request to the specified route, returning the response.
+	request := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	// payment returns a payment involving the specified amount in the specified currency.
+	payment := func(amount float64, currency string) models.Payment {
+		return models.Payment{
+			Amount:   amount,
+			Currency: currency,
+		}
+	}
+
+	// consume consumes the quota of the specified payment as if it were created by an unauthenticated client.
+	consume := func(p models.Payment) (func(), error) {
+		ctx := e.NewContext(httptest.NewRequest(http.MethodPost, "/payments", nil), httptest.NewRecorder())
+		ctx.Set(constants.RateLimiterContextKey, l)
+		return ConsumeQuota(ctx, p)
+	}
+
+	BeforeEach(func() {
+		now = time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+		l = NewLimiter(Config{
+			Default: Limit{Rate: 1, Burst: 2},
+			Routes: map[string]Limit{
+				"GET /unlimited": {Rate: 0},
+			},
+			Quota: Quota{
+				DailyCount:  3,
+				DailyAmount: map[string]float64{"GBP": 100},
+			},
+		}, NewMemoryStore())
+		l.now = func() time.Time {
+			return now
+		}
+		e = echo.New()
+		e.Use(l.Middleware())
+		for _, p := range []string{"/limited", "/unlimited"} {
+			e.GET(p, func(ctx echo.Context) error {
+				return ctx.NoContent(http.StatusOK)
+			})
+		}
+	})
+
+	It("allows bursts and then rejects requests until tokens are refilled", func() {
+		rec := request(http.MethodGet, "/limited")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get(LimitHeader)).To(Equal("2"))
+		Expect(rec.Header().Get(RemainingHeader)).To(Equal("1"))
+		Expect(rec.Header().Get(ResetHeader)).To(Equal("1"))
+		Expect(request(http.MethodGet, "/limited").Code).To(Equal(http.StatusOK))
+		rec = request(http.MethodGet, "/limited")
+		Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(rec.Header().Get(RemainingHeader)).To(Equal("0"))
+		Expect(rec.Header().Get(RetryAfterHeader)).To(Equal("1"))
+		now = now.Add(time.Second)
+		Expect(request(http.MethodGet, "/limited").Code).To(Equal(http.StatusOK))
+	})
+
+	It("does not limit routes whose rate is not positive", func() {
+		for i := 0; i < 10; i++ {
+			rec := request(http.MethodGet, "/unlimited")
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Header().Get(LimitHeader)).To(BeEmpty())
+		}
+	})
+
+	It("rate-limits requests per ip address, including those that fail to authenticate", func() {
+		l.config.IP = Limit{Rate: 1, Burst: 2}
+		e = echo.New()
+		e.Use(l.IPMiddleware(func(ctx echo.Context) bool {
+			return ctx.Path() == "/healthz"
+		}))
+		e.GET("/limited", func(ctx echo.Context) error {
+			return echo.NewHTTPError(http.StatusUnauthorized, "missing credentials")
+		})
+		e.GET("/healthz", func(ctx echo.Context) error {
+			return ctx.NoContent(http.StatusOK)
+		})
+		for i := 0; i < 2; i++ {
+			Expect(request(http.MethodGet, "/limited").Code).To(Equal(http.StatusUnauthorized))
+		}
+		rec := request(http.MethodGet, "/limited")
+		Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(rec.Header().Get(RetryAfterHeader)).To(Equal("1"))
+		Expect(request(http.MethodGet, "/healthz").Code).To(Equal(http.StatusOK))
+	})
+
+	It("enforces the daily count quota", func() {
+		for i := 0; i < 3; i++ {
+			_, err := consume(payment(1, "EUR"))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		_, err := consume(payment(1, "EUR"))
+		Expect(err).To(HaveOccurred())
+		Expect(err.(*echo.HTTPError).Code).To(Equal(http.StatusTooManyRequests))
+		// Make sure that the quota is reset on the next day.
+		now = now.Add(12 * time.Hour)
+		_, err = consume(payment(1, "EUR"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("enforces the daily amount quota per currency", func() {
+		_, err := consume(payment(60, "GBP"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = consume(payment(50, "GBP"))
+		Expect(err).To(HaveOccurred())
+		_, err = consume(payment(500, "EUR"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("releases quota consumed by payments which were not created", func() {
+		release, err := consume(payment(60, "GBP"))
+		Expect(err).NotTo(HaveOccurred())
+		release()
+		_, err = consume(payment(100, "GBP"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
+
+var _ = Describe("Config", func() {
+	DescribeTable("validates limits",
+		func(c Config, valid bool) {
+			if valid {
+				Expect(c.Validate()).To(Succeed())
+			} else {
+				Expect(c.Validate()).NotTo(Succeed())
+			}
+		},
+		Entry("empty", Config{}, true),
+		Entry("default without burst", Config{Default: Limit{Rate: 1}}, false),
+		Entry("route", Config{Routes: map[string]Limit{"POST /payments": {Rate: 1, Burst: 1}}}, true),
+		Entry("route without method", Config{Routes: map[string]Limit{"/payments": {Rate: 1, Burst: 1}}}, false),
+		Entry("unlimited route", Config{Routes: map[string]Limit{"GET /payments": {}}}, true),
+		Entry("ip", Config{IP: Limit{Rate: 1, Burst: 1}}, true),
+		Entry("ip without burst", Config{IP: Limit{Rate: 1}}, false),
+	)
+})
+
+var _ = Describe("Memory store", func() {
+	It("discards expired state at most once every prune interval", func() {
+		s := NewMemoryStore().(*memoryStore)
+		now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+		l := Limit{Rate: 1, Burst: 1}
+		_, err := s.Take("a", l, now)
+		Expect(err).NotTo(HaveOccurred())
+		// The bucket has expired, but it is kept until the prune interval elapses.
+		_, err = s.Take("b", l, now.Add(memoryStorePruneInterval/2))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.buckets).To(HaveLen(2))
+		_, err = s.Take("c", l, now.Add(memoryStorePruneInterval))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.buckets).To(HaveLen(1))
+		Expect(s.buckets).To(HaveKey("c"))
+	})
+})
@@ -0,0 +1,149 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+const (
+	// maxSaveAttempts is the maximum number of times saving a token bucket to the database is attempted in the face of concurrent updates.
+	maxSaveAttempts = 5
+	// memoryStorePruneInterval is the minimum amount of time between two consecutive discards of expired state by the in-memory store.
+	memoryStorePruneInterval = time.Minute
+)
+
+// Store stores the state of rate limits and quotas.
+type Store interface {
+	// Take tries to take a token from the bucket with the specified key, configured using the provided limit, as of the specified time.
+	Take(key string, l Limit, now time.Time) (Result, error)
+	// AddUsage adds the specified count and amount (in the specified currency) to the usage of the quota with the specified key, which expires at the provided date.
+	// The usage is left untouched and false is returned in case the resulting count or amount would exceed the specified maximums (if positive).
+	AddUsage(key string, count int64, currency string, amount float64, maxCount int64, maxAmount float64, expiresAt time.Time) (bool, error)
+}
+
+// memoryStore is an implementation of Store that keeps state in memory.
+type memoryStore struct {
+	// lock protects the fields below.
+	lock sync.Mutex
+	// buckets are the token buckets, indexed by key.
+	buckets map[string]models.RateLimitBucket
+	// prunedAt is the time at which expired state was last discarded.
+	prunedAt time.Time
+	// usages are the usages of quotas, indexed by key.
+	usages map[string]models.QuotaUsage
+}
+
+// NewMemoryStore returns a new Store that keeps state in memory.
+// Limits and quotas are only enforced per instance of the API server.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		buckets: make(map[string]models.RateLimitBucket),
+		usages:  make(map[string]models.QuotaUsage),
+	}
+}
+
+// Take tries to take a token from the bucket with the specified key.
+func (s *memoryStore) Take(key string, l Limit, now time.Time) (Result, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// Discard expired state every now and then so that it does not grow indefinitely.
+	s.prune(now)
+	b, r := take(s.buckets[key], l, now)
+	s.buckets[key] = b
+	return r, nil
+}
+
+// AddUsage adds the specified count and amount to the usage of the quota with the specified key.
+func (s *memoryStore) AddUsage(key string, count int64, currency string, amount float64, maxCount int64, maxAmount float64, expiresAt time.Time) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	u := s.usages[key]
+	if u.Amounts == nil {
+		u.Amounts = make(map[string]float64)
+	}
+	if maxCount > 0 && u.Count+count > maxCount {
+		return false, nil
+	}
+	if maxAmount > 0 && u.Amounts[currency]+amount > maxAmount {
+		return false, nil
+	}
+	u.Count += count
+	u.Amounts[currency] += amount
+	u.ExpiresAt = expiresAt
+	s.usages[key] = u
+	return true, nil
+}
+
+// prune discards expired token buckets and quota usages, at most once every memoryStorePruneInterval so that the cost of doing so is amortized across requests.
+func (s *memoryStore) prune(now time.Time) {
+	if now.Sub(s.prunedAt) < memoryStorePruneInterval {
+		return
+	}
+	s.prunedAt = now
+	for k, b := range s.buckets {
+		if now.After(b.ExpiresAt) {
+			delete(s.buckets, k)
+		}
+	}
+	for k, u := range s.usages {
+		if now.After(u.ExpiresAt) {
+			delete(s.usages, k)
+		}
+	}
+}
+
+// databaseStore is an implementation of Store that keeps state in the database, so that it is shared between instances of the API server.
+type databaseStore struct {
+	// database is the database in which to keep state.
+	database db.Database
+}
+
+// NewDatabaseStore returns a new Store that keeps state in the provided database.
+func NewDatabaseStore(database db.Database) Store {
+	return &databaseStore{
+		database: database,
+	}
+}
+
+// Take tries to take a token from the bucket with the specified key, retrying in case the bucket is concurrently updated.
+func (s *databaseStore) Take(key string, l Limit, now time.Time) (Result, error) {
+	for i := 0; i < maxSaveAttempts; i++ {
+		b, err := s.database.RateLimits().GetRateLimitBucket(key)
+		if err != nil {
+			return Result{}, err
+		}
+		b.Key = key
+		b, r := take(b, l, now)
+		ok, err := s.database.RateLimits().SaveRateLimitBucket(b)
+		if err != nil {
+			return Result{}, err
+		}
+		if ok {
+			return r, nil
+		}
+	}
+	return Result{}, errors.New("failed to update rate limit bucket due to concurrent updates")
+}
+
+// AddUsage adds the specified count and amount to the usage of the quota with the specified key.
+func (s *databaseStore) AddUsage(key string, count int64, currency string, amount float64, maxCount int64, maxAmount float64, expiresAt time.Time) (bool, error) {
+	return s.database.RateLimits().IncrementQuotaUsage(key, count, currency, amount, maxCount, maxAmount, expiresAt)
+}
@@ -0,0 +1,152 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package resilience
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// probeRetryAfter is the amount of time after which to retry operations rejected while a probe is in flight.
+	probeRetryAfter = time.Second
+)
+
+// State is the state of a circuit breaker.
+type State string
+
+const (
+	// StateClosed indicates that operations are allowed.
+	StateClosed State = "closed"
+	// StateHalfOpen indicates that a single operation is allowed in order to probe whether the database has recovered.
+	StateHalfOpen State = "half-open"
+	// StateOpen indicates that operations are rejected without being attempted.
+	StateOpen State = "open"
+)
+
+// OpenError is the error returned when an operation is rejected because the circuit breaker is open.
+type OpenError struct {
+	// RetryAfter is the amount of time after which the operation may be retried.
+	RetryAfter time.Duration
+}
+
+// Error returns a message describing the error.
+func (e *OpenError) Error() string {
+	return "the database is unavailable (circuit breaker is open)"
+}
+
+// BreakerOptions configures a circuit breaker.
+type BreakerOptions struct {
+	// Cooldown is the amount of time for which the breaker stays open before letting a single operation through to probe whether the database has recovered.
+	Cooldown time.Duration
+	// FailureThreshold is the number of consecutive failures after which the breaker opens.
+	FailureThreshold int
+}
+
+// Breaker is a circuit breaker, which stops operations from being attempted after repeated failures so that they fail fast while the database recovers.
+type Breaker struct {
+	// failures is the number of consecutive failures.
+	failures int
+	// lock protects the fields of the breaker.
+	lock sync.Mutex
+	// now returns the current time.
+	now func() time.Time
+	// openedAt is the date at which the breaker last opened.
+	openedAt time.Time
+	// opts are the options used to configure the breaker.
+	opts BreakerOptions
+	// probing indicates whether a probe is in flight.
+	probing bool
+	// state is the current state of the breaker.
+	state State
+}
+
+// NewBreaker returns a new circuit breaker, which is initially closed.
+func NewBreaker(opts BreakerOptions) *Breaker {
+	return &Breaker{
+		now:   time.Now,
+		opts:  opts,
+		state: StateClosed,
+	}
+}
+
+// Allow returns an *OpenError in case an operation must not be attempted.
+// Otherwise, it returns a function that must be called with a value indicating whether the operation failed once it completes.
+func (b *Breaker) Allow() (func(failed bool), error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	switch b.state {
+	case StateOpen:
+		now := b.now()
+		if r := b.openedAt.Add(b.opts.Cooldown).Sub(now); r > 0 {
+			return nil, &OpenError{RetryAfter: r}
+		}
+		b.state = StateHalfOpen
+		fallthrough
+	case StateHalfOpen:
+		if b.probing {
+			return nil, &OpenError{RetryAfter: probeRetryAfter}
+		}
+		b.probing = true
+		return b.done(true), nil
+	default:
+		return b.done(false), nil
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.state == StateOpen && !b.now().Before(b.openedAt.Add(b.opts.Cooldown)) {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// done returns the function used to record the outcome of an operation, which may be a probe.
+func (b *Breaker) done(probe bool) func(failed bool) {
+	return func(failed bool) {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		if probe {
+			b.probing = false
+		}
+		switch {
+		case !failed && probe:
+			log.Info("the database has recovered, closing the circuit breaker")
+			b.failures = 0
+			b.state = StateClosed
+		case !failed && b.state == StateClosed:
+			b.failures = 0
+		case failed && probe:
+			log.Warn("the database is still unavailable, reopening the circuit breaker")
+			b.open()
+		case failed && b.state == StateClosed:
+			b.failures++
+			if b.failures >= b.opts.FailureThreshold {
+				log.Warnf("the database is unavailable, opening the circuit breaker after %d consecutive failures", b.failures)
+				b.open()
+			}
+		}
+	}
+}
+
+// open opens the breaker.
+func (b *Breaker) open() {
+	b.openedAt = b.now()
+	b.state = StateOpen
+}
@@ -0,0 +1,500 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package resilience
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+// Options configures how operations are retried.
+type Options struct {
+	// BaseDelay is the maximum amount of time to wait before retrying an operation for the first time, which doubles with every subsequent attempt.
+	BaseDelay time.Duration
+	// MaxAttempts is the maximum number of times a read is attempted (reads are not retried if one or less).
+	MaxAttempts int
+	// MaxDelay is the maximum amount of time to wait before retrying an operation.
+	MaxDelay time.Duration
+	// OnRetry, if not nil, is called with the name of the operation whenever it is retried.
+	OnRetry func(operation string)
+}
+
+// runner performs operations, retrying reads and stopping operations from being attempted while the circuit breaker is open.
+type runner struct {
+	// breaker is the circuit breaker through which operations are performed, if any.
+	breaker *Breaker
+	// opts are the options used to retry operations.
+	opts Options
+	// unavailable returns a value indicating whether the provided error was caused by the database being unavailable.
+	unavailable func(error) bool
+}
+
+// backoff returns the amount of time to wait before making the specified retry (starting at one), chosen at random up to an exponentially increasing maximum.
+func (r *runner) backoff(retry int) time.Duration {
+	d := r.opts.BaseDelay << uint(retry-1)
+	if d > r.opts.MaxDelay || d <= 0 {
+		d = r.opts.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+// call performs the provided operation once, unless the circuit breaker is open.
+// Only errors caused by the database being unavailable count as failures.
+func (r *runner) call(fn func() error) error {
+	if r.breaker == nil {
+		return fn()
+	}
+	done, err := r.breaker.Allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	done(r.unavailable(err))
+	return err
+}
+
+// read performs the provided idempotent operation, retrying it with jittered exponential backoff while it fails because the database is unavailable.
+// It stops retrying once the maximum number of attempts is reached, the circuit breaker opens or the provided context is done.
+func (r *runner) read(ctx context.Context, operation string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := r.call(fn)
+		if err == nil || attempt >= r.opts.MaxAttempts || !r.unavailable(err) {
+			return err
+		}
+		if r.opts.OnRetry != nil {
+			r.opts.OnRetry(operation)
+		}
+		t := time.NewTimer(r.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// resilientDatabase is an implementation of db.Database that retries reads and stops operations from being attempted against the wrapped database while the circuit breaker is open.
+type resilientDatabase struct {
+	db.Database
+
+	// ctx is the context within which operations are performed.
+	ctx context.Context
+	// runner performs operations.
+	runner *runner
+}
+
+// NewDatabase returns a view of the provided database that retries idempotent reads which fail because the database is unavailable, and through which operations fail fast with an *OpenError while the provided circuit breaker (if any) is open.
+// Health checks (i.e. IsOnline) and migrations are neither retried nor subject to the circuit breaker.
+func NewDatabase(database db.Database, breaker *Breaker, opts Options) db.Database {
+	return &resilientDatabase{
+		Database: database,
+		ctx:      context.Background(),
+		runner: &runner{
+			breaker:     breaker,
+			opts:        opts,
+			unavailable: db.IsUnavailable,
+		},
+	}
+}
+
+// APIKeys allows for accessing methods used to manage API keys.
+func (d *resilientDatabase) APIKeys() db.APIKeysDatabase {
+	return &resilientAPIKeysDatabase{
+		apiKeys: d.Database.APIKeys(),
+		ctx:     d.ctx,
+		runner:  d.runner,
+	}
+}
+
+// Events allows for accessing methods used to record and list events.
+func (d *resilientDatabase) Events() db.EventsDatabase {
+	return &resilientEventsDatabase{
+		ctx:    d.ctx,
+		events: d.Database.Events(),
+		runner: d.runner,
+	}
+}
+
+// ForTenant returns a resilient view of the database that only allows for accessing data belonging to the specified tenant.
+func (d *resilientDatabase) ForTenant(tenant string) (db.Database, error) {
+	v, err := d.Database.ForTenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+	return &resilientDatabase{
+		Database: v,
+		ctx:      d.ctx,
+		runner:   d.runner,
+	}, nil
+}
+
+// Payments allows for accessing methods used to perform CRUD operations on payments.
+func (d *resilientDatabase) Payments() db.PaymentsDatabase {
+	return &resilientPaymentsDatabase{
+		ctx:      d.ctx,
+		payments: d.Database.Payments(),
+		runner:   d.runner,
+	}
+}
+
+// RateLimits allows for accessing methods used to store the state of rate limits and quotas.
+func (d *resilientDatabase) RateLimits() db.RateLimitsDatabase {
+	return &resilientRateLimitsDatabase{
+		ctx:        d.ctx,
+		rateLimits: d.Database.RateLimits(),
+		runner:     d.runner,
+	}
+}
+
+// ScheduledPayments allows for accessing methods used to execute scheduled payments.
+func (d *resilientDatabase) ScheduledPayments() db.ScheduledPaymentsDatabase {
+	return &resilientScheduledPaymentsDatabase{
+		runner:    d.runner,
+		scheduled: d.Database.ScheduledPayments(),
+	}
+}
+
+// StandingOrders allows for accessing methods used to manage standing orders.
+func (d *resilientDatabase) StandingOrders() db.StandingOrdersDatabase {
+	return &resilientStandingOrdersDatabase{
+		ctx:            d.ctx,
+		runner:         d.runner,
+		standingOrders: d.Database.StandingOrders(),
+	}
+}
+
+// WithContext returns a resilient view of the database whose operations are performed within the provided context.
+func (d *resilientDatabase) WithContext(ctx context.Context) db.Database {
+	return &resilientDatabase{
+		Database: d.Database.WithContext(ctx),
+		ctx:      ctx,
+		runner:   d.runner,
+	}
+}
+
+// WithTransaction runs the provided function within a transaction, unless the circuit breaker is open.
+// Operations performed within the transaction are not retried individually, as the transaction as a whole is retried on transient errors.
+func (d *resilientDatabase) WithTransaction(ctx context.Context, fn func(tx db.Database) error) error {
+	return d.runner.call(func() error {
+		return d.Database.WithTransaction(ctx, fn)
+	})
+}
+
+// resilientAPIKeysDatabase is an implementation of db.APIKeysDatabase that retries reads and stops operations from being attempted while the circuit breaker is open.
+type resilientAPIKeysDatabase struct {
+	// apiKeys is the wrapped database.
+	apiKeys db.APIKeysDatabase
+	// ctx is the context within which operations are performed.
+	ctx context.Context
+	// runner performs operations.
+	runner *runner
+}
+
+// CreateAPIKey creates the provided API key.
+func (d *resilientAPIKeysDatabase) CreateAPIKey(k models.APIKey) (r models.APIKey, err error) {
+	err = d.runner.call(func() error {
+		r, err = d.apiKeys.CreateAPIKey(k)
+		return err
+	})
+	return r, err
+}
+
+// GetAPIKey returns the API key with the specified ID, retrying in case the database is unavailable.
+func (d *resilientAPIKeysDatabase) GetAPIKey(id string) (r models.APIKey, err error) {
+	err = d.runner.read(d.ctx, "GetAPIKey", func() error {
+		r, err = d.apiKeys.GetAPIKey(id)
+		return err
+	})
+	return r, err
+}
+
+// ListAPIKeys lists all API keys, retrying in case the database is unavailable.
+func (d *resilientAPIKeysDatabase) ListAPIKeys() (r []models.APIKey, err error) {
+	err = d.runner.read(d.ctx, "ListAPIKeys", func() error {
+		r, err = d.apiKeys.ListAPIKeys()
+		return err
+	})
+	return r, err
+}
+
+// RevokeAPIKey revokes the API key with the specified ID.
+func (d *resilientAPIKeysDatabase) RevokeAPIKey(id string) (r bool, err error) {
+	err = d.runner.call(func() error {
+		r, err = d.apiKeys.RevokeAPIKey(id)
+		return err
+	})
+	return r, err
+}
+
+// RotateAPIKey replaces the salt and hash of the secret of the API key with the specified ID.
+func (d *resilientAPIKeysDatabase) RotateAPIKey(id string, salt, hash []byte) (r models.APIKey, err error) {
+	err = d.runner.call(func() error {
+		r, err = d.apiKeys.RotateAPIKey(id, salt, hash)
+		return err
+	})
+	return r, err
+}
+
+// TouchAPIKey records that the API key with the specified ID was used at the provided date.
+func (d *resilientAPIKeysDatabase) TouchAPIKey(id string, at time.Time) error {
+	return d.runner.call(func() error {
+		return d.apiKeys.TouchAPIKey(id, at)
+	})
+}
+
+// resilientEventsDatabase is an implementation of db.EventsDatabase that retries reads and stops operations from being attempted while the circuit breaker is open.
+type resilientEventsDatabase struct {
+	// ctx is the context within which operations are performed.
+	ctx context.Context
+	// events is the wrapped database.
+	events db.EventsDatabase
+	// runner performs operations.
+	runner *runner
+}
+
+// AppendEvent appends the provided event.
+func (d *resilientEventsDatabase) AppendEvent(e models.Event) (r models.Event, err error) {
+	err = d.runner.call(func() error {
+		r, err = d.events.AppendEvent(e)
+		return err
+	})
+	return r, err
+}
+
+// ListEvents lists the events that follow the specified sequence number, retrying in case the database is unavailable.
+func (d *resilientEventsDatabase) ListEvents(after int64) (r []models.Event, err error) {
+	err = d.runner.read(d.ctx, "ListEvents", func() error {
+		r, err = d.events.ListEvents(after)
+		return err
+	})
+	return r, err
+}
+
+// resilientPaymentsDatabase is an implementation of db.PaymentsDatabase that retries reads and stops operations from being attempted while the circuit breaker is open.
+type resilientPaymentsDatabase struct {
+	// ctx is the context within which operations are performed.
+	ctx context.Context
+	// payments is the wrapped database.
+	payments db.PaymentsDatabase
+	// runner performs operations.
+	runner *runner
+}
+
+// CountPayments returns the number of registered payments, retrying in case the database is unavailable.
+func (d *resilientPaymentsDatabase) CountPayments() (r int64, err error) {
+	err = d.runner.read(d.ctx, "CountPayments", func() error {
+		r, err = d.payments.CountPayments()
+		return err
+	})
+	return r, err
+}
+
+// CreatePayment creates the provided payment.
+func (d *resilientPaymentsDatabase) CreatePayment(p models.Payment) (r models.Payment, err error) {
+	err = d.runner.call(func() error {
+		r, err = d.payments.CreatePayment(p)
+		return err
+	})
+	return r, err
+}
+
+// DeletePayment deletes the payment with the specified ID.
+func (d *resilientPaymentsDatabase) DeletePayment(id string) (r bool, err error) {
+	err = d.runner.call(func() error {
+		r, err = d.payments.DeletePayment(id)
+		return err
+	})
+	return r, err
+}
+
+// GetPayment returns the payment with the specified ID, retrying in case the database is unavailable.
+func (d *resilientPaymentsDatabase) GetPayment(id string) (r models.Payment, err error) {
+	err = d.runner.read(d.ctx, "GetPayment", func() error {
+		r, err = d.payments.GetPayment(id)
+		return err
+	})
+	return r, err
+}
+
+// ListPayments lists registered payments ordered by ID, skipping the specified number of payments and returning at most the specified number of them, retrying in case the database is unavailable.
+func (d *resilientPaymentsDatabase) ListPayments(offset, limit int) (r []models.Payment, err error) {
+	err = d.runner.read(d.ctx, "ListPayments", func() error {
+		r, err = d.payments.ListPayments(offset, limit)
+		return err
+	})
+	return r, err
+}
+
+// RestorePayment restores the deleted payment with the specified ID.
+func (d *resilientPaymentsDatabase) RestorePayment(id string) (r bool, err error) {
+	err = d.runner.call(func() error {
+		r, err = d.payments.RestorePayment(id)
+		return err
+	})
+	return r, err
+}
+
+// SearchPayments lists registered payments matching the provided filter ordered by ID, skipping the specified number of payments and returning at most the specified number of them, together with the total number of matching payments, retrying in case the database is unavailable.
+func (d *resilientPaymentsDatabase) SearchPayments(f db.PaymentsFilter, offset, limit int) (r []models.Payment, n int64, err error) {
+	err = d.runner.read(d.ctx, "SearchPayments", func() error {
+		r, n, err = d.payments.SearchPayments(f, offset, limit)
+		return err
+	})
+	return r, n, err
+}
+
+// UpdatePayment updates the payment with the specified ID.
+func (d *resilientPaymentsDatabase) UpdatePayment(id string, p models.Payment) (r models.Payment, err error) {
+	err = d.runner.call(func() error {
+		r, err = d.payments.UpdatePayment(id, p)
+		return err
+	})
+	return r, err
+}
+
+// resilientRateLimitsDatabase is an implementation of db.RateLimitsDatabase that retries reads and stops operations from being attempted while the circuit breaker is open.
+type resilientRateLimitsDatabase struct {
+	// ctx is the context within which operations are performed.
+	ctx context.Context
+	// rateLimits is the wrapped database.
+	rateLimits db.RateLimitsDatabase
+	// runner performs operations.
+	runner *runner
+}
+
+// GetRateLimitBucket returns the token bucket with the specified key, retrying in case the database is unavailable.
+func (d *resilientRateLimitsDatabase) GetRateLimitBucket(key string) (r models.RateLimitBucket, err error) {
+	err = d.runner.read(d.ctx, "GetRateLimitBucket", func() error {
+		r, err = d.rateLimits.GetRateLimitBucket(key)
+		return err
+	})
+	return r, err
+}
+
+// IncrementQuotaUsage adds the specified count and amount to the usage of the quota with the specified key.
+func (d *resilientRateLimitsDatabase) IncrementQuotaUsage(key string, count int64, currency string, amount float64, maxCount int64, maxAmount float64, expiresAt time.Time) (r bool, err error) {
+	err = d.runner.call(func() error {
+		r, err = d.rateLimits.IncrementQuotaUsage(key, count, currency, amount, maxCount, maxAmount, expiresAt)
+		return err
+	})
+	return r, err
+}
+
+// SaveRateLimitBucket saves the provided token bucket.
+func (d *resilientRateLimitsDatabase) SaveRateLimitBucket(b models.RateLimitBucket) (r bool, err error) {
+	err = d.runner.call(func() error {
+		r, err = d.rateLimits.SaveRateLimitBucket(b)
+		return err
+	})
+	return r, err
+}
+
+// resilientScheduledPaymentsDatabase is an implementation of db.ScheduledPaymentsDatabase that stops operations from being attempted while the circuit breaker is open.
+// Claiming and executing payments modifies them, so neither is retried.
+type resilientScheduledPaymentsDatabase struct {
+	// runner performs operations.
+	runner *runner
+	// scheduled is the wrapped database.
+	scheduled db.ScheduledPaymentsDatabase
+}
+
+// AdvanceStandingOrder saves the state of the provided (claimed) standing order after a payment has been generated from it, and releases the lease held on it by the specified owner.
+func (d *resilientScheduledPaymentsDatabase) AdvanceStandingOrder(o models.StandingOrder, owner string) (r models.StandingOrder, err error) {
+	err = d.runner.call(func() error {
+		r, err = d.scheduled.AdvanceStandingOrder(o, owner)
+		return err
+	})
+	return r, err
+}
+
+// ClaimDuePayment leases a scheduled payment whose date is not after the provided time on behalf of the specified owner, for the provided duration.
+func (d *resilientScheduledPaymentsDatabase) ClaimDuePayment(owner string, now time.Time, lease time.Duration) (r models.Payment, err error) {
+	err = d.runner.call(func() error {
+		r, err = d.scheduled.ClaimDuePayment(owner, now, lease)
+		return err
+	})
+	return r, err
+}
+
+// ClaimDueStandingOrder leases an active standing order whose next occurrence is not after the provided time on behalf of the specified owner, for the provided duration.
+func (d *resilientScheduledPaymentsDatabase) ClaimDueStandingOrder(owner string, now time.Time, lease time.Duration) (r models.StandingOrder, err error) {
+	err = d.runner.call(func() error {
+		r, err = d.scheduled.ClaimDueStandingOrder(owner, now, lease)
+		return err
+	})
+	return r, err
+}
+
+// ExecutePayment marks the provided (claimed) payment as having been executed at the provided time, and releases the lease held on it by the specified owner.
+func (d *resilientScheduledPaymentsDatabase) ExecutePayment(p models.Payment, owner string, now time.Time) (r models.Payment, err error) {
+	err = d.runner.call(func() error {
+		r, err = d.scheduled.ExecutePayment(p, owner, now)
+		return err
+	})
+	return r, err
+}
+
+// resilientStandingOrdersDatabase is an implementation of db.StandingOrdersDatabase that retries reads and stops operations from being attempted while the circuit breaker is open.
+type resilientStandingOrdersDatabase struct {
+	// ctx is the context within which operations are performed.
+	ctx context.Context
+	// runner performs operations.
+	runner *runner
+	// standingOrders is the wrapped database.
+	standingOrders db.StandingOrdersDatabase
+}
+
+// CreateStandingOrder creates the provided standing order.
+func (d *resilientStandingOrdersDatabase) CreateStandingOrder(o models.StandingOrder) (r models.StandingOrder, err error) {
+	err = d.runner.call(func() error {
+		r, err = d.standingOrders.CreateStandingOrder(o)
+		return err
+	})
+	return r, err
+}
+
+// GetStandingOrder returns the standing order with the specified ID.
+func (d *resilientStandingOrdersDatabase) GetStandingOrder(id string) (r models.StandingOrder, err error) {
+	err = d.runner.read(d.ctx, "GetStandingOrder", func() error {
+		r, err = d.standingOrders.GetStandingOrder(id)
+		return err
+	})
+	return r, err
+}
+
+// ListStandingOrders lists all registered standing orders.
+func (d *resilientStandingOrdersDatabase) ListStandingOrders() (r []models.StandingOrder, err error) {
+	err = d.runner.read(d.ctx, "ListStandingOrders", func() error {
+		r, err = d.standingOrders.ListStandingOrders()
+		return err
+	})
+	return r, err
+}
+
+// UpdateStandingOrder updates the status and the next occurrence of the provided standing order, provided that it has not been modified since it was read.
+func (d *resilientStandingOrdersDatabase) UpdateStandingOrder(o models.StandingOrder) (r models.StandingOrder, err error) {
+	err = d.runner.call(func() error {
+		r, err = d.standingOrders.UpdateStandingOrder(o)
+		return err
+	})
+	return r, err
+}
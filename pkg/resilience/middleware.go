@@ -0,0 +1,50 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package resilience
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	// RetryAfterHeader is the name of the header that contains the number of seconds after which a request may be retried.
+	RetryAfterHeader = "Retry-After"
+)
+
+// Middleware returns a middleware that turns errors caused by the circuit breaker being open into responses with status 503 carrying a Retry-After header.
+// Handlers must include the original error in the HTTP errors they return (i.e. using SetInternal) for it to be recognized.
+func Middleware() echo.MiddlewareFunc {
+	return func(fn echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			err := fn(ctx)
+			cause := err
+			if h, ok := err.(*echo.HTTPError); ok && h.Internal != nil {
+				cause = h.Internal
+			}
+			var (
+				e *OpenError
+			)
+			if !errors.As(cause, &e) {
+				return err
+			}
+			ctx.Response().Header().Set(RetryAfterHeader, strconv.Itoa(int(math.Max(1, math.Ceil(e.RetryAfter.Seconds())))))
+			return echo.NewHTTPError(http.StatusServiceUnavailable, e.Error()).SetInternal(e)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+var (
+	// errUnavailable is the error returned by fakeDatabase to simulate the database being unavailable.
+	errUnavailable = errors.New("server selection timeout")
+)
+
+// fakeDatabase is an implementation of db.Database whose payments can only be read, failing a configurable number of times.
+type fakeDatabase struct {
+	db.Database
+
+	// attempts is the number of times a payment was read.
+	attempts int
+	// failures is the number of times reading a payment fails before succeeding.
+	failures int
+}
+
+// Payments allows for accessing methods used to perform CRUD operations on payments.
+func (f *fakeDatabase) Payments() db.PaymentsDatabase {
+	return &fakePaymentsDatabase{fakeDatabase: f}
+}
+
+// WithContext returns the database itself.
+func (f *fakeDatabase) WithContext(context.Context) db.Database {
+	return f
+}
+
+// fakePaymentsDatabase is an implementation of db.PaymentsDatabase backed by a fakeDatabase.
+type fakePaymentsDatabase struct {
+	db.PaymentsDatabase
+	*fakeDatabase
+}
+
+func (f *fakePaymentsDatabase) DeletePayment(string) (bool, error) {
+	f.attempts++
+	return false, errUnavailable
+}
+
+func (f *fakePaymentsDatabase) GetPayment(string) (models.Payment, error) {
+	f.attempts++
+	if f.attempts <= f.failures {
+		return models.Payment{}, errUnavailable
+	}
+	return models.Payment{Currency: "GBP"}, nil
+}
+
+// newDatabase returns a resilient view of the provided database which considers errUnavailable to be caused by the database being unavailable.
+func newDatabase(database db.Database, breaker *Breaker, opts Options) db.Database {
+	d := NewDatabase(database, breaker, opts).(*resilientDatabase)
+	d.runner.unavailable = func(err error) bool {
+		return err == errUnavailable
+	}
+	return d
+}
+
+var _ = Describe("Circuit breaker", func() {
+	var (
+		b   *Breaker
+		now time.Time
+	)
+
+	BeforeEach(func() {
+		now = time.Now()
+		b = NewBreaker(BreakerOptions{Cooldown: 10 * time.Second, FailureThreshold: 2})
+		b.now = func() time.Time { return now }
+	})
+
+	// attempt makes an operation with the specified outcome through the breaker, returning the error returned by the breaker (if any).
+	attempt := func(failed bool) error {
+		done, err := b.Allow()
+		if err != nil {
+			return err
+		}
+		done(failed)
+		return nil
+	}
+
+	It("opens after consecutive failures", func() {
+		Expect(attempt(true)).To(Succeed())
+		Expect(attempt(false)).To(Succeed())
+		Expect(attempt(true)).To(Succeed())
+		Expect(b.State()).To(Equal(StateClosed))
+		Expect(attempt(true)).To(Succeed())
+		Expect(b.State()).To(Equal(StateOpen))
+		now = now.Add(4 * time.Second)
+		Expect(attempt(false)).To(Equal(&OpenError{RetryAfter: 6 * time.Second}))
+	})
+
+	It("lets a single probe through once the cooldown elapses", func() {
+		Expect(attempt(true)).To(Succeed())
+		Expect(attempt(true)).To(Succeed())
+		now = now.Add(10 * time.Second)
+		Expect(b.State()).To(Equal(StateHalfOpen))
+		done, err := b.Allow()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attempt(false)).To(Equal(&OpenError{RetryAfter: probeRetryAfter}))
+		done(false)
+		Expect(b.State()).To(Equal(StateClosed))
+	})
+
+	It("reopens in case the probe fails", func() {
+		Expect(attempt(true)).To(Succeed())
+		Expect(attempt(true)).To(Succeed())
+		now = now.Add(10 * time.Second)
+		Expect(attempt(true)).To(Succeed())
+		Expect(b.State()).To(Equal(StateOpen))
+		now = now.Add(time.Second)
+		Expect(attempt(false)).To(Equal(&OpenError{RetryAfter: 9 * time.Second}))
+	})
+})
+
+var _ = Describe("Resilient database", func() {
+	var (
+		database *fakeDatabase
+		retries  []string
+	)
+
+	BeforeEach(func() {
+		database = &fakeDatabase{}
+		retries = nil
+	})
+
+	opts := func() Options {
+		return Options{
+			BaseDelay:   time.Millisecond,
+			MaxAttempts: 3,
+			MaxDelay:    5 * time.Millisecond,
+			OnRetry: func(operation string) {
+				retries = append(retries, operation)
+			},
+		}
+	}
+
+	It("retries reads while the database is unavailable", func() {
+		database.failures = 2
+		p, err := newDatabase(database, nil, opts()).Payments().GetPayment("1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.Currency).To(Equal("GBP"))
+		Expect(database.attempts).To(Equal(3))
+		Expect(retries).To(Equal([]string{"GetPayment", "GetPayment"}))
+	})
+
+	It("gives up retrying reads after the maximum number of attempts", func() {
+		database.failures = 5
+		_, err := newDatabase(database, nil, opts()).Payments().GetPayment("1")
+		Expect(err).To(Equal(errUnavailable))
+		Expect(database.attempts).To(Equal(3))
+	})
+
+	It("stops retrying reads once the context is done", func() {
+		database.failures = 5
+		ctx, fn := context.WithCancel(context.Background())
+		fn()
+		_, err := newDatabase(database, nil, opts()).WithContext(ctx).Payments().GetPayment("1")
+		Expect(err).To(Equal(errUnavailable))
+		Expect(database.attempts).To(Equal(1))
+	})
+
+	It("does not retry writes", func() {
+		_, err := newDatabase(database, nil, opts()).Payments().DeletePayment("1")
+		Expect(err).To(Equal(errUnavailable))
+		Expect(database.attempts).To(Equal(1))
+	})
+
+	It("fails fast once the circuit breaker opens", func() {
+		database.failures = 5
+		b := NewBreaker(BreakerOptions{Cooldown: time.Minute, FailureThreshold: 2})
+		d := newDatabase(database, b, opts())
+		_, err := d.Payments().GetPayment("1")
+		Expect(err).To(BeAssignableToTypeOf(&OpenError{}))
+		Expect(database.attempts).To(Equal(2))
+		_, err = d.Payments().GetPayment("1")
+		Expect(err).To(BeAssignableToTypeOf(&OpenError{}))
+		Expect(database.attempts).To(Equal(2))
+	})
+
+	It("does not count errors caused by invalid input as failures", func() {
+		b := NewBreaker(BreakerOptions{Cooldown: time.Minute, FailureThreshold: 1})
+		d := NewDatabase(database, b, opts())
+		database.failures = 1
+		// The fake's error is not recognized by db.IsUnavailable, and is hence neither retried nor counted as a failure.
+		_, err := d.Payments().GetPayment("1")
+		Expect(err).To(Equal(errUnavailable))
+		Expect(database.attempts).To(Equal(1))
+		Expect(b.State()).To(Equal(StateClosed))
+	})
+})
+
+var _ = Describe("Middleware", func() {
+	It("responds with 503 and a Retry-After header while the circuit breaker is open", func() {
+		e := echo.New()
+		e.Use(Middleware())
+		e.GET("/payments/:id", func(ctx echo.Context) error {
+			err := &OpenError{RetryAfter: 1500 * time.Millisecond}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
+		})
+		e.GET("/payments", func(ctx echo.Context) error {
+			return echo.NewHTTPError(http.StatusInternalServerError, "boom")
+		})
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/payments/1", nil))
+		Expect(rec.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(rec.Header().Get(RetryAfterHeader)).To(Equal("2"))
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/payments", nil))
+		Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+		Expect(rec.Header().Get(RetryAfterHeader)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,83 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package payments
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+// fromModel converts the provided payment into its protobuf representation.
+func fromModel(p models.Payment) *Payment {
+	r := &Payment{
+		Id:          p.ID.Hex(),
+		Beneficiary: fromEntityModel(p.Beneficiary),
+		Debtor:      fromEntityModel(p.Debtor),
+		Amount:      p.Amount,
+		Currency:    p.Currency,
+		Date:        timestamppb.New(p.Date),
+		Description: p.Description,
+		Status:      p.Status,
+	}
+	if p.ExecutedAt != nil {
+		r.ExecutedAt = timestamppb.New(*p.ExecutedAt)
+	}
+	if p.StandingOrderID != nil {
+		r.StandingOrderId = p.StandingOrderID.Hex()
+	}
+	return r
+}
+
+// fromEntityModel converts the provided entity into its protobuf representation.
+func fromEntityModel(e models.Entity) *Entity {
+	return &Entity{
+		AccountNumber: e.AccountNumber,
+		BankId:        e.BankID,
+		Name:          e.Name,
+	}
+}
+
+// toModel converts the provided protobuf payment into a payment that can be stored.
+// The payment's ID is ignored, as it is either assigned by the database or provided separately, and so are its status and execution date, which are set by the server.
+func toModel(p *Payment) models.Payment {
+	var (
+		date time.Time
+	)
+	if p.GetDate() != nil {
+		date = p.GetDate().AsTime()
+	}
+	return models.Payment{
+		ID:          primitive.NilObjectID,
+		Beneficiary: toEntityModel(p.GetBeneficiary()),
+		Debtor:      toEntityModel(p.GetDebtor()),
+		Amount:      p.GetAmount(),
+		Currency:    p.GetCurrency(),
+		Date:        date,
+		Description: p.GetDescription(),
+	}
+}
+
+// toEntityModel converts the provided protobuf entity into an entity that can be stored.
+func toEntityModel(e *Entity) models.Entity {
+	return models.Entity{
+		AccountNumber: e.GetAccountNumber(),
+		BankID:        e.GetBankId(),
+		Name:          e.GetName(),
+	}
+}
@@ -0,0 +1,574 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        v5.28.3
+// source: pkg/rpc/apis/payments/payments.proto
+
+package payments
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Entity represents a party involved in a payment.
+type Entity struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// account_number is the account number for the entity.
+	AccountNumber string `protobuf:"bytes,1,opt,name=account_number,json=accountNumber,proto3" json:"account_number,omitempty"`
+	// bank_id is the bank ID for the entity.
+	BankId string `protobuf:"bytes,2,opt,name=bank_id,json=bankId,proto3" json:"bank_id,omitempty"`
+	// name is the name of the entity.
+	Name          string `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Entity) Reset() {
+	*x = Entity{}
+	mi := &file_pkg_rpc_apis_payments_payments_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Entity) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Entity) ProtoMessage() {}
+
+func (x *Entity) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_rpc_apis_payments_payments_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Entity.ProtoReflect.Descriptor instead.
+func (*Entity) Descriptor() ([]byte, []int) {
+	return file_pkg_rpc_apis_payments_payments_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Entity) GetAccountNumber() string {
+	if x != nil {
+		return x.AccountNumber
+	}
+	return ""
+}
+
+func (x *Entity) GetBankId() string {
+	if x != nil {
+		return x.BankId
+	}
+	return ""
+}
+
+func (x *Entity) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+// Payment represents a payment to an entity (the beneficiary) made by another entity (the debtor).
+type Payment struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id is the ID of the payment.
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// beneficiary is the entity that received the payment.
+	Beneficiary *Entity `protobuf:"bytes,2,opt,name=beneficiary,proto3" json:"beneficiary,omitempty"`
+	// debtor is the entity that sent the payment.
+	Debtor *Entity `protobuf:"bytes,3,opt,name=debtor,proto3" json:"debtor,omitempty"`
+	// amount is the amount involved in the payment.
+	Amount float64 `protobuf:"fixed64,4,opt,name=amount,proto3" json:"amount,omitempty"`
+	// currency is the currency in which the payment was made.
+	Currency string `protobuf:"bytes,5,opt,name=currency,proto3" json:"currency,omitempty"`
+	// date is the date at which the payment was processed.
+	Date *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=date,proto3" json:"date,omitempty"`
+	// description is the description associated with the payment.
+	Description string `protobuf:"bytes,7,opt,name=description,proto3" json:"description,omitempty"`
+	// status is the status of the payment (i.e. "scheduled" or "executed").
+	// It is set by the server based on the payment's date, and ignored when provided.
+	Status string `protobuf:"bytes,8,opt,name=status,proto3" json:"status,omitempty"`
+	// executed_at is the date at which the payment was executed, if it has been executed.
+	// It is set by the server, and ignored when provided.
+	ExecutedAt *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=executed_at,json=executedAt,proto3" json:"executed_at,omitempty"`
+	// standing_order_id is the ID of the standing order from which the payment was generated, if any.
+	// It is set by the server, and ignored when provided.
+	StandingOrderId string `protobuf:"bytes,10,opt,name=standing_order_id,json=standingOrderId,proto3" json:"standing_order_id,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Payment) Reset() {
+	*x = Payment{}
+	mi := &file_pkg_rpc_apis_payments_payments_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Payment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Payment) ProtoMessage() {}
+
+func (x *Payment) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_rpc_apis_payments_payments_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Payment.ProtoReflect.Descriptor instead.
+func (*Payment) Descriptor() ([]byte, []int) {
+	return file_pkg_rpc_apis_payments_payments_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Payment) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Payment) GetBeneficiary() *Entity {
+	if x != nil {
+		return x.Beneficiary
+	}
+	return nil
+}
+
+func (x *Payment) GetDebtor() *Entity {
+	if x != nil {
+		return x.Debtor
+	}
+	return nil
+}
+
+func (x *Payment) GetAmount() float64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *Payment) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+func (x *Payment) GetDate() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Date
+	}
+	return nil
+}
+
+func (x *Payment) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Payment) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Payment) GetExecutedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ExecutedAt
+	}
+	return nil
+}
+
+func (x *Payment) GetStandingOrderId() string {
+	if x != nil {
+		return x.StandingOrderId
+	}
+	return ""
+}
+
+// CreatePaymentRequest is the request message for CreatePayment.
+type CreatePaymentRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// payment is the payment to create.
+	Payment       *Payment `protobuf:"bytes,1,opt,name=payment,proto3" json:"payment,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreatePaymentRequest) Reset() {
+	*x = CreatePaymentRequest{}
+	mi := &file_pkg_rpc_apis_payments_payments_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreatePaymentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreatePaymentRequest) ProtoMessage() {}
+
+func (x *CreatePaymentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_rpc_apis_payments_payments_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreatePaymentRequest.ProtoReflect.Descriptor instead.
+func (*CreatePaymentRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_rpc_apis_payments_payments_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CreatePaymentRequest) GetPayment() *Payment {
+	if x != nil {
+		return x.Payment
+	}
+	return nil
+}
+
+// DeletePaymentRequest is the request message for DeletePayment.
+type DeletePaymentRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id is the ID of the payment to delete.
+	Id            string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeletePaymentRequest) Reset() {
+	*x = DeletePaymentRequest{}
+	mi := &file_pkg_rpc_apis_payments_payments_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeletePaymentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeletePaymentRequest) ProtoMessage() {}
+
+func (x *DeletePaymentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_rpc_apis_payments_payments_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeletePaymentRequest.ProtoReflect.Descriptor instead.
+func (*DeletePaymentRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_rpc_apis_payments_payments_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *DeletePaymentRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+// GetPaymentRequest is the request message for GetPayment.
+type GetPaymentRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id is the ID of the payment to get.
+	Id            string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPaymentRequest) Reset() {
+	*x = GetPaymentRequest{}
+	mi := &file_pkg_rpc_apis_payments_payments_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPaymentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPaymentRequest) ProtoMessage() {}
+
+func (x *GetPaymentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_rpc_apis_payments_payments_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPaymentRequest.ProtoReflect.Descriptor instead.
+func (*GetPaymentRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_rpc_apis_payments_payments_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetPaymentRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+// ListPaymentsRequest is the request message for ListPayments.
+type ListPaymentsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListPaymentsRequest) Reset() {
+	*x = ListPaymentsRequest{}
+	mi := &file_pkg_rpc_apis_payments_payments_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListPaymentsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPaymentsRequest) ProtoMessage() {}
+
+func (x *ListPaymentsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_rpc_apis_payments_payments_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPaymentsRequest.ProtoReflect.Descriptor instead.
+func (*ListPaymentsRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_rpc_apis_payments_payments_proto_rawDescGZIP(), []int{5}
+}
+
+// UpdatePaymentRequest is the request message for UpdatePayment.
+type UpdatePaymentRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id is the ID of the payment to update.
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// payment is the new contents of the payment.
+	Payment       *Payment `protobuf:"bytes,2,opt,name=payment,proto3" json:"payment,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdatePaymentRequest) Reset() {
+	*x = UpdatePaymentRequest{}
+	mi := &file_pkg_rpc_apis_payments_payments_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdatePaymentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdatePaymentRequest) ProtoMessage() {}
+
+func (x *UpdatePaymentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_rpc_apis_payments_payments_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdatePaymentRequest.ProtoReflect.Descriptor instead.
+func (*UpdatePaymentRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_rpc_apis_payments_payments_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *UpdatePaymentRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *UpdatePaymentRequest) GetPayment() *Payment {
+	if x != nil {
+		return x.Payment
+	}
+	return nil
+}
+
+var File_pkg_rpc_apis_payments_payments_proto protoreflect.FileDescriptor
+
+const file_pkg_rpc_apis_payments_payments_proto_rawDesc = "" +
+	"\n" +
+	"$pkg/rpc/apis/payments/payments.proto\x12\x10dojo.payments.v1\x1a\x1bgoogle/protobuf/empty.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\\\n" +
+	"\x06Entity\x12%\n" +
+	"\x0eaccount_number\x18\x01 \x01(\tR\raccountNumber\x12\x17\n" +
+	"\abank_id\x18\x02 \x01(\tR\x06bankId\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\"\x8e\x03\n" +
+	"\aPayment\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12:\n" +
+	"\vbeneficiary\x18\x02 \x01(\v2\x18.dojo.payments.v1.EntityR\vbeneficiary\x120\n" +
+	"\x06debtor\x18\x03 \x01(\v2\x18.dojo.payments.v1.EntityR\x06debtor\x12\x16\n" +
+	"\x06amount\x18\x04 \x01(\x01R\x06amount\x12\x1a\n" +
+	"\bcurrency\x18\x05 \x01(\tR\bcurrency\x12.\n" +
+	"\x04date\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\x04date\x12 \n" +
+	"\vdescription\x18\a \x01(\tR\vdescription\x12\x16\n" +
+	"\x06status\x18\b \x01(\tR\x06status\x12;\n" +
+	"\vexecuted_at\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"executedAt\x12*\n" +
+	"\x11standing_order_id\x18\n" +
+	" \x01(\tR\x0fstandingOrderId\"K\n" +
+	"\x14CreatePaymentRequest\x123\n" +
+	"\apayment\x18\x01 \x01(\v2\x19.dojo.payments.v1.PaymentR\apayment\"&\n" +
+	"\x14DeletePaymentRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"#\n" +
+	"\x11GetPaymentRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x15\n" +
+	"\x13ListPaymentsRequest\"[\n" +
+	"\x14UpdatePaymentRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x123\n" +
+	"\apayment\x18\x02 \x01(\v2\x19.dojo.payments.v1.PaymentR\apayment2\xa5\x03\n" +
+	"\bPayments\x12R\n" +
+	"\rCreatePayment\x12&.dojo.payments.v1.CreatePaymentRequest\x1a\x19.dojo.payments.v1.Payment\x12O\n" +
+	"\rDeletePayment\x12&.dojo.payments.v1.DeletePaymentRequest\x1a\x16.google.protobuf.Empty\x12L\n" +
+	"\n" +
+	"GetPayment\x12#.dojo.payments.v1.GetPaymentRequest\x1a\x19.dojo.payments.v1.Payment\x12R\n" +
+	"\fListPayments\x12%.dojo.payments.v1.ListPaymentsRequest\x1a\x19.dojo.payments.v1.Payment0\x01\x12R\n" +
+	"\rUpdatePayment\x12&.dojo.payments.v1.UpdatePaymentRequest\x1a\x19.dojo.payments.v1.PaymentB9Z7github.com/bmcstdio/dojo-payments/pkg/rpc/apis/paymentsb\x06proto3"
+
+var (
+	file_pkg_rpc_apis_payments_payments_proto_rawDescOnce sync.Once
+	file_pkg_rpc_apis_payments_payments_proto_rawDescData []byte
+)
+
+func file_pkg_rpc_apis_payments_payments_proto_rawDescGZIP() []byte {
+	file_pkg_rpc_apis_payments_payments_proto_rawDescOnce.Do(func() {
+		file_pkg_rpc_apis_payments_payments_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pkg_rpc_apis_payments_payments_proto_rawDesc), len(file_pkg_rpc_apis_payments_payments_proto_rawDesc)))
+	})
+	return file_pkg_rpc_apis_payments_payments_proto_rawDescData
+}
+
+var file_pkg_rpc_apis_payments_payments_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_pkg_rpc_apis_payments_payments_proto_goTypes = []any{
+	(*Entity)(nil),                // 0: dojo.payments.v1.Entity
+	(*Payment)(nil),               // 1: dojo.payments.v1.Payment
+	(*CreatePaymentRequest)(nil),  // 2: dojo.payments.v1.CreatePaymentRequest
+	(*DeletePaymentRequest)(nil),  // 3: dojo.payments.v1.DeletePaymentRequest
+	(*GetPaymentRequest)(nil),     // 4: dojo.payments.v1.GetPaymentRequest
+	(*ListPaymentsRequest)(nil),   // 5: dojo.payments.v1.ListPaymentsRequest
+	(*UpdatePaymentRequest)(nil),  // 6: dojo.payments.v1.UpdatePaymentRequest
+	(*timestamppb.Timestamp)(nil), // 7: google.protobuf.Timestamp
+	(*emptypb.Empty)(nil),         // 8: google.protobuf.Empty
+}
+var file_pkg_rpc_apis_payments_payments_proto_depIdxs = []int32{
+	0,  // 0: dojo.payments.v1.Payment.beneficiary:type_name -> dojo.payments.v1.Entity
+	0,  // 1: dojo.payments.v1.Payment.debtor:type_name -> dojo.payments.v1.Entity
+	7,  // 2: dojo.payments.v1.Payment.date:type_name -> google.protobuf.Timestamp
+	7,  // 3: dojo.payments.v1.Payment.executed_at:type_name -> google.protobuf.Timestamp
+	1,  // 4: dojo.payments.v1.CreatePaymentRequest.payment:type_name -> dojo.payments.v1.Payment
+	1,  // 5: dojo.payments.v1.UpdatePaymentRequest.payment:type_name -> dojo.payments.v1.Payment
+	2,  // 6: dojo.payments.v1.Payments.CreatePayment:input_type -> dojo.payments.v1.CreatePaymentRequest
+	3,  // 7: dojo.payments.v1.Payments.DeletePayment:input_type -> dojo.payments.v1.DeletePaymentRequest
+	4,  // 8: dojo.payments.v1.Payments.GetPayment:input_type -> dojo.payments.v1.GetPaymentRequest
+	5,  // 9: dojo.payments.v1.Payments.ListPayments:input_type -> dojo.payments.v1.ListPaymentsRequest
+	6,  // 10: dojo.payments.v1.Payments.UpdatePayment:input_type -> dojo.payments.v1.UpdatePaymentRequest
+	1,  // 11: dojo.payments.v1.Payments.CreatePayment:output_type -> dojo.payments.v1.Payment
+	8,  // 12: dojo.payments.v1.Payments.DeletePayment:output_type -> google.protobuf.Empty
+	1,  // 13: dojo.payments.v1.Payments.GetPayment:output_type -> dojo.payments.v1.Payment
+	1,  // 14: dojo.payments.v1.Payments.ListPayments:output_type -> dojo.payments.v1.Payment
+	1,  // 15: dojo.payments.v1.Payments.UpdatePayment:output_type -> dojo.payments.v1.Payment
+	11, // [11:16] is the sub-list for method output_type
+	6,  // [6:11] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_pkg_rpc_apis_payments_payments_proto_init() }
+func file_pkg_rpc_apis_payments_payments_proto_init() {
+	if File_pkg_rpc_apis_payments_payments_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pkg_rpc_apis_payments_payments_proto_rawDesc), len(file_pkg_rpc_apis_payments_payments_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_pkg_rpc_apis_payments_payments_proto_goTypes,
+		DependencyIndexes: file_pkg_rpc_apis_payments_payments_proto_depIdxs,
+		MessageInfos:      file_pkg_rpc_apis_payments_payments_proto_msgTypes,
+	}.Build()
+	File_pkg_rpc_apis_payments_payments_proto = out.File
+	file_pkg_rpc_apis_payments_payments_proto_goTypes = nil
+	file_pkg_rpc_apis_payments_payments_proto_depIdxs = nil
+}
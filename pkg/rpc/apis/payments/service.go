@@ -0,0 +1,230 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package payments
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/pkg/events"
+	"github.com/bmcstdio/dojo-payments/pkg/ratelimit"
+	"github.com/bmcstdio/dojo-payments/pkg/resilience"
+)
+
+// service is an implementation of PaymentsServer that uses a database for storage.
+type service struct {
+	UnimplementedPaymentsServer
+
+	// bus is the bus to which events describing changes to payments are published.
+	bus *events.Bus
+	// database is the database to use for storing payments.
+	database db.Database
+}
+
+// Policy maps each RPC of the Payments API (as a POST request to the method's full name) to the scope required to make it.
+var Policy = auth.Policy{
+	{Method: http.MethodPost, Path: Payments_CreatePayment_FullMethodName}: auth.ScopePaymentsWrite,
+	{Method: http.MethodPost, Path: Payments_DeletePayment_FullMethodName}: auth.ScopePaymentsDelete,
+	{Method: http.MethodPost, Path: Payments_GetPayment_FullMethodName}:    auth.ScopePaymentsRead,
+	{Method: http.MethodPost, Path: Payments_ListPayments_FullMethodName}:  auth.ScopePaymentsRead,
+	{Method: http.MethodPost, Path: Payments_UpdatePayment_FullMethodName}: auth.ScopePaymentsWrite,
+}
+
+// Register registers the Payments API to the provided gRPC server.
+func Register(srv *grpc.Server, database db.Database, bus *events.Bus) {
+	RegisterPaymentsServer(srv, &service{
+		bus:      bus,
+		database: database,
+	})
+}
+
+// CreatePayment creates the provided payment.
+func (s *service) CreatePayment(ctx context.Context, req *CreatePaymentRequest) (*Payment, error) {
+	p := toModel(req.GetPayment())
+	if err := p.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	d, err := s.databaseFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	release, err := consumeQuota(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	p, err = d.Payments().CreatePayment(p)
+	if err != nil {
+		release()
+		return nil, storageError(err)
+	}
+	events.Record(ctx, d, s.bus, models.EventTypePaymentCreated, p)
+	return fromModel(p), nil
+}
+
+// DeletePayment deletes the payment with the specified ID.
+func (s *service) DeletePayment(ctx context.Context, req *DeletePaymentRequest) (*emptypb.Empty, error) {
+	if err := validateID(req.GetId()); err != nil {
+		return nil, err
+	}
+	d, err := s.databaseFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Grab the payment before deleting it so that it can be included in the corresponding event.
+	p, err := d.Payments().GetPayment(req.GetId())
+	if err != nil {
+		return nil, storageError(err)
+	}
+	ok, err := d.Payments().DeletePayment(req.GetId())
+	if err != nil {
+		return nil, storageError(err)
+	}
+	if !ok {
+		return nil, status.Error(codes.NotFound, "payment not found")
+	}
+	events.Record(ctx, d, s.bus, models.EventTypePaymentDeleted, p)
+	return &emptypb.Empty{}, nil
+}
+
+// GetPayment returns the payment with the specified ID.
+func (s *service) GetPayment(ctx context.Context, req *GetPaymentRequest) (*Payment, error) {
+	if err := validateID(req.GetId()); err != nil {
+		return nil, err
+	}
+	d, err := s.databaseFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p, err := d.Payments().GetPayment(req.GetId())
+	if err != nil {
+		return nil, storageError(err)
+	}
+	if p == (models.Payment{}) {
+		return nil, status.Error(codes.NotFound, "payment not found")
+	}
+	return fromModel(p), nil
+}
+
+// ListPayments streams all registered payments.
+func (s *service) ListPayments(_ *ListPaymentsRequest, stream grpc.ServerStreamingServer[Payment]) error {
+	d, err := s.databaseFor(stream.Context())
+	if err != nil {
+		return err
+	}
+	r, err := d.Payments().ListPayments(0, -1)
+	if err != nil {
+		return storageError(err)
+	}
+	for _, p := range r {
+		if err := stream.Send(fromModel(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdatePayment updates the payment with the specified ID.
+func (s *service) UpdatePayment(ctx context.Context, req *UpdatePaymentRequest) (*Payment, error) {
+	if err := validateID(req.GetId()); err != nil {
+		return nil, err
+	}
+	p := toModel(req.GetPayment())
+	if err := p.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	d, err := s.databaseFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r, err := d.Payments().UpdatePayment(req.GetId(), p)
+	if errors.Is(err, db.ErrPaymentExecuted) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, storageError(err)
+	}
+	if r == (models.Payment{}) {
+		return nil, status.Error(codes.NotFound, "payment not found")
+	}
+	events.Record(ctx, d, s.bus, models.EventTypePaymentUpdated, r)
+	return fromModel(r), nil
+}
+
+// databaseFor returns the database to use for the RPC made within the provided context.
+// The database is scoped to the tenant of the authenticated principal (if any) so that data belonging to other tenants can never be accessed.
+func (s *service) databaseFor(ctx context.Context) (db.Database, error) {
+	d := s.database
+	if t := auth.TenantFromContext(ctx); t != "" {
+		v, err := d.ForTenant(t)
+		if err != nil {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		d = v
+	}
+	// Perform storage operations within the RPC's context so that they are logged as part of it.
+	return d.WithContext(ctx), nil
+}
+
+// consumeQuota adds the provided payment to the daily quota of the client making the RPC within the provided context, using the limiter present in the context (if any).
+// A "RESOURCE_EXHAUSTED" error is returned in case the quota would be exceeded.
+// Callers must call the returned function in case the payment ends up not being created.
+func consumeQuota(ctx context.Context, p models.Payment) (func(), error) {
+	l, c := ratelimit.FromContext(ctx)
+	if l == nil {
+		return func() {}, nil
+	}
+	release, retryAfter, err := l.Consume(ctx, c, p)
+	switch {
+	case err == ratelimit.ErrQuotaExceeded:
+		_ = grpc.SetHeader(ctx, metadata.Pairs(strings.ToLower(ratelimit.RetryAfterHeader), strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))))
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return release, nil
+}
+
+// storageError returns an "UNAVAILABLE" error in case the provided error was caused by the circuit breaker protecting the database being open, and an "INTERNAL" error otherwise.
+func storageError(err error) error {
+	var (
+		e *resilience.OpenError
+	)
+	if errors.As(err, &e) {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// validateID returns an "INVALID_ARGUMENT" error in case the provided value is not a valid payment ID.
+func validateID(id string) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%q is not a valid payment ID", id)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/logging"
+	"github.com/bmcstdio/dojo-payments/pkg/ratelimit"
+)
+
+const (
+	// authorityKey is the metadata key that contains the authority (i.e. the host) to which an RPC is made.
+	authorityKey = ":authority"
+)
+
+// publicServices are the services which can be used without authenticating.
+// Reflection only describes the services that are offered, similarly to the OpenAPI document served by the API server.
+var publicServices = map[string]bool{
+	"grpc.reflection.v1.ServerReflection":      true,
+	"grpc.reflection.v1alpha.ServerReflection": true,
+}
+
+// interceptor admits RPCs the same way the API server admits HTTP requests, authenticating them, checking that they are made by principals that have been granted the required scopes and enforcing rate limits.
+type interceptor struct {
+	// authenticators are the authenticators used to authenticate RPCs, if any.
+	authenticators []auth.Authenticator
+	// policy maps every RPC (as a route) to the scope required to make it.
+	policy auth.Policy
+	// rateLimiter is the limiter used to enforce rate limits and quotas, if any.
+	rateLimiter *ratelimit.Limiter
+	// roles are the roles assigned to authenticated principals.
+	roles auth.Roles
+}
+
+// unary is a unary server interceptor that admits RPCs before handling them.
+func (i *interceptor) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, fn grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := i.admit(ctx, info.FullMethod, req)
+	if err != nil {
+		return nil, err
+	}
+	return fn(ctx, req)
+}
+
+// stream is a stream server interceptor that admits RPCs once their first message is received, so that said message can be authenticated.
+func (i *interceptor) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, fn grpc.StreamHandler) error {
+	if publicServices[serviceName(info.FullMethod)] {
+		return fn(srv, ss)
+	}
+	return fn(srv, &admittingStream{
+		ServerStream: ss,
+		ctx:          ss.Context(),
+		interceptor:  i,
+		method:       info.FullMethod,
+	})
+}
+
+// admit admits the RPC to the specified method made within the provided context with the specified message, returning the context within which it must be handled.
+// The returned context carries the authenticated principal (if any), as well as the limiter used to enforce quotas.
+func (i *interceptor) admit(ctx context.Context, method string, msg interface{}) (context.Context, error) {
+	if publicServices[serviceName(method)] {
+		return ctx, nil
+	}
+	r := route(method)
+	// Rate-limit RPCs per IP address before authenticating them, so that credentials cannot be guessed at an unlimited rate.
+	if i.rateLimiter != nil {
+		res, err := i.rateLimiter.TakeIP(peerIP(ctx))
+		if err := i.checkRateLimit(ctx, res, err); err != nil {
+			return nil, err
+		}
+	}
+	if len(i.authenticators) > 0 {
+		req, err := newHTTPRequest(ctx, method, msg)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		p, err := auth.Authenticate(req, i.roles, i.authenticators...)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if s := i.policy.Scope(r); !p.HasScope(s) {
+			return nil, status.Errorf(codes.PermissionDenied, "missing permission %q", s)
+		}
+		ctx = auth.WithPrincipal(ctx, p)
+	}
+	if i.rateLimiter != nil {
+		c := ratelimit.ClientKey(ctx, peerIP(ctx))
+		res, err := i.rateLimiter.Take(c, r.Method+" "+r.Path)
+		if err := i.checkRateLimit(ctx, res, err); err != nil {
+			return nil, err
+		}
+		ctx = ratelimit.NewContext(ctx, i.rateLimiter, c)
+	}
+	return ctx, nil
+}
+
+// checkRateLimit returns a "RESOURCE_EXHAUSTED" error in case the provided result of taking a token indicates that the RPC made within the provided context is not allowed.
+func (i *interceptor) checkRateLimit(ctx context.Context, res *ratelimit.Result, err error) error {
+	switch {
+	case err != nil:
+		// Fail open rather than rejecting every RPC because the store is unavailable.
+		logging.FromContext(ctx).Errorf("failed to enforce rate limit: %v", err)
+	case res != nil && !res.Allowed:
+		_ = grpc.SetHeader(ctx, metadata.Pairs(strings.ToLower(ratelimit.RetryAfterHeader), strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds())))))
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	return nil
+}
+
+// admittingStream is a server stream that admits the RPC once its first message is received.
+type admittingStream struct {
+	grpc.ServerStream
+
+	// admitted indicates whether the RPC has been admitted.
+	admitted bool
+	// ctx is the context within which the RPC must be handled.
+	ctx context.Context
+	// interceptor is the interceptor used to admit the RPC.
+	interceptor *interceptor
+	// method is the full name of the method being called.
+	method string
+}
+
+// Context returns the context within which the RPC must be handled.
+func (s *admittingStream) Context() context.Context {
+	return s.ctx
+}
+
+// RecvMsg receives a message, admitting the RPC in case it is the first one.
+func (s *admittingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if s.admitted {
+		return nil
+	}
+	ctx, err := s.interceptor.admit(s.ctx, s.method, m)
+	if err != nil {
+		return err
+	}
+	s.admitted, s.ctx = true, ctx
+	return nil
+}
+
+// SendMsg sends a message, refusing to do so in case the RPC has not been admitted.
+func (s *admittingStream) SendMsg(m interface{}) error {
+	if !s.admitted {
+		return status.Error(codes.Unauthenticated, "the rpc has not been admitted")
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// newHTTPRequest returns an HTTP request equivalent to the RPC to the specified method made within the provided context with the specified message, so that it can be authenticated the same way as requests made to the API server.
+// The request is a POST request to the method's full name which carries the RPC's metadata as headers and the deterministic binary encoding of the message as its body.
+func newHTTPRequest(ctx context.Context, method string, msg interface{}) (*http.Request, error) {
+	var (
+		b []byte
+	)
+	if m, ok := msg.(proto.Message); ok {
+		v, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode message: %v", err)
+		}
+		b = v
+	}
+	req, err := http.NewRequest(http.MethodPost, method, bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %v", err)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, v := range md {
+		switch {
+		case k == authorityKey && len(v) > 0:
+			req.Host = v[0]
+		case !strings.HasPrefix(k, ":"):
+			req.Header[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		req.RemoteAddr = p.Addr.String()
+		if t, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			req.TLS = &t.State
+		}
+	}
+	return req.WithContext(ctx), nil
+}
+
+// peerIP returns the IP address of the client making the RPC within the provided context, or the empty string if it is unknown.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	h, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return h
+}
+
+// route returns the route corresponding to the specified method, which is used to look up the scope required to call it and the rate limit that applies to it.
+// RPCs are POST requests to the method's full name (e.g. "POST /dojo.payments.v1.Payments/CreatePayment").
+func route(method string) auth.Route {
+	return auth.Route{
+		Method: http.MethodPost,
+		Path:   method,
+	}
+}
+
+// serviceName returns the full name of the service to which the specified method belongs.
+func serviceName(method string) string {
+	s := strings.TrimPrefix(method, "/")
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
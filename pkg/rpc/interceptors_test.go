@@ -0,0 +1,212 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/ratelimit"
+	"github.com/bmcstdio/dojo-payments/pkg/rpc/apis/payments"
+	"github.com/bmcstdio/dojo-payments/pkg/signing"
+)
+
+// fakeStream is an implementation of grpc.ServerStream that receives a single message.
+type fakeStream struct {
+	grpc.ServerStream
+
+	// ctx is the context of the stream.
+	ctx context.Context
+	// sent are the messages sent through the stream.
+	sent []interface{}
+}
+
+// Context returns the context of the stream.
+func (s *fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+// RecvMsg receives a message.
+func (s *fakeStream) RecvMsg(interface{}) error {
+	return nil
+}
+
+// SendMsg sends the provided message.
+func (s *fakeStream) SendMsg(m interface{}) error {
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+var _ = Describe("Interceptor", func() {
+	var (
+		i *interceptor
+	)
+
+	// newContext returns the context of an RPC made from the specified address with the provided metadata.
+	newContext := func(addr string, kv ...string) context.Context {
+		a, err := net.ResolveTCPAddr("tcp", addr)
+		Expect(err).NotTo(HaveOccurred())
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: a})
+		return metadata.NewIncomingContext(ctx, metadata.Pairs(kv...))
+	}
+
+	// signedContext returns the context of an RPC to the specified method carrying the provided message, signed using the specified key and secret.
+	signedContext := func(method string, msg proto.Message, id, secret string) context.Context {
+		b, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+		Expect(err).NotTo(HaveOccurred())
+		req, err := http.NewRequest(http.MethodPost, method, bytes.NewReader(b))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signing.Sign(req, id, []byte(secret), nil, time.Now())).To(Succeed())
+		kv := make([]string, 0)
+		for k, v := range req.Header {
+			kv = append(kv, k, v[0])
+		}
+		return newContext("10.0.0.1:1234", kv...)
+	}
+
+	BeforeEach(func() {
+		i = &interceptor{
+			authenticators: []auth.Authenticator{
+				auth.NewHMACAuthenticator([]auth.HMACKey{
+					{
+						ID:     "partner",
+						Secret: "secret",
+						Tenant: "acme",
+						Roles:  []string{auth.RoleViewer},
+					},
+				}, signing.NewMemoryNonceCache(), 1<<20),
+			},
+			policy: payments.Policy,
+			roles:  auth.DefaultRoles,
+		}
+	})
+
+	It("rejects rpcs which are not authenticated", func() {
+		_, err := i.admit(newContext("10.0.0.1:1234"), payments.Payments_GetPayment_FullMethodName, &payments.GetPaymentRequest{})
+		Expect(status.Code(err)).To(Equal(codes.Unauthenticated))
+	})
+
+	It("rejects rpcs whose message does not match its signature", func() {
+		ctx := signedContext(payments.Payments_GetPayment_FullMethodName, &payments.GetPaymentRequest{Id: "a"}, "partner", "secret")
+		_, err := i.admit(ctx, payments.Payments_GetPayment_FullMethodName, &payments.GetPaymentRequest{Id: "b"})
+		Expect(status.Code(err)).To(Equal(codes.Unauthenticated))
+	})
+
+	It("admits signed rpcs made by principals that have been granted the required scope", func() {
+		req := &payments.GetPaymentRequest{Id: "a"}
+		ctx, err := i.admit(signedContext(payments.Payments_GetPayment_FullMethodName, req, "partner", "secret"), payments.Payments_GetPayment_FullMethodName, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(auth.TenantFromContext(ctx)).To(Equal("acme"))
+	})
+
+	It("rejects rpcs made by principals that have not been granted the required scope", func() {
+		req := &payments.DeletePaymentRequest{Id: "a"}
+		_, err := i.admit(signedContext(payments.Payments_DeletePayment_FullMethodName, req, "partner", "secret"), payments.Payments_DeletePayment_FullMethodName, req)
+		Expect(status.Code(err)).To(Equal(codes.PermissionDenied))
+	})
+
+	It("rejects rpcs to methods not covered by the policy", func() {
+		req := &payments.GetPaymentRequest{}
+		_, err := i.admit(signedContext("/dojo.payments.v1.Payments/Unknown", req, "partner", "secret"), "/dojo.payments.v1.Payments/Unknown", req)
+		Expect(status.Code(err)).To(Equal(codes.PermissionDenied))
+	})
+
+	It("admits rpcs to public services without credentials", func() {
+		_, err := i.admit(newContext("10.0.0.1:1234"), "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo", nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("identifies principals using the certificates presented by clients", func() {
+		c := &x509.Certificate{}
+		c.Subject.CommonName = "billing"
+		i.authenticators = []auth.Authenticator{
+			auth.NewClientCertAuthenticator(map[string]auth.ClientCertIdentity{
+				"CN=billing": {Tenant: "acme", Roles: []string{auth.RoleViewer}},
+			}),
+		}
+		ctx := peer.NewContext(context.Background(), &peer.Peer{
+			Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234},
+			AuthInfo: credentials.TLSInfo{
+				State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{c}}},
+			},
+		})
+		ctx, err := i.admit(ctx, payments.Payments_ListPayments_FullMethodName, &payments.ListPaymentsRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(auth.TenantFromContext(ctx)).To(Equal("acme"))
+	})
+
+	It("rate-limits rpcs per client and makes the limiter available to the service", func() {
+		i.authenticators = nil
+		i.rateLimiter = ratelimit.NewLimiter(ratelimit.Config{
+			Default: ratelimit.Limit{Rate: 0.001, Burst: 1},
+		}, ratelimit.NewMemoryStore())
+		ctx, err := i.admit(newContext("10.0.0.1:1234"), payments.Payments_GetPayment_FullMethodName, &payments.GetPaymentRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		l, c := ratelimit.FromContext(ctx)
+		Expect(l).To(Equal(i.rateLimiter))
+		Expect(c).To(Equal("ip:10.0.0.1"))
+		_, err = i.admit(newContext("10.0.0.1:5678"), payments.Payments_GetPayment_FullMethodName, &payments.GetPaymentRequest{})
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+		_, err = i.admit(newContext("10.0.0.2:1234"), payments.Payments_GetPayment_FullMethodName, &payments.GetPaymentRequest{})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("rate-limits rpcs per ip address before authenticating them", func() {
+		i.rateLimiter = ratelimit.NewLimiter(ratelimit.Config{
+			IP: ratelimit.Limit{Rate: 0.001, Burst: 1},
+		}, ratelimit.NewMemoryStore())
+		_, err := i.admit(newContext("10.0.0.1:1234"), payments.Payments_GetPayment_FullMethodName, &payments.GetPaymentRequest{})
+		Expect(status.Code(err)).To(Equal(codes.Unauthenticated))
+		_, err = i.admit(newContext("10.0.0.1:1234"), payments.Payments_GetPayment_FullMethodName, &payments.GetPaymentRequest{})
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+	})
+
+	It("admits streaming rpcs once their first message is received", func() {
+		req := &payments.ListPaymentsRequest{}
+		ss := &fakeStream{ctx: signedContext(payments.Payments_ListPayments_FullMethodName, req, "partner", "secret")}
+		err := i.stream(nil, ss, &grpc.StreamServerInfo{FullMethod: payments.Payments_ListPayments_FullMethodName}, func(_ interface{}, s grpc.ServerStream) error {
+			Expect(s.SendMsg(&payments.Payment{})).NotTo(Succeed())
+			Expect(auth.PrincipalFromContext(s.Context())).To(BeNil())
+			Expect(s.RecvMsg(req)).To(Succeed())
+			Expect(auth.TenantFromContext(s.Context())).To(Equal("acme"))
+			return s.SendMsg(&payments.Payment{})
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ss.sent).To(HaveLen(1))
+	})
+
+	It("rejects streaming rpcs which are not authenticated", func() {
+		ss := &fakeStream{ctx: newContext("10.0.0.1:1234")}
+		err := i.stream(nil, ss, &grpc.StreamServerInfo{FullMethod: payments.Payments_ListPayments_FullMethodName}, func(_ interface{}, s grpc.ServerStream) error {
+			return s.RecvMsg(&payments.ListPaymentsRequest{})
+		})
+		Expect(status.Code(err)).To(Equal(codes.Unauthenticated))
+	})
+})
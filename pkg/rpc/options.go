@@ -0,0 +1,65 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"crypto/tls"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/ratelimit"
+)
+
+// grpcServerOptions holds the configurable aspects of a GRPCServer.
+type grpcServerOptions struct {
+	// authenticators are the authenticators used to authenticate RPCs, if any.
+	authenticators []auth.Authenticator
+	// rateLimiter is the limiter used to enforce rate limits and quotas, if any.
+	rateLimiter *ratelimit.Limiter
+	// roles are the roles assigned to authenticated principals.
+	roles auth.Roles
+	// tlsConfig is the configuration used to serve TLS connections, if any.
+	tlsConfig *tls.Config
+}
+
+// GRPCServerOption configures a GRPCServer.
+type GRPCServerOption func(*grpcServerOptions)
+
+// WithAuthenticators configures the gRPC server to require every RPC (other than those made to public services) to be authenticated using one of the provided authenticators.
+func WithAuthenticators(authenticators ...auth.Authenticator) GRPCServerOption {
+	return func(o *grpcServerOptions) {
+		o.authenticators = append(o.authenticators, authenticators...)
+	}
+}
+
+// WithRateLimiter configures the gRPC server to enforce rate limits and quotas using the provided limiter.
+func WithRateLimiter(limiter *ratelimit.Limiter) GRPCServerOption {
+	return func(o *grpcServerOptions) {
+		o.rateLimiter = limiter
+	}
+}
+
+// WithRoles configures the roles assigned to authenticated principals, replacing the default ones.
+func WithRoles(roles auth.Roles) GRPCServerOption {
+	return func(o *grpcServerOptions) {
+		o.roles = roles
+	}
+}
+
+// WithTLS configures the gRPC server to serve TLS connections using the provided configuration.
+func WithTLS(config *tls.Config) GRPCServerOption {
+	return func(o *grpcServerOptions) {
+		o.tlsConfig = config
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"context"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/rpc/apis/payments"
+	"github.com/bmcstdio/dojo-payments/pkg/server/apis/apitest"
+)
+
+// allowedRoles maps each RPC of the Payments API to the default roles allowed to make it.
+var allowedRoles = map[string][]string{
+	payments.Payments_CreatePayment_FullMethodName: {auth.RoleAdmin, auth.RoleOperator},
+	payments.Payments_DeletePayment_FullMethodName: {auth.RoleAdmin},
+	payments.Payments_GetPayment_FullMethodName:    {auth.RoleAdmin, auth.RoleOperator, auth.RoleViewer},
+	payments.Payments_ListPayments_FullMethodName:  {auth.RoleAdmin, auth.RoleOperator, auth.RoleViewer},
+	payments.Payments_UpdatePayment_FullMethodName: {auth.RoleAdmin, auth.RoleOperator},
+}
+
+// roleAuthenticator is an implementation of auth.Authenticator that identifies every request as made by a principal assigned a given role.
+type roleAuthenticator struct {
+	// role is the role assigned to principals.
+	role string
+}
+
+func (a *roleAuthenticator) Authenticate(*http.Request) (*auth.Principal, error) {
+	return &auth.Principal{
+		Subject: "alice",
+		Roles:   []string{a.role},
+	}, nil
+}
+
+func (a *roleAuthenticator) Challenge() string {
+	return ""
+}
+
+var _ = Describe("Policy", func() {
+	It("covers every rpc of the payments api", func() {
+		methods := make([]string, 0)
+		for _, m := range payments.Payments_ServiceDesc.Methods {
+			methods = append(methods, "/"+payments.Payments_ServiceDesc.ServiceName+"/"+m.MethodName)
+		}
+		for _, s := range payments.Payments_ServiceDesc.Streams {
+			methods = append(methods, "/"+payments.Payments_ServiceDesc.ServiceName+"/"+s.StreamName)
+		}
+		Expect(methods).To(HaveLen(len(allowedRoles)))
+		for _, m := range methods {
+			Expect(allowedRoles).To(HaveKey(m))
+			Expect(payments.Policy).To(HaveKey(route(m)))
+		}
+	})
+
+	apitest.DescribeRoles("payments grpc api", allowedRoles, func(method, role string) bool {
+		i := &interceptor{
+			authenticators: []auth.Authenticator{&roleAuthenticator{role: role}},
+			policy:         payments.Policy,
+			roles:          auth.DefaultRoles,
+		}
+		_, err := i.admit(context.Background(), method, nil)
+		if status.Code(err) != codes.PermissionDenied {
+			Expect(err).NotTo(HaveOccurred())
+			return false
+		}
+		Expect(err.Error()).To(ContainSubstring(payments.Policy[route(method)]))
+		return true
+	})
+})
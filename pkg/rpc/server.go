@@ -0,0 +1,100 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/events"
+	"github.com/bmcstdio/dojo-payments/pkg/rpc/apis/payments"
+)
+
+// GRPCServer serves gRPC APIs such as the Payments API.
+type GRPCServer struct {
+	// server is the gRPC server that powers the current instance.
+	server *grpc.Server
+}
+
+// NewGRPCServer returns a new instance of the gRPC server that uses the specified database for storage and publishes events to the specified bus.
+// RPCs are authenticated, authorized and rate-limited the same way as requests made to the API server.
+func NewGRPCServer(database db.Database, bus *events.Bus, options ...GRPCServerOption) *GRPCServer {
+	// Compute the options to use.
+	o := &grpcServerOptions{
+		roles: auth.DefaultRoles,
+	}
+	for _, fn := range options {
+		fn(o)
+	}
+	i := &interceptor{
+		authenticators: o.authenticators,
+		policy:         payments.Policy,
+		rateLimiter:    o.rateLimiter,
+		roles:          o.roles,
+	}
+	opts := []grpc.ServerOption{
+		grpc.StreamInterceptor(i.stream),
+		grpc.UnaryInterceptor(i.unary),
+	}
+	// Serve TLS connections, if configured to do so.
+	if o.tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(o.tlsConfig)))
+	}
+	// Create a new instance of the gRPC server.
+	s := &GRPCServer{
+		server: grpc.NewServer(opts...),
+	}
+	// Register the Payments API.
+	payments.Register(s.server, database, bus)
+	// Allow clients to discover the registered services.
+	reflection.Register(s.server)
+	// Return the instance of the gRPC server to the caller.
+	return s
+}
+
+// Run runs the gRPC server at the specified address.
+func (srv *GRPCServer) Run(bindAddress string) error {
+	l, err := net.Listen("tcp", bindAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen at %s: %v", bindAddress, err)
+	}
+	log.Infof("starting the grpc server at %s", bindAddress)
+	return srv.server.Serve(l)
+}
+
+// Shutdown gracefully shuts down the gRPC server.
+// The gRPC server stops accepting connections and waits for in-flight RPCs to complete, forcibly closing remaining connections in case they do not complete before the provided context is done.
+func (srv *GRPCServer) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		srv.server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		srv.server.Stop()
+		return fmt.Errorf("failed to drain in-flight rpcs: %v", ctx.Err())
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/bmcstdio/dojo-payments/pkg/clock"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/pkg/events"
+	"github.com/bmcstdio/dojo-payments/pkg/logging"
+	"github.com/bmcstdio/dojo-payments/pkg/ratelimit"
+)
+
+// Options are the options used to configure a Scheduler.
+type Options struct {
+	// Clock is the clock used to tell whether payments are due and to wait between passes.
+	// It defaults to the system clock.
+	Clock clock.Clock
+	// Interval is the interval at which due payments are looked for.
+	Interval time.Duration
+	// Limiter, if not nil, is the limiter whose daily quotas are consumed by payments generated from standing orders, on behalf of the client that created each standing order.
+	// Occurrences that would exceed the quota of said client are postponed until the lease on the standing order expires.
+	Limiter *ratelimit.Limiter
+	// LeaseDuration is the duration for which a due payment is leased while being executed.
+	// Payments whose lease expires (e.g. because the replica executing them crashed) are executed by the next replica to look for due payments.
+	LeaseDuration time.Duration
+	// OnExecute, if not nil, is called with every payment executed by the scheduler.
+	OnExecute func(models.Payment)
+	// Owner identifies the scheduler when leasing payments, and must be unique across replicas.
+	// It defaults to a random ID.
+	Owner string
+}
+
+// Scheduler executes scheduled payments once their date arrives, recording a "payment.executed" event for each of them.
+// It also generates payments from standing orders on each occurrence of their schedule, recording a "payment.created" event for each of them.
+// Payments and standing orders are leased before being processed, so that each of them is processed by a single replica even if several replicas run a scheduler.
+type Scheduler struct {
+	// bus is the bus to which events are published.
+	bus *events.Bus
+	// database is the database in which payments are stored.
+	database db.Database
+	// opts are the options used to configure the scheduler.
+	opts Options
+}
+
+// New returns a new scheduler that executes payments and generates payments from standing orders stored in the provided database, publishing events to the provided bus.
+func New(database db.Database, bus *events.Bus, opts Options) *Scheduler {
+	if opts.Clock == nil {
+		opts.Clock = clock.Real()
+	}
+	if opts.Owner == "" {
+		opts.Owner = primitive.NewObjectID().Hex()
+	}
+	return &Scheduler{
+		bus:      bus,
+		database: database,
+		opts:     opts,
+	}
+}
+
+// Run executes due payments and generates payments from due standing orders at the configured interval until the provided context is canceled.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		if _, err := s.RunOnce(ctx); err != nil {
+			logging.FromContext(ctx).Warnf("failed to process due payments and standing orders: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.opts.Clock.After(s.opts.Interval):
+		}
+	}
+}
+
+// RunOnce generates payments from all standing orders which are currently due and executes all payments which are currently due, returning the number of payments it generated and executed.
+// It stops at the first error, leaving the standing orders and payments which remain due to be processed in the next pass.
+func (s *Scheduler) RunOnce(ctx context.Context) (int, error) {
+	d := s.database.WithContext(ctx)
+	// Generate payments from standing orders first.
+	// Generated payments are dated at occurrences which are already due, and are hence executed as soon as they are created.
+	g, err := s.generatePayments(ctx, d)
+	if err != nil {
+		return g, err
+	}
+	n, err := s.executePayments(ctx, d)
+	return g + n, err
+}
+
+// executePayments executes all payments which are currently due, returning the number of payments it executed.
+func (s *Scheduler) executePayments(ctx context.Context, d db.Database) (int, error) {
+	var (
+		n int
+	)
+	// Use a single view for the whole pass, so that tenants are only listed once.
+	sp := d.ScheduledPayments()
+	for ctx.Err() == nil {
+		// Lease the oldest due payment, if any.
+		now := s.opts.Clock.Now()
+		p, err := sp.ClaimDuePayment(s.opts.Owner, now, s.opts.LeaseDuration)
+		if err != nil {
+			return n, err
+		}
+		if p.ID.IsZero() {
+			return n, nil
+		}
+		// Execute the payment, provided that the lease has not been lost in the meantime.
+		r, err := sp.ExecutePayment(p, s.opts.Owner, s.opts.Clock.Now())
+		if err != nil {
+			return n, err
+		}
+		if r.ID.IsZero() {
+			logging.FromContext(ctx).Warnf("lost the lease on payment %q before executing it", p.ID.Hex())
+			continue
+		}
+		n++
+		logging.FromContext(ctx).Infof("executed scheduled payment %q", r.ID.Hex())
+		if s.opts.OnExecute != nil {
+			s.opts.OnExecute(r)
+		}
+		// Record the event in the payment's tenant, so that it is only visible to its principals.
+		t, err := d.ForTenant(r.Tenant)
+		if err != nil {
+			return n, err
+		}
+		events.Record(ctx, t, s.bus, models.EventTypePaymentExecuted, r)
+	}
+	return n, ctx.Err()
+}
+
+// generatePayments generates a payment for each occurrence of the schedule of standing orders which is currently due, returning the number of payments it generated.
+// Occurrences missed while no scheduler was running are caught up with.
+func (s *Scheduler) generatePayments(ctx context.Context, d db.Database) (int, error) {
+	var (
+		n int
+	)
+	// Use a single view for the whole pass, so that tenants are only listed once.
+	sp := d.ScheduledPayments()
+	for ctx.Err() == nil {
+		// Lease the standing order whose next occurrence is the oldest due one, if any.
+		o, err := sp.ClaimDueStandingOrder(s.opts.Owner, s.opts.Clock.Now(), s.opts.LeaseDuration)
+		if err != nil {
+			return n, err
+		}
+		if o.ID.IsZero() {
+			return n, nil
+		}
+		t, err := d.ForTenant(o.Tenant)
+		if err != nil {
+			return n, err
+		}
+		// Generate the payment for the next occurrence, unless it has already been generated (e.g. by a replica which crashed before advancing the standing order).
+		p := o.Payment.Payment(*o.NextAt)
+		p.ID = occurrenceID(o.ID, o.NextOccurrence)
+		p.StandingOrderID = &o.ID
+		release, err := s.consumeQuota(ctx, o, p)
+		if err == ratelimit.ErrQuotaExceeded {
+			// Keep the lease so that the standing order is only claimed again once it expires, by which time the quota may allow the payment.
+			logging.FromContext(ctx).Warnf("postponing the generation of payment %q from standing order %q as it would exceed the daily quota", p.ID.Hex(), o.ID.Hex())
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		r, err := t.Payments().CreatePayment(p)
+		switch {
+		case db.IsDuplicate(err):
+			release()
+			logging.FromContext(ctx).Warnf("payment %q had already been generated from standing order %q", p.ID.Hex(), o.ID.Hex())
+		case err != nil:
+			release()
+			return n, err
+		default:
+			n++
+			logging.FromContext(ctx).Infof("generated payment %q from standing order %q", r.ID.Hex(), o.ID.Hex())
+			events.Record(ctx, t, s.bus, models.EventTypePaymentCreated, r)
+		}
+		// Move the standing order to the next occurrence, provided that the lease has not been lost in the meantime.
+		o.Generated++
+		o.Advance()
+		a, err := sp.AdvanceStandingOrder(o, s.opts.Owner)
+		if err != nil {
+			return n, err
+		}
+		if a.ID.IsZero() {
+			logging.FromContext(ctx).Warnf("standing order %q was modified or its lease was lost before it could be advanced", o.ID.Hex())
+		}
+	}
+	return n, ctx.Err()
+}
+
+// consumeQuota adds the provided payment, generated from the provided standing order, to the daily quota of the client that created the standing order.
+// Standing orders created before clients were recorded do not consume any quota.
+// Callers must call the returned function in case the payment ends up not being created.
+func (s *Scheduler) consumeQuota(ctx context.Context, o models.StandingOrder, p models.Payment) (func(), error) {
+	if s.opts.Limiter == nil || o.Client == "" {
+		return func() {}, nil
+	}
+	release, _, err := s.opts.Limiter.Consume(ctx, o.Client, p)
+	return release, err
+}
+
+// occurrenceID returns the ID of the payment generated for the specified (zero-based) occurrence of the schedule of the standing order with the specified ID.
+// IDs are derived deterministically so that the payment for a given occurrence is never generated twice.
+func occurrenceID(id primitive.ObjectID, n int) primitive.ObjectID {
+	b := make([]byte, len(id)+8)
+	copy(b, id[:])
+	binary.BigEndian.PutUint64(b[len(id):], uint64(n))
+	h := sha256.Sum256(b)
+	var (
+		r primitive.ObjectID
+	)
+	copy(r[:], h[:])
+	return r
+}
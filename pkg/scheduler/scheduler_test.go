@@ -0,0 +1,390 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/bmcstdio/dojo-payments/pkg/clock"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/pkg/events"
+	"github.com/bmcstdio/dojo-payments/pkg/ratelimit"
+)
+
+// fakeDatabase is an implementation of db.Database that keeps payments, standing orders and events in memory, leasing them the same way as MongoDB.
+type fakeDatabase struct {
+	db.Database
+	db.PaymentsDatabase
+
+	// events are the recorded events.
+	events []models.Event
+	// mu guards access to the fields of the database.
+	mu *sync.Mutex
+	// payments are the stored payments.
+	payments []*models.Payment
+	// standingOrders are the stored standing orders.
+	standingOrders []*models.StandingOrder
+}
+
+// newFakeDatabase returns a new fake database storing the provided payments.
+func newFakeDatabase(payments ...models.Payment) *fakeDatabase {
+	f := &fakeDatabase{
+		mu: &sync.Mutex{},
+	}
+	for _, p := range payments {
+		p := p
+		p.ID = primitive.NewObjectID()
+		f.payments = append(f.payments, &p)
+	}
+	return f
+}
+
+func (f *fakeDatabase) AdvanceStandingOrder(v models.StandingOrder, owner string) (models.StandingOrder, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, o := range f.standingOrders {
+		if o.ID != v.ID || o.LeaseOwner != owner || o.Version != v.Version {
+			continue
+		}
+		*o = v
+		o.LeaseExpiresAt, o.LeaseOwner = nil, ""
+		o.Version++
+		return *o, nil
+	}
+	return models.StandingOrder{}, nil
+}
+
+func (f *fakeDatabase) AppendEvent(e models.Event) (models.Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e.Sequence = int64(len(f.events) + 1)
+	f.events = append(f.events, e)
+	return e, nil
+}
+
+func (f *fakeDatabase) ClaimDuePayment(owner string, now time.Time, lease time.Duration) (models.Payment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range f.payments {
+		if p.Status != models.PaymentStatusScheduled || p.Date.After(now) || (p.LeaseExpiresAt != nil && p.LeaseExpiresAt.After(now)) {
+			continue
+		}
+		t := now.Add(lease)
+		p.LeaseExpiresAt, p.LeaseOwner = &t, owner
+		return *p, nil
+	}
+	return models.Payment{}, nil
+}
+
+func (f *fakeDatabase) ClaimDueStandingOrder(owner string, now time.Time, lease time.Duration) (models.StandingOrder, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, o := range f.standingOrders {
+		if o.Status != models.StandingOrderStatusActive || o.NextAt == nil || o.NextAt.After(now) || (o.LeaseExpiresAt != nil && o.LeaseExpiresAt.After(now)) {
+			continue
+		}
+		t := now.Add(lease)
+		o.LeaseExpiresAt, o.LeaseOwner = &t, owner
+		return *o, nil
+	}
+	return models.StandingOrder{}, nil
+}
+
+func (f *fakeDatabase) CreatePayment(v models.Payment) (models.Payment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range f.payments {
+		if p.ID == v.ID {
+			return models.Payment{}, mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}
+		}
+	}
+	v.Status = models.PaymentStatusExecuted
+	f.payments = append(f.payments, &v)
+	return v, nil
+}
+
+func (f *fakeDatabase) Events() db.EventsDatabase {
+	return f
+}
+
+func (f *fakeDatabase) ExecutePayment(v models.Payment, owner string, now time.Time) (models.Payment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range f.payments {
+		if p.ID != v.ID || p.Status != models.PaymentStatusScheduled || p.LeaseOwner != owner {
+			continue
+		}
+		p.ExecutedAt, p.Status = &now, models.PaymentStatusExecuted
+		p.LeaseExpiresAt, p.LeaseOwner = nil, ""
+		return *p, nil
+	}
+	return models.Payment{}, nil
+}
+
+func (f *fakeDatabase) ForTenant(string) (db.Database, error) {
+	return f, nil
+}
+
+func (f *fakeDatabase) ListEvents(int64) ([]models.Event, error) {
+	return f.events, nil
+}
+
+func (f *fakeDatabase) Payments() db.PaymentsDatabase {
+	return f
+}
+
+func (f *fakeDatabase) ScheduledPayments() db.ScheduledPaymentsDatabase {
+	return f
+}
+
+func (f *fakeDatabase) WithContext(context.Context) db.Database {
+	return f
+}
+
+// addStandingOrder stores the provided standing order as if it had been created at the specified instant.
+func (f *fakeDatabase) addStandingOrder(o models.StandingOrder, now time.Time) *models.StandingOrder {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	o.ID = primitive.NewObjectID()
+	o.Status = models.StandingOrderStatusActive
+	o.SkipUntil(now)
+	f.standingOrders = append(f.standingOrders, &o)
+	return &o
+}
+
+// generated returns the payments generated from the standing order with the specified ID.
+func (f *fakeDatabase) generated(id primitive.ObjectID) []models.Payment {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := make([]models.Payment, 0)
+	for _, p := range f.payments {
+		if p.StandingOrderID != nil && *p.StandingOrderID == id {
+			r = append(r, *p)
+		}
+	}
+	return r
+}
+
+// statuses returns the status of each of the stored payments.
+func (f *fakeDatabase) statuses() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := make([]string, 0, len(f.payments))
+	for _, p := range f.payments {
+		r = append(r, p.Status)
+	}
+	return r
+}
+
+var _ = Describe("Scheduler", func() {
+	var (
+		c   *clock.Fake
+		d   *fakeDatabase
+		now time.Time
+	)
+
+	BeforeEach(func() {
+		now = time.Date(2019, 4, 30, 22, 30, 0, 0, time.UTC)
+		c = clock.NewFake(now)
+		d = newFakeDatabase(
+			models.Payment{Currency: "EUR", Date: now.Add(-time.Minute), Status: models.PaymentStatusScheduled},
+			models.Payment{Currency: "GBP", Date: now.Add(time.Hour), Status: models.PaymentStatusScheduled},
+			models.Payment{Currency: "USD", Date: now.Add(-time.Hour), Status: models.PaymentStatusExecuted},
+		)
+	})
+
+	// newScheduler returns a new scheduler using the fake clock and database.
+	newScheduler := func(owner string) *Scheduler {
+		return New(d, events.NewBus(), Options{
+			Clock:         c,
+			Interval:      10 * time.Second,
+			LeaseDuration: time.Minute,
+			Owner:         owner,
+		})
+	}
+
+	It("executes payments once their date arrives", func() {
+		s := newScheduler("")
+		n, err := s.RunOnce(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(1))
+		Expect(d.statuses()).To(Equal([]string{models.PaymentStatusExecuted, models.PaymentStatusScheduled, models.PaymentStatusExecuted}))
+		Expect(*d.payments[0].ExecutedAt).To(Equal(now))
+
+		c.Advance(time.Hour)
+		n, err = s.RunOnce(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(1))
+		Expect(d.statuses()).To(ConsistOf(models.PaymentStatusExecuted, models.PaymentStatusExecuted, models.PaymentStatusExecuted))
+		Expect(*d.payments[1].ExecutedAt).To(Equal(now.Add(time.Hour)))
+	})
+
+	It("records an event for each executed payment and calls the provided callback", func() {
+		var (
+			executed []string
+		)
+		s := New(d, events.NewBus(), Options{
+			Clock: c,
+			OnExecute: func(p models.Payment) {
+				executed = append(executed, p.Currency)
+			},
+		})
+		_, err := s.RunOnce(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.events).To(HaveLen(1))
+		Expect(d.events[0].Type).To(Equal(models.EventTypePaymentExecuted))
+		Expect(d.events[0].Payment.Status).To(Equal(models.PaymentStatusExecuted))
+		Expect(executed).To(Equal([]string{"EUR"}))
+	})
+
+	It("does not execute payments leased by another scheduler until the lease expires", func() {
+		_, err := d.ClaimDuePayment("other", now, time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		s := newScheduler("")
+		n, err := s.RunOnce(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(BeZero())
+
+		c.Advance(time.Minute)
+		n, err = s.RunOnce(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(1))
+		// The other scheduler lost its lease, and hence cannot execute the payment again.
+		r, err := d.ExecutePayment(*d.payments[0], "other", c.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r).To(Equal(models.Payment{}))
+	})
+
+	It("generates a payment for each due occurrence of a standing order, catching up on missed ones", func() {
+		o := d.addStandingOrder(models.StandingOrder{
+			Payment:  models.PaymentTemplate{Amount: 10, Currency: "EUR", Description: "rent"},
+			Schedule: models.Schedule{Frequency: models.FrequencyDaily, Start: now.Add(time.Hour), MaxOccurrences: 3},
+		}, now)
+		s := newScheduler("")
+		n, err := s.RunOnce(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(1))
+		Expect(d.generated(o.ID)).To(BeEmpty())
+
+		// Two payments are generated from the standing order, and the payment scheduled by the test fixture is executed.
+		c.Advance(48 * time.Hour)
+		n, err = s.RunOnce(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(3))
+		g := d.generated(o.ID)
+		Expect(g).To(HaveLen(2))
+		Expect(g[0].Date).To(Equal(now.Add(time.Hour)))
+		Expect(g[1].Date).To(Equal(now.Add(25 * time.Hour)))
+		Expect(d.standingOrders[0].Generated).To(Equal(2))
+		Expect(*d.standingOrders[0].NextAt).To(Equal(now.Add(49 * time.Hour)))
+
+		c.Advance(time.Hour)
+		n, err = s.RunOnce(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(1))
+		Expect(d.generated(o.ID)).To(HaveLen(3))
+		Expect(d.standingOrders[0].Status).To(Equal(models.StandingOrderStatusCompleted))
+		Expect(d.standingOrders[0].NextAt).To(BeNil())
+	})
+
+	It("does not generate the payment for an occurrence twice", func() {
+		o := d.addStandingOrder(models.StandingOrder{
+			Payment:  models.PaymentTemplate{Amount: 10, Currency: "EUR", Description: "rent"},
+			Schedule: models.Schedule{Frequency: models.FrequencyWeekly, Start: now},
+		}, now)
+		// Simulate a scheduler which generated the payment for the first occurrence but crashed before advancing the standing order.
+		_, err := d.CreatePayment(models.Payment{ID: occurrenceID(o.ID, 0), StandingOrderID: &o.ID})
+		Expect(err).NotTo(HaveOccurred())
+		s := newScheduler("")
+		n, err := s.RunOnce(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(1))
+		Expect(d.generated(o.ID)).To(HaveLen(1))
+		Expect(d.standingOrders[0].NextOccurrence).To(Equal(1))
+		Expect(occurrenceID(o.ID, 0)).NotTo(Equal(occurrenceID(o.ID, 1)))
+	})
+
+	It("consumes the daily quota of the client that created a standing order, postponing occurrences that would exceed it", func() {
+		o := d.addStandingOrder(models.StandingOrder{
+			Client:   "principal:acme/alice",
+			Payment:  models.PaymentTemplate{Amount: 10, Currency: "EUR", Description: "rent"},
+			Schedule: models.Schedule{Frequency: models.FrequencyDaily, Start: now.Add(time.Hour)},
+		}, now)
+		// Standing orders which do not record the client that created them do not consume any quota.
+		p := d.addStandingOrder(models.StandingOrder{
+			Payment:  models.PaymentTemplate{Amount: 10, Currency: "EUR", Description: "rent"},
+			Schedule: models.Schedule{Frequency: models.FrequencyDaily, Start: now.Add(time.Hour)},
+		}, now)
+		s := New(d, events.NewBus(), Options{
+			Clock:         c,
+			LeaseDuration: time.Minute,
+			Limiter:       ratelimit.NewLimiter(ratelimit.Config{Quota: ratelimit.Quota{DailyCount: 1}}, ratelimit.NewMemoryStore()),
+		})
+		// Two occurrences of each standing order are due, but the quota only allows for generating a single payment from the first one.
+		// Both payments scheduled by the test fixture are executed too.
+		c.Advance(25 * time.Hour)
+		n, err := s.RunOnce(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(5))
+		Expect(d.generated(o.ID)).To(HaveLen(1))
+		Expect(d.generated(p.ID)).To(HaveLen(2))
+		Expect(d.standingOrders[0].Generated).To(Equal(1))
+		Expect(d.standingOrders[0].LeaseOwner).NotTo(BeEmpty())
+
+		// The standing order is claimed again once its lease expires, but the quota still does not allow for generating the payment.
+		c.Advance(time.Minute)
+		n, err = s.RunOnce(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(BeZero())
+		Expect(d.generated(o.ID)).To(HaveLen(1))
+	})
+
+	It("does not generate payments from paused standing orders", func() {
+		o := d.addStandingOrder(models.StandingOrder{
+			Payment:  models.PaymentTemplate{Amount: 10, Currency: "EUR", Description: "rent"},
+			Schedule: models.Schedule{Frequency: models.FrequencyDaily, Start: now},
+		}, now)
+		d.standingOrders[0].Status = models.StandingOrderStatusPaused
+		n, err := newScheduler("").RunOnce(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(1))
+		Expect(d.generated(o.ID)).To(BeEmpty())
+	})
+
+	It("looks for due payments at the configured interval until the context is canceled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			newScheduler("").Run(ctx)
+		}()
+		Eventually(c.Waiters).Should(Equal(1))
+		Expect(d.statuses()[1]).To(Equal(models.PaymentStatusScheduled))
+
+		c.Advance(time.Hour)
+		Eventually(d.statuses).Should(ConsistOf(models.PaymentStatusExecuted, models.PaymentStatusExecuted, models.PaymentStatusExecuted))
+		Eventually(c.Waiters).Should(Equal(1))
+
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+})
@@ -0,0 +1,190 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apikeys
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	keys "github.com/bmcstdio/dojo-payments/pkg/apikeys"
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+const (
+	// BasePath is the base path of the API keys admin API.
+	BasePath = "/admin/apikeys"
+)
+
+// IssuedAPIKey represents an API key together with its secret, which is returned exactly once (when the API key is created or rotated).
+type IssuedAPIKey struct {
+	models.APIKey
+
+	// Key is the full API key which clients must send in the "X-API-Key" header.
+	Key string `json:"key"`
+}
+
+// Policy maps each route of the API keys admin API to the scope required to access it.
+var Policy = auth.Policy{
+	{Method: http.MethodDelete, Path: BasePath + "/:id"}:      auth.ScopeAPIKeysManage,
+	{Method: http.MethodGet, Path: BasePath}:                  auth.ScopeAPIKeysManage,
+	{Method: http.MethodPost, Path: BasePath}:                 auth.ScopeAPIKeysManage,
+	{Method: http.MethodPost, Path: BasePath + "/:id/rotate"}: auth.ScopeAPIKeysManage,
+}
+
+// handlers maps each route of the API keys admin API to the HTTP handler that serves it.
+var handlers = map[auth.Route]echo.HandlerFunc{
+	{Method: http.MethodDelete, Path: BasePath + "/:id"}:      revokeAPIKey,
+	{Method: http.MethodGet, Path: BasePath}:                  listAPIKeys,
+	{Method: http.MethodPost, Path: BasePath}:                 createAPIKey,
+	{Method: http.MethodPost, Path: BasePath + "/:id/rotate"}: rotateAPIKey,
+}
+
+// Register registers the handlers for the API keys admin API to the provided Echo instance, requiring the scopes defined by Policy.
+// The API keys admin API is never accessible anonymously, so requests are rejected with "401 UNAUTHORIZED" in case authentication is disabled.
+func Register(e *echo.Echo) {
+	for r, fn := range handlers {
+		e.Add(r.Method, r.Path, fn, auth.RequirePrincipal(), auth.RequireScope(Policy.Scope(r)))
+	}
+}
+
+// createAPIKey creates an API key, returning its secret.
+func createAPIKey(ctx echo.Context) error {
+	var (
+		err error
+		k   models.APIKey
+	)
+	if err := ctx.Bind(&k); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := k.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	// Principals can only grant the scopes they have been granted themselves, so that they cannot escalate their privileges.
+	p := auth.PrincipalFromContext(ctx.Request().Context())
+	for _, s := range k.Scopes {
+		if !auth.IsKnownScope(s) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown scope %q", s))
+		}
+		if p == nil || !p.HasScope(s) {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("cannot grant scope %q", s))
+		}
+	}
+	// Make sure that the API key is created from scratch, regardless of the provided values.
+	k.ID = primitive.NewObjectID()
+	k.LastUsedAt = nil
+	k.RevokedAt = nil
+	// Principals belonging to a tenant can only issue API keys for said tenant.
+	if t := auth.TenantFromContext(ctx.Request().Context()); t != "" {
+		k.Tenant = t
+	}
+	// Generate the API key's secret.
+	v, salt, hash, err := keys.NewSecret(k.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
+	}
+	k.Salt, k.Hash = salt, hash
+	k, err = ctx.Get(constants.DatabaseContextKey).(db.Database).APIKeys().CreateAPIKey(k)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
+	}
+	return ctx.JSON(http.StatusCreated, IssuedAPIKey{
+		APIKey: k,
+		Key:    v,
+	})
+}
+
+// listAPIKeys lists all API keys visible to the principal making the request, including revoked ones.
+func listAPIKeys(ctx echo.Context) error {
+	r, err := ctx.Get(constants.DatabaseContextKey).(db.Database).APIKeys().ListAPIKeys()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
+	}
+	res := make([]models.APIKey, 0, len(r))
+	for _, k := range r {
+		if visible(ctx, k) {
+			res = append(res, k)
+		}
+	}
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// revokeAPIKey revokes an API key by ID.
+func revokeAPIKey(ctx echo.Context) error {
+	if err := checkVisible(ctx, ctx.Param("id")); err != nil {
+		return err
+	}
+	r, err := ctx.Get(constants.DatabaseContextKey).(db.Database).APIKeys().RevokeAPIKey(ctx.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
+	}
+	if !r {
+		return echo.NewHTTPError(http.StatusNotFound, "api key not found")
+	}
+	return ctx.String(http.StatusNoContent, "")
+}
+
+// rotateAPIKey replaces the secret of an API key by ID, returning the new secret.
+func rotateAPIKey(ctx echo.Context) error {
+	id, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "api key not found")
+	}
+	if err := checkVisible(ctx, id.Hex()); err != nil {
+		return err
+	}
+	v, salt, hash, err := keys.NewSecret(id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
+	}
+	k, err := ctx.Get(constants.DatabaseContextKey).(db.Database).APIKeys().RotateAPIKey(id.Hex(), salt, hash)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
+	}
+	if k.ID.IsZero() {
+		return echo.NewHTTPError(http.StatusNotFound, "api key not found")
+	}
+	return ctx.JSON(http.StatusOK, IssuedAPIKey{
+		APIKey: k,
+		Key:    v,
+	})
+}
+
+// checkVisible returns an error in case the API key with the specified ID does not exist or is not visible to the principal making the request.
+func checkVisible(ctx echo.Context, id string) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "api key not found")
+	}
+	k, err := ctx.Get(constants.DatabaseContextKey).(db.Database).APIKeys().GetAPIKey(id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
+	}
+	if k.ID.IsZero() || !visible(ctx, k) {
+		return echo.NewHTTPError(http.StatusNotFound, "api key not found")
+	}
+	return nil
+}
+
+// visible returns a value indicating whether the provided API key is visible to the principal making the request.
+// Principals belonging to a tenant can only see API keys issued for said tenant.
+func visible(ctx echo.Context, k models.APIKey) bool {
+	t := auth.TenantFromContext(ctx.Request().Context())
+	return t == "" || k.Tenant == t
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package apikeys
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+// fakeDatabase is an implementation of db.Database that records the API keys created.
+type fakeDatabase struct {
+	db.Database
+	db.APIKeysDatabase
+
+	// created are the API keys created.
+	created []models.APIKey
+}
+
+func (f *fakeDatabase) APIKeys() db.APIKeysDatabase {
+	return f
+}
+
+func (f *fakeDatabase) CreateAPIKey(k models.APIKey) (models.APIKey, error) {
+	f.created = append(f.created, k)
+	return k, nil
+}
+
+var _ = Describe("Creating API keys", func() {
+	var (
+		d *fakeDatabase
+	)
+
+	// create requests the creation of the provided API key on behalf of the specified principal (if any).
+	create := func(p *auth.Principal, body string) *httptest.ResponseRecorder {
+		srv := echo.New()
+		srv.Use(func(fn echo.HandlerFunc) echo.HandlerFunc {
+			return func(ctx echo.Context) error {
+				if p != nil {
+					ctx.Set(constants.PrincipalContextKey, p)
+					ctx.SetRequest(ctx.Request().WithContext(auth.WithPrincipal(ctx.Request().Context(), p)))
+				}
+				ctx.Set(constants.DatabaseContextKey, d)
+				return fn(ctx)
+			}
+		})
+		Register(srv)
+		req := httptest.NewRequest(http.MethodPost, BasePath, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	BeforeEach(func() {
+		d = &fakeDatabase{}
+	})
+
+	It(`rejects unauthenticated requests with "401 UNAUTHORIZED"`, func() {
+		Expect(create(nil, `{"name": "reporting", "scopes": ["payments:read"]}`).Code).To(Equal(http.StatusUnauthorized))
+		Expect(d.created).To(BeEmpty())
+	})
+
+	It(`rejects requests for scopes the principal has not been granted with "403 FORBIDDEN"`, func() {
+		p := &auth.Principal{Subject: "alice", Scopes: []string{auth.ScopeAPIKeysManage, auth.ScopePaymentsRead}}
+		rec := create(p, `{"name": "reporting", "scopes": ["payments:read", "payments:delete"]}`)
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+		Expect(rec.Body.String()).To(ContainSubstring(auth.ScopePaymentsDelete))
+		Expect(d.created).To(BeEmpty())
+	})
+
+	It("issues API keys with scopes the principal has been granted for the principal's tenant", func() {
+		p := &auth.Principal{Subject: "alice", Tenant: "acme", Scopes: []string{auth.ScopeAPIKeysManage, auth.ScopePaymentsRead}}
+		rec := create(p, `{"name": "reporting", "scopes": ["payments:read"], "tenant": "other"}`)
+		Expect(rec.Code).To(Equal(http.StatusCreated))
+		Expect(d.created).To(HaveLen(1))
+		Expect(d.created[0].Scopes).To(Equal([]string{auth.ScopePaymentsRead}))
+		Expect(d.created[0].Tenant).To(Equal("acme"))
+	})
+})
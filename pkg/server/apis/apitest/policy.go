@@ -0,0 +1,119 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apitest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+)
+
+// DescribePolicy describes how the provided policy protects the routes of the API registered by the provided function, making sure that every route is covered and that each route can only be accessed by the specified default roles.
+// The name of the API is used to describe the specs.
+func DescribePolicy(name string, register func(*echo.Echo), policy auth.Policy, allowedRoles map[auth.Route][]string) bool {
+	return Describe("Policy", func() {
+		var (
+			role string
+			srv  *echo.Echo
+		)
+
+		BeforeEach(func() {
+			srv = echo.New()
+			// Handlers are served without a database, so recover from the resulting panics.
+			srv.Use(middleware.Recover())
+			// Make every request on behalf of a principal assigned the current role.
+			srv.Use(func(fn echo.HandlerFunc) echo.HandlerFunc {
+				return func(ctx echo.Context) error {
+					ctx.Set(constants.PrincipalContextKey, &auth.Principal{
+						Subject: "alice",
+						Roles:   []string{role},
+						Scopes:  auth.DefaultRoles.Scopes([]string{role}),
+					})
+					return fn(ctx)
+				}
+			})
+			register(srv)
+		})
+
+		// do makes a request to the specified route.
+		do := func(r auth.Route) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httptest.NewRequest(r.Method, strings.Replace(r.Path, ":id", primitive.NewObjectID().Hex(), 1), nil))
+			return rec
+		}
+
+		It(fmt.Sprintf("covers every route of the %s", name), func() {
+			Expect(srv.Routes()).To(HaveLen(len(allowedRoles)))
+			for _, r := range srv.Routes() {
+				Expect(allowedRoles).To(HaveKey(auth.Route{Method: r.Method, Path: r.Path}))
+				Expect(policy).To(HaveKey(auth.Route{Method: r.Method, Path: r.Path}))
+			}
+		})
+
+		// Perform each operation by making a request to the corresponding route, which is denied in case it is rejected with "403 FORBIDDEN".
+		routes := make(map[string]auth.Route, len(allowedRoles))
+		operations := make(map[string][]string, len(allowedRoles))
+		for r, allowed := range allowedRoles {
+			routes[r.Method+" "+r.Path] = r
+			operations[r.Method+" "+r.Path] = allowed
+		}
+		DescribeRoles(name, operations, func(operation, n string) bool {
+			role = n
+			r := routes[operation]
+			rec := do(r)
+			if rec.Code != http.StatusForbidden {
+				return false
+			}
+			Expect(rec.Body.String()).To(ContainSubstring(policy[r]))
+			return true
+		})
+	})
+}
+
+// DescribeRoles describes which of the default roles are allowed to perform each of the operations of an API, making sure that each operation can only be performed by the specified default roles.
+// The provided function performs the specified operation on behalf of a principal assigned the specified role, and reports whether it was denied.
+// The name of the API is used to describe the specs.
+func DescribeRoles(name string, allowedRoles map[string][]string, denied func(operation, role string) bool) bool {
+	return Describe("Roles", func() {
+		for op, allowed := range allowedRoles {
+			for n := range auth.DefaultRoles {
+				op, n, allowed := op, n, allowed
+				It(fmt.Sprintf("enforces the access of %q to %s of the %s", n, op, name), func() {
+					Expect(denied(op, n)).To(Equal(!contains(allowed, n)))
+				})
+			}
+		}
+	})
+}
+
+// contains returns whether the provided slice contains the specified value.
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
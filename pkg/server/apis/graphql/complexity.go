@@ -0,0 +1,167 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphql
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+)
+
+const (
+	// introspectionFieldPrefix is the prefix of the name of introspection fields, which are not accounted for when computing complexity.
+	introspectionFieldPrefix = "__"
+	// limitArgumentName is the name of the argument used to limit the number of items returned by a field.
+	limitArgumentName = "limit"
+)
+
+// complexityChecker computes the complexity of an operation.
+type complexityChecker struct {
+	// defaults are the default values of the variables defined by the operation being checked, indexed by name.
+	defaults map[string]ast.Value
+	// fragments are the fragments defined in the document, indexed by name.
+	fragments map[string]*ast.FragmentDefinition
+	// variables are the values of the variables used in the operation.
+	variables map[string]interface{}
+}
+
+// checkComplexity returns an error in case the selected operation of the provided query exceeds the maximum allowed depth or complexity.
+// Every field costs one point, and the cost of the selections of fields which accept a limit is multiplied by that limit (or by the maximum limit, in case it cannot be determined).
+// Errors in the query itself are ignored, as they are reported when executing it.
+func checkComplexity(query, operationName string, variables map[string]interface{}) error {
+	d, err := parser.Parse(parser.ParseParams{
+		Source: query,
+	})
+	if err != nil {
+		return nil
+	}
+	c := &complexityChecker{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+	}
+	ops := make([]*ast.OperationDefinition, 0)
+	for _, def := range d.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			c.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				ops = append(ops, def)
+			}
+		}
+	}
+	for _, op := range ops {
+		c.defaults = make(map[string]ast.Value)
+		for _, v := range op.VariableDefinitions {
+			if v.DefaultValue != nil {
+				c.defaults[v.Variable.Name.Value] = v.DefaultValue
+			}
+		}
+		n, err := c.selectionSet(op.SelectionSet, 1, make(map[string]bool))
+		if err != nil {
+			return err
+		}
+		if n > constants.GraphQLMaxQueryComplexity {
+			return fmt.Errorf("the query has a complexity of %d, which exceeds the maximum of %d", n, constants.GraphQLMaxQueryComplexity)
+		}
+	}
+	return nil
+}
+
+// selectionSet returns the complexity of the provided selection set, found at the specified depth.
+// The names of the fragments being expanded are tracked so that fragment cycles do not cause infinite recursion.
+func (c *complexityChecker) selectionSet(s *ast.SelectionSet, depth int, expanding map[string]bool) (int, error) {
+	if s == nil {
+		return 0, nil
+	}
+	if depth > constants.GraphQLMaxQueryDepth {
+		return 0, fmt.Errorf("the query exceeds the maximum depth of %d", constants.GraphQLMaxQueryDepth)
+	}
+	r := 0
+	for _, sel := range s.Selections {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(sel.Name.Value, introspectionFieldPrefix) {
+				continue
+			}
+			n, err := c.selectionSet(sel.SelectionSet, depth+1, expanding)
+			if err != nil {
+				return 0, err
+			}
+			r += 1 + c.multiplier(sel)*n
+		case *ast.InlineFragment:
+			n, err := c.selectionSet(sel.SelectionSet, depth, expanding)
+			if err != nil {
+				return 0, err
+			}
+			r += n
+		case *ast.FragmentSpread:
+			f, ok := c.fragments[sel.Name.Value]
+			if !ok || expanding[sel.Name.Value] {
+				continue
+			}
+			expanding[sel.Name.Value] = true
+			n, err := c.selectionSet(f.SelectionSet, depth, expanding)
+			delete(expanding, sel.Name.Value)
+			if err != nil {
+				return 0, err
+			}
+			r += n
+		}
+	}
+	return r, nil
+}
+
+// limit returns the value of the provided limit argument, resolving variables to the value provided for them or to their default value, and a value indicating whether it could be determined.
+func (c *complexityChecker) limit(v ast.Value) (int, bool) {
+	switch v := v.(type) {
+	case *ast.IntValue:
+		n, err := strconv.Atoi(v.Value)
+		return n, err == nil && n >= 0
+	case *ast.Variable:
+		if x, ok := c.variables[v.Name.Value]; ok {
+			n, ok := x.(float64)
+			return int(n), ok && n >= 0 && n <= math.MaxInt32 && n == math.Trunc(n)
+		}
+		if d, ok := c.defaults[v.Name.Value]; ok {
+			return c.limit(d)
+		}
+	}
+	return 0, false
+}
+
+// multiplier returns the number of items the provided field may return.
+// The maximum limit is assumed in case the limit provided for the field cannot be determined.
+func (c *complexityChecker) multiplier(f *ast.Field) int {
+	for _, arg := range f.Arguments {
+		if arg.Name.Value != limitArgumentName {
+			continue
+		}
+		if n, ok := c.limit(arg.Value); ok {
+			return n
+		}
+		return maxLimit
+	}
+	if f.Name.Value == "payments" {
+		return defaultLimit
+	}
+	return 1
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package graphql
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Complexity", func() {
+	// aliased returns a query selecting the provided field under the specified number of aliases.
+	aliased := func(n int, field string) string {
+		s := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			s = append(s, "a"+strings.Repeat("a", i)+": "+field)
+		}
+		return strings.Join(s, " ")
+	}
+
+	It("rejects queries exceeding the maximum depth", func() {
+		q := "{ " + strings.Repeat("a { ", 11) + "b" + strings.Repeat(" }", 11) + " }"
+		Expect(checkComplexity(q, "", nil)).To(MatchError(ContainSubstring("exceeds the maximum depth")))
+	})
+
+	It("does not follow fragment cycles", func() {
+		Expect(checkComplexity("{ ...a } fragment a on Query { ...b } fragment b on Query { ...a }", "", nil)).To(Succeed())
+	})
+
+	DescribeTable("accepting queries",
+		func(query string, variables map[string]interface{}) {
+			Expect(checkComplexity(query, "", variables)).To(Succeed())
+		},
+		Entry("with a small limit", "{ "+aliased(7, "payments(limit: 10) { nodes { id amount } }")+" }", nil),
+		Entry("with a small limit provided using a variable", "query($n: Int) { "+aliased(7, "payments(limit: $n) { nodes { id amount } }")+" }", map[string]interface{}{"n": float64(10)}),
+		Entry("with a small default limit", "query($n: Int = 10) { "+aliased(7, "payments(limit: $n) { nodes { id amount } }")+" }", nil),
+	)
+
+	DescribeTable("rejecting queries whose aliases select too many payments",
+		func(query string, variables map[string]interface{}) {
+			Expect(checkComplexity(query, "", variables)).To(MatchError(ContainSubstring("exceeds the maximum of")))
+		},
+		Entry("with a large limit", "{ "+aliased(2, "payments(limit: 100000) { nodes { id } }")+" }", nil),
+		Entry("with a large limit provided using a variable", "query($n: Int) { "+aliased(2, "payments(limit: $n) { nodes { id } }")+" }", map[string]interface{}{"n": float64(100000)}),
+		Entry("with a large default limit", "query($n: Int = 100000) { "+aliased(2, "payments(limit: $n) { nodes { id } }")+" }", nil),
+		Entry("with a limit which cannot be determined", "query($n: Int) { "+aliased(7, "payments(limit: $n) { nodes { id amount } }")+" }", nil),
+		Entry("with a limit which is not an integer", "query($n: Int) { "+aliased(7, "payments(limit: $n) { nodes { id amount } }")+" }", map[string]interface{}{"n": "10"}),
+		Entry("with the default limit", "{ "+aliased(50, "payments { nodes { id amount } }")+" }", nil),
+	)
+})
@@ -0,0 +1,107 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphql
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/labstack/echo"
+)
+
+const (
+	// BasePath is the base path of the GraphQL API.
+	BasePath = "/graphql"
+)
+
+// echoContextKey is the type of the key under which the Echo context is stored in the context passed to resolvers.
+type echoContextKey struct{}
+
+// request represents a GraphQL request.
+type request struct {
+	// OperationName is the name of the operation to execute, in case the query contains more than one.
+	OperationName string `json:"operationName" query:"operationName"`
+	// Query is the GraphQL document to execute.
+	Query string `json:"query" query:"query"`
+	// Variables are the values of the variables used in the query.
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// Register registers the handlers for the GraphQL API to the provided Echo instance.
+func Register(echo *echo.Echo) {
+	echo.Add(http.MethodGet, BasePath, executeQuery)
+	echo.Add(http.MethodPost, BasePath, executeQuery)
+}
+
+// executeQuery executes a GraphQL query or mutation.
+// Mutations can only be executed using POST.
+func executeQuery(ctx echo.Context) error {
+	var (
+		r request
+	)
+	if err := ctx.Bind(&r); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if r.Query == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "the query must not be empty")
+	}
+	// Only allow for mutations to be executed using POST, so that they cannot be triggered by following a link (nor be cached or retried by proxies).
+	if ctx.Request().Method == http.MethodGet && isMutation(r.Query, r.OperationName) {
+		ctx.Response().Header().Set(echo.HeaderAllow, http.MethodPost)
+		return echo.NewHTTPError(http.StatusMethodNotAllowed, "mutations must be executed using POST")
+	}
+	// Reject queries which would be too expensive to execute.
+	if err := checkComplexity(r.Query, r.OperationName, r.Variables); err != nil {
+		return ctx.JSON(http.StatusBadRequest, graphql.Result{
+			Errors: []gqlerrors.FormattedError{
+				gqlerrors.NewFormattedError(err.Error()),
+			},
+		})
+	}
+	// Execute the query, making the Echo context available to resolvers.
+	res := graphql.Do(graphql.Params{
+		Schema:         schema,
+		RequestString:  r.Query,
+		VariableValues: r.Variables,
+		OperationName:  r.OperationName,
+		Context:        context.WithValue(ctx.Request().Context(), echoContextKey{}, ctx),
+	})
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// isMutation returns a value indicating whether the selected operation of the provided query is a mutation.
+// Errors in the query itself are ignored, as they are reported when executing it.
+func isMutation(query, operationName string) bool {
+	d, err := parser.Parse(parser.ParseParams{
+		Source: query,
+	})
+	if err != nil {
+		return false
+	}
+	for _, def := range d.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok || (operationName != "" && (op.Name == nil || op.Name.Value != operationName)) {
+			continue
+		}
+		if op.Operation == ast.OperationTypeMutation {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package graphql
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/pkg/events"
+	"github.com/bmcstdio/dojo-payments/pkg/ratelimit"
+)
+
+const (
+	// createPaymentMutation is a mutation that creates a valid payment.
+	createPaymentMutation = `mutation {
+		createPayment(input: {
+			amount: 314.15,
+			beneficiary: {account_number: "1234", bank_id: "4321", name: "John"},
+			currency: "EUR",
+			date: "2019-04-30T22:30:00Z",
+			debtor: {account_number: "5678", bank_id: "8765", name: "Dave"},
+			description: "Order #1"
+		}) { id }
+	}`
+)
+
+// fakeDatabase is an implementation of db.Database that serves a single payment, recording the searches performed and the payments created.
+// Every other operation on payments succeeds.
+type fakeDatabase struct {
+	db.Database
+	db.EventsDatabase
+	db.PaymentsDatabase
+
+	// created are the payments created.
+	created []models.Payment
+	// filters are the filters with which payments were searched.
+	filters []db.PaymentsFilter
+	// pages are the (offset, limit) pairs requested.
+	pages [][2]int
+}
+
+func (f *fakeDatabase) AppendEvent(e models.Event) (models.Event, error) {
+	return e, nil
+}
+
+func (f *fakeDatabase) CreatePayment(p models.Payment) (models.Payment, error) {
+	p.ID = primitive.NewObjectID()
+	f.created = append(f.created, p)
+	return p, nil
+}
+
+func (f *fakeDatabase) DeletePayment(string) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeDatabase) Events() db.EventsDatabase {
+	return f
+}
+
+func (f *fakeDatabase) GetPayment(id string) (models.Payment, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Payment{}, err
+	}
+	return models.Payment{ID: objectID, Description: "Order #1"}, nil
+}
+
+func (f *fakeDatabase) Payments() db.PaymentsDatabase {
+	return f
+}
+
+func (f *fakeDatabase) SearchPayments(filter db.PaymentsFilter, offset, limit int) ([]models.Payment, int64, error) {
+	f.filters = append(f.filters, filter)
+	f.pages = append(f.pages, [2]int{offset, limit})
+	return []models.Payment{{ID: primitive.NewObjectID(), Description: "Order #1"}}, 1, nil
+}
+
+func (f *fakeDatabase) UpdatePayment(id string, p models.Payment) (models.Payment, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Payment{}, err
+	}
+	p.ID = objectID
+	return p, nil
+}
+
+// response represents the response to a GraphQL request.
+type response struct {
+	// Data is the result of executing the operation.
+	Data map[string]interface{} `json:"data"`
+	// Errors are the errors which occurred while executing the operation.
+	Errors []struct {
+		// Message is the error message.
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+var _ = Describe("Handlers", func() {
+	var (
+		d         *fakeDatabase
+		limiter   *ratelimit.Limiter
+		principal *auth.Principal
+		srv       *echo.Echo
+	)
+
+	BeforeEach(func() {
+		d = &fakeDatabase{}
+		limiter = nil
+		principal = nil
+		srv = echo.New()
+		srv.Use(func(fn echo.HandlerFunc) echo.HandlerFunc {
+			return func(ctx echo.Context) error {
+				if principal != nil {
+					ctx.Set(constants.PrincipalContextKey, principal)
+					ctx.SetRequest(ctx.Request().WithContext(auth.WithPrincipal(ctx.Request().Context(), principal)))
+				}
+				if limiter != nil {
+					ctx.Set(constants.RateLimiterContextKey, limiter)
+				}
+				ctx.Set(constants.DatabaseContextKey, d)
+				ctx.Set(constants.EventBusContextKey, events.NewBus())
+				return fn(ctx)
+			}
+		})
+		Register(srv)
+	})
+
+	// get sends the provided query using GET, returning the recorded response.
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, BasePath+"?query="+url.QueryEscape(query), nil))
+		return rec
+	}
+
+	// post sends the provided query using POST, returning the recorded response.
+	post := func(query string) *httptest.ResponseRecorder {
+		b, err := json.Marshal(request{Query: query})
+		Expect(err).NotTo(HaveOccurred())
+		req := httptest.NewRequest(http.MethodPost, BasePath, strings.NewReader(string(b)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// decode decodes the provided GraphQL response.
+	decode := func(rec *httptest.ResponseRecorder) response {
+		r := response{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &r)).To(Succeed())
+		return r
+	}
+
+	It("executes queries, filtering and paging payments in the database", func() {
+		principal = &auth.Principal{Subject: "alice", Scopes: []string{auth.ScopePaymentsRead}}
+		rec := post(`{ payments(account: "1234", currency: "EUR", limit: 10, offset: 5) { total_count nodes { description } } }`)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		r := decode(rec)
+		Expect(r.Errors).To(BeEmpty())
+		Expect(r.Data).To(HaveKeyWithValue("payments", map[string]interface{}{
+			"total_count": float64(1),
+			"nodes":       []interface{}{map[string]interface{}{"description": "Order #1"}},
+		}))
+		Expect(d.filters).To(Equal([]db.PaymentsFilter{{Account: "1234", Currency: "EUR"}}))
+		Expect(d.pages).To(Equal([][2]int{{5, 10}}))
+	})
+
+	It("executes queries sent using GET", func() {
+		rec := get(`{ payments { total_count } }`)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(decode(rec).Errors).To(BeEmpty())
+		Expect(d.pages).To(Equal([][2]int{{0, defaultLimit}}))
+	})
+
+	It("rejects mutations sent using GET", func() {
+		rec := get(createPaymentMutation)
+		Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+		Expect(rec.Header().Get(echo.HeaderAllow)).To(Equal(http.MethodPost))
+		Expect(d.created).To(BeEmpty())
+	})
+
+	It("rejects queries exceeding the maximum depth", func() {
+		rec := post("{ " + strings.Repeat("payments { nodes { beneficiary { ", 4) + "name" + strings.Repeat(" } } }", 4) + " }")
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		Expect(decode(rec).Errors[0].Message).To(ContainSubstring("exceeds the maximum depth"))
+		Expect(d.pages).To(BeEmpty())
+	})
+
+	It("rejects queries whose aliases select too many payments using limits omitted from variables", func() {
+		rec := post(`query($n: Int = 100000) { a: payments(limit: $n) { nodes { id } } b: payments(limit: $n) { nodes { id } } }`)
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		Expect(decode(rec).Errors[0].Message).To(ContainSubstring("exceeds the maximum of"))
+		Expect(d.pages).To(BeEmpty())
+	})
+
+	It("creates payments", func() {
+		principal = &auth.Principal{Subject: "alice", Scopes: []string{auth.ScopePaymentsWrite}}
+		rec := post(createPaymentMutation)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(decode(rec).Errors).To(BeEmpty())
+		Expect(d.created).To(HaveLen(1))
+		Expect(d.created[0].Description).To(Equal("Order #1"))
+	})
+
+	It("rejects mutations made by principals lacking the required scope", func() {
+		principal = &auth.Principal{Subject: "alice", Scopes: []string{auth.ScopePaymentsRead}}
+		rec := post(createPaymentMutation)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		r := decode(rec)
+		Expect(r.Errors).To(HaveLen(1))
+		Expect(r.Errors[0].Message).To(ContainSubstring(`missing permission "payments:write"`))
+		Expect(d.created).To(BeEmpty())
+	})
+
+	It("rejects mutations exceeding the daily quota", func() {
+		limiter = ratelimit.NewLimiter(ratelimit.Config{Quota: ratelimit.Quota{DailyCount: 1}}, ratelimit.NewMemoryStore())
+		Expect(decode(post(createPaymentMutation)).Errors).To(BeEmpty())
+		r := decode(post(createPaymentMutation))
+		Expect(r.Errors).To(HaveLen(1))
+		Expect(r.Errors[0].Message).To(ContainSubstring(ratelimit.ErrQuotaExceeded.Error()))
+		Expect(d.created).To(HaveLen(1))
+	})
+})
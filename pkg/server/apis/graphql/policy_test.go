@@ -0,0 +1,100 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package graphql
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+	"github.com/bmcstdio/dojo-payments/pkg/events"
+	"github.com/bmcstdio/dojo-payments/pkg/server/apis/apitest"
+)
+
+// allowedRoles maps each query and mutation of the GraphQL API to the default roles allowed to perform it.
+var allowedRoles = map[string][]string{
+	"createPayment": {auth.RoleAdmin, auth.RoleOperator},
+	"deletePayment": {auth.RoleAdmin},
+	"payment":       {auth.RoleAdmin, auth.RoleOperator, auth.RoleViewer},
+	"payments":      {auth.RoleAdmin, auth.RoleOperator, auth.RoleViewer},
+	"updatePayment": {auth.RoleAdmin, auth.RoleOperator},
+}
+
+// operations maps each query and mutation of the GraphQL API to a document performing it.
+var operations = map[string]string{
+	"createPayment": createPaymentMutation,
+	"deletePayment": `mutation { deletePayment(id: "5cc8c1f9e5ef8e0001d8c4d3") }`,
+	"payment":       `{ payment(id: "5cc8c1f9e5ef8e0001d8c4d3") { id } }`,
+	"payments":      `{ payments { total_count } }`,
+	"updatePayment": strings.Replace(createPaymentMutation, "createPayment(", `updatePayment(id: "5cc8c1f9e5ef8e0001d8c4d3", `, 1),
+}
+
+var _ = Describe("Policy", func() {
+	It("covers every query and mutation", func() {
+		fields := make([]string, 0)
+		for f := range schema.QueryType().Fields() {
+			fields = append(fields, f)
+		}
+		for f := range schema.MutationType().Fields() {
+			fields = append(fields, f)
+		}
+		Expect(fields).To(HaveLen(len(allowedRoles)))
+		for _, f := range fields {
+			Expect(allowedRoles).To(HaveKey(f))
+			Expect(operations).To(HaveKey(f))
+		}
+	})
+
+	apitest.DescribeRoles("graphql api", allowedRoles, func(operation, role string) bool {
+		p := &auth.Principal{
+			Subject: "alice",
+			Roles:   []string{role},
+			Scopes:  auth.DefaultRoles.Scopes([]string{role}),
+		}
+		srv := echo.New()
+		srv.Use(func(fn echo.HandlerFunc) echo.HandlerFunc {
+			return func(ctx echo.Context) error {
+				ctx.Set(constants.PrincipalContextKey, p)
+				ctx.SetRequest(ctx.Request().WithContext(auth.WithPrincipal(ctx.Request().Context(), p)))
+				ctx.Set(constants.DatabaseContextKey, &fakeDatabase{})
+				ctx.Set(constants.EventBusContextKey, events.NewBus())
+				return fn(ctx)
+			}
+		})
+		Register(srv)
+		b, err := json.Marshal(request{Query: operations[operation]})
+		Expect(err).NotTo(HaveOccurred())
+		req := httptest.NewRequest(http.MethodPost, BasePath, strings.NewReader(string(b)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		r := response{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &r)).To(Succeed())
+		for _, e := range r.Errors {
+			if strings.Contains(e.Message, "missing permission") {
+				return true
+			}
+		}
+		Expect(r.Errors).To(BeEmpty())
+		return false
+	})
+})
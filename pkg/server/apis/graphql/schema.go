@@ -0,0 +1,430 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphql
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/labstack/echo"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/pkg/events"
+	"github.com/bmcstdio/dojo-payments/pkg/ratelimit"
+	"github.com/bmcstdio/dojo-payments/pkg/tracing"
+)
+
+const (
+	// defaultLimit is the maximum number of payments returned by the "payments" query when no limit is specified.
+	defaultLimit = 20
+	// maxLimit is the maximum number of payments which may be requested from the "payments" query.
+	maxLimit = 100
+)
+
+var (
+	// errPaymentNotFound is the error returned when the requested payment does not exist.
+	errPaymentNotFound = errors.New("payment not found")
+)
+
+// entityType is the GraphQL type that represents models.Entity.
+var entityType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Entity",
+	Description: "A party involved in a payment.",
+	Fields: graphql.Fields{
+		"account_number": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "The account number for the entity.",
+		},
+		"bank_id": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "The bank ID for the entity.",
+		},
+		"name": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "The name of the entity.",
+		},
+	},
+})
+
+// entityInputType is the GraphQL input type used to provide a models.Entity.
+var entityInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name:        "EntityInput",
+	Description: "A party involved in a payment.",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"account_number": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"bank_id": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"name": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+})
+
+// paymentType is the GraphQL type that represents models.Payment.
+var paymentType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Payment",
+	Description: "A payment to an entity (the beneficiary) made by another entity (the debtor).",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.ID),
+			Description: "The ID of the payment.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(models.Payment).ID.Hex(), nil
+			},
+		},
+		"beneficiary": &graphql.Field{
+			Type:        graphql.NewNonNull(entityType),
+			Description: "The entity that received the payment.",
+		},
+		"debtor": &graphql.Field{
+			Type:        graphql.NewNonNull(entityType),
+			Description: "The entity that sent the payment.",
+		},
+		"amount": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.Float),
+			Description: "The amount involved in the payment.",
+		},
+		"currency": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "The currency in which the payment was made.",
+		},
+		"date": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.DateTime),
+			Description: "The date at which the payment was processed.",
+		},
+		"description": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "The description associated with the payment.",
+		},
+		"status": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "The status of the payment (i.e. \"scheduled\" or \"executed\"), which is set based on its date.",
+		},
+		"executedAt": &graphql.Field{
+			Type:        graphql.DateTime,
+			Description: "The date at which the payment was executed, if it has been executed.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if t := p.Source.(models.Payment).ExecutedAt; t != nil {
+					return *t, nil
+				}
+				return nil, nil
+			},
+		},
+		"standingOrderId": &graphql.Field{
+			Type:        graphql.ID,
+			Description: "The ID of the standing order from which the payment was generated, if any.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if id := p.Source.(models.Payment).StandingOrderID; id != nil {
+					return id.Hex(), nil
+				}
+				return nil, nil
+			},
+		},
+	},
+})
+
+// paymentInputType is the GraphQL input type used to provide a models.Payment.
+var paymentInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name:        "PaymentInput",
+	Description: "A payment to an entity (the beneficiary) made by another entity (the debtor).",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"beneficiary": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(entityInputType),
+		},
+		"debtor": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(entityInputType),
+		},
+		"amount": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.Float),
+		},
+		"currency": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"date": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.DateTime),
+		},
+		"description": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+	},
+})
+
+// paymentListType is the GraphQL type that represents a page of payments.
+var paymentListType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "PaymentList",
+	Description: "A page of payments.",
+	Fields: graphql.Fields{
+		"nodes": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(paymentType))),
+			Description: "The payments in the current page.",
+		},
+		"total_count": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.Int),
+			Description: "The total number of payments matching the provided filters.",
+		},
+	},
+})
+
+// paymentList represents a page of payments.
+type paymentList struct {
+	// Nodes are the payments in the current page.
+	Nodes []models.Payment `json:"nodes"`
+	// TotalCount is the total number of payments matching the provided filters.
+	TotalCount int `json:"total_count"`
+}
+
+// queryType is the root type for queries.
+var queryType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Query",
+	Fields: graphql.Fields{
+		"payment": &graphql.Field{
+			Type:        paymentType,
+			Description: "Gets a payment by ID.",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.ID),
+				},
+			},
+			Resolve: resolvePayment,
+		},
+		"payments": &graphql.Field{
+			Type:        graphql.NewNonNull(paymentListType),
+			Description: "Lists payments, optionally filtering them by currency and by the account number of either party.",
+			Args: graphql.FieldConfigArgument{
+				"account": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"currency": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"limit": &graphql.ArgumentConfig{
+					Type:         graphql.Int,
+					DefaultValue: defaultLimit,
+				},
+				"offset": &graphql.ArgumentConfig{
+					Type:         graphql.Int,
+					DefaultValue: 0,
+				},
+			},
+			Resolve: resolvePayments,
+		},
+	},
+})
+
+// mutationType is the root type for mutations.
+var mutationType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Mutation",
+	Fields: graphql.Fields{
+		"createPayment": &graphql.Field{
+			Type:        graphql.NewNonNull(paymentType),
+			Description: "Creates a payment.",
+			Args: graphql.FieldConfigArgument{
+				"input": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(paymentInputType),
+				},
+			},
+			Resolve: resolveCreatePayment,
+		},
+		"deletePayment": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.Boolean),
+			Description: "Deletes a payment by ID.",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.ID),
+				},
+			},
+			Resolve: resolveDeletePayment,
+		},
+		"updatePayment": &graphql.Field{
+			Type:        graphql.NewNonNull(paymentType),
+			Description: "Updates a payment by ID.",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.ID),
+				},
+				"input": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(paymentInputType),
+				},
+			},
+			Resolve: resolveUpdatePayment,
+		},
+	},
+})
+
+// schema is the GraphQL schema of the API.
+var schema graphql.Schema
+
+func init() {
+	s, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query:    queryType,
+		Mutation: mutationType,
+	})
+	if err != nil {
+		panic(err)
+	}
+	schema = s
+}
+
+// database returns the database to use for storing payments given the provided resolver parameters.
+func database(p graphql.ResolveParams) db.Database {
+	return p.Context.Value(echoContextKey{}).(echo.Context).Get(constants.DatabaseContextKey).(db.Database)
+}
+
+// recordEvent persists an event describing the specified change to the provided payment and publishes it to the event bus.
+func recordEvent(p graphql.ResolveParams, t models.EventType, payment models.Payment) {
+	events.Record(p.Context, database(p), p.Context.Value(echoContextKey{}).(echo.Context).Get(constants.EventBusContextKey).(*events.Bus), t, payment)
+}
+
+// resolvePayment gets a payment by ID.
+func resolvePayment(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.CheckScope(p.Context, auth.ScopePaymentsRead); err != nil {
+		return nil, err
+	}
+	r, err := database(p).Payments().GetPayment(p.Args["id"].(string))
+	if err != nil {
+		return nil, err
+	}
+	if r == (models.Payment{}) {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// resolvePayments lists payments.
+func resolvePayments(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.CheckScope(p.Context, auth.ScopePaymentsRead); err != nil {
+		return nil, err
+	}
+	limit, offset := p.Args["limit"].(int), p.Args["offset"].(int)
+	if limit < 0 || limit > maxLimit {
+		return nil, fmt.Errorf("the limit must be between 0 and %d", maxLimit)
+	}
+	if offset < 0 {
+		return nil, errors.New("the offset must not be negative")
+	}
+	// Push the filters and the selection of the requested page to the database.
+	account, _ := p.Args["account"].(string)
+	currency, _ := p.Args["currency"].(string)
+	r, n, err := database(p).Payments().SearchPayments(db.PaymentsFilter{
+		Account:  account,
+		Currency: currency,
+	}, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return paymentList{
+		Nodes:      r,
+		TotalCount: int(n),
+	}, nil
+}
+
+// resolveCreatePayment creates a payment.
+func resolveCreatePayment(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.CheckScope(p.Context, auth.ScopePaymentsWrite); err != nil {
+		return nil, err
+	}
+	v := toModel(p.Args["input"].(map[string]interface{}))
+	if err := tracing.Span(p.Context, "Payment.Validate", v.Validate); err != nil {
+		return nil, err
+	}
+	release, err := ratelimit.ConsumeQuota(p.Context.Value(echoContextKey{}).(echo.Context), v)
+	if err != nil {
+		var (
+			e *echo.HTTPError
+		)
+		if errors.As(err, &e) {
+			return nil, fmt.Errorf("%v", e.Message)
+		}
+		return nil, err
+	}
+	r, err := database(p).Payments().CreatePayment(v)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	recordEvent(p, models.EventTypePaymentCreated, r)
+	return r, nil
+}
+
+// resolveDeletePayment deletes a payment by ID.
+func resolveDeletePayment(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.CheckScope(p.Context, auth.ScopePaymentsDelete); err != nil {
+		return nil, err
+	}
+	// Grab the payment before deleting it so that it can be included in the corresponding event.
+	v, err := database(p).Payments().GetPayment(p.Args["id"].(string))
+	if err != nil {
+		return nil, err
+	}
+	d, err := database(p).Payments().DeletePayment(p.Args["id"].(string))
+	if err != nil {
+		return nil, err
+	}
+	if !d {
+		return nil, errPaymentNotFound
+	}
+	recordEvent(p, models.EventTypePaymentDeleted, v)
+	return true, nil
+}
+
+// resolveUpdatePayment updates a payment by ID.
+func resolveUpdatePayment(p graphql.ResolveParams) (interface{}, error) {
+	if err := auth.CheckScope(p.Context, auth.ScopePaymentsWrite); err != nil {
+		return nil, err
+	}
+	v := toModel(p.Args["input"].(map[string]interface{}))
+	if err := tracing.Span(p.Context, "Payment.Validate", v.Validate); err != nil {
+		return nil, err
+	}
+	r, err := database(p).Payments().UpdatePayment(p.Args["id"].(string), v)
+	if err != nil {
+		return nil, err
+	}
+	if r == (models.Payment{}) {
+		return nil, errPaymentNotFound
+	}
+	recordEvent(p, models.EventTypePaymentUpdated, r)
+	return r, nil
+}
+
+// toModel converts the provided value of the "PaymentInput" input type into a payment that can be stored.
+func toModel(v map[string]interface{}) models.Payment {
+	p := models.Payment{
+		Beneficiary: toEntityModel(v["beneficiary"].(map[string]interface{})),
+		Debtor:      toEntityModel(v["debtor"].(map[string]interface{})),
+	}
+	p.Amount, _ = v["amount"].(float64)
+	p.Currency, _ = v["currency"].(string)
+	p.Date, _ = v["date"].(time.Time)
+	p.Description, _ = v["description"].(string)
+	return p
+}
+
+// toEntityModel converts the provided value of the "EntityInput" input type into an entity that can be stored.
+func toEntityModel(v map[string]interface{}) models.Entity {
+	e := models.Entity{}
+	e.AccountNumber, _ = v["account_number"].(string)
+	e.BankID, _ = v["bank_id"].(string)
+	e.Name, _ = v["name"].(string)
+	return e
+}
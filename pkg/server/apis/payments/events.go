@@ -0,0 +1,157 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package payments
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/pkg/events"
+)
+
+const (
+	// accountQueryParam is the name of the query parameter used to filter events by the account number of either party.
+	accountQueryParam = "account"
+	// currencyQueryParam is the name of the query parameter used to filter events by currency.
+	currencyQueryParam = "currency"
+	// lastEventIDHeader is the name of the header used by clients to resume an event stream.
+	lastEventIDHeader = "Last-Event-ID"
+)
+
+// eventFilter selects the events which a client of the event stream is interested in.
+type eventFilter struct {
+	// account is the account number which either party to the payment must have, if non-empty.
+	account string
+	// currency is the currency in which the payment must have been made, if non-empty.
+	currency string
+	// tenant is the tenant to which the payment must belong.
+	tenant string
+}
+
+// matches returns a value indicating whether the provided event is selected by the current filter.
+func (f eventFilter) matches(e models.Event) bool {
+	if e.Payment.Tenant != f.tenant {
+		return false
+	}
+	if f.currency != "" && e.Payment.Currency != f.currency {
+		return false
+	}
+	if f.account != "" && !e.Involves(f.account) {
+		return false
+	}
+	return true
+}
+
+// recordEvent persists an event describing the specified change to the provided payment and publishes it to the event bus.
+func recordEvent(ctx echo.Context, t models.EventType, p models.Payment) {
+	events.Record(ctx.Request().Context(), ctx.Get(constants.DatabaseContextKey).(db.Database), ctx.Get(constants.EventBusContextKey).(*events.Bus), t, p)
+}
+
+// streamEvents streams changes made to payments as server-sent events.
+func streamEvents(ctx echo.Context) error {
+	var (
+		last   int64
+		replay []models.Event
+	)
+	// Parse the ID of the last event received by the client, if any.
+	v := ctx.Request().Header.Get(lastEventIDHeader)
+	if v != "" {
+		s, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || s < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%q is not a valid event ID", v))
+		}
+		last = s
+	}
+	f := eventFilter{
+		account:  ctx.QueryParam(accountQueryParam),
+		currency: ctx.QueryParam(currencyQueryParam),
+		tenant:   auth.TenantFromContext(ctx.Request().Context()),
+	}
+	// Subscribe to the event bus before replaying persisted events so that no events are missed in between.
+	ch, unsubscribe := ctx.Get(constants.EventBusContextKey).(*events.Bus).Subscribe()
+	defer unsubscribe()
+	// Replay the events the client has missed, if it is resuming the stream.
+	if v != "" {
+		r, err := ctx.Get(constants.DatabaseContextKey).(db.Database).Events().ListEvents(last)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
+		}
+		replay = r
+	}
+	// Start the event stream.
+	res := ctx.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+	for _, e := range replay {
+		if err := writeEvent(res, f, e); err != nil {
+			return nil
+		}
+		last = e.Sequence
+	}
+	// Deliver live events until either the client goes away or it falls behind.
+	t := time.NewTicker(constants.EventStreamHeartbeatInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Request().Context().Done():
+			return nil
+		case <-t.C:
+			if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case e, ok := <-ch:
+			if !ok {
+				// The client was dropped for not keeping up (or the server is shutting down), and should reconnect using the ID of the last event it received.
+				return nil
+			}
+			if e.Sequence <= last {
+				// The event has already been delivered while replaying.
+				continue
+			}
+			if err := writeEvent(res, f, e); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// writeEvent writes the provided event to the event stream, provided that it is selected by the specified filter.
+func writeEvent(res *echo.Response, f eventFilter, e models.Event) error {
+	if !f.matches(e) {
+		return nil
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", e.Sequence, e.Type, b); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
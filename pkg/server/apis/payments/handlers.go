@@ -15,27 +15,73 @@
 package payments
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/labstack/echo"
+	log "github.com/sirupsen/logrus"
 
+	"github.com/bmcstdio/dojo-payments/pkg/api"
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
 	"github.com/bmcstdio/dojo-payments/pkg/constants"
 	"github.com/bmcstdio/dojo-payments/pkg/db"
 	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/pkg/logging"
+	"github.com/bmcstdio/dojo-payments/pkg/ratelimit"
+	"github.com/bmcstdio/dojo-payments/pkg/tracing"
 )
 
 const (
 	// BasePath is the base path of the Payments API.
-	BasePath = "/payments"
+	BasePath = api.PaymentsBasePath
 )
 
-// Register registers the handlers for the Payments API to the provided Echo instance.
-func Register(echo *echo.Echo) {
-	echo.Add(http.MethodPost, BasePath, createPayment)
-	echo.Add(http.MethodDelete, BasePath+"/:id", deletePayment)
-	echo.Add(http.MethodGet, BasePath+"/:id", getPayment)
-	echo.Add(http.MethodGet, BasePath, listPayments)
-	echo.Add(http.MethodPut, BasePath+"/:id", updatePayment)
+const (
+	// LimitQueryParam is the name of the query parameter used to limit the number of payments listed.
+	LimitQueryParam = api.LimitQueryParam
+	// OffsetQueryParam is the name of the query parameter used to skip payments when listing them.
+	OffsetQueryParam = api.OffsetQueryParam
+	// TotalCountHeader is the name of the header containing the total number of payments when listing them.
+	TotalCountHeader = api.TotalCountHeader
+)
+
+// Policy maps each route of the Payments API to the scope required to access it.
+var Policy = auth.Policy{
+	{Method: http.MethodDelete, Path: BasePath + "/:id"}: auth.ScopePaymentsDelete,
+	{Method: http.MethodGet, Path: BasePath}:             auth.ScopePaymentsRead,
+	{Method: http.MethodGet, Path: BasePath + "/:id"}:    auth.ScopePaymentsRead,
+	{Method: http.MethodGet, Path: BasePath + "/events"}: auth.ScopePaymentsRead,
+	{Method: http.MethodPost, Path: BasePath}:            auth.ScopePaymentsWrite,
+	{Method: http.MethodPut, Path: BasePath + "/:id"}:    auth.ScopePaymentsWrite,
+}
+
+// handlers maps each route of the Payments API to the HTTP handler that serves it.
+var handlers = map[auth.Route]echo.HandlerFunc{
+	{Method: http.MethodDelete, Path: BasePath + "/:id"}: deletePayment,
+	{Method: http.MethodGet, Path: BasePath}:             listPayments,
+	{Method: http.MethodGet, Path: BasePath + "/:id"}:    getPayment,
+	{Method: http.MethodGet, Path: BasePath + "/events"}: streamEvents,
+	{Method: http.MethodPost, Path: BasePath}:            createPayment,
+	{Method: http.MethodPut, Path: BasePath + "/:id"}:    updatePayment,
+}
+
+// Register registers the handlers for the Payments API to the provided Echo instance, requiring the scopes defined by Policy.
+func Register(e *echo.Echo) {
+	for r, fn := range handlers {
+		e.Add(r.Method, r.Path, fn, auth.RequireScope(Policy.Scope(r)), logPaymentID)
+	}
+}
+
+// logPaymentID is an Echo middleware that includes the ID of the payment being handled (if any) in every line logged while handling the current request.
+func logPaymentID(fn echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		if id := ctx.Param("id"); id != "" {
+			logging.AddFields(ctx, log.Fields{logging.PaymentIDField: id})
+		}
+		return fn(ctx)
+	}
 }
 
 // createPayment creates a payment.
@@ -47,25 +93,40 @@ func createPayment(ctx echo.Context) error {
 	if err := ctx.Bind(&p); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
-	if err := p.Validate(); err != nil {
+	if err := tracing.Span(ctx.Request().Context(), "Payment.Validate", p.Validate); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
+	// Only payments generated by the scheduler originate from standing orders.
+	p.StandingOrderID = nil
+	release, err := ratelimit.ConsumeQuota(ctx, p)
+	if err != nil {
+		return err
+	}
 	p, err = ctx.Get(constants.DatabaseContextKey).(db.Database).Payments().CreatePayment(p)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		release()
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
 	}
+	logging.AddFields(ctx, log.Fields{logging.PaymentIDField: p.ID.Hex()})
+	recordEvent(ctx, models.EventTypePaymentCreated, p)
 	return ctx.JSON(http.StatusCreated, p)
 }
 
 // deletePayment deletes a payment by ID.
 func deletePayment(ctx echo.Context) error {
+	// Grab the payment before deleting it so that it can be included in the corresponding event.
+	p, err := ctx.Get(constants.DatabaseContextKey).(db.Database).Payments().GetPayment(ctx.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
+	}
 	d, err := ctx.Get(constants.DatabaseContextKey).(db.Database).Payments().DeletePayment(ctx.Param("id"))
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
 	}
 	if !d {
 		return echo.NewHTTPError(http.StatusNotFound, "payment not found")
 	}
+	recordEvent(ctx, models.EventTypePaymentDeleted, p)
 	return ctx.String(http.StatusNoContent, "")
 }
 
@@ -73,7 +134,7 @@ func deletePayment(ctx echo.Context) error {
 func getPayment(ctx echo.Context) error {
 	p, err := ctx.Get(constants.DatabaseContextKey).(db.Database).Payments().GetPayment(ctx.Param("id"))
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
 	}
 	if p == (models.Payment{}) {
 		return echo.NewHTTPError(http.StatusNotFound, "payment not found")
@@ -81,12 +142,26 @@ func getPayment(ctx echo.Context) error {
 	return ctx.JSON(http.StatusOK, p)
 }
 
-// listPayments lists payments.
+// listPayments lists payments ordered by ID, optionally selecting a single page of them.
 func listPayments(ctx echo.Context) error {
-	r, err := ctx.Get(constants.DatabaseContextKey).(db.Database).Payments().ListPayments()
+	limit, err := intQueryParam(ctx, LimitQueryParam, -1)
+	if err != nil {
+		return err
+	}
+	offset, err := intQueryParam(ctx, OffsetQueryParam, 0)
+	if err != nil {
+		return err
+	}
+	d := ctx.Get(constants.DatabaseContextKey).(db.Database).Payments()
+	n, err := d.CountPayments()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
+	}
+	r, err := d.ListPayments(offset, limit)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
 	}
+	ctx.Response().Header().Set(TotalCountHeader, strconv.FormatInt(n, 10))
 	return ctx.JSON(http.StatusOK, r)
 }
 
@@ -100,15 +175,32 @@ func updatePayment(ctx echo.Context) error {
 	if err := ctx.Bind(&p); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
-	if err := p.Validate(); err != nil {
+	if err := tracing.Span(ctx.Request().Context(), "Payment.Validate", p.Validate); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 	r, err = ctx.Get(constants.DatabaseContextKey).(db.Database).Payments().UpdatePayment(ctx.Param("id"), p)
+	if errors.Is(err, db.ErrPaymentExecuted) {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
 	}
-	if p == (models.Payment{}) {
+	if r == (models.Payment{}) {
 		return echo.NewHTTPError(http.StatusNotFound, "payment not found")
 	}
+	recordEvent(ctx, models.EventTypePaymentUpdated, r)
 	return ctx.JSON(http.StatusOK, r)
 }
+
+// intQueryParam returns the value of the specified query parameter as a non-negative integer, or the provided default value in case it is absent.
+func intQueryParam(ctx echo.Context, name string, def int) (int, error) {
+	v := ctx.QueryParam(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("the %s must be a non-negative integer", name))
+	}
+	return n, nil
+}
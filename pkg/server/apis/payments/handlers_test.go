@@ -0,0 +1,139 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package payments
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+// fakeDatabase is an implementation of db.Database that serves a fixed number of payments, recording the pages requested.
+type fakeDatabase struct {
+	db.Database
+	db.PaymentsDatabase
+
+	// count is the number of registered payments.
+	count int
+	// pages are the (offset, limit) pairs requested.
+	pages [][2]int
+	// updateErr is the error returned when updating payments.
+	updateErr error
+}
+
+func (f *fakeDatabase) CountPayments() (int64, error) {
+	return int64(f.count), nil
+}
+
+func (f *fakeDatabase) ListPayments(offset, limit int) ([]models.Payment, error) {
+	f.pages = append(f.pages, [2]int{offset, limit})
+	r := make([]models.Payment, 0)
+	for i := offset; i < f.count && (limit < 0 || len(r) < limit); i++ {
+		r = append(r, models.Payment{Description: string(rune('a' + i))})
+	}
+	return r, nil
+}
+
+func (f *fakeDatabase) Payments() db.PaymentsDatabase {
+	return f
+}
+
+func (f *fakeDatabase) UpdatePayment(string, models.Payment) (models.Payment, error) {
+	return models.Payment{}, f.updateErr
+}
+
+var _ = Describe("Listing payments", func() {
+	var (
+		d   *fakeDatabase
+		srv *echo.Echo
+	)
+
+	BeforeEach(func() {
+		d = &fakeDatabase{count: 5}
+		srv = echo.New()
+		srv.Use(func(fn echo.HandlerFunc) echo.HandlerFunc {
+			return func(ctx echo.Context) error {
+				ctx.Set(constants.DatabaseContextKey, d)
+				return fn(ctx)
+			}
+		})
+		Register(srv)
+	})
+
+	It("selects the requested page in the database and reports the total number of payments", func() {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, BasePath+"?limit=2&offset=3", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get(TotalCountHeader)).To(Equal("5"))
+		Expect(d.pages).To(Equal([][2]int{{3, 2}}))
+		Expect(rec.Body.String()).To(ContainSubstring(`"description":"d"`))
+		Expect(rec.Body.String()).To(ContainSubstring(`"description":"e"`))
+	})
+
+	It("lists every payment when no page is requested", func() {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, BasePath, nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(d.pages).To(Equal([][2]int{{0, -1}}))
+	})
+})
+
+var _ = Describe("Updating payments", func() {
+	var (
+		d   *fakeDatabase
+		srv *echo.Echo
+	)
+
+	// update updates a payment, returning the recorded response.
+	update := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, BasePath+"/5cc8c1f9e5ef8e0001d8c4d3", strings.NewReader(`{
+			"amount": 314.15,
+			"beneficiary": {"account_number": "1234", "bank_id": "4321", "name": "John"},
+			"currency": "EUR",
+			"date": "2019-04-30T22:30:00Z",
+			"debtor": {"account_number": "5678", "bank_id": "8765", "name": "Dave"},
+			"description": "Order #1"
+		}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	BeforeEach(func() {
+		d = &fakeDatabase{updateErr: db.ErrPaymentExecuted}
+		srv = echo.New()
+		srv.Use(func(fn echo.HandlerFunc) echo.HandlerFunc {
+			return func(ctx echo.Context) error {
+				ctx.Set(constants.DatabaseContextKey, d)
+				return fn(ctx)
+			}
+		})
+		Register(srv)
+	})
+
+	It("rejects changing the date of executed payments", func() {
+		rec := update()
+		Expect(rec.Code).To(Equal(http.StatusConflict))
+		Expect(rec.Body.String()).To(ContainSubstring(db.ErrPaymentExecuted.Error()))
+	})
+})
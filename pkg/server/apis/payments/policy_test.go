@@ -0,0 +1,34 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package payments
+
+import (
+	"net/http"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/server/apis/apitest"
+)
+
+// allowedRoles maps each route of the Payments API to the default roles allowed to access it.
+var allowedRoles = map[auth.Route][]string{
+	{Method: http.MethodDelete, Path: BasePath + "/:id"}: {auth.RoleAdmin},
+	{Method: http.MethodGet, Path: BasePath}:             {auth.RoleAdmin, auth.RoleOperator, auth.RoleViewer},
+	{Method: http.MethodGet, Path: BasePath + "/:id"}:    {auth.RoleAdmin, auth.RoleOperator, auth.RoleViewer},
+	{Method: http.MethodGet, Path: BasePath + "/events"}: {auth.RoleAdmin, auth.RoleOperator, auth.RoleViewer},
+	{Method: http.MethodPost, Path: BasePath}:            {auth.RoleAdmin, auth.RoleOperator},
+	{Method: http.MethodPut, Path: BasePath + "/:id"}:    {auth.RoleAdmin, auth.RoleOperator},
+}
+
+var _ = apitest.DescribePolicy("payments api", Register, Policy, allowedRoles)
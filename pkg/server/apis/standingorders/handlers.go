@@ -0,0 +1,205 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package standingorders
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/pkg/logging"
+	"github.com/bmcstdio/dojo-payments/pkg/ratelimit"
+	"github.com/bmcstdio/dojo-payments/pkg/tracing"
+)
+
+const (
+	// BasePath is the base path of the Standing Orders API.
+	BasePath = "/standing-orders"
+)
+
+const (
+	// DefaultOccurrencesLimit is the number of upcoming occurrences listed when no limit is specified.
+	DefaultOccurrencesLimit = 10
+	// LimitQueryParam is the name of the query parameter used to limit the number of upcoming occurrences listed.
+	LimitQueryParam = "limit"
+	// MaxOccurrencesLimit is the maximum number of upcoming occurrences that can be listed at once.
+	MaxOccurrencesLimit = 100
+)
+
+// Policy maps each route of the Standing Orders API to the scope required to access it.
+// Standing orders generate payments, and hence are protected by the same scopes as payments.
+var Policy = auth.Policy{
+	{Method: http.MethodGet, Path: BasePath}:                      auth.ScopePaymentsRead,
+	{Method: http.MethodGet, Path: BasePath + "/:id"}:             auth.ScopePaymentsRead,
+	{Method: http.MethodGet, Path: BasePath + "/:id/occurrences"}: auth.ScopePaymentsRead,
+	{Method: http.MethodPost, Path: BasePath}:                     auth.ScopePaymentsWrite,
+	{Method: http.MethodPost, Path: BasePath + "/:id/cancel"}:     auth.ScopePaymentsDelete,
+	{Method: http.MethodPost, Path: BasePath + "/:id/pause"}:      auth.ScopePaymentsWrite,
+	{Method: http.MethodPost, Path: BasePath + "/:id/resume"}:     auth.ScopePaymentsWrite,
+}
+
+// handlers maps each route of the Standing Orders API to the HTTP handler that serves it.
+var handlers = map[auth.Route]echo.HandlerFunc{
+	{Method: http.MethodGet, Path: BasePath}:                      listStandingOrders,
+	{Method: http.MethodGet, Path: BasePath + "/:id"}:             getStandingOrder,
+	{Method: http.MethodGet, Path: BasePath + "/:id/occurrences"}: listOccurrences,
+	{Method: http.MethodPost, Path: BasePath}:                     createStandingOrder,
+	{Method: http.MethodPost, Path: BasePath + "/:id/cancel"}:     transition(cancel, models.StandingOrderStatusActive, models.StandingOrderStatusPaused),
+	{Method: http.MethodPost, Path: BasePath + "/:id/pause"}:      transition(pause, models.StandingOrderStatusActive),
+	{Method: http.MethodPost, Path: BasePath + "/:id/resume"}:     transition(resume, models.StandingOrderStatusPaused),
+}
+
+// Register registers the handlers for the Standing Orders API to the provided Echo instance, requiring the scopes defined by Policy.
+func Register(e *echo.Echo) {
+	for r, fn := range handlers {
+		e.Add(r.Method, r.Path, fn, auth.RequireScope(Policy.Scope(r)), logStandingOrderID)
+	}
+}
+
+// logStandingOrderID is an Echo middleware that includes the ID of the standing order being handled (if any) in every line logged while handling the current request.
+func logStandingOrderID(fn echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		if id := ctx.Param("id"); id != "" {
+			logging.AddFields(ctx, log.Fields{logging.StandingOrderIDField: id})
+		}
+		return fn(ctx)
+	}
+}
+
+// createStandingOrder creates a standing order.
+// The standing order records the client making the request, so that each payment it generates consumes the daily quota of said client (see scheduler.Options.Limiter), and so that the quota cannot be bypassed by creating standing orders instead of payments.
+func createStandingOrder(ctx echo.Context) error {
+	var (
+		err error
+		o   models.StandingOrder
+	)
+	if err := ctx.Bind(&o); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := tracing.Span(ctx.Request().Context(), "StandingOrder.Validate", o.Validate); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	o.Client = ratelimit.ClientKey(ctx.Request().Context(), ctx.RealIP())
+	o, err = ctx.Get(constants.DatabaseContextKey).(db.Database).StandingOrders().CreateStandingOrder(o)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
+	}
+	logging.AddFields(ctx, log.Fields{logging.StandingOrderIDField: o.ID.Hex()})
+	return ctx.JSON(http.StatusCreated, o)
+}
+
+// getStandingOrder gets a standing order by ID.
+func getStandingOrder(ctx echo.Context) error {
+	o, err := findStandingOrder(ctx)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, o)
+}
+
+// listOccurrences lists the dates of the upcoming occurrences of the schedule of a standing order by ID.
+func listOccurrences(ctx echo.Context) error {
+	limit := DefaultOccurrencesLimit
+	if v := ctx.QueryParam(LimitQueryParam); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > MaxOccurrencesLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("the %s must be an integer between 0 and %d", LimitQueryParam, MaxOccurrencesLimit))
+		}
+		limit = n
+	}
+	o, err := findStandingOrder(ctx)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, o.Upcoming(limit))
+}
+
+// listStandingOrders lists standing orders.
+func listStandingOrders(ctx echo.Context) error {
+	r, err := ctx.Get(constants.DatabaseContextKey).(db.Database).StandingOrders().ListStandingOrders()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
+	}
+	return ctx.JSON(http.StatusOK, r)
+}
+
+// transition returns an HTTP handler that applies the provided change to a standing order by ID, provided that its current status is one of the specified ones.
+func transition(fn func(*models.StandingOrder), from ...string) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		o, err := findStandingOrder(ctx)
+		if err != nil {
+			return err
+		}
+		if !contains(from, o.Status) {
+			return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("the standing order is %s", o.Status))
+		}
+		fn(&o)
+		r, err := ctx.Get(constants.DatabaseContextKey).(db.Database).StandingOrders().UpdateStandingOrder(o)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
+		}
+		// The standing order was deleted or modified (e.g. by the scheduler) since it was read.
+		if r.ID.IsZero() {
+			return echo.NewHTTPError(http.StatusConflict, "the standing order was modified concurrently, please retry")
+		}
+		return ctx.JSON(http.StatusOK, r)
+	}
+}
+
+// cancel cancels the provided standing order, which no longer generates payments.
+func cancel(o *models.StandingOrder) {
+	o.NextAt, o.Status = nil, models.StandingOrderStatusCancelled
+}
+
+// pause pauses the provided standing order, which does not generate payments until it is resumed.
+func pause(o *models.StandingOrder) {
+	o.Status = models.StandingOrderStatusPaused
+}
+
+// resume resumes the provided standing order, skipping the occurrences of its schedule which were missed while it was paused.
+func resume(o *models.StandingOrder) {
+	o.Status = models.StandingOrderStatusActive
+	o.SkipUntil(time.Now())
+}
+
+// findStandingOrder returns the standing order whose ID is specified in the path of the current request, or an HTTP error in case it does not exist.
+func findStandingOrder(ctx echo.Context) (models.StandingOrder, error) {
+	o, err := ctx.Get(constants.DatabaseContextKey).(db.Database).StandingOrders().GetStandingOrder(ctx.Param("id"))
+	if err != nil {
+		return models.StandingOrder{}, echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
+	}
+	if o.ID.IsZero() {
+		return models.StandingOrder{}, echo.NewHTTPError(http.StatusNotFound, "standing order not found")
+	}
+	return o, nil
+}
+
+// contains returns whether the provided slice contains the specified value.
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package standingorders
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/bmcstdio/dojo-payments/pkg/constants"
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/pkg/ratelimit"
+)
+
+// fakeDatabase is an implementation of db.Database that stores a single standing order, recording the standing orders created and updated.
+type fakeDatabase struct {
+	db.Database
+	db.StandingOrdersDatabase
+
+	// created are the standing orders created.
+	created []models.StandingOrder
+	// order is the stored standing order, if any.
+	order *models.StandingOrder
+	// stale indicates whether updates fail as if the standing order had been modified concurrently.
+	stale bool
+	// updated are the standing orders updated.
+	updated []models.StandingOrder
+}
+
+func (f *fakeDatabase) CreateStandingOrder(o models.StandingOrder) (models.StandingOrder, error) {
+	o.ID, o.Status = primitive.NewObjectID(), models.StandingOrderStatusActive
+	f.created = append(f.created, o)
+	return o, nil
+}
+
+func (f *fakeDatabase) GetStandingOrder(id string) (models.StandingOrder, error) {
+	if f.order == nil || f.order.ID.Hex() != id {
+		return models.StandingOrder{}, nil
+	}
+	return *f.order, nil
+}
+
+func (f *fakeDatabase) StandingOrders() db.StandingOrdersDatabase {
+	return f
+}
+
+func (f *fakeDatabase) UpdateStandingOrder(o models.StandingOrder) (models.StandingOrder, error) {
+	if f.stale {
+		return models.StandingOrder{}, nil
+	}
+	f.updated = append(f.updated, o)
+	return o, nil
+}
+
+var _ = Describe("Handlers", func() {
+	var (
+		d       *fakeDatabase
+		limiter *ratelimit.Limiter
+		o       models.StandingOrder
+		srv     *echo.Echo
+	)
+
+	BeforeEach(func() {
+		now := time.Now().UTC()
+		next := now.Add(time.Hour)
+		o = models.StandingOrder{
+			ID:       primitive.NewObjectID(),
+			NextAt:   &next,
+			Schedule: models.Schedule{Frequency: models.FrequencyDaily, Start: next},
+			Status:   models.StandingOrderStatusActive,
+		}
+		d = &fakeDatabase{order: &o}
+		limiter = nil
+		srv = echo.New()
+		srv.Use(func(fn echo.HandlerFunc) echo.HandlerFunc {
+			return func(ctx echo.Context) error {
+				ctx.Set(constants.DatabaseContextKey, d)
+				if limiter != nil {
+					ctx.Set(constants.RateLimiterContextKey, limiter)
+				}
+				return fn(ctx)
+			}
+		})
+		Register(srv)
+	})
+
+	// do makes a request with the provided body (if any) to the specified path, returning the recorded response.
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	Describe("creating standing orders", func() {
+		// create creates a daily standing order, returning the recorded response.
+		create := func() *httptest.ResponseRecorder {
+			return do(http.MethodPost, BasePath, `{
+				"payment": {
+					"amount": 314.15,
+					"beneficiary": {"account_number": "1234", "bank_id": "4321", "name": "John"},
+					"currency": "EUR",
+					"debtor": {"account_number": "5678", "bank_id": "8765", "name": "Dave"},
+					"description": "Rent"
+				},
+				"schedule": {"frequency": "daily", "start": "2030-01-01T09:00:00Z"}
+			}`)
+		}
+
+		It("does not consume the daily quota of the client, but records the client", func() {
+			limiter = ratelimit.NewLimiter(ratelimit.Config{Quota: ratelimit.Quota{DailyCount: 1}}, ratelimit.NewMemoryStore())
+			Expect(create().Code).To(Equal(http.StatusCreated))
+			Expect(create().Code).To(Equal(http.StatusCreated))
+			Expect(d.created).To(HaveLen(2))
+			Expect(d.created[0].Client).To(Equal("ip:192.0.2.1"))
+		})
+
+		It("does not allow clients to choose the client recorded in the standing order", func() {
+			rec := do(http.MethodPost, BasePath, `{
+				"client": "principal:acme/alice",
+				"payment": {
+					"amount": 314.15,
+					"beneficiary": {"account_number": "1234", "bank_id": "4321", "name": "John"},
+					"currency": "EUR",
+					"debtor": {"account_number": "5678", "bank_id": "8765", "name": "Dave"},
+					"description": "Rent"
+				},
+				"schedule": {"frequency": "daily", "start": "2030-01-01T09:00:00Z"}
+			}`)
+			Expect(rec.Code).To(Equal(http.StatusCreated))
+			Expect(d.created[0].Client).To(Equal("ip:192.0.2.1"))
+		})
+	})
+
+	DescribeTable("changing the status of standing orders",
+		func(action, from, to string) {
+			o.Status = from
+			rec := do(http.MethodPost, BasePath+"/"+o.ID.Hex()+"/"+action, "")
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(ContainSubstring(`"status":"` + to + `"`))
+			Expect(d.updated).To(HaveLen(1))
+			Expect(d.updated[0].Status).To(Equal(to))
+			if to == models.StandingOrderStatusCancelled {
+				Expect(d.updated[0].NextAt).To(BeNil())
+			}
+		},
+		Entry("pauses active standing orders", "pause", models.StandingOrderStatusActive, models.StandingOrderStatusPaused),
+		Entry("resumes paused standing orders", "resume", models.StandingOrderStatusPaused, models.StandingOrderStatusActive),
+		Entry("cancels active standing orders", "cancel", models.StandingOrderStatusActive, models.StandingOrderStatusCancelled),
+		Entry("cancels paused standing orders", "cancel", models.StandingOrderStatusPaused, models.StandingOrderStatusCancelled),
+	)
+
+	DescribeTable("rejecting invalid changes to the status of standing orders",
+		func(action, from string) {
+			o.Status = from
+			rec := do(http.MethodPost, BasePath+"/"+o.ID.Hex()+"/"+action, "")
+			Expect(rec.Code).To(Equal(http.StatusConflict))
+			Expect(rec.Body.String()).To(ContainSubstring("the standing order is " + from))
+			Expect(d.updated).To(BeEmpty())
+		},
+		Entry("does not pause paused standing orders", "pause", models.StandingOrderStatusPaused),
+		Entry("does not pause cancelled standing orders", "pause", models.StandingOrderStatusCancelled),
+		Entry("does not pause completed standing orders", "pause", models.StandingOrderStatusCompleted),
+		Entry("does not resume active standing orders", "resume", models.StandingOrderStatusActive),
+		Entry("does not resume cancelled standing orders", "resume", models.StandingOrderStatusCancelled),
+		Entry("does not resume completed standing orders", "resume", models.StandingOrderStatusCompleted),
+		Entry("does not cancel cancelled standing orders", "cancel", models.StandingOrderStatusCancelled),
+		Entry("does not cancel completed standing orders", "cancel", models.StandingOrderStatusCompleted),
+	)
+
+	It("skips the occurrences missed while a standing order was paused when resuming it", func() {
+		now := time.Now().UTC()
+		o.Schedule.Start, o.Status = now.AddDate(0, 0, -3).Add(time.Hour), models.StandingOrderStatusPaused
+		Expect(do(http.MethodPost, BasePath+"/"+o.ID.Hex()+"/resume", "").Code).To(Equal(http.StatusOK))
+		Expect(d.updated).To(HaveLen(1))
+		Expect(d.updated[0].NextOccurrence).To(Equal(3))
+		Expect(*d.updated[0].NextAt).NotTo(BeTemporally("<", now))
+	})
+
+	It("reports standing orders which do not exist", func() {
+		rec := do(http.MethodPost, BasePath+"/"+primitive.NewObjectID().Hex()+"/pause", "")
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("reports standing orders modified concurrently", func() {
+		d.stale = true
+		rec := do(http.MethodPost, BasePath+"/"+o.ID.Hex()+"/pause", "")
+		Expect(rec.Code).To(Equal(http.StatusConflict))
+		Expect(rec.Body.String()).To(ContainSubstring("modified concurrently"))
+	})
+})
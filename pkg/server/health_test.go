@@ -0,0 +1,116 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/bmcstdio/dojo-payments/pkg/api"
+	"github.com/bmcstdio/dojo-payments/pkg/events"
+	"github.com/bmcstdio/dojo-payments/pkg/health"
+	"github.com/bmcstdio/dojo-payments/pkg/resilience"
+)
+
+var _ = Describe("Health", func() {
+	var (
+		database *fakeDatabase
+		srv      *APIServer
+	)
+
+	// get makes a request to the specified path, returning the status code and the decoded body of the response.
+	get := func(path string) (int, map[string]interface{}) {
+		rec := httptest.NewRecorder()
+		srv.echo.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		r := make(map[string]interface{})
+		Expect(json.Unmarshal(rec.Body.Bytes(), &r)).To(Succeed())
+		return rec.Code, r
+	}
+
+	BeforeEach(func() {
+		database = &fakeDatabase{online: true}
+		srv = NewAPIServer(database, events.NewBus())
+	})
+
+	It("reports that the API server is alive regardless of its dependencies", func() {
+		database.online = false
+		srv.health.CheckNow(context.Background())
+		c, r := get(LivenessPath)
+		Expect(c).To(Equal(http.StatusOK))
+		Expect(r).To(HaveKeyWithValue("status", health.StatusUp))
+	})
+
+	It("reports that the API server is not ready before dependencies are checked", func() {
+		c, r := get(ReadinessPath)
+		Expect(c).To(Equal(http.StatusServiceUnavailable))
+		Expect(r).To(HaveKeyWithValue("status", health.StatusDown))
+	})
+
+	It("reports readiness and detailed health according to the last checks", func() {
+		srv.health.CheckNow(context.Background())
+		c, _ := get(ReadinessPath)
+		Expect(c).To(Equal(http.StatusOK))
+		c, r := get(HealthPath)
+		Expect(c).To(Equal(http.StatusOK))
+		Expect(r["checks"]).To(HaveKey(databaseCheckName))
+		Expect(r["checks"].(map[string]interface{})[databaseCheckName]).To(HaveKeyWithValue("status", health.StatusUp))
+		Expect(r["checks"].(map[string]interface{})[databaseCheckName]).To(HaveKey("latency_ms"))
+		_, r = get("/")
+		Expect(r).To(HaveKeyWithValue("database_status", api.DatabaseStatusOnline))
+
+		// Take the database offline, and make sure that the cached results are reported until the next check.
+		database.online = false
+		c, _ = get(ReadinessPath)
+		Expect(c).To(Equal(http.StatusOK))
+		srv.health.CheckNow(context.Background())
+		c, r = get(HealthPath)
+		Expect(c).To(Equal(http.StatusServiceUnavailable))
+		Expect(r["checks"].(map[string]interface{})[databaseCheckName]).To(HaveKeyWithValue("error", "the database is offline"))
+		_, r = get("/")
+		Expect(r).To(HaveKeyWithValue("database_status", api.DatabaseStatusOffline))
+	})
+	It("reports that the API server is not ready once it is shutting down", func() {
+		srv.health.CheckNow(context.Background())
+		c, _ := get(ReadinessPath)
+		Expect(c).To(Equal(http.StatusOK))
+		Expect(srv.Shutdown(context.Background())).To(Succeed())
+		c, r := get(ReadinessPath)
+		Expect(c).To(Equal(http.StatusServiceUnavailable))
+		Expect(r).To(HaveKeyWithValue("status", health.StatusDown))
+		c, _ = get(LivenessPath)
+		Expect(c).To(Equal(http.StatusOK))
+		Expect(srv.ctx.Err()).To(Equal(context.Canceled))
+	})
+
+	It("reports the state of the circuit breaker protecting the database without affecting readiness", func() {
+		b := resilience.NewBreaker(resilience.BreakerOptions{Cooldown: time.Minute, FailureThreshold: 1})
+		srv = NewAPIServer(database, events.NewBus(), WithCircuitBreaker(b))
+		srv.health.CheckNow(context.Background())
+		_, r := get(HealthPath)
+		Expect(r["info"]).To(HaveKeyWithValue(databaseCircuitBreakerInfoName, string(resilience.StateClosed)))
+		done, err := b.Allow()
+		Expect(err).NotTo(HaveOccurred())
+		done(true)
+		c, r := get(HealthPath)
+		Expect(c).To(Equal(http.StatusOK))
+		Expect(r["info"]).To(HaveKeyWithValue(databaseCircuitBreakerInfoName, string(resilience.StateOpen)))
+	})
+})
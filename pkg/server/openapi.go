@@ -0,0 +1,445 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bmcstdio/dojo-payments/pkg/api"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/pkg/health"
+	"github.com/bmcstdio/dojo-payments/pkg/openapi"
+	"github.com/bmcstdio/dojo-payments/pkg/server/apis/apikeys"
+	"github.com/bmcstdio/dojo-payments/pkg/server/apis/graphql"
+	"github.com/bmcstdio/dojo-payments/pkg/server/apis/payments"
+	"github.com/bmcstdio/dojo-payments/pkg/server/apis/standingorders"
+)
+
+const (
+	// OpenAPIPath is the path at which the OpenAPI document describing the API server is served.
+	OpenAPIPath = "/openapi.json"
+)
+
+// newOpenAPIDocument returns the OpenAPI document describing every route served by the API server.
+func newOpenAPIDocument() *openapi.Document {
+	d := openapi.NewDocument(openapi.Info{
+		Title:       "dojo-payments",
+		Description: "An API for creating, listing, updating and deleting payments.",
+		Version:     "1.0.0",
+	})
+
+	// Schemas and parameters shared by several operations.
+	errorResponse := openapi.Response{
+		Description: "An error has occurred.",
+		Content:     openapi.JSON(d.SchemaOf(api.ErrorResponse{})),
+	}
+	idParameter := openapi.Parameter{
+		Name:        "id",
+		In:          "path",
+		Description: "The ID of the payment.",
+		Required:    true,
+		Schema:      &openapi.Schema{Type: "string"},
+	}
+	paymentRequestBody := &openapi.RequestBody{
+		Required: true,
+		Content:  openapi.JSON(d.SchemaOf(models.Payment{})),
+	}
+
+	// Root handler.
+	d.AddOperation(http.MethodGet, "/", &openapi.Operation{
+		OperationID: "getStatus",
+		Summary:     "Gets the status of the API server and of the database.",
+		Responses: map[string]openapi.Response{
+			"200": {
+				Description: "The status of the API server and of the database.",
+				Content:     openapi.JSON(d.SchemaOf(api.APIServerRootResponse{})),
+			},
+		},
+	})
+	d.AddOperation(http.MethodGet, LivenessPath, &openapi.Operation{
+		OperationID: "getLiveness",
+		Summary:     "Reports that the API server is alive.",
+		Responses: map[string]openapi.Response{
+			"200": {
+				Description: "The API server is alive.",
+				Content:     openapi.JSON(d.SchemaOf(health.Report{})),
+			},
+		},
+	})
+	d.AddOperation(http.MethodGet, ReadinessPath, &openapi.Operation{
+		OperationID: "getReadiness",
+		Summary:     "Reports whether the API server is ready to serve requests (i.e. whether all of its dependencies are healthy).",
+		Responses: map[string]openapi.Response{
+			"200": {
+				Description: "The API server is ready to serve requests.",
+				Content:     openapi.JSON(d.SchemaOf(health.Report{})),
+			},
+			"503": {
+				Description: "The API server is not ready to serve requests.",
+				Content:     openapi.JSON(d.SchemaOf(health.Report{})),
+			},
+		},
+	})
+	d.AddOperation(http.MethodGet, HealthPath, &openapi.Operation{
+		OperationID: "getHealth",
+		Summary:     "Reports the health of each of the API server's dependencies, as of the last time it was checked.",
+		Responses: map[string]openapi.Response{
+			"200": {
+				Description: "All of the API server's dependencies are healthy.",
+				Content:     openapi.JSON(d.SchemaOf(health.Report{})),
+			},
+			"503": {
+				Description: "At least one of the API server's dependencies is not healthy.",
+				Content:     openapi.JSON(d.SchemaOf(health.Report{})),
+			},
+		},
+	})
+	d.AddOperation(http.MethodGet, OpenAPIPath, &openapi.Operation{
+		OperationID: "getOpenAPIDocument",
+		Summary:     "Gets the OpenAPI document describing the API server.",
+		Responses: map[string]openapi.Response{
+			"200": {
+				Description: "The OpenAPI document describing the API server.",
+				Content:     openapi.JSON(&openapi.Schema{Type: "object"}),
+			},
+		},
+	})
+
+	// Payments API.
+	d.AddOperation(http.MethodPost, payments.BasePath, &openapi.Operation{
+		OperationID: "createPayment",
+		Summary:     "Creates a payment.",
+		RequestBody: paymentRequestBody,
+		Responses: map[string]openapi.Response{
+			"201": {
+				Description: "The payment has been created.",
+				Content:     openapi.JSON(d.SchemaOf(models.Payment{})),
+			},
+			"400": errorResponse,
+			"500": errorResponse,
+		},
+	})
+	d.AddOperation(http.MethodGet, payments.BasePath, &openapi.Operation{
+		OperationID: "listPayments",
+		Summary:     "Lists all registered payments, optionally selecting a single page of them.",
+		Parameters: []openapi.Parameter{
+			{
+				Name:        payments.LimitQueryParam,
+				In:          "query",
+				Description: "The maximum number of payments to list.",
+				Schema:      &openapi.Schema{Type: "integer", Format: "int32"},
+			},
+			{
+				Name:        payments.OffsetQueryParam,
+				In:          "query",
+				Description: "The number of payments to skip.",
+				Schema:      &openapi.Schema{Type: "integer", Format: "int32"},
+			},
+		},
+		Responses: map[string]openapi.Response{
+			"200": {
+				Description: "The list of registered payments. The total number of payments is returned in the " + payments.TotalCountHeader + " header.",
+				Content:     openapi.JSON(d.SchemaOf([]models.Payment{})),
+			},
+			"400": errorResponse,
+			"500": errorResponse,
+		},
+	})
+	d.AddOperation(http.MethodGet, payments.BasePath+"/events", &openapi.Operation{
+		OperationID: "streamEvents",
+		Summary:     "Streams changes made to payments as server-sent events.",
+		Parameters: []openapi.Parameter{
+			{
+				Name:        "currency",
+				In:          "query",
+				Description: "Only stream events concerning payments made in this currency.",
+				Schema:      &openapi.Schema{Type: "string"},
+			},
+			{
+				Name:        "account",
+				In:          "query",
+				Description: "Only stream events concerning payments involving this account number.",
+				Schema:      &openapi.Schema{Type: "string"},
+			},
+			{
+				Name:        "Last-Event-ID",
+				In:          "header",
+				Description: "The ID of the last event received, used to resume the stream.",
+				Schema:      &openapi.Schema{Type: "string"},
+			},
+		},
+		Responses: map[string]openapi.Response{
+			"200": {
+				Description: "A stream of events, each of which carries an event as its data.",
+				Content: map[string]openapi.MediaType{
+					"text/event-stream": {
+						Schema: d.SchemaOf(models.Event{}),
+					},
+				},
+			},
+			"400": errorResponse,
+			"500": errorResponse,
+		},
+	})
+	d.AddOperation(http.MethodGet, payments.BasePath+"/{id}", &openapi.Operation{
+		OperationID: "getPayment",
+		Summary:     "Gets a payment by ID.",
+		Parameters:  []openapi.Parameter{idParameter},
+		Responses: map[string]openapi.Response{
+			"200": {
+				Description: "The payment with the specified ID.",
+				Content:     openapi.JSON(d.SchemaOf(models.Payment{})),
+			},
+			"404": errorResponse,
+			"500": errorResponse,
+		},
+	})
+	d.AddOperation(http.MethodPut, payments.BasePath+"/{id}", &openapi.Operation{
+		OperationID: "updatePayment",
+		Summary:     "Updates a payment by ID.",
+		Parameters:  []openapi.Parameter{idParameter},
+		RequestBody: paymentRequestBody,
+		Responses: map[string]openapi.Response{
+			"200": {
+				Description: "The payment has been updated.",
+				Content:     openapi.JSON(d.SchemaOf(models.Payment{})),
+			},
+			"400": errorResponse,
+			"404": errorResponse,
+			"409": errorResponse,
+			"500": errorResponse,
+		},
+	})
+	d.AddOperation(http.MethodDelete, payments.BasePath+"/{id}", &openapi.Operation{
+		OperationID: "deletePayment",
+		Summary:     "Deletes a payment by ID.",
+		Parameters:  []openapi.Parameter{idParameter},
+		Responses: map[string]openapi.Response{
+			"204": {
+				Description: "The payment has been deleted.",
+			},
+			"404": errorResponse,
+			"500": errorResponse,
+		},
+	})
+
+	// Standing Orders API.
+	standingOrderIDParameter := openapi.Parameter{
+		Name:        "id",
+		In:          "path",
+		Description: "The ID of the standing order.",
+		Required:    true,
+		Schema:      &openapi.Schema{Type: "string"},
+	}
+	d.AddOperation(http.MethodPost, standingorders.BasePath, &openapi.Operation{
+		OperationID: "createStandingOrder",
+		Summary:     "Creates a standing order, which generates a payment on each occurrence of its schedule.",
+		Description: "Creating a standing order does not consume the daily quota of the client. Instead, each payment generated by the standing order consumes the daily quota of the client that created it on the day it is generated. " +
+			"Occurrences that would exceed the quota are postponed (and retried) until the quota allows them, the generated payments still being dated at the occurrences.",
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content:  openapi.JSON(d.SchemaOf(models.StandingOrder{})),
+		},
+		Responses: map[string]openapi.Response{
+			"201": {
+				Description: "The standing order has been created.",
+				Content:     openapi.JSON(d.SchemaOf(models.StandingOrder{})),
+			},
+			"400": errorResponse,
+			"500": errorResponse,
+		},
+	})
+	d.AddOperation(http.MethodGet, standingorders.BasePath, &openapi.Operation{
+		OperationID: "listStandingOrders",
+		Summary:     "Lists all registered standing orders.",
+		Responses: map[string]openapi.Response{
+			"200": {
+				Description: "The list of registered standing orders.",
+				Content:     openapi.JSON(d.SchemaOf([]models.StandingOrder{})),
+			},
+			"500": errorResponse,
+		},
+	})
+	d.AddOperation(http.MethodGet, standingorders.BasePath+"/{id}", &openapi.Operation{
+		OperationID: "getStandingOrder",
+		Summary:     "Gets a standing order by ID.",
+		Parameters:  []openapi.Parameter{standingOrderIDParameter},
+		Responses: map[string]openapi.Response{
+			"200": {
+				Description: "The standing order with the specified ID.",
+				Content:     openapi.JSON(d.SchemaOf(models.StandingOrder{})),
+			},
+			"404": errorResponse,
+			"500": errorResponse,
+		},
+	})
+	d.AddOperation(http.MethodGet, standingorders.BasePath+"/{id}/occurrences", &openapi.Operation{
+		OperationID: "listStandingOrderOccurrences",
+		Summary:     "Lists the dates of the upcoming occurrences of the schedule of a standing order by ID.",
+		Parameters: []openapi.Parameter{
+			standingOrderIDParameter,
+			{
+				Name:        standingorders.LimitQueryParam,
+				In:          "query",
+				Description: "The maximum number of occurrences to list (" + strconv.Itoa(standingorders.DefaultOccurrencesLimit) + " by default, and at most " + strconv.Itoa(standingorders.MaxOccurrencesLimit) + ").",
+				Schema:      &openapi.Schema{Type: "integer", Format: "int32"},
+			},
+		},
+		Responses: map[string]openapi.Response{
+			"200": {
+				Description: "The dates of the upcoming occurrences, which are empty in case the standing order has been cancelled or completed.",
+				Content:     openapi.JSON(d.SchemaOf([]time.Time{})),
+			},
+			"400": errorResponse,
+			"404": errorResponse,
+			"500": errorResponse,
+		},
+	})
+	for _, t := range []struct {
+		action      string
+		description string
+		summary     string
+	}{
+		{action: "cancel", description: "The standing order has been cancelled.", summary: "Cancels a standing order by ID, which no longer generates payments."},
+		{action: "pause", description: "The standing order has been paused.", summary: "Pauses a standing order by ID, which does not generate payments until it is resumed."},
+		{action: "resume", description: "The standing order has been resumed. Occurrences missed while it was paused are skipped.", summary: "Resumes a paused standing order by ID."},
+	} {
+		d.AddOperation(http.MethodPost, standingorders.BasePath+"/{id}/"+t.action, &openapi.Operation{
+			OperationID: t.action + "StandingOrder",
+			Summary:     t.summary,
+			Parameters:  []openapi.Parameter{standingOrderIDParameter},
+			Responses: map[string]openapi.Response{
+				"200": {
+					Description: t.description,
+					Content:     openapi.JSON(d.SchemaOf(models.StandingOrder{})),
+				},
+				"404": errorResponse,
+				"409": errorResponse,
+				"500": errorResponse,
+			},
+		})
+	}
+
+	// API keys admin API.
+	apiKeyIDParameter := openapi.Parameter{
+		Name:        "id",
+		In:          "path",
+		Description: "The ID of the API key.",
+		Required:    true,
+		Schema:      &openapi.Schema{Type: "string"},
+	}
+	d.AddOperation(http.MethodPost, apikeys.BasePath, &openapi.Operation{
+		OperationID: "createAPIKey",
+		Summary:     "Creates an API key, returning its secret.",
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content:  openapi.JSON(d.SchemaOf(models.APIKey{})),
+		},
+		Responses: map[string]openapi.Response{
+			"201": {
+				Description: "The API key has been created. Its secret is not returned ever again.",
+				Content:     openapi.JSON(d.SchemaOf(apikeys.IssuedAPIKey{})),
+			},
+			"400": errorResponse,
+			"500": errorResponse,
+		},
+	})
+	d.AddOperation(http.MethodGet, apikeys.BasePath, &openapi.Operation{
+		OperationID: "listAPIKeys",
+		Summary:     "Lists all API keys, including revoked ones.",
+		Responses: map[string]openapi.Response{
+			"200": {
+				Description: "The list of API keys.",
+				Content:     openapi.JSON(d.SchemaOf([]models.APIKey{})),
+			},
+			"500": errorResponse,
+		},
+	})
+	d.AddOperation(http.MethodDelete, apikeys.BasePath+"/{id}", &openapi.Operation{
+		OperationID: "revokeAPIKey",
+		Summary:     "Revokes an API key by ID.",
+		Parameters:  []openapi.Parameter{apiKeyIDParameter},
+		Responses: map[string]openapi.Response{
+			"204": {
+				Description: "The API key has been revoked.",
+			},
+			"404": errorResponse,
+			"500": errorResponse,
+		},
+	})
+	d.AddOperation(http.MethodPost, apikeys.BasePath+"/{id}/rotate", &openapi.Operation{
+		OperationID: "rotateAPIKey",
+		Summary:     "Replaces the secret of an API key by ID, returning the new secret.",
+		Parameters:  []openapi.Parameter{apiKeyIDParameter},
+		Responses: map[string]openapi.Response{
+			"200": {
+				Description: "The API key has been rotated. Its previous secret can no longer be used.",
+				Content:     openapi.JSON(d.SchemaOf(apikeys.IssuedAPIKey{})),
+			},
+			"404": errorResponse,
+			"500": errorResponse,
+		},
+	})
+
+	// GraphQL API.
+	graphqlResponse := openapi.Response{
+		Description: "The result of the GraphQL operation.",
+		Content:     openapi.JSON(&openapi.Schema{Type: "object"}),
+	}
+	d.AddOperation(http.MethodGet, graphql.BasePath, &openapi.Operation{
+		OperationID: "executeGraphQLQuery",
+		Summary:     "Executes a GraphQL query provided in the query string.",
+		Parameters: []openapi.Parameter{
+			{
+				Name:     "query",
+				In:       "query",
+				Required: true,
+				Schema:   &openapi.Schema{Type: "string"},
+			},
+			{
+				Name:   "operationName",
+				In:     "query",
+				Schema: &openapi.Schema{Type: "string"},
+			},
+		},
+		Responses: map[string]openapi.Response{
+			"200": graphqlResponse,
+			"400": graphqlResponse,
+		},
+	})
+	d.AddOperation(http.MethodPost, graphql.BasePath, &openapi.Operation{
+		OperationID: "executeGraphQLOperation",
+		Summary:     "Executes a GraphQL query or mutation.",
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content: openapi.JSON(&openapi.Schema{
+				Type: "object",
+				Properties: map[string]*openapi.Schema{
+					"query":         {Type: "string"},
+					"operationName": {Type: "string"},
+					"variables":     {Type: "object"},
+				},
+			}),
+		},
+		Responses: map[string]openapi.Response{
+			"200": graphqlResponse,
+			"400": graphqlResponse,
+		},
+	})
+
+	return d
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/events"
+	"github.com/bmcstdio/dojo-payments/pkg/openapi"
+)
+
+var (
+	// echoPathParamRegexp matches path parameters in Echo's route syntax (e.g. ":id").
+	echoPathParamRegexp = regexp.MustCompile(`:([^/]+)`)
+)
+
+// fakeDatabase is an implementation of db.Database which can only report whether it is online.
+type fakeDatabase struct {
+	db.Database
+
+	// online indicates whether the database is online.
+	online bool
+}
+
+// IsOnline returns a value indicating whether the database is online.
+func (f *fakeDatabase) IsOnline() bool {
+	return f.online
+}
+
+// WithContext returns the database itself.
+func (f *fakeDatabase) WithContext(context.Context) db.Database {
+	return f
+}
+
+var _ = Describe("OpenAPI document", func() {
+	var (
+		srv *APIServer
+	)
+
+	BeforeEach(func() {
+		srv = NewAPIServer(&fakeDatabase{}, events.NewBus())
+	})
+
+	It("describes exactly the routes served by the API server", func() {
+		// Build the set of "METHOD /path" combinations registered in Echo, using OpenAPI's path template syntax.
+		routes := make([]string, 0)
+		for _, r := range srv.echo.Routes() {
+			routes = append(routes, r.Method+" "+echoPathParamRegexp.ReplaceAllString(r.Path, "{$1}"))
+		}
+		// Build the set of "METHOD /path" combinations described in the OpenAPI document.
+		operations := make([]string, 0)
+		for path, item := range newOpenAPIDocument().Paths {
+			for method := range item {
+				operations = append(operations, strings.ToUpper(method)+" "+path)
+			}
+		}
+		Expect(operations).To(ConsistOf(routes))
+	})
+
+	It("references only schemas which are defined", func() {
+		d := newOpenAPIDocument()
+		b, err := json.Marshal(d)
+		Expect(err).NotTo(HaveOccurred())
+		for _, m := range regexp.MustCompile(`"\$ref":"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(string(b), -1) {
+			Expect(d.Components.Schemas).To(HaveKey(m[1]))
+		}
+	})
+
+	It("describes errors the way Echo's error handler sends them", func() {
+		d := newOpenAPIDocument()
+		Expect(d.Components.Schemas).NotTo(HaveKey("HTTPError"))
+		Expect(d.Components.Schemas).To(HaveKey("ErrorResponse"))
+		Expect(d.Components.Schemas["ErrorResponse"].Properties).To(HaveLen(1))
+		Expect(d.Components.Schemas["ErrorResponse"].Properties).To(HaveKey("message"))
+		// Make sure that the schema matches what is actually sent.
+		rec := httptest.NewRecorder()
+		srv.echo.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/payments/foo/bar", nil))
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+		e := map[string]interface{}{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &e)).To(Succeed())
+		Expect(e).To(HaveLen(1))
+		Expect(e).To(HaveKey("message"))
+	})
+
+	It(`is served at "GET /openapi.json"`, func() {
+		rec := httptest.NewRecorder()
+		srv.echo.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, OpenAPIPath, nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		d := openapi.Document{}
+		err := json.Unmarshal(rec.Body.Bytes(), &d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.OpenAPI).To(Equal(openapi.Version))
+		Expect(d.Components.Schemas).To(HaveKey("Payment"))
+		Expect(d.Components.Schemas).To(HaveKey("Entity"))
+		Expect(d.Components.Schemas).To(HaveKey("APIServerRootResponse"))
+	})
+})
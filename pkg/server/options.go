@@ -0,0 +1,95 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/tls"
+
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
+	"github.com/bmcstdio/dojo-payments/pkg/metrics"
+	"github.com/bmcstdio/dojo-payments/pkg/ratelimit"
+	"github.com/bmcstdio/dojo-payments/pkg/resilience"
+)
+
+// apiServerOptions holds the configurable aspects of an APIServer.
+type apiServerOptions struct {
+	// authenticators are the authenticators used to authenticate requests, if any.
+	authenticators []auth.Authenticator
+	// breaker is the circuit breaker protecting the database, if any.
+	breaker *resilience.Breaker
+	// metrics is the set of metrics in which to record observations about HTTP requests, if any.
+	metrics *metrics.Metrics
+	// rateLimiter is the limiter used to enforce rate limits and quotas, if any.
+	rateLimiter *ratelimit.Limiter
+	// roles are the roles assigned to authenticated principals.
+	roles auth.Roles
+	// tlsConfig is the configuration used to serve TLS connections, if any.
+	tlsConfig *tls.Config
+	// tracing indicates whether requests are traced.
+	tracing bool
+}
+
+// APIServerOption configures an APIServer.
+type APIServerOption func(*apiServerOptions)
+
+// WithAuthenticators configures the API server to require every request (other than those made to public routes) to be authenticated using one of the provided authenticators.
+func WithAuthenticators(authenticators ...auth.Authenticator) APIServerOption {
+	return func(o *apiServerOptions) {
+		o.authenticators = append(o.authenticators, authenticators...)
+	}
+}
+
+// WithCircuitBreaker configures the API server to respond with "503 SERVICE UNAVAILABLE" to requests that fail because the provided circuit breaker is open, and to report its state in the health endpoint.
+func WithCircuitBreaker(b *resilience.Breaker) APIServerOption {
+	return func(o *apiServerOptions) {
+		o.breaker = b
+	}
+}
+
+// WithMetrics configures the API server to record metrics about HTTP requests in the provided set of metrics.
+// Metrics are not exposed by the API server itself, but by the metrics server (see metrics.Metrics.NewServer).
+func WithMetrics(m *metrics.Metrics) APIServerOption {
+	return func(o *apiServerOptions) {
+		o.metrics = m
+	}
+}
+
+// WithRateLimiter configures the API server to enforce rate limits and quotas using the provided limiter.
+func WithRateLimiter(limiter *ratelimit.Limiter) APIServerOption {
+	return func(o *apiServerOptions) {
+		o.rateLimiter = limiter
+	}
+}
+
+// WithRoles configures the roles assigned to authenticated principals, replacing the default ones.
+func WithRoles(roles auth.Roles) APIServerOption {
+	return func(o *apiServerOptions) {
+		o.roles = roles
+	}
+}
+
+// WithTLS configures the API server to serve TLS connections using the provided configuration.
+func WithTLS(config *tls.Config) APIServerOption {
+	return func(o *apiServerOptions) {
+		o.tlsConfig = config
+	}
+}
+
+// WithTracing configures the API server to trace requests, as well as the storage operations performed while handling them.
+func WithTracing() APIServerOption {
+	return func(o *apiServerOptions) {
+		o.tracing = true
+	}
+}
@@ -15,6 +15,10 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -22,76 +26,252 @@ import (
 	"github.com/labstack/echo/middleware"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/bmcstdio/dojo-payments/pkg/api"
+	"github.com/bmcstdio/dojo-payments/pkg/auth"
 	"github.com/bmcstdio/dojo-payments/pkg/constants"
 	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/events"
+	"github.com/bmcstdio/dojo-payments/pkg/health"
+	"github.com/bmcstdio/dojo-payments/pkg/logging"
+	"github.com/bmcstdio/dojo-payments/pkg/resilience"
+	"github.com/bmcstdio/dojo-payments/pkg/server/apis/apikeys"
+	"github.com/bmcstdio/dojo-payments/pkg/server/apis/graphql"
 	"github.com/bmcstdio/dojo-payments/pkg/server/apis/payments"
+	"github.com/bmcstdio/dojo-payments/pkg/server/apis/standingorders"
+	"github.com/bmcstdio/dojo-payments/pkg/tracing"
 )
 
 const (
-	// DatabaseStatusOffline indicates that the database cannot be reached.
-	DatabaseStatusOffline = "OFFLINE"
-	// DatabaseStatusOnline indicates that the database can be reached.
-	DatabaseStatusOnline = "ONLINE"
+	// HealthPath is the path at which the detailed health of the API server and of its dependencies is reported.
+	HealthPath = "/health"
+	// LivenessPath is the path at which the API server reports that it is alive.
+	LivenessPath = "/healthz"
+	// ReadinessPath is the path at which the API server reports whether it is ready to serve requests.
+	ReadinessPath = "/readyz"
 )
 
-// APIServerRootResponse represents a response returned by the root handler.
-type APIServerRootResponse struct {
-	// DatabaseStatus is the current status of the database.
-	DatabaseStatus string `json:"database_status"`
-	// Timestamp is the current timestamp.
-	Timestamp time.Time `json:"time"`
-}
+const (
+	// databaseCheckName is the name of the health check of the database.
+	databaseCheckName = "database"
+	// databaseCircuitBreakerInfoName is the name under which the state of the circuit breaker protecting the database is reported.
+	databaseCircuitBreakerInfoName = "database_circuit_breaker"
+)
 
 // APIServer serves APIs such as the Payments API.
 type APIServer struct {
+	// cancel stops the API server's background workers.
+	cancel context.CancelFunc
+	// ctx is the context within which the API server's background workers run.
+	ctx context.Context
 	// echo is the instance of Echo that powers the API server.
 	echo *echo.Echo
+	// health is the checker used to check the health of the API server's dependencies.
+	health *health.Checker
+	// tlsConfig is the configuration used to serve TLS connections, if any.
+	tlsConfig *tls.Config
+}
+
+// publicPaths are the paths which can be accessed without authenticating.
+var publicPaths = map[string]bool{
+	"/":           true,
+	HealthPath:    true,
+	LivenessPath:  true,
+	OpenAPIPath:   true,
+	ReadinessPath: true,
 }
 
-// NewAPIServer returns a new instance of the API server that uses the specified database for storage.
-func NewAPIServer(database db.Database) *APIServer {
+// isPublic returns a value indicating whether the route being requested can be accessed without authenticating.
+func isPublic(ctx echo.Context) bool {
+	return publicPaths[ctx.Path()]
+}
+
+// NewAPIServer returns a new instance of the API server that uses the specified database for storage and publishes events to the specified bus.
+func NewAPIServer(database db.Database, bus *events.Bus, opts ...APIServerOption) *APIServer {
+	// Apply the provided options.
+	o := &apiServerOptions{
+		roles: auth.DefaultRoles,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
 	// Create a new instance of the API server.
+	ctx, cancel := context.WithCancel(context.Background())
 	s := &APIServer{
-		echo: echo.New(),
+		cancel: cancel,
+		ctx:    ctx,
+		echo:   echo.New(),
+		health: health.NewChecker(map[string]health.Check{
+			databaseCheckName: func(ctx context.Context) error {
+				if !database.WithContext(ctx).IsOnline() {
+					return errors.New("the database is offline")
+				}
+				return nil
+			},
+		}, constants.HealthCheckTimeout),
+		tlsConfig: o.tlsConfig,
+	}
+	// Report the state of the circuit breaker protecting the database, if any.
+	if o.breaker != nil {
+		s.health.AddInfo(databaseCircuitBreakerInfoName, func() string {
+			return string(o.breaker.State())
+		})
 	}
-	// Register the root handler.
+	// Register the root handler, which reports the cached status of the database.
 	s.echo.Add(http.MethodGet, "/", func(ctx echo.Context) error {
 		var (
 			status string
 		)
-		if ctx.Get(constants.DatabaseContextKey).(db.Database).IsOnline() {
-			status = DatabaseStatusOnline
+		if s.IsDatabaseOnline() {
+			status = api.DatabaseStatusOnline
 		} else {
-			status = DatabaseStatusOffline
+			status = api.DatabaseStatusOffline
 		}
-		return ctx.JSON(http.StatusOK, APIServerRootResponse{
+		return ctx.JSON(http.StatusOK, api.APIServerRootResponse{
 			DatabaseStatus: status,
 			Timestamp:      time.Now(),
 		})
 	})
+	// Register the handlers that report the health of the API server.
+	s.echo.Add(http.MethodGet, LivenessPath, func(ctx echo.Context) error {
+		return ctx.JSON(http.StatusOK, health.Report{
+			Status: health.StatusUp,
+		})
+	})
+	s.echo.Add(http.MethodGet, ReadinessPath, func(ctx echo.Context) error {
+		r := s.health.Report()
+		return ctx.JSON(statusCode(r), health.Report{
+			Status: r.Status,
+		})
+	})
+	s.echo.Add(http.MethodGet, HealthPath, func(ctx echo.Context) error {
+		r := s.health.Report()
+		return ctx.JSON(statusCode(r), r)
+	})
+	// Register the handler that serves the OpenAPI document describing the API server.
+	spec := newOpenAPIDocument()
+	s.echo.Add(http.MethodGet, OpenAPIPath, func(ctx echo.Context) error {
+		return ctx.JSON(http.StatusOK, spec)
+	})
 	// Disable Echo's banner.
 	s.echo.HideBanner = true
 	// Disable Echo's initial message.
 	s.echo.HidePort = true
-	// Activate logging of HTTP requests.
-	s.echo.Use(middleware.Logger())
+	// Record metrics about HTTP requests, if metrics are enabled.
+	if o.metrics != nil {
+		s.echo.Use(o.metrics.Middleware())
+	}
 	// Assign an ID to each HTTP request.
 	s.echo.Use(middleware.RequestID())
+	// Trace requests, if tracing is enabled.
+	if o.tracing {
+		s.echo.Use(tracing.Middleware())
+	}
+	// Activate logging of HTTP requests, making a request-scoped logger available in each request's context.
+	s.echo.Use(logging.Middleware())
+	// Respond with "503 SERVICE UNAVAILABLE" while the circuit breaker protecting the database is open, if any.
+	if o.breaker != nil {
+		s.echo.Use(resilience.Middleware())
+	}
+	// Rate-limit requests made to non-public routes per IP address before authenticating them, so that credentials cannot be guessed at an unlimited rate.
+	if o.rateLimiter != nil {
+		s.echo.Use(o.rateLimiter.IPMiddleware(isPublic))
+	}
+	// Authenticate requests made to non-public routes, if authentication is enabled.
+	if len(o.authenticators) > 0 {
+		s.echo.Use(auth.Middleware(isPublic, o.roles, o.authenticators...))
+	}
+	// Rate-limit requests, if rate limiting is enabled.
+	if o.rateLimiter != nil {
+		s.echo.Use(o.rateLimiter.Middleware())
+	}
 	// Add the database to the context so that HTTP handlers can use it to actually store data.
+	// The database is scoped to the tenant of the authenticated principal (if any) so that data belonging to other tenants can never be accessed.
+	s.echo.Use(func(fn echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			d := database
+			if t := auth.TenantFromContext(ctx.Request().Context()); t != "" {
+				v, err := database.ForTenant(t)
+				if err != nil {
+					return echo.NewHTTPError(http.StatusForbidden, err.Error())
+				}
+				d = v
+			}
+			// Perform storage operations within the request's context so that they are traced and logged as part of it.
+			d = d.WithContext(ctx.Request().Context())
+			ctx.Set(constants.DatabaseContextKey, d)
+			return fn(ctx)
+		}
+	})
+	// Add the event bus to the context so that HTTP handlers can use it to publish and subscribe to events.
 	s.echo.Use(func(fn echo.HandlerFunc) echo.HandlerFunc {
 		return func(ctx echo.Context) error {
-			ctx.Set(constants.DatabaseContextKey, database)
+			ctx.Set(constants.EventBusContextKey, bus)
 			return fn(ctx)
 		}
 	})
 	// Register the Payments API.
 	payments.Register(s.echo)
+	// Register the Standing Orders API.
+	standingorders.Register(s.echo)
+	// Register the GraphQL API.
+	graphql.Register(s.echo)
+	// Register the API keys admin API.
+	apikeys.Register(s.echo)
 	// Return the instance of the API server to the caller.
 	return s
 }
 
-// Run runs the API server at the specified address.
+// Drain causes the API server to report that it is not ready to serve requests, so that load balancers stop routing new requests to it.
+// Requests continue to be served until Shutdown is called.
+func (srv *APIServer) Drain() {
+	srv.health.Drain()
+}
+
+// IsDatabaseOnline returns a value indicating whether the database was online as of the last check of the health of the API server's dependencies, without checking it again.
+func (srv *APIServer) IsDatabaseOnline() bool {
+	return srv.health.Result(databaseCheckName).Status == health.StatusUp
+}
+
+// Run runs the API server at the specified address, serving TLS connections if configured to do so.
+// The health of the API server's dependencies is checked in the background while it runs.
+// Run returns nil once the API server has been shut down.
 func (srv *APIServer) Run(bindAddress string) error {
-	log.Infof("starting the api server at %s", bindAddress)
-	return srv.echo.Start(bindAddress)
+	go srv.health.Run(srv.ctx, constants.HealthCheckInterval)
+	var (
+		err error
+	)
+	if srv.tlsConfig != nil {
+		log.Infof("starting the api server at %s (tls)", bindAddress)
+		srv.echo.TLSServer.Addr = bindAddress
+		srv.echo.TLSServer.TLSConfig = srv.tlsConfig
+		err = srv.echo.StartServer(srv.echo.TLSServer)
+	} else {
+		log.Infof("starting the api server at %s", bindAddress)
+		err = srv.echo.Start(bindAddress)
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Shutdown gracefully shuts down the API server.
+// The API server stops reporting that it is ready, stops its background workers and stops accepting connections, and then waits for in-flight requests to complete.
+// Remaining connections are forcibly closed in case in-flight requests do not complete before the provided context is done.
+func (srv *APIServer) Shutdown(ctx context.Context) error {
+	srv.Drain()
+	srv.cancel()
+	if err := srv.echo.Shutdown(ctx); err != nil {
+		srv.echo.Close()
+		return fmt.Errorf("failed to drain in-flight requests: %v", err)
+	}
+	return nil
+}
+
+// statusCode returns the HTTP status code corresponding to the provided health report.
+func statusCode(r health.Report) int {
+	if r.Status == health.StatusUp {
+		return http.StatusOK
+	}
+	return http.StatusServiceUnavailable
 }
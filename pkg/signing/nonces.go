@@ -0,0 +1,69 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signing
+
+import (
+	"sync"
+	"time"
+)
+
+// NonceCache remembers the nonces of signed requests so that replayed requests can be detected.
+type NonceCache interface {
+	// Add records the specified nonce until the specified time, returning false in case it had already been recorded.
+	Add(nonce string, until time.Time) bool
+}
+
+// memoryNonceCache is an implementation of NonceCache that keeps nonces in memory.
+type memoryNonceCache struct {
+	// lock protects nonces.
+	lock sync.Mutex
+	// nonces maps each recorded nonce to the time until which it is recorded.
+	nonces map[string]time.Time
+	// now returns the current time.
+	now func() time.Time
+	// pruned is the time at which expired nonces were last removed.
+	pruned time.Time
+}
+
+// NewMemoryNonceCache returns a new NonceCache that keeps nonces in memory.
+// Nonces are only remembered by the current instance of the API server, so requests replayed against other instances (e.g. behind a load balancer) are not detected.
+// Deployments running multiple instances should provide a NonceCache backed by shared storage instead.
+func NewMemoryNonceCache() NonceCache {
+	return &memoryNonceCache{
+		nonces: make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+// Add records the specified nonce until the specified time, returning false in case it had already been recorded.
+func (c *memoryNonceCache) Add(nonce string, until time.Time) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := c.now()
+	// Remove expired nonces every once in a while so that the cache does not grow indefinitely.
+	if now.Sub(c.pruned) > time.Minute {
+		for n, t := range c.nonces {
+			if now.After(t) {
+				delete(c.nonces, n)
+			}
+		}
+		c.pruned = now
+	}
+	if t, ok := c.nonces[nonce]; ok && !now.After(t) {
+		return false
+	}
+	c.nonces[nonce] = until
+	return true
+}
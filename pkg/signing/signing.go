@@ -0,0 +1,214 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signing
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Algorithm is the name of the algorithm used to sign requests, which is also used as the authentication scheme.
+	Algorithm = "DP-HMAC-SHA256"
+	// ContentSHA256Header is the name of the header containing the hex-encoded SHA-256 digest of the request's body.
+	ContentSHA256Header = "X-DP-Content-SHA256"
+	// DateHeader is the name of the header containing the time at which the request was signed, in RFC3339 format.
+	DateHeader = "X-DP-Date"
+	// NonceHeader is the name of the header containing the random value that uniquely identifies the request.
+	NonceHeader = "X-DP-Nonce"
+)
+
+const (
+	// hostHeader is the name of the pseudo-header that can be used to sign the host to which the request is made.
+	hostHeader = "host"
+	// keyIDParam is the name of the parameter of the "Authorization" header that contains the ID of the signing key.
+	keyIDParam = "KeyId"
+	// signatureParam is the name of the parameter of the "Authorization" header that contains the hex-encoded signature.
+	signatureParam = "Signature"
+	// signedHeadersParam is the name of the parameter of the "Authorization" header that contains the semicolon-separated list of signed headers.
+	signedHeadersParam = "SignedHeaders"
+)
+
+var (
+	// ErrNotSigned is the error returned by Verify when a request is not signed.
+	ErrNotSigned = errors.New("the request is not signed")
+)
+
+// Sign signs the provided request on behalf of the specified key using the provided secret, as of the specified time.
+// The method, path, query, body and the specified headers of the request are signed, together with a random nonce.
+func Sign(req *http.Request, keyID string, secret []byte, headers []string, now time.Time) error {
+	// Read the request's body so that its digest can be computed, making sure it can be read again.
+	b, err := readBody(req, 0)
+	if err != nil {
+		return err
+	}
+	// Generate the nonce.
+	n := make([]byte, 16)
+	if _, err := rand.Read(n); err != nil {
+		return fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	req.Header.Set(ContentSHA256Header, digest(b))
+	req.Header.Set(DateHeader, now.UTC().Format(time.RFC3339))
+	req.Header.Set(NonceHeader, hex.EncodeToString(n))
+	// Compute and set the signature.
+	h := make([]string, 0, len(headers))
+	for _, v := range headers {
+		h = append(h, strings.ToLower(v))
+	}
+	sort.Strings(h)
+	s := signature(secret, canonicalRequest(req, h))
+	req.Header.Set("Authorization", fmt.Sprintf("%s %s=%s,%s=%s,%s=%s", Algorithm, keyIDParam, keyID, signedHeadersParam, strings.Join(h, ";"), signatureParam, s))
+	return nil
+}
+
+// Verify verifies the signature of the provided request as of the specified time, looking up the secret of the signing key using the provided function.
+// Since the request's body must be read before the request is authenticated, requests whose body is larger than maxBodySize bytes (if positive) are rejected.
+// It returns the ID of the signing key and the nonce of the request, which the caller must check has not been used before.
+// ErrNotSigned is returned in case the request is not signed.
+func Verify(req *http.Request, secret func(keyID string) ([]byte, error), now time.Time, maxSkew time.Duration, maxBodySize int64) (string, string, error) {
+	// Parse the "Authorization" header.
+	keyID, headers, sig, err := parseAuthorization(req.Header.Get("Authorization"))
+	if err != nil {
+		return "", "", err
+	}
+	// Make sure that the request was signed recently enough.
+	d, err := time.Parse(time.RFC3339, req.Header.Get(DateHeader))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid %s header", DateHeader)
+	}
+	if d.Before(now.Add(-maxSkew)) || d.After(now.Add(maxSkew)) {
+		return "", "", errors.New("the request's signing time is too far from the current time")
+	}
+	// Make sure that the nonce is present.
+	n := req.Header.Get(NonceHeader)
+	if n == "" {
+		return "", "", fmt.Errorf("missing %s header", NonceHeader)
+	}
+	// Make sure that the request's body matches its digest.
+	b, err := readBody(req, maxBodySize)
+	if err != nil {
+		return "", "", err
+	}
+	if !hmac.Equal([]byte(digest(b)), []byte(req.Header.Get(ContentSHA256Header))) {
+		return "", "", errors.New("the request's body does not match its digest")
+	}
+	// Check the signature.
+	k, err := secret(keyID)
+	if err != nil {
+		return "", "", err
+	}
+	if !hmac.Equal([]byte(signature(k, canonicalRequest(req, headers))), []byte(sig)) {
+		return "", "", errors.New("invalid signature")
+	}
+	return keyID, n, nil
+}
+
+// canonicalRequest returns the canonical representation of the provided request which is signed, including the specified (lowercase, sorted) headers.
+func canonicalRequest(req *http.Request, headers []string) string {
+	var (
+		b strings.Builder
+	)
+	b.WriteString(Algorithm + "\n")
+	b.WriteString(req.Method + "\n")
+	b.WriteString(req.URL.EscapedPath() + "\n")
+	b.WriteString(req.URL.Query().Encode() + "\n")
+	b.WriteString(req.Header.Get(DateHeader) + "\n")
+	b.WriteString(req.Header.Get(NonceHeader) + "\n")
+	b.WriteString(req.Header.Get(ContentSHA256Header) + "\n")
+	for _, h := range headers {
+		b.WriteString(h + ":" + headerValue(req, h) + "\n")
+	}
+	b.WriteString(strings.Join(headers, ";"))
+	return b.String()
+}
+
+// digest returns the hex-encoded SHA-256 digest of the provided data.
+func digest(b []byte) string {
+	s := sha256.Sum256(b)
+	return hex.EncodeToString(s[:])
+}
+
+// headerValue returns the canonical value of the specified (lowercase) header of the provided request.
+func headerValue(req *http.Request, name string) string {
+	if name == hostHeader {
+		if req.Host != "" {
+			return req.Host
+		}
+		return req.URL.Host
+	}
+	return strings.TrimSpace(strings.Join(req.Header[http.CanonicalHeaderKey(name)], ","))
+}
+
+// parseAuthorization parses the provided value of the "Authorization" header, returning the ID of the signing key, the signed headers and the signature.
+func parseAuthorization(v string) (string, []string, string, error) {
+	if !strings.HasPrefix(v, Algorithm+" ") {
+		return "", nil, "", ErrNotSigned
+	}
+	p := make(map[string]string)
+	for _, kv := range strings.Split(strings.TrimPrefix(v, Algorithm+" "), ",") {
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			return "", nil, "", errors.New("malformed authorization header")
+		}
+		p[strings.TrimSpace(kv[:i])] = strings.TrimSpace(kv[i+1:])
+	}
+	if p[keyIDParam] == "" || p[signatureParam] == "" {
+		return "", nil, "", errors.New("malformed authorization header")
+	}
+	h := make([]string, 0)
+	if v := p[signedHeadersParam]; v != "" {
+		h = strings.Split(v, ";")
+	}
+	if !sort.StringsAreSorted(h) {
+		return "", nil, "", errors.New("malformed authorization header")
+	}
+	return p[keyIDParam], h, p[signatureParam], nil
+}
+
+// readBody reads the body of the provided request (if any), replacing it so that it can be read again.
+// An error is returned in case the body is larger than the specified number of bytes (if positive).
+func readBody(req *http.Request, maxSize int64) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return []byte{}, nil
+	}
+	r := req.Body
+	if maxSize > 0 {
+		r = http.MaxBytesReader(nil, req.Body, maxSize)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %v", err)
+	}
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+// signature returns the hex-encoded HMAC-SHA256 signature of the provided data using the provided secret.
+func signature(secret []byte, data string) string {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(data))
+	return hex.EncodeToString(m.Sum(nil))
+}
@@ -0,0 +1,156 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signing
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+// countingReader is an io.Reader that counts the number of bytes read.
+type countingReader struct {
+	// n is the number of bytes read.
+	n int
+	// r is the underlying reader.
+	r io.Reader
+}
+
+// Read reads from the underlying reader.
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += n
+	return n, err
+}
+
+var _ = Describe("Signing", func() {
+	var (
+		now time.Time
+		req *http.Request
+	)
+
+	// secret returns the secret of the "partner" key.
+	secret := func(id string) ([]byte, error) {
+		if id != "partner" {
+			return nil, errors.New("unknown key")
+		}
+		return []byte("secret"), nil
+	}
+
+	// verify verifies the current request as of the current time.
+	verify := func() error {
+		_, _, err := Verify(req, secret, now, time.Minute, 1024)
+		return err
+	}
+
+	BeforeEach(func() {
+		now = time.Now()
+		req = httptest.NewRequest(http.MethodPut, "https://payments.example.com/payments/1234?foo=bar", strings.NewReader(`{"amount":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		Expect(Sign(req, "partner", []byte("secret"), []string{"Host", "Content-Type"}, now)).To(Succeed())
+	})
+
+	It("accepts correctly signed requests", func() {
+		id, nonce, err := Verify(req, secret, now, time.Minute, 1024)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("partner"))
+		Expect(nonce).To(Equal(req.Header.Get(NonceHeader)))
+		// Make sure that the body can still be read.
+		b, err := ioutil.ReadAll(req.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(Equal(`{"amount":1}`))
+	})
+
+	It("rejects requests whose body is too large without reading it entirely", func() {
+		r := &countingReader{r: strings.NewReader(strings.Repeat("a", 1<<20))}
+		req.Body = ioutil.NopCloser(r)
+		Expect(verify()).To(MatchError(ContainSubstring("too large")))
+		Expect(r.n).To(BeNumerically("<=", 2048))
+	})
+
+	It("reports requests which are not signed", func() {
+		req.Header.Del("Authorization")
+		Expect(verify()).To(Equal(ErrNotSigned))
+	})
+
+	It("rejects requests signed too long ago", func() {
+		now = now.Add(2 * time.Minute)
+		Expect(verify()).To(HaveOccurred())
+	})
+
+	It("rejects requests signed with an unknown key", func() {
+		req.Header.Set("Authorization", strings.Replace(req.Header.Get("Authorization"), "KeyId=partner", "KeyId=other", 1))
+		Expect(verify()).To(HaveOccurred())
+	})
+
+	DescribeTable("rejects tampered requests",
+		func(tamper func(*http.Request)) {
+			tamper(req)
+			Expect(verify()).To(HaveOccurred())
+		},
+		Entry("with a different method", func(req *http.Request) {
+			req.Method = http.MethodDelete
+		}),
+		Entry("with a different path", func(req *http.Request) {
+			req.URL.Path = "/payments/5678"
+		}),
+		Entry("with a different query", func(req *http.Request) {
+			req.URL.RawQuery = "foo=baz"
+		}),
+		Entry("with a different body", func(req *http.Request) {
+			req.Body = ioutil.NopCloser(strings.NewReader(`{"amount":2}`))
+		}),
+		Entry("with a different body and digest", func(req *http.Request) {
+			req.Body = ioutil.NopCloser(strings.NewReader(`{"amount":2}`))
+			req.Header.Set(ContentSHA256Header, digest([]byte(`{"amount":2}`)))
+		}),
+		Entry("with a different signed header", func(req *http.Request) {
+			req.Header.Set("Content-Type", "text/plain")
+		}),
+		Entry("with a different host", func(req *http.Request) {
+			req.Host = "evil.example.com"
+		}),
+		Entry("with a different nonce", func(req *http.Request) {
+			req.Header.Set(NonceHeader, "0000")
+		}),
+		Entry("with fewer signed headers", func(req *http.Request) {
+			req.Header.Set("Authorization", strings.Replace(req.Header.Get("Authorization"), "SignedHeaders=content-type;host", "SignedHeaders=host", 1))
+		}),
+	)
+})
+
+var _ = Describe("Nonce cache", func() {
+	It("detects nonces which have already been recorded", func() {
+		c := NewMemoryNonceCache()
+		until := time.Now().Add(time.Minute)
+		Expect(c.Add("foo", until)).To(BeTrue())
+		Expect(c.Add("foo", until)).To(BeFalse())
+		Expect(c.Add("bar", until)).To(BeTrue())
+	})
+
+	It("forgets expired nonces", func() {
+		c := NewMemoryNonceCache()
+		Expect(c.Add("foo", time.Now().Add(-time.Second))).To(BeTrue())
+		Expect(c.Add("foo", time.Now().Add(time.Minute))).To(BeTrue())
+	})
+})
@@ -0,0 +1,215 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// CipherPolicyCompatible is the cipher policy that additionally allows for CBC cipher suites, for the sake of older clients.
+	CipherPolicyCompatible = "compatible"
+	// CipherPolicyModern is the cipher policy that only allows for forward-secret AEAD cipher suites.
+	CipherPolicyModern = "modern"
+)
+
+var (
+	// cipherSuites maps each cipher policy to the TLS 1.2 cipher suites it allows (TLS 1.3 cipher suites are not configurable).
+	cipherSuites = map[string][]uint16{
+		CipherPolicyCompatible: {
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+		},
+		CipherPolicyModern: {
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		},
+	}
+	// versions maps each supported minimum TLS version to its identifier.
+	versions = map[string]uint16{
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+)
+
+// Options configures the way TLS connections are served.
+type Options struct {
+	// CertFile is the path to the PEM-encoded certificate (chain) to serve.
+	CertFile string
+	// KeyFile is the path to the PEM-encoded private key of the certificate.
+	KeyFile string
+	// ClientCAFile is the path to the PEM-encoded bundle of CAs used to verify client certificates, if any.
+	// Clients are not asked for certificates if empty.
+	ClientCAFile string
+	// MinVersion is the minimum TLS version to accept ("1.2" or "1.3").
+	MinVersion string
+	// CipherPolicy is the policy that determines the cipher suites to accept ("modern" or "compatible").
+	CipherPolicy string
+}
+
+// Reloader serves TLS connections using certificates which are reloaded whenever the files they are read from change.
+type Reloader struct {
+	// base is the configuration on top of which the current certificates are applied.
+	base *tls.Config
+	// opts are the options used to create the current instance.
+	opts Options
+
+	// lock protects the fields below.
+	lock sync.RWMutex
+	// cert is the current certificate.
+	cert *tls.Certificate
+	// clientCAs is the current pool of CAs used to verify client certificates, if any.
+	clientCAs *x509.CertPool
+	// modTimes are the modification times of the files as of when they were last loaded.
+	modTimes map[string]time.Time
+}
+
+// NewReloader returns a new Reloader configured using the provided options, loading the certificates for the first time.
+func NewReloader(opts Options) (*Reloader, error) {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, errors.New("both a certificate file and a key file must be provided")
+	}
+	v, ok := versions[opts.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported minimum tls version %q", opts.MinVersion)
+	}
+	c, ok := cipherSuites[opts.CipherPolicy]
+	if !ok {
+		return nil, fmt.Errorf("unsupported cipher policy %q", opts.CipherPolicy)
+	}
+	r := &Reloader{
+		base: &tls.Config{
+			CipherSuites: c,
+			MinVersion:   v,
+		},
+		opts: opts,
+	}
+	if opts.ClientCAFile != "" {
+		r.base.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Config returns the TLS configuration to use to serve connections, which always uses the current certificates.
+func (r *Reloader) Config() *tls.Config {
+	c := r.base.Clone()
+	c.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.lock.RLock()
+		defer r.lock.RUnlock()
+		v := r.base.Clone()
+		v.Certificates = []tls.Certificate{*r.cert}
+		v.ClientCAs = r.clientCAs
+		return v, nil
+	}
+	return c
+}
+
+// Watch checks the certificate files for changes at the specified interval until the provided context is done, reloading them whenever they change.
+// Failing to reload the certificates is logged, and the previous certificates are kept.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.load(); err != nil {
+				log.Errorf("failed to reload tls certificates: %v", err)
+				continue
+			}
+			log.Infof("reloaded tls certificates")
+		}
+	}
+}
+
+// changed returns a value indicating whether any of the certificate files has changed since it was last loaded.
+func (r *Reloader) changed() bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for f, t := range r.modTimes {
+		s, err := os.Stat(f)
+		if err != nil || !s.ModTime().Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// load loads the certificates from the files they are read from.
+func (r *Reloader) load() error {
+	m := make(map[string]time.Time)
+	for _, f := range []string{r.opts.CertFile, r.opts.KeyFile, r.opts.ClientCAFile} {
+		if f == "" {
+			continue
+		}
+		s, err := os.Stat(f)
+		if err != nil {
+			return fmt.Errorf("failed to stat %q: %v", f, err)
+		}
+		m[f] = s.ModTime()
+	}
+	c, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load the certificate: %v", err)
+	}
+	var (
+		p *x509.CertPool
+	)
+	if r.opts.ClientCAFile != "" {
+		b, err := ioutil.ReadFile(r.opts.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read the client ca bundle: %v", err)
+		}
+		p = x509.NewCertPool()
+		if !p.AppendCertsFromPEM(b) {
+			return errors.New("failed to parse the client ca bundle")
+		}
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.cert = &c
+	r.clientCAs = p
+	r.modTimes = m
+	return nil
+}
@@ -0,0 +1,216 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// issue issues a certificate with the specified common name, signed by the provided parent (or self-signed, if nil).
+func issue(cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, ca bool) (*x509.Certificate, *ecdsa.PrivateKey) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	t := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  ca,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		parent, parentKey = t, k
+	}
+	b, err := x509.CreateCertificate(rand.Reader, t, parent, &k.PublicKey, parentKey)
+	Expect(err).NotTo(HaveOccurred())
+	c, err := x509.ParseCertificate(b)
+	Expect(err).NotTo(HaveOccurred())
+	return c, k
+}
+
+// writePEM writes the provided certificate and key (if any) to the specified files.
+func writePEM(c *x509.Certificate, certFile string, k *ecdsa.PrivateKey, keyFile string) {
+	Expect(ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}), 0600)).To(Succeed())
+	if k != nil {
+		b, err := x509.MarshalECPrivateKey(k)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b}), 0600)).To(Succeed())
+	}
+}
+
+var _ = Describe("Reloader", func() {
+	var (
+		ca      *x509.Certificate
+		caKey   *ecdsa.PrivateKey
+		dir     string
+		opts    Options
+		servers *x509.CertPool
+	)
+
+	// handshake performs a TLS handshake with a server using the provided reloader, presenting the provided client certificate (if any).
+	// It returns the certificate presented by the server and the verified chains of the client certificate, as seen by the server.
+	handshake := func(r *Reloader, client *tls.Certificate) (*x509.Certificate, [][]*x509.Certificate, error) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer l.Close()
+		cfg := &tls.Config{
+			RootCAs:    servers,
+			ServerName: "127.0.0.1",
+		}
+		if client != nil {
+			// Present the certificate even if it was not issued by any of the cas the server asks for.
+			cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return client, nil
+			}
+		}
+		ch := make(chan error, 1)
+		chains := make(chan [][]*x509.Certificate, 1)
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				ch <- err
+				return
+			}
+			defer conn.Close()
+			s := tls.Server(conn, r.Config())
+			err = s.Handshake()
+			chains <- s.ConnectionState().VerifiedChains
+			ch <- err
+		}()
+		conn, err := net.Dial("tcp", l.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+		c := tls.Client(conn, cfg)
+		if err := c.Handshake(); err != nil {
+			return nil, nil, err
+		}
+		// With TLS 1.3, client certificates are verified by the server after the client completes the handshake.
+		if err := <-ch; err != nil {
+			return nil, nil, err
+		}
+		return c.ConnectionState().PeerCertificates[0], <-chains, nil
+	}
+
+	BeforeEach(func() {
+		var (
+			err error
+		)
+		dir, err = ioutil.TempDir("", "tlsconfig")
+		Expect(err).NotTo(HaveOccurred())
+		ca, caKey = issue("ca", nil, nil, true)
+		servers = x509.NewCertPool()
+		servers.AddCert(ca)
+		c, k := issue("server-1", ca, caKey, false)
+		opts = Options{
+			CertFile:     filepath.Join(dir, "tls.crt"),
+			KeyFile:      filepath.Join(dir, "tls.key"),
+			ClientCAFile: filepath.Join(dir, "ca.crt"),
+			MinVersion:   "1.2",
+			CipherPolicy: CipherPolicyModern,
+		}
+		writePEM(c, opts.CertFile, k, opts.KeyFile)
+		writePEM(ca, opts.ClientCAFile, nil, "")
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("serves the configured certificate", func() {
+		r, err := NewReloader(opts)
+		Expect(err).NotTo(HaveOccurred())
+		c, _, err := handshake(r, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Subject.CommonName).To(Equal("server-1"))
+	})
+
+	It("reloads the certificate when it changes", func() {
+		r, err := NewReloader(opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.changed()).To(BeFalse())
+		// Replace the certificate, making sure its modification time changes.
+		c, k := issue("server-2", ca, caKey, false)
+		writePEM(c, opts.CertFile, k, opts.KeyFile)
+		later := time.Now().Add(time.Minute)
+		Expect(os.Chtimes(opts.CertFile, later, later)).To(Succeed())
+		Expect(r.changed()).To(BeTrue())
+		Expect(r.load()).To(Succeed())
+		v, _, err := handshake(r, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(v.Subject.CommonName).To(Equal("server-2"))
+	})
+
+	It("verifies client certificates", func() {
+		r, err := NewReloader(opts)
+		Expect(err).NotTo(HaveOccurred())
+		c, k := issue("client", ca, caKey, false)
+		_, chains, err := handshake(r, &tls.Certificate{
+			Certificate: [][]byte{c.Raw},
+			PrivateKey:  k,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chains).NotTo(BeEmpty())
+		Expect(chains[0][0].Subject.CommonName).To(Equal("client"))
+	})
+
+	It("rejects client certificates issued by unknown cas", func() {
+		r, err := NewReloader(opts)
+		Expect(err).NotTo(HaveOccurred())
+		other, otherKey := issue("other-ca", nil, nil, true)
+		c, k := issue("client", other, otherKey, false)
+		_, _, err = handshake(r, &tls.Certificate{
+			Certificate: [][]byte{c.Raw},
+			PrivateKey:  k,
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("accepts clients without certificates", func() {
+		r, err := NewReloader(opts)
+		Expect(err).NotTo(HaveOccurred())
+		_, chains, err := handshake(r, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chains).To(BeEmpty())
+	})
+
+	It("rejects unsupported options", func() {
+		v := opts
+		v.MinVersion = "1.0"
+		_, err := NewReloader(v)
+		Expect(err).To(HaveOccurred())
+		v = opts
+		v.CipherPolicy = "legacy"
+		_, err = NewReloader(v)
+		Expect(err).To(HaveOccurred())
+	})
+})
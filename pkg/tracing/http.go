@@ -0,0 +1,88 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/labstack/echo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware returns an Echo middleware that starts a server span for each request, continuing the trace propagated by the caller (if any).
+// The span is made active in the request's context so that work done while handling the request is traced as part of it.
+// It must be installed after the middleware that assigns IDs to requests.
+func Middleware() echo.MiddlewareFunc {
+	var (
+		once   sync.Once
+		routes map[string]bool
+	)
+	return func(fn echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			// Echo reports the requested path as the path of requests that do not match any route, so only registered routes are used to name spans.
+			// Routes are only collected once the first request is served, as they are registered after middleware is installed.
+			once.Do(func() {
+				routes = make(map[string]bool)
+				for _, r := range ctx.Echo().Routes() {
+					routes[r.Path] = true
+				}
+			})
+			req := ctx.Request()
+			name := req.Method
+			attrs := []attribute.KeyValue{
+				attribute.String("http.request.method", req.Method),
+				attribute.String("url.path", req.URL.Path),
+				attribute.String("http.request.id", ctx.Response().Header().Get(echo.HeaderXRequestID)),
+			}
+			if r := ctx.Path(); routes[r] {
+				name += " " + r
+				attrs = append(attrs, attribute.String("http.route", r))
+			}
+			// Start the server span, continuing the trace propagated by the caller (if any).
+			parent := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			c, span := Tracer().Start(parent, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+			defer span.End()
+			ctx.SetRequest(req.WithContext(c))
+			// Handle the request and record its outcome.
+			err := fn(ctx)
+			s := status(ctx, err)
+			span.SetAttributes(attribute.Int("http.response.status_code", s))
+			if s >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(s))
+				if err != nil {
+					span.RecordError(err)
+				}
+			}
+			return err
+		}
+	}
+}
+
+// status returns the status of the response to the current request.
+// Errors are only turned into responses by Echo's error handler after middleware returns, so the status is derived from them when present.
+func status(ctx echo.Context, err error) int {
+	if err == nil {
+		return ctx.Response().Status
+	}
+	if he, ok := err.(*echo.HTTPError); ok {
+		return he.Code
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ExporterNone indicates that spans are not exported.
+	ExporterNone = "none"
+	// ExporterOTLP indicates that spans are exported to an OTLP collector over gRPC.
+	ExporterOTLP = "otlp"
+	// ExporterStdout indicates that spans are written as JSON to the standard output or to a file.
+	ExporterStdout = "stdout"
+)
+
+const (
+	// instrumentationName is the name of the instrumentation library reported in spans.
+	instrumentationName = "github.com/bmcstdio/dojo-payments"
+	// serviceName is the name of the service reported in spans.
+	serviceName = "dojo-payments"
+)
+
+// Options holds the configurable aspects of tracing.
+type Options struct {
+	// Exporter is the exporter to which spans are sent ("none", "otlp" or "stdout").
+	Exporter string
+	// File is the path to the file to which spans are written when using the "stdout" exporter (the standard output is used if empty).
+	File string
+	// OTLPEndpoint is the "host:port" combination at which the OTLP collector can be reached.
+	OTLPEndpoint string
+	// OTLPInsecure indicates whether to connect to the OTLP collector without TLS.
+	OTLPInsecure bool
+	// SampleRatio is the ratio of traces started by the API server that are sampled.
+	// Traces started by callers are sampled according to the decision of the caller.
+	SampleRatio float64
+}
+
+// Setup installs the global tracer provider and the W3C Trace Context propagator according to the provided options.
+// It returns a function that flushes and stops exporting spans, and that must be called before the process exits.
+func Setup(opts Options) (func(context.Context) error, error) {
+	// Propagate the trace context even if spans are not exported so that traces are not broken.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	var (
+		p sdktrace.SpanProcessor
+	)
+	switch opts.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		o := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.OTLPEndpoint)}
+		if opts.OTLPInsecure {
+			o = append(o, otlptracegrpc.WithInsecure())
+		}
+		e, err := otlptracegrpc.New(context.Background(), o...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create otlp exporter: %v", err)
+		}
+		p = sdktrace.NewBatchSpanProcessor(e)
+	case ExporterStdout:
+		var (
+			w io.Writer = os.Stdout
+		)
+		if opts.File != "" {
+			f, err := os.OpenFile(opts.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open the tracing file: %v", err)
+			}
+			w = f
+		}
+		e, err := stdouttrace.New(stdouttrace.WithWriter(w))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout exporter: %v", err)
+		}
+		// Write spans as soon as they end, as this exporter is meant for testing.
+		p = sdktrace.NewSimpleSpanProcessor(e)
+	default:
+		return nil, fmt.Errorf("unsupported tracing exporter %q", opts.Exporter)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(p),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Tracer returns the tracer used to trace the handling of requests.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Span runs the provided function in a new span with the specified name, child of the span active in the provided context (if any).
+// The error returned by the function (if any) is recorded in the span and returned.
+func Span(ctx context.Context, name string, fn func() error) error {
+	_, span := Tracer().Start(ctx, name)
+	defer span.End()
+	if err := fn(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// traceID is the ID of the trace propagated by callers in tests.
+	traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	// parentSpanID is the ID of the span propagated by callers in tests.
+	parentSpanID = "00f067aa0ba902b7"
+)
+
+var _ = Describe("Tracing", func() {
+	var (
+		e        *echo.Echo
+		recorder *tracetest.SpanRecorder
+	)
+
+	// attributes returns the attributes of the provided span, indexed by key.
+	attributes := func(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+		r := make(map[attribute.Key]attribute.Value)
+		for _, a := range s.Attributes() {
+			r[a.Key] = a.Value
+		}
+		return r
+	}
+
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+		e = echo.New()
+		e.Use(middleware.RequestID())
+		e.Use(Middleware())
+		e.PUT("/payments/:id", func(ctx echo.Context) error {
+			if err := Span(ctx.Request().Context(), "Payment.Validate", func() error { return nil }); err != nil {
+				return err
+			}
+			if ctx.Param("id") == "broken" {
+				return errors.New("boom")
+			}
+			return ctx.NoContent(http.StatusOK)
+		})
+	})
+
+	It("continues the trace propagated by the caller", func() {
+		req := httptest.NewRequest(http.MethodPut, "/payments/1234", nil)
+		req.Header.Set("traceparent", "00-"+traceID+"-"+parentSpanID+"-01")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(2))
+		// The validation span ends first, as a child of the server span.
+		v, s := spans[0], spans[1]
+		Expect(v.Name()).To(Equal("Payment.Validate"))
+		Expect(v.Parent().SpanID()).To(Equal(s.SpanContext().SpanID()))
+		Expect(s.Name()).To(Equal("PUT /payments/:id"))
+		Expect(s.SpanKind()).To(Equal(trace.SpanKindServer))
+		Expect(s.SpanContext().TraceID().String()).To(Equal(traceID))
+		Expect(s.Parent().SpanID().String()).To(Equal(parentSpanID))
+		a := attributes(s)
+		Expect(a["http.route"].AsString()).To(Equal("/payments/:id"))
+		Expect(a["http.request.id"].AsString()).To(Equal(rec.Header().Get(echo.HeaderXRequestID)))
+		Expect(a["http.response.status_code"].AsInt64()).To(Equal(int64(http.StatusOK)))
+	})
+
+	It("marks spans of failed requests as errors", func() {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/payments/broken", nil))
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(2))
+		Expect(spans[1].Status().Code).To(Equal(codes.Error))
+		Expect(attributes(spans[1])["http.response.status_code"].AsInt64()).To(Equal(int64(http.StatusInternalServerError)))
+	})
+
+	It("does not name spans after paths not matching any route", func() {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/foo/bar", nil))
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Name()).To(Equal(http.MethodGet))
+	})
+
+	It("records errors returned within spans", func() {
+		err := Span(httptest.NewRequest(http.MethodGet, "/", nil).Context(), "Payment.Validate", func() error {
+			return errors.New("the amount must be positive")
+		})
+		Expect(err).To(MatchError("the amount must be positive"))
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Status().Code).To(Equal(codes.Error))
+		Expect(spans[0].Events()).To(HaveLen(1))
+	})
+})
@@ -15,23 +15,29 @@
 package e2e
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"net/http"
+	"strconv"
 	"time"
 
-	request "github.com/imroc/req"
-	"github.com/labstack/echo"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 	. "github.com/onsi/gomega/gstruct"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 
+	"github.com/bmcstdio/dojo-payments/pkg/api"
+	"github.com/bmcstdio/dojo-payments/pkg/client"
 	"github.com/bmcstdio/dojo-payments/pkg/db/models"
-	"github.com/bmcstdio/dojo-payments/pkg/server"
 	"github.com/bmcstdio/dojo-payments/pkg/server/apis/payments"
 	"github.com/bmcstdio/dojo-payments/test/e2e/util"
 )
 
 const (
+	// eventStreamTimeout is the maximum amount of time to wait for events to be streamed.
+	eventStreamTimeout = 10 * time.Second
 	// paymentIDFieldName is the name of the "id" field of a Payment object.
 	paymentIDFieldName = "ID"
 )
@@ -40,26 +46,18 @@ var _ = Describe("API Server", func() {
 	When(`receiving a "GET /" HTTP request`, func() {
 		var (
 			err error
-			res *request.Resp
+			res api.APIServerRootResponse
 		)
 
 		BeforeEach(func() {
-			// Make a "GET /" request and make sure no errors have occurred.
-			res, err = request.Get(baseUrl)
+			// Make a "GET /" request and make sure that no errors have occurred (i.e. that "200 OK" was returned).
+			res, err = apiClient.Health(context.Background())
 			Expect(err).NotTo(HaveOccurred())
 		})
 
-		It(`returns "200 OK"`, func() {
-			// Make sure that a "200 OK" response was returned.
-			Expect(res.Response().StatusCode).To(Equal(http.StatusOK))
-		})
-
 		It("returns a value indicating that the database is online", func() {
 			// Make sure that there is a key on the response's body indicating that the database is online.
-			body := server.APIServerRootResponse{}
-			err = res.ToJSON(&body)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(body.DatabaseStatus).To(Equal(server.DatabaseStatusOnline))
+			Expect(res.DatabaseStatus).To(Equal(api.DatabaseStatusOnline))
 		})
 	})
 
@@ -98,14 +96,10 @@ var _ = Describe("API Server", func() {
 						// Apply the transformation function to the base payment object in order to make it invalid.
 						fn(&payment)
 						// Attempt to create the payment and make sure that "400 BAD REQUEST" is returned.
-						res, err := request.Post(baseUrl+payments.BasePath, request.BodyJSON(payment))
-						Expect(err).NotTo(HaveOccurred())
-						Expect(res.Response().StatusCode).To(Equal(http.StatusBadRequest))
+						_, err := apiClient.CreatePayment(context.Background(), payment)
+						Expect(client.IsBadRequest(err)).To(BeTrue())
 						// Make sure that the expected error message was returned.
-						resBody := echo.HTTPError{}
-						err = res.ToJSON(&resBody)
-						Expect(err).NotTo(HaveOccurred())
-						Expect(resBody.Message).To(Equal(expectedErrorMessage))
+						Expect(err.(*client.Error).Message).To(Equal(expectedErrorMessage))
 					},
 
 					// The following entries represent the test cases.
@@ -158,12 +152,9 @@ var _ = Describe("API Server", func() {
 
 			Context("containing a valid payment", func() {
 				It("creates the payment and returns its ID in the response's body", func() {
-					req, err := request.Post(baseUrl+payments.BasePath, request.BodyJSON(payment))
-					Expect(err).NotTo(HaveOccurred())
-					Expect(req.Response().StatusCode).To(Equal(http.StatusCreated))
-					err = req.ToJSON(&payment)
+					created, err := apiClient.CreatePayment(context.Background(), payment)
 					Expect(err).NotTo(HaveOccurred())
-					Expect(payment.ID).NotTo(BeEmpty())
+					Expect(created.ID).NotTo(BeEmpty())
 				})
 			})
 		})
@@ -208,44 +199,34 @@ var _ = Describe("API Server", func() {
 					},
 				}
 
+				var (
+					err error
+				)
+
 				// Create the first payment.
-				res, err := request.Post(baseUrl+payments.BasePath, request.BodyJSON(payment1))
-				Expect(err).NotTo(HaveOccurred())
-				Expect(res.Response().StatusCode).To(Equal(http.StatusCreated))
-				err = res.ToJSON(&payment1)
+				payment1, err = apiClient.CreatePayment(context.Background(), payment1)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(payment1.ID).NotTo(BeEmpty())
 
 				// Create the second payment.
-				res, err = request.Post(baseUrl+payments.BasePath, request.BodyJSON(payment2))
-				Expect(err).NotTo(HaveOccurred())
-				Expect(res.Response().StatusCode).To(Equal(http.StatusCreated))
-				err = res.ToJSON(&payment2)
+				payment2, err = apiClient.CreatePayment(context.Background(), payment2)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(payment2.ID).NotTo(BeEmpty())
 			})
 
 			It("can find an existing payment by its ID", func() {
 				// Try to get one of the payments by its ID and make sure no error has been returned.
-				res, err := request.Get(baseUrl + payments.BasePath + "/" + payment1.ID.Hex())
-				Expect(err).NotTo(HaveOccurred())
-				Expect(res.Response().StatusCode).To(Equal(http.StatusOK))
-				// Decode the response's body and make sure the correct payment has been returned.
-				result := models.Payment{}
-				err = res.ToJSON(&result)
+				result, err := apiClient.GetPayment(context.Background(), payment1.ID.Hex())
 				Expect(err).NotTo(HaveOccurred())
+				// Make sure the correct payment has been returned.
 				Expect(result.ID.Hex()).To(Equal(payment1.ID.Hex()))
 			})
 
 			It("can list all registered payments", func() {
 				// List all registered payments and make sure no error has been returned.
-				res, err := request.Get(baseUrl + payments.BasePath)
-				Expect(err).NotTo(HaveOccurred())
-				Expect(res.Response().StatusCode).To(Equal(http.StatusOK))
-				// Decode the response's body and make sure that both payments have been returned.
-				result := make([]models.Payment, 0)
-				err = res.ToJSON(&result)
+				result, err := apiClient.ListPayments(context.Background()).All()
 				Expect(err).NotTo(HaveOccurred())
+				// Make sure that both payments have been returned.
 				Expect(result).To(ContainElement(MatchFields(IgnoreExtras, Fields{
 					paymentIDFieldName: Equal(payment1.ID),
 				})))
@@ -256,26 +237,19 @@ var _ = Describe("API Server", func() {
 
 			It("can delete a payment by its ID and does not further list it", func() {
 				// Delete the first payment and make sure no error has been returned.
-				res, err := request.Delete(baseUrl + payments.BasePath + "/" + payment1.ID.Hex())
+				err := apiClient.DeletePayment(context.Background(), payment1.ID.Hex())
 				Expect(err).NotTo(HaveOccurred())
-				Expect(res.Response().StatusCode).To(Equal(http.StatusNoContent))
 
 				// Make sure that the first payment can no longer be retrieved by its ID.
-				res, err = request.Get(baseUrl + payments.BasePath + "/" + payment1.ID.Hex())
-				Expect(err).NotTo(HaveOccurred())
-				Expect(res.Response().StatusCode).To(Equal(http.StatusNotFound))
+				_, err = apiClient.GetPayment(context.Background(), payment1.ID.Hex())
+				Expect(client.IsNotFound(err)).To(BeTrue())
 
 				// Make sure that the second payment can still be retrieved by its ID.
-				res, err = request.Get(baseUrl + payments.BasePath + "/" + payment2.ID.Hex())
+				_, err = apiClient.GetPayment(context.Background(), payment2.ID.Hex())
 				Expect(err).NotTo(HaveOccurred())
-				Expect(res.Response().StatusCode).To(Equal(http.StatusOK))
 
 				// Make sure that the first payment is no longer listed, but that the second one is.
-				res, err = request.Get(baseUrl + payments.BasePath)
-				Expect(err).NotTo(HaveOccurred())
-				Expect(res.Response().StatusCode).To(Equal(http.StatusOK))
-				result := make([]models.Payment, 0)
-				err = res.ToJSON(&result)
+				result, err := apiClient.ListPayments(context.Background()).All()
 				Expect(err).NotTo(HaveOccurred())
 				Expect(result).NotTo(ContainElement(MatchFields(IgnoreExtras, Fields{
 					paymentIDFieldName: Equal(payment1.ID),
@@ -292,15 +266,119 @@ var _ = Describe("API Server", func() {
 				payment1.Amount = 1200.41
 				payment1.ID = payment2.ID
 				// Update the first payment and make sure that only the ".amount" field was updated.
-				res, err := request.Put(baseUrl+payments.BasePath+"/"+originalID, request.BodyJSON(payment1))
-				Expect(err).NotTo(HaveOccurred())
-				Expect(res.Response().StatusCode).To(Equal(http.StatusOK))
-				result := models.Payment{}
-				err = res.ToJSON(&result)
+				result, err := apiClient.UpdatePayment(context.Background(), originalID, payment1)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(result.Amount).To(Equal(payment1.Amount))
 				Expect(result.ID.Hex()).To(Equal(originalID))
 			})
+
+			It("refuses to change the date of an executed payment", func() {
+				// The first payment is dated in the past, and hence has been executed when created.
+				Expect(payment1.Status).To(Equal(models.PaymentStatusExecuted))
+				payment1.Date = time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+				_, err := apiClient.UpdatePayment(context.Background(), payment1.ID.Hex(), payment1)
+				Expect(client.IsConflict(err)).To(BeTrue())
+				// Make sure that the payment was left untouched.
+				result, err := apiClient.GetPayment(context.Background(), payment1.ID.Hex())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Date).To(BeTemporally("==", util.MustParseRFC3339Time("2019-04-30T22:30:00Z")))
+				Expect(result.Status).To(Equal(models.PaymentStatusExecuted))
+			})
+
+			It("executes a scheduled payment right away when its date is moved to the past", func() {
+				// Schedule a new payment, and then move its date back to the one of the second payment.
+				p := payment2
+				p.ID = primitive.NilObjectID
+				p.Date = time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+				scheduled, err := apiClient.CreatePayment(context.Background(), p)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(scheduled.Status).To(Equal(models.PaymentStatusScheduled))
+				scheduled.Date = payment2.Date
+				result, err := apiClient.UpdatePayment(context.Background(), scheduled.ID.Hex(), scheduled)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Status).To(Equal(models.PaymentStatusExecuted))
+				Expect(result.ExecutedAt).NotTo(BeNil())
+			})
+		})
+
+		When(`receiving a "GET /payments/events" request`, func() {
+			var (
+				account    string
+				httpClient *http.Client
+				payment    models.Payment
+			)
+
+			BeforeEach(func() {
+				// Use a unique account number so that only events caused by the current test are selected.
+				account = strconv.FormatInt(time.Now().UnixNano(), 10)
+				// Make sure that reading from the event stream does not block forever.
+				httpClient = &http.Client{
+					Timeout: eventStreamTimeout,
+				}
+				payment = models.Payment{
+					Amount:      314.15,
+					Currency:    "EUR",
+					Date:        util.MustParseRFC3339Time("2019-04-30T22:30:00Z"),
+					Description: "Order #1",
+					Beneficiary: models.Entity{
+						AccountNumber: account,
+						BankID:        "4321",
+						Name:          "John",
+					},
+					Debtor: models.Entity{
+						AccountNumber: "5678",
+						BankID:        "8765",
+						Name:          "Dave",
+					},
+				}
+			})
+
+			It("streams an event when a payment is created", func() {
+				// Open the event stream, selecting only events involving the beneficiary's account.
+				stream, err := httpClient.Do(newRequest(http.MethodGet, payments.BasePath+"/events?account="+account, nil))
+				Expect(err).NotTo(HaveOccurred())
+				defer stream.Body.Close()
+				Expect(stream.StatusCode).To(Equal(http.StatusOK))
+
+				// Create the payment.
+				payment, err = apiClient.CreatePayment(context.Background(), payment)
+				Expect(err).NotTo(HaveOccurred())
+
+				// Make sure that the corresponding event has been streamed.
+				e, err := util.ReadServerSentEvent(bufio.NewReader(stream.Body))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(e.Type).To(Equal(string(models.EventTypePaymentCreated)))
+				result := models.Event{}
+				err = json.Unmarshal([]byte(e.Data), &result)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(e.ID).To(Equal(strconv.FormatInt(result.Sequence, 10)))
+				Expect(result.Payment.ID).To(Equal(payment.ID))
+			})
+
+			It("replays missed events when resuming the stream", func() {
+				// Create and then delete the payment.
+				created, err := apiClient.CreatePayment(context.Background(), payment)
+				Expect(err).NotTo(HaveOccurred())
+				err = apiClient.DeletePayment(context.Background(), created.ID.Hex())
+				Expect(err).NotTo(HaveOccurred())
+
+				// Open the event stream as if resuming it from the very beginning.
+				req := newRequest(http.MethodGet, payments.BasePath+"/events?account="+account, nil)
+				req.Header.Set("Last-Event-ID", "0")
+				stream, err := httpClient.Do(req)
+				Expect(err).NotTo(HaveOccurred())
+				defer stream.Body.Close()
+				Expect(stream.StatusCode).To(Equal(http.StatusOK))
+
+				// Make sure that both events have been replayed, in order.
+				r := bufio.NewReader(stream.Body)
+				e, err := util.ReadServerSentEvent(r)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(e.Type).To(Equal(string(models.EventTypePaymentCreated)))
+				e, err = util.ReadServerSentEvent(r)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(e.Type).To(Equal(string(models.EventTypePaymentDeleted)))
+			})
 		})
 	})
 })
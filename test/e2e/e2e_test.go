@@ -16,25 +16,53 @@ package e2e
 
 import (
 	"flag"
+	"io"
+	"net/http"
 	"testing"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/bmcstdio/dojo-payments/pkg/client"
 )
 
 var (
-	baseUrl string
+	baseUrl              string
+	bearerToken          string
+	grpcAddr             string
+	mongodbDatabase      string
+	mongodbReplicaSetURL string
+	otherBearerToken     string
+
+	// apiClient is the client used to interact with the Payments API.
+	apiClient *client.Client
 )
 
 func init() {
 	flag.StringVar(&baseUrl, "base-url", "http://localhost:8080", "the base url at which the api server can be reached")
+	flag.StringVar(&bearerToken, "bearer-token", "", "the bearer token to use when making requests to the api server, if it requires authentication")
+	flag.StringVar(&grpcAddr, "grpc-addr", "localhost:9090", `the "host:port" combination at which the grpc server can be reached`)
+	flag.StringVar(&mongodbDatabase, "mongodb-database", "dojo-payments-e2e", "the name of the mongodb database to use when running tests directly against the replica set identified by --mongodb-replica-set-url")
+	flag.StringVar(&mongodbReplicaSetURL, "mongodb-replica-set-url", "", "the url at which a mongodb replica set can be reached (tests run directly against mongodb, such as transactions tests, are skipped if empty)")
+	flag.StringVar(&otherBearerToken, "other-bearer-token", "", "the bearer token of a principal belonging to a tenant other than the one identified by --bearer-token (tenancy tests are skipped if empty)")
 }
 
 var _ = BeforeSuite(func() {
-	log.Infof("running the end-to-end test suite against the api server at %q", baseUrl)
+	apiClient = client.New(baseUrl, client.WithBearerToken(bearerToken))
+	log.Infof("running the end-to-end test suite against the api server at %q and the grpc server at %q", baseUrl, grpcAddr)
 })
 
+// newRequest returns a new HTTP request to the api server, carrying the bearer token (if any).
+func newRequest(method, path string, body io.Reader) *http.Request {
+	req, err := http.NewRequest(method, baseUrl+path, body)
+	Expect(err).NotTo(HaveOccurred())
+	if bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+bearerToken)
+	}
+	return req
+}
+
 func TestEndToEnd(t *testing.T) {
 	// Parse the provided command-line flags.
 	flag.Parse()
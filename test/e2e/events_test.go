@@ -0,0 +1,105 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package e2e
+
+import (
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+)
+
+var _ = Describe("Events", func() {
+	var (
+		// database is the database to which events are appended.
+		database db.Database
+	)
+
+	// lastSequence returns the sequence number of the last persisted event.
+	lastSequence := func() int64 {
+		r, err := database.Events().ListEvents(0)
+		Expect(err).NotTo(HaveOccurred())
+		if len(r) == 0 {
+			return 0
+		}
+		return r[len(r)-1].Sequence
+	}
+
+	BeforeEach(func() {
+		if mongodbReplicaSetURL == "" {
+			Skip("--mongodb-replica-set-url has not been provided")
+		}
+		var (
+			err error
+		)
+		database, err = db.NewMongoDDatabase(mongodbReplicaSetURL, mongodbDatabase)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(database.Migrations().Migrate(db.LatestMigrationVersion)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		if database != nil {
+			Expect(database.Close()).To(Succeed())
+		}
+	})
+
+	It("are persisted in the order of their sequence numbers when appended concurrently", func() {
+		var (
+			errs = make(chan error, 2)
+			last = lastSequence()
+			n    = 25
+		)
+		start := last
+		// listNew lists the events persisted after the last one seen, checking that none has been skipped.
+		listNew := func() {
+			r, err := database.Events().ListEvents(last)
+			Expect(err).NotTo(HaveOccurred())
+			for _, e := range r {
+				Expect(e.Sequence).To(Equal(last+1), "an event was persisted after one with a greater sequence number")
+				last = e.Sequence
+			}
+		}
+		for i := 0; i < n; i++ {
+			// Interleave two appends while listing the events being persisted.
+			wg := sync.WaitGroup{}
+			for j := 0; j < 2; j++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := database.Events().AppendEvent(models.Event{Type: models.EventTypePaymentCreated})
+					errs <- err
+				}()
+			}
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+			for appending := true; appending; {
+				select {
+				case <-done:
+					appending = false
+				default:
+				}
+				listNew()
+			}
+			Expect(<-errs).NotTo(HaveOccurred())
+			Expect(<-errs).NotTo(HaveOccurred())
+		}
+		Expect(last).To(Equal(start + int64(2*n)))
+	})
+})
@@ -0,0 +1,165 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/bmcstdio/dojo-payments/pkg/server/apis/graphql"
+)
+
+// graphqlResponse represents a response returned by the GraphQL API.
+type graphqlResponse struct {
+	// Data is the result of the operation.
+	Data json.RawMessage `json:"data"`
+	// Errors are the errors that occurred while executing the operation.
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// doGraphQL executes the provided GraphQL operation and returns the status code and the decoded response.
+func doGraphQL(query string, variables map[string]interface{}) (int, graphqlResponse) {
+	b, err := json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	Expect(err).NotTo(HaveOccurred())
+	req := newRequest(http.MethodPost, graphql.BasePath, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	Expect(err).NotTo(HaveOccurred())
+	defer res.Body.Close()
+	r := graphqlResponse{}
+	err = json.NewDecoder(res.Body).Decode(&r)
+	Expect(err).NotTo(HaveOccurred())
+	return res.StatusCode, r
+}
+
+var _ = Describe("GraphQL API", func() {
+	var (
+		account string
+		input   map[string]interface{}
+	)
+
+	BeforeEach(func() {
+		// Use a unique account number so that only payments created by the current test are selected.
+		account = strconv.FormatInt(time.Now().UnixNano(), 10)
+		input = map[string]interface{}{
+			"amount":      314.15,
+			"currency":    "EUR",
+			"date":        "2019-04-30T22:30:00Z",
+			"description": "Order #1",
+			"beneficiary": map[string]interface{}{
+				"account_number": account,
+				"bank_id":        "4321",
+				"name":           "John",
+			},
+			"debtor": map[string]interface{}{
+				"account_number": "5678",
+				"bank_id":        "8765",
+				"name":           "Dave",
+			},
+		}
+	})
+
+	It("supports schema introspection", func() {
+		status, res := doGraphQL(`{ __schema { queryType { name } mutationType { name } } }`, nil)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(res.Errors).To(BeEmpty())
+		Expect(string(res.Data)).To(MatchJSON(`{"__schema":{"queryType":{"name":"Query"},"mutationType":{"name":"Mutation"}}}`))
+	})
+
+	It("rejects invalid payments", func() {
+		input["amount"] = 0
+		status, res := doGraphQL(`mutation($input: PaymentInput!) { createPayment(input: $input) { id } }`, map[string]interface{}{
+			"input": input,
+		})
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(res.Errors).To(HaveLen(1))
+		Expect(res.Errors[0].Message).To(Equal("the amount must be positive"))
+	})
+
+	It("rejects queries which are too complex", func() {
+		status, res := doGraphQL(`{
+			a: payments(limit: 100) { nodes { id beneficiary { name } debtor { name } amount currency date description } }
+			b: payments(limit: 100) { nodes { id beneficiary { name } debtor { name } amount currency date description } }
+		}`, nil)
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(res.Errors).To(HaveLen(1))
+	})
+
+	It("can create, query, update and delete a payment", func() {
+		// Create the payment and grab its ID.
+		status, res := doGraphQL(`mutation($input: PaymentInput!) { createPayment(input: $input) { id } }`, map[string]interface{}{
+			"input": input,
+		})
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(res.Errors).To(BeEmpty())
+		created := struct {
+			CreatePayment struct {
+				ID string `json:"id"`
+			} `json:"createPayment"`
+		}{}
+		Expect(json.Unmarshal(res.Data, &created)).To(Succeed())
+		id := created.CreatePayment.ID
+		Expect(id).NotTo(BeEmpty())
+
+		// Get the payment by its ID, selecting nested fields of the parties.
+		status, res = doGraphQL(`query($id: ID!) { payment(id: $id) { id beneficiary { account_number } debtor { name } } }`, map[string]interface{}{
+			"id": id,
+		})
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(res.Errors).To(BeEmpty())
+		Expect(string(res.Data)).To(MatchJSON(`{"payment":{"id":"` + id + `","beneficiary":{"account_number":"` + account + `"},"debtor":{"name":"Dave"}}}`))
+
+		// List payments involving the beneficiary's account.
+		status, res = doGraphQL(`query($account: String) { payments(account: $account) { total_count nodes { id } } }`, map[string]interface{}{
+			"account": account,
+		})
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(res.Errors).To(BeEmpty())
+		Expect(string(res.Data)).To(MatchJSON(`{"payments":{"total_count":1,"nodes":[{"id":"` + id + `"}]}}`))
+
+		// Update the payment's amount.
+		input["amount"] = 1200.41
+		status, res = doGraphQL(`mutation($id: ID!, $input: PaymentInput!) { updatePayment(id: $id, input: $input) { amount } }`, map[string]interface{}{
+			"id":    id,
+			"input": input,
+		})
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(res.Errors).To(BeEmpty())
+		Expect(string(res.Data)).To(MatchJSON(`{"updatePayment":{"amount":1200.41}}`))
+
+		// Delete the payment and make sure it can no longer be found.
+		status, res = doGraphQL(`mutation($id: ID!) { deletePayment(id: $id) }`, map[string]interface{}{
+			"id": id,
+		})
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(res.Errors).To(BeEmpty())
+		status, res = doGraphQL(`query($id: ID!) { payment(id: $id) { id } }`, map[string]interface{}{
+			"id": id,
+		})
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(string(res.Data)).To(MatchJSON(`{"payment":null}`))
+	})
+})
@@ -0,0 +1,126 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2e
+
+import (
+	"context"
+	"io"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/bmcstdio/dojo-payments/pkg/rpc/apis/payments"
+	"github.com/bmcstdio/dojo-payments/test/e2e/util"
+)
+
+var _ = Describe("gRPC Server", func() {
+	var (
+		client  payments.PaymentsClient
+		conn    *grpc.ClientConn
+		payment *payments.Payment
+	)
+
+	BeforeEach(func() {
+		var (
+			err error
+		)
+		// Connect to the gRPC server.
+		conn, err = grpc.NewClient(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		Expect(err).NotTo(HaveOccurred())
+		client = payments.NewPaymentsClient(conn)
+		// Make sure we start with a valid payment.
+		payment = &payments.Payment{
+			Amount:      314.15,
+			Currency:    "EUR",
+			Date:        timestamppb.New(util.MustParseRFC3339Time("2019-04-30T22:30:00Z")),
+			Description: "Order #1",
+			Beneficiary: &payments.Entity{
+				AccountNumber: "1234",
+				BankId:        "4321",
+				Name:          "John",
+			},
+			Debtor: &payments.Entity{
+				AccountNumber: "5678",
+				BankId:        "8765",
+				Name:          "Dave",
+			},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(conn.Close()).To(Succeed())
+	})
+
+	Context("serving the Payments API", func() {
+		It(`returns "INVALID_ARGUMENT" when creating an invalid payment`, func() {
+			payment.Amount = 0
+			_, err := client.CreatePayment(context.Background(), &payments.CreatePaymentRequest{Payment: payment})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			Expect(status.Convert(err).Message()).To(Equal("the amount must be positive"))
+		})
+
+		It(`returns "INVALID_ARGUMENT" when getting a payment by an invalid ID`, func() {
+			_, err := client.GetPayment(context.Background(), &payments.GetPaymentRequest{Id: "foo"})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+
+		It("can create, get, list, update and delete a payment", func() {
+			// Create the payment and make sure it has been assigned an ID.
+			created, err := client.CreatePayment(context.Background(), &payments.CreatePaymentRequest{Payment: payment})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(created.Id).NotTo(BeEmpty())
+
+			// Get the payment by its ID.
+			res, err := client.GetPayment(context.Background(), &payments.GetPaymentRequest{Id: created.Id})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Id).To(Equal(created.Id))
+			Expect(res.Date.AsTime()).To(Equal(payment.Date.AsTime()))
+
+			// List all registered payments and make sure the payment is listed.
+			stream, err := client.ListPayments(context.Background(), &payments.ListPaymentsRequest{})
+			Expect(err).NotTo(HaveOccurred())
+			ids := make([]string, 0)
+			for {
+				p, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).NotTo(HaveOccurred())
+				ids = append(ids, p.Id)
+			}
+			Expect(ids).To(ContainElement(created.Id))
+
+			// Update the payment's amount.
+			payment.Amount = 1200.41
+			res, err = client.UpdatePayment(context.Background(), &payments.UpdatePaymentRequest{Id: created.Id, Payment: payment})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Id).To(Equal(created.Id))
+			Expect(res.Amount).To(Equal(payment.Amount))
+
+			// Delete the payment and make sure it can no longer be found.
+			_, err = client.DeletePayment(context.Background(), &payments.DeletePaymentRequest{Id: created.Id})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.GetPayment(context.Background(), &payments.GetPaymentRequest{Id: created.Id})
+			Expect(status.Code(err)).To(Equal(codes.NotFound))
+			_, err = client.DeletePayment(context.Background(), &payments.DeletePaymentRequest{Id: created.Id})
+			Expect(status.Code(err)).To(Equal(codes.NotFound))
+		})
+	})
+})
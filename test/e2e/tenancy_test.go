@@ -0,0 +1,95 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2e
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/bmcstdio/dojo-payments/pkg/client"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/test/e2e/util"
+)
+
+var _ = Describe("Tenancy", func() {
+	var (
+		// otherClient is the client used to interact with the Payments API on behalf of another tenant.
+		otherClient *client.Client
+		// payment is a payment belonging to the tenant identified by the main bearer token.
+		payment models.Payment
+	)
+
+	BeforeEach(func() {
+		if otherBearerToken == "" {
+			Skip("--other-bearer-token has not been provided")
+		}
+		otherClient = client.New(baseUrl, client.WithBearerToken(otherBearerToken))
+
+		var (
+			err error
+		)
+		payment, err = apiClient.CreatePayment(context.Background(), models.Payment{
+			Amount:      314.15,
+			Currency:    "EUR",
+			Date:        util.MustParseRFC3339Time("2019-04-30T22:30:00Z"),
+			Description: "Order #1",
+			Beneficiary: models.Entity{
+				AccountNumber: "1234",
+				BankID:        "4321",
+				Name:          "John",
+			},
+			Debtor: models.Entity{
+				AccountNumber: "5678",
+				BankID:        "8765",
+				Name:          "Dave",
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("prevents other tenants from getting the payment", func() {
+		_, err := otherClient.GetPayment(context.Background(), payment.ID.Hex())
+		Expect(client.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("prevents other tenants from listing the payment", func() {
+		r, err := otherClient.ListPayments(context.Background()).All()
+		Expect(err).NotTo(HaveOccurred())
+		for _, p := range r {
+			Expect(p.ID).NotTo(Equal(payment.ID))
+		}
+	})
+
+	It("prevents other tenants from updating the payment", func() {
+		v := payment
+		v.Description = "Order #2"
+		_, err := otherClient.UpdatePayment(context.Background(), payment.ID.Hex(), v)
+		Expect(client.IsNotFound(err)).To(BeTrue())
+		// Make sure that the payment was left untouched.
+		r, err := apiClient.GetPayment(context.Background(), payment.ID.Hex())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Description).To(Equal(payment.Description))
+	})
+
+	It("prevents other tenants from deleting the payment", func() {
+		err := otherClient.DeletePayment(context.Background(), payment.ID.Hex())
+		Expect(client.IsNotFound(err)).To(BeTrue())
+		// Make sure that the payment still exists.
+		_, err = apiClient.GetPayment(context.Background(), payment.ID.Hex())
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,121 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package e2e
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/bmcstdio/dojo-payments/pkg/db"
+	"github.com/bmcstdio/dojo-payments/pkg/db/models"
+	"github.com/bmcstdio/dojo-payments/test/e2e/util"
+)
+
+var _ = Describe("Transactions", func() {
+	var (
+		// database is the database against which transactions are run.
+		database db.Database
+	)
+
+	// newPayment returns a new, valid payment with the specified description.
+	newPayment := func(description string) models.Payment {
+		return models.Payment{
+			Amount:      314.15,
+			Currency:    "EUR",
+			Date:        util.MustParseRFC3339Time("2019-04-30T22:30:00Z"),
+			Description: description,
+			Beneficiary: models.Entity{
+				AccountNumber: "1234",
+				BankID:        "4321",
+				Name:          "John",
+			},
+			Debtor: models.Entity{
+				AccountNumber: "5678",
+				BankID:        "8765",
+				Name:          "Dave",
+			},
+		}
+	}
+
+	// exists returns a value indicating whether the payment with the specified ID can be read outside of any transaction.
+	exists := func(id primitive.ObjectID) bool {
+		p, err := database.Payments().GetPayment(id.Hex())
+		Expect(err).NotTo(HaveOccurred())
+		return p.ID == id
+	}
+
+	BeforeEach(func() {
+		if mongodbReplicaSetURL == "" {
+			Skip("--mongodb-replica-set-url has not been provided")
+		}
+		var (
+			err error
+		)
+		database, err = db.NewMongoDDatabase(mongodbReplicaSetURL, mongodbDatabase)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		if database != nil {
+			Expect(database.Close()).To(Succeed())
+		}
+	})
+
+	It("perform operations as part of the transaction, only making them visible once it is committed", func() {
+		var (
+			p models.Payment
+		)
+		err := database.WithTransaction(context.Background(), func(tx db.Database) error {
+			var (
+				err error
+			)
+			p, err = tx.Payments().CreatePayment(newPayment("Order #1"))
+			if err != nil {
+				return err
+			}
+			// The payment can be read as part of the transaction, but not outside of it.
+			r, err := tx.Payments().GetPayment(p.ID.Hex())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.ID).To(Equal(p.ID))
+			Expect(exists(p.ID)).To(BeFalse())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists(p.ID)).To(BeTrue())
+	})
+
+	It("discard operations performed as part of the transaction when it is aborted", func() {
+		var (
+			p models.Payment
+		)
+		e := errors.New("rejected")
+		err := database.WithTransaction(context.Background(), func(tx db.Database) error {
+			var (
+				err error
+			)
+			p, err = tx.Payments().CreatePayment(newPayment("Order #2"))
+			if err != nil {
+				return err
+			}
+			return e
+		})
+		Expect(err).To(MatchError(e))
+		Expect(p.ID.IsZero()).To(BeFalse())
+		Expect(exists(p.ID)).To(BeFalse())
+	})
+})
@@ -0,0 +1,54 @@
+// Copyright 2019 Bruno Miguel Custodio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bufio"
+	"strings"
+)
+
+// ServerSentEvent represents an event received from an event stream.
+type ServerSentEvent struct {
+	// ID is the ID of the event.
+	ID string
+	// Type is the type of the event.
+	Type string
+	// Data is the payload of the event.
+	Data string
+}
+
+// ReadServerSentEvent reads the next event from the provided event stream, skipping comments.
+func ReadServerSentEvent(r *bufio.Reader) (ServerSentEvent, error) {
+	e := ServerSentEvent{}
+	for {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			return ServerSentEvent{}, err
+		}
+		l = strings.TrimSuffix(l, "\n")
+		switch {
+		case l == "":
+			if e != (ServerSentEvent{}) {
+				return e, nil
+			}
+		case strings.HasPrefix(l, "id: "):
+			e.ID = strings.TrimPrefix(l, "id: ")
+		case strings.HasPrefix(l, "event: "):
+			e.Type = strings.TrimPrefix(l, "event: ")
+		case strings.HasPrefix(l, "data: "):
+			e.Data = strings.TrimPrefix(l, "data: ")
+		}
+	}
+}